@@ -0,0 +1,9 @@
+// Command bottle-launch launches Flatpak applications with their data stored
+// in encrypted bottles. The application itself lives in internal/app.
+package main
+
+import "bottle-launch/internal/app"
+
+func main() {
+	app.Main()
+}
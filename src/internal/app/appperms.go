@@ -0,0 +1,169 @@
+// App permissions: what an app's manifest grants it, compared with what bottle-launch lets through.
+package app
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// appPermission is one permission an app's metadata asks for
+type appPermission struct {
+	Name    string // e.g. "network", "filesystem home", "talk org.freedesktop.Notifications"
+	Granted bool   // bottle-launch grants it too
+	Reason  string // why it is removed, e.g. "Network is off" (empty when granted)
+}
+
+// mockAppMetadata is what mock apps ask for
+const mockAppMetadata = `[Context]
+shared=network;ipc;
+sockets=x11;wayland;pulseaudio;
+devices=dri;
+filesystems=xdg-download;home:ro;
+
+[Session Bus Policy]
+org.freedesktop.Notifications=talk
+org.freedesktop.portal.Desktop=talk
+`
+
+// appStaticPermissions reads an app's metadata permissions with flatpak info
+func appStaticPermissions(app FlatpakApp) (*keyFile, error) {
+	var out []byte
+	if mockMode {
+		out = []byte(mockAppMetadata)
+	} else {
+		args := append([]string{"info", "--show-permissions"}, app.installationArgs()...)
+		var err error
+		out, err = command("flatpak", append(args, app.Ref())...).Output()
+		if err != nil {
+			return nil, &bottleError{op: "flatpak info", msg: "could not read the permissions of " + app.ID}
+		}
+	}
+	return &keyFile{lines: strings.Split(strings.TrimRight(string(out), "\n"), "\n")}, nil
+}
+
+// compareAppPermissions lists what an app's metadata asks for and whether a
+// bottle with perms grants it
+func compareAppPermissions(static *keyFile, perms *Permissions) []appPermission {
+	var result []appPermission
+	for _, key := range []string{"shared", "sockets", "devices", "features", "filesystems"} {
+		value, _ := static.Get("Context", key)
+		for _, entry := range splitKeyList(value) {
+			if strings.HasPrefix(entry, "!") {
+				continue
+			}
+			p := appPermission{Name: entry, Reason: "removed by --sandbox"}
+			switch key {
+			case "features":
+				p.Name = "feature " + entry
+			case "filesystems":
+				p.Name = "filesystem " + entry
+				p.Reason = "removed by --sandbox; only the bottle is shared"
+			}
+			for _, t := range overrideToggles {
+				if t.key == key && slices.Contains(t.names, entry) {
+					p.Granted = *permissionToggle(perms, t.pref)
+					p.Reason = permissionLabel(t.pref) + " is off"
+				}
+			}
+			if p.Granted {
+				p.Reason = ""
+			}
+			result = append(result, p)
+		}
+	}
+
+	// D-Bus names the app may talk to or own
+	current := ""
+	for _, line := range static.lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			current = strings.Trim(trimmed, "[]")
+			continue
+		}
+		name, policy, ok := strings.Cut(trimmed, "=")
+		if current != "Session Bus Policy" || !ok || policy == "none" {
+			continue
+		}
+		p := appPermission{Name: policy + " " + name, Reason: "removed by --sandbox"}
+		for _, t := range busToggles {
+			if slices.ContainsFunc(t.names, func(pattern string) bool { return busNameMatches(pattern, name) }) &&
+				(policy == t.policy || policy == "talk") {
+				p.Granted = *permissionToggle(perms, t.pref)
+				p.Reason = permissionLabel(t.pref) + " is off"
+			}
+		}
+		if p.Granted {
+			p.Reason = ""
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+// busNameMatches reports whether a D-Bus name matches a flatpak name pattern,
+// which may end in .* for a whole subtree
+func busNameMatches(pattern, name string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(name, prefix)
+	}
+	return name == pattern
+}
+
+// permissionLabel returns the label of a permission by its config key
+func permissionLabel(pref string) string {
+	for _, def := range permissionDefs {
+		if def.Config == pref {
+			return def.Label
+		}
+	}
+	return pref
+}
+
+// splitAppPermissions returns the names of the granted and removed permissions
+func splitAppPermissions(list []appPermission) (granted, removed []string) {
+	for _, p := range list {
+		if p.Granted {
+			granted = append(granted, p.Name)
+		} else {
+			removed = append(removed, p.Name)
+		}
+	}
+	return granted, removed
+}
+
+// cmdSandbox shows what an app's metadata asks for and which of it a bottle
+// lets through
+func cmdSandbox(bottle, appArg string) error {
+	bottle = resolveBottlePath(bottle)
+	if _, err := os.Stat(bottle); err != nil {
+		return errBottleNotFound
+	}
+	app := parseAppRef(appArg)
+	static, err := appStaticPermissions(app)
+	if err != nil {
+		return err
+	}
+	perms := loadPermissions(getConfigPath(bottle))
+	list := compareAppPermissions(static, perms)
+
+	fmt.Printf("%s in %s (bottle permissions: %s)\n\n", app.ID, bottleName(bottle), orNone(perms.Summary()))
+	if len(list) == 0 {
+		fmt.Println("The app's metadata asks for no permissions.")
+		return nil
+	}
+	width := 0
+	for _, p := range list {
+		width = max(width, len(p.Name))
+	}
+	for _, p := range list {
+		if p.Granted {
+			fmt.Printf("  + %-*s  granted\n", width, p.Name)
+		} else {
+			fmt.Printf("  - %-*s  %s\n", width, p.Name, p.Reason)
+		}
+	}
+	fmt.Println("\n+ the app gets it in the bottle, - it would get it from a plain flatpak run but not here")
+	return nil
+}
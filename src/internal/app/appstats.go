@@ -0,0 +1,121 @@
+// Running app statistics: CPU and memory of the app's process tree, and the bottle's free space.
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// clockTicks is the kernel's USER_HZ, the unit of CPU times in /proc (100 on
+// every Linux architecture bottle-launch runs on)
+const clockTicks = 100
+
+// appUsage is a snapshot of the resources used by a running app. Flatpak
+// starts the app through bwrap, so the whole process tree under the
+// `flatpak run` process is counted.
+type appUsage struct {
+	Procs    int    // processes in the tree
+	RSS      int64  // resident memory in bytes
+	CPUTicks uint64 // user+system CPU time, in clock ticks
+	At       time.Time
+}
+
+// procStat holds the fields of /proc/<pid>/stat needed to build the tree
+type procStat struct {
+	ppid     int
+	cpuTicks uint64
+	rssPages int64
+}
+
+// readProcStat parses /proc/<pid>/stat
+func readProcStat(pid int) (procStat, bool) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return procStat{}, false
+	}
+	// The command name (field 2) may contain spaces, so split after its ')'
+	s := string(data)
+	end := strings.LastIndexByte(s, ')')
+	if end < 0 {
+		return procStat{}, false
+	}
+	// Fields from 3 on: state ppid ... utime(14) stime(15) ... rss(24)
+	f := strings.Fields(s[end+1:])
+	if len(f) < 22 {
+		return procStat{}, false
+	}
+	var st procStat
+	st.ppid, _ = strconv.Atoi(f[1])
+	utime, _ := strconv.ParseUint(f[11], 10, 64)
+	stime, _ := strconv.ParseUint(f[12], 10, 64)
+	st.cpuTicks = utime + stime
+	st.rssPages, _ = strconv.ParseInt(f[21], 10, 64)
+	return st, true
+}
+
+// sampleAppUsage sums the resources of pid and all its descendants
+func sampleAppUsage(pid int) appUsage {
+	usage := appUsage{At: time.Now()}
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return usage
+	}
+
+	stats := map[int]procStat{}
+	children := map[int][]int{}
+	for _, e := range entries {
+		p, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		if st, ok := readProcStat(p); ok {
+			stats[p] = st
+			children[st.ppid] = append(children[st.ppid], p)
+		}
+	}
+
+	pageSize := int64(os.Getpagesize())
+	queue := []int{pid}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		st, ok := stats[p]
+		if !ok {
+			continue
+		}
+		usage.Procs++
+		usage.RSS += st.rssPages * pageSize
+		usage.CPUTicks += st.cpuTicks
+		queue = append(queue, children[p]...)
+	}
+	return usage
+}
+
+// cpuPercent returns the CPU used between two samples, in percent of one core
+func cpuPercent(prev, cur appUsage) float64 {
+	wall := cur.At.Sub(prev.At).Seconds()
+	if prev.At.IsZero() || wall <= 0 || cur.CPUTicks < prev.CPUTicks {
+		return 0
+	}
+	return float64(cur.CPUTicks-prev.CPUTicks) / clockTicks / wall * 100
+}
+
+// filesystemSpace returns the free and total bytes of the filesystem at path
+func filesystemSpace(path string) (free, total int64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), int64(st.Blocks) * int64(st.Bsize), nil
+}
+
+// spaceIsLow reports whether free is under LOW_SPACE_PERCENT of total
+// (0 turns the warning off)
+func spaceIsLow(free, total int64) bool {
+	percent := globalConfig.GetInt("LOW_SPACE_PERCENT", DefaultLowSpacePercent)
+	return percent > 0 && total > 0 && free*100 < total*int64(percent)
+}
@@ -0,0 +1,171 @@
+// Bottle archiving: compresses rarely-used bottles out of the way and restores them.
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// archiveSuffix is appended to the bottle file name for archived bottles
+const archiveSuffix = ".tar.zst"
+
+// archiveDir returns the directory holding archived bottles.
+// It is a subdirectory of the bottle directory, so archives are hidden from
+// the bottle list (which only looks at top-level .bottle files).
+func archiveDir() string {
+	return globalConfig.GetDefault("ARCHIVE_DIR", filepath.Join(bottleDir, "archive"))
+}
+
+// listArchivedBottles returns the archive files in the archive directory
+func listArchivedBottles() []string {
+	entries, err := os.ReadDir(archiveDir())
+	if err != nil {
+		return nil
+	}
+
+	var archives []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".bottle"+archiveSuffix) {
+			archives = append(archives, filepath.Join(archiveDir(), e.Name()))
+		}
+	}
+
+	sort.Strings(archives)
+	return archives
+}
+
+// resolveArchivePath maps an unarchive argument (bottle name or archive path)
+// to an archive file
+func resolveArchivePath(name string) string {
+	if strings.Contains(name, string(os.PathSeparator)) {
+		return name
+	}
+	name = strings.TrimSuffix(name, archiveSuffix)
+	if !strings.HasSuffix(name, ".bottle") {
+		name += ".bottle"
+	}
+	return filepath.Join(archiveDir(), name+archiveSuffix)
+}
+
+// archiveBottle compresses a locked bottle into the archive directory and
+// removes the original. GNU tar's sparse mode skips the file's holes, so
+// only allocated data is read and compressed. The bottle's config is kept,
+// so permissions and FIDO2 enrollment survive a round trip.
+func archiveBottle(bottle string) (string, error) {
+	if findLoopForFile(bottle) != "" || bottleInUse(bottle) {
+		return "", errBottleMounted
+	}
+	if _, err := os.Stat(bottle); err != nil {
+		return "", err
+	}
+	if err := requireImageBottle(bottle); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(archiveDir(), 0700); err != nil {
+		return "", err
+	}
+	archive := filepath.Join(archiveDir(), bottleName(bottle)+archiveSuffix)
+	if _, err := os.Stat(archive); err == nil {
+		return "", &bottleError{op: "archive", msg: archive + " already exists"}
+	}
+
+	// Write to a temp name so an interrupted archive never looks complete
+	tmp := archive + ".partial"
+	out, err := command("tar", "--create", "--sparse", "--zstd",
+		"--file", tmp, "--directory", filepath.Dir(bottle), bottleName(bottle)).CombinedOutput()
+	if err != nil {
+		os.Remove(tmp)
+		return "", &bottleError{op: "archive", msg: strings.TrimSpace(string(out))}
+	}
+
+	// Verify the archive reads back before deleting the only other copy
+	if out, err := command("tar", "--list", "--zstd", "--file", tmp).CombinedOutput(); err != nil {
+		os.Remove(tmp)
+		return "", &bottleError{op: "archive", msg: "verification failed: " + strings.TrimSpace(string(out))}
+	}
+
+	// Flush the archive and its name to disk before the bottle goes, so a
+	// crash can't leave neither
+	if err := syncPath(tmp); err != nil {
+		os.Remove(tmp)
+		return "", &bottleError{op: "archive", msg: "could not flush the archive: " + err.Error()}
+	}
+	if err := os.Rename(tmp, archive); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := syncPath(filepath.Dir(archive)); err != nil {
+		return archive, &bottleError{op: "archive", msg: "could not flush " + filepath.Dir(archive) + ": " + err.Error()}
+	}
+	if err := os.Remove(bottle); err != nil {
+		return archive, err
+	}
+
+	// Unarchive restores into the bottle directory; carry config and stats
+	// over to that path for bottles that lived elsewhere
+	moveBottleMetadata(bottle, filepath.Join(bottleDir, bottleName(bottle)))
+	return archive, nil
+}
+
+// syncPath flushes a file, or a directory's entries, to disk
+func syncPath(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// moveBottleMetadata renames a bottle's config and stats files (keyed by path
+// hash) to follow the bottle to a new path
+func moveBottleMetadata(from, to string) {
+	if getBottleHash(from) == getBottleHash(to) {
+		return
+	}
+	// The config's HMAC covers its name; sign it again if it was intact
+	intact := !loadPermissions(getConfigPath(from)).Tampered
+	if os.Rename(getConfigPath(from), getConfigPath(to)) == nil && intact {
+		_ = trustConfig(getConfigPath(to))
+	}
+	os.Rename(getStatsPath(from), getStatsPath(to))
+}
+
+// unarchiveBottle restores an archived bottle into the bottle directory
+// (sparse again) and removes the archive
+func unarchiveBottle(archive string) (string, error) {
+	name := strings.TrimSuffix(filepath.Base(archive), archiveSuffix)
+	bottle := filepath.Join(bottleDir, name)
+	if _, err := os.Stat(bottle); err == nil {
+		return "", errBottleExists
+	}
+	if _, err := os.Stat(archive); err != nil {
+		return "", err
+	}
+
+	out, err := command("tar", "--extract", "--zstd",
+		"--file", archive, "--directory", bottleDir, name).CombinedOutput()
+	if err != nil {
+		os.Remove(bottle)
+		return "", &bottleError{op: "unarchive", msg: strings.TrimSpace(string(out))}
+	}
+	// Same as archiving: the bottle must be on disk before the archive goes
+	err = syncPath(bottle)
+	if err == nil {
+		err = syncPath(bottleDir)
+	}
+	if err != nil {
+		return bottle, &bottleError{op: "unarchive", msg: "could not flush the bottle, the archive is kept: " + err.Error()}
+	}
+
+	if err := os.Remove(archive); err != nil {
+		return bottle, err
+	}
+	return bottle, nil
+}
@@ -0,0 +1,102 @@
+// Audit log: a record of what happened in each bottle, kept for review after the fact.
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// auditEntry is one line of the audit log
+type auditEntry struct {
+	Time   time.Time
+	Bottle string // absolute bottle path
+	Kind   string
+	Detail string
+}
+
+// auditLogPath returns the audit log's path
+func auditLogPath() string {
+	return filepath.Join(configDir, "audit.log")
+}
+
+// appendAudit adds events about a bottle to the audit log
+func appendAudit(bottle string, entries ...auditEntry) error {
+	bottle = absBottlePath(bottle)
+	if err := os.MkdirAll(configDir, 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(auditLogPath(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	var sb strings.Builder
+	now := time.Now().Format(time.RFC3339)
+	for _, e := range entries {
+		// Tabs and newlines would split the entry
+		detail := strings.NewReplacer("\t", " ", "\n", " ").Replace(e.Detail)
+		fmt.Fprintf(&sb, "%s\t%s\t%s\t%s\n", now, bottle, e.Kind, detail)
+	}
+	if _, err := f.WriteString(sb.String()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readAudit returns the audit log's entries for a bottle, or for all bottles
+// if bottle is empty, oldest first
+func readAudit(bottle string) ([]auditEntry, error) {
+	f, err := os.Open(auditLogPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if bottle != "" {
+		bottle = absBottlePath(bottle)
+	}
+	var entries []auditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "\t", 4)
+		if len(fields) != 4 || (bottle != "" && fields[1] != bottle) {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, fields[0])
+		if err != nil {
+			continue
+		}
+		entries = append(entries, auditEntry{Time: t, Bottle: fields[1], Kind: fields[2], Detail: fields[3]})
+	}
+	return entries, scanner.Err()
+}
+
+// cmdAudit prints the audit log, for one bottle or all of them
+func cmdAudit(bottle string) error {
+	entries, err := readAudit(bottle)
+	if err != nil {
+		return &bottleError{op: "audit", msg: err.Error()}
+	}
+	if len(entries) == 0 {
+		fmt.Println("Nothing recorded yet - see `bottle-launch forensics` and `bottle-launch untrusted`")
+		return nil
+	}
+	for _, e := range entries {
+		switch e.Kind {
+		case "session":
+			fmt.Println(e.Time.Local().Format("2006-01-02 15:04") + " " + bottleName(e.Bottle) + ": " + e.Detail)
+		case "scan":
+			fmt.Println(e.Time.Local().Format("2006-01-02 15:04") + " " + bottleName(e.Bottle) + ": malware scan: " + e.Detail)
+		default:
+			fmt.Printf("  %-8s %s\n", e.Kind, e.Detail)
+		}
+	}
+	return nil
+}
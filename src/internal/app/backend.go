@@ -0,0 +1,162 @@
+// Storage backends: how a bottle is stored, unlocked, mounted, and locked again.
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"bottle-launch/internal/sysfs"
+)
+
+// Backend names, recorded as BACKEND in a bottle's config
+const (
+	BackendLUKS      = "luks"      // LUKS2 image file or block device, via udisks2
+	BackendGocryptfs = "gocryptfs" // gocryptfs directory via FUSE, no root or polkit needed
+	BackendFscrypt   = "fscrypt"   // kernel-encrypted directory (ext4/f2fs), no root or mounts
+	BackendSquashfs  = "squashfs"  // read-only squashfs image, plain or inside LUKS
+)
+
+// Backend mounts and locks bottles of one storage type
+type Backend interface {
+	// Create makes a new bottle; an empty password prompts on the terminal.
+	// Cancelling ctx stops it and removes what it made.
+	Create(ctx context.Context, bottle, size, password string) error
+	// Mount unlocks and mounts a bottle, reusing whatever is already open.
+	// Cancelling ctx stops it and undoes the steps it took.
+	Mount(ctx context.Context, bottle, password string) (*MountInfo, error)
+	// Unmount unmounts and locks a bottle
+	Unmount(info *MountInfo) error
+	// Current returns what is open for a bottle right now (nil if nothing)
+	Current(bottle string) *MountInfo
+}
+
+var backends = map[string]Backend{
+	BackendLUKS:      luksBackend{},
+	BackendGocryptfs: gocryptfsBackend{},
+	BackendFscrypt:   fscryptBackend{},
+	BackendSquashfs:  squashfsBackend{},
+}
+
+var errNotImageBottle = &bottleError{op: "bottle", msg: "only supported for LUKS image bottles"}
+
+// getBackend looks up a backend by name ("" = LUKS)
+func getBackend(name string) (Backend, error) {
+	if mockMode {
+		return mockBackend{}, nil
+	}
+	if name == "" {
+		name = BackendLUKS
+	}
+	b, ok := backends[name]
+	if !ok {
+		return nil, &bottleError{op: "backend", msg: "unknown backend " + name + " (use luks, gocryptfs, fscrypt, or squashfs)"}
+	}
+	return b, nil
+}
+
+// bottleBackend returns the name of a bottle's backend: as recorded in its
+// config, or recognised on disk if the config is missing (directory bottles
+// are gocryptfs if they hold its config file, fscrypt otherwise; squashfs
+// images by their header)
+func bottleBackend(bottle string) string {
+	if mockMode {
+		return BackendMock
+	}
+	// Unchecked: a changed config is refused where it would be used
+	if name := readPermissions(getConfigPath(bottle)).Backend; name != "" {
+		return name
+	}
+	if fi, err := os.Stat(bottle); err == nil && fi.IsDir() {
+		if _, err := os.Stat(filepath.Join(bottle, "gocryptfs.conf")); err == nil {
+			return BackendGocryptfs
+		}
+		return BackendFscrypt
+	}
+	if squashfsImageKind(bottle) != "" {
+		return BackendSquashfs
+	}
+	return BackendLUKS
+}
+
+// backendFor returns the backend of a bottle
+func backendFor(bottle string) Backend {
+	if b, err := getBackend(bottleBackend(bottle)); err == nil {
+		return b
+	}
+	return luksBackend{}
+}
+
+// mountBottle unlocks and mounts a bottle with its backend
+func mountBottle(ctx context.Context, bottle, password string) (*MountInfo, error) {
+	return backendFor(bottle).Mount(ctx, bottle, password)
+}
+
+// unmountBottle unmounts and locks a bottle with the backend that mounted it
+func unmountBottle(info *MountInfo) error {
+	if info == nil {
+		return nil
+	}
+	b, err := getBackend(info.Backend)
+	if err != nil {
+		return err
+	}
+	if needsScan(info) {
+		// Locking goes ahead either way; a finding is reported, not acted on
+		if r := scanBeforeLock(info); r.Err != nil || len(r.Found) > 0 {
+			msg := bottleName(info.BottlePath) + ": " + r.Summary()
+			notice("Warning: " + msg)
+			sendNotification("Malware scan", msg)
+		}
+	}
+	return b.Unmount(info)
+}
+
+// currentMount returns what is open for a bottle (nil if it is fully locked)
+func currentMount(bottle string) *MountInfo {
+	return backendFor(bottle).Current(bottle)
+}
+
+// requireImageBottle refuses operations that work on the bottle as a single
+// LUKS image file (archiving, syncing, checksums)
+func requireImageBottle(bottle string) error {
+	if blockDevicePath(bottle) != "" {
+		return errBlockDevice
+	}
+	if bottleBackend(bottle) != BackendLUKS {
+		return errNotImageBottle
+	}
+	return nil
+}
+
+// luksBackend is the default backend: LUKS2 images attached as loop devices
+// (or block devices) and unlocked/mounted through udisks2
+type luksBackend struct{}
+
+func (luksBackend) Create(ctx context.Context, bottle, size, password string) error {
+	if strings.HasPrefix(size, "/dev/") {
+		return createBlockDeviceBottle(bottle, size)
+	}
+	return createBottleBase(ctx, bottle, size, password, "", false)
+}
+
+func (luksBackend) Mount(ctx context.Context, bottle, password string) (*MountInfo, error) {
+	return mountLUKS(ctx, bottle, passwordKey(password))
+}
+
+func (luksBackend) Unmount(info *MountInfo) error {
+	return unmountLUKS(info)
+}
+
+func (luksBackend) Current(bottle string) *MountInfo {
+	loopDev := findLoopForFile(bottle)
+	if loopDev == "" {
+		return nil
+	}
+	info := &MountInfo{BottlePath: bottle, LoopDevice: loopDev, Backend: BackendLUKS}
+	if info.CleartextDevice = sysfs.CryptHolder(loopDev); info.CleartextDevice != "" {
+		info.MountPoint = sysfs.MountPoint(info.CleartextDevice)
+	}
+	return info
+}
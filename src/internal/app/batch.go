@@ -0,0 +1,235 @@
+// Batch commands: unlocking and locking a configured set of bottles in one go.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// batchResult is the outcome for one bottle of a batch command
+type batchResult struct {
+	bottle string
+	status string
+	err    error
+}
+
+// Unlock order, so prompts come in groups: nothing to ask first, then
+// key drives and password manager lookups, then key touches, then typed
+// passwords
+const (
+	unlockOpen = iota
+	unlockKeyDrive
+	unlockManager
+	unlockYubiKey
+	unlockPassword
+)
+
+// bottleSet returns the bottle paths of a configured set ("" for the default)
+func bottleSet(name string) ([]string, error) {
+	key := "BOTTLE_SET"
+	if name != "" {
+		key += "_" + strings.ToUpper(name)
+	}
+	names := globalConfig.GetList(key)
+	if len(names) == 0 {
+		return nil, &bottleError{op: "set", msg: "no bottles configured - add " + key + "=<bottle>,<bottle> to " + globalConfigPath()}
+	}
+	bottles := make([]string, len(names))
+	for i, n := range names {
+		bottles[i] = resolveBottlePath(n)
+	}
+	return bottles, nil
+}
+
+// unlockKind says how a bottle will be unlocked, for ordering the prompts
+func unlockKind(bottle string, perms *Permissions) int {
+	if info := currentMount(bottle); (info != nil && info.MountPoint != "") || opensWithoutSecret(bottle) {
+		return unlockOpen
+	}
+	if perms.KeyDriveUUID != "" {
+		return unlockKeyDrive
+	}
+	if isFIDO2, _ := IsFIDO2Bottle(perms); isFIDO2 {
+		return unlockYubiKey
+	}
+	if perms.SecretRef != "" {
+		return unlockManager
+	}
+	return unlockPassword
+}
+
+// cmdUnlockAll unlocks and mounts every bottle in a set and leaves them open
+func cmdUnlockAll(set string) error {
+	bottles, err := bottleSet(set)
+	if err != nil {
+		return err
+	}
+	kinds := map[string]int{}
+	for _, bottle := range bottles {
+		kinds[bottle] = unlockKind(bottle, loadPermissions(getConfigPath(bottle)))
+	}
+	sort.SliceStable(bottles, func(i, j int) bool { return kinds[bottles[i]] < kinds[bottles[j]] })
+
+	results := make([]batchResult, len(bottles))
+	for i, bottle := range bottles {
+		if kinds[bottle] != unlockOpen {
+			notice(fmt.Sprintf("[%d/%d] Unlocking %s", i+1, len(bottles), bottleName(bottle)))
+		}
+		results[i] = unlockKeptOpen(bottle, kinds[bottle])
+	}
+	return printBatchSummary(results)
+}
+
+// unlockKeptOpen mounts one bottle for unlock-all and marks it kept open
+func unlockKeptOpen(bottle string, kind int) batchResult {
+	result := batchResult{bottle: bottle}
+	if _, err := os.Stat(bottle); err != nil {
+		result.err = errBottleNotFound
+		return result
+	}
+
+	lock, err := acquireBottleLock(bottle, "")
+	var inUse *bottleInUseError
+	if errors.As(err, &inUse) {
+		// A session has it mounted; keep it open when that session ends
+		markKeptOpen(bottle)
+		result.status = "already mounted, in use by " + inUse.owner.String()
+		return result
+	}
+	if err != nil {
+		result.err = err
+		return result
+	}
+	defer lock.Release()
+
+	configPath := getConfigPath(bottle)
+	perms := loadPermissions(configPath)
+	if perms.Tampered {
+		result.err = errConfigTampered(bottle)
+		return result
+	}
+	if warning := checkBottleChanged(bottle, perms); warning != "" {
+		notice("Warning: " + bottleName(bottle) + ": " + warning)
+	}
+
+	var info *MountInfo
+	method := UnlockPolkit
+	switch kind {
+	case unlockKeyDrive:
+		method = UnlockKeyDrive
+		info, err = mountWithKeyDrive(bottle, perms)
+	case unlockYubiKey:
+		method = UnlockYubiKey
+		info, err = mountWithYubiKey(bottle, perms)
+	case unlockManager:
+		password, lookupErr := cliLookupSecret(perms.SecretRef)
+		if lookupErr == nil {
+			method = UnlockManager
+			info, err = mountBottle(context.Background(), bottle, password)
+		}
+		if lookupErr != nil || (err == errWrongPassword && password != "") {
+			notice("Warning: the password manager didn't unlock " + bottleName(bottle) + "; asking for the password")
+			method = UnlockPolkit
+			info, err = mountBottle(context.Background(), bottle, "")
+		}
+	default:
+		if needGUIPrompts() && !opensWithoutSecret(bottle) {
+			method = UnlockDialog
+			info, err = mountWithDialog(bottle)
+		}
+		if method != UnlockDialog || err == errNoGUIPrompt {
+			method = UnlockPolkit
+			info, err = mountBottle(context.Background(), bottle, "")
+		}
+	}
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	markKeptOpen(bottle)
+	if info.Unlocked {
+		recordUnlock(configPath, perms, method)
+		result.status = "mounted at " + info.MountPoint
+	} else {
+		result.status = "already mounted at " + info.MountPoint
+	}
+	return result
+}
+
+// mountWithYubiKey unlocks a FIDO2 bottle with the first connected key that
+// works, trying the likeliest first (each key tried needs a touch)
+func mountWithYubiKey(bottle string, perms *Permissions) (*MountInfo, error) {
+	devices, err := EnumerateFIDO2Devices()
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return nil, errNoFIDO2Device
+	}
+	devices = orderFIDO2Devices(devices, perms)
+	closeNotice := showTouchNotice("Touch your YubiKey to unlock " + bottleName(bottle) + "...")
+	defer closeNotice()
+	var failures []error
+	rpID, _ := bottleFIDO2Party(perms)
+	for _, dev := range devices {
+		if len(devices) > 1 && !needGUIPrompts() {
+			notice("  trying " + dev.Description + " (" + dev.Path + ")")
+		}
+		secret, err := GetFIDO2Secret(context.Background(), dev.Path, rpID, perms.FIDO2BottleID, perms.FIDO2CredentialID, perms.FIDO2Salt)
+		if err != nil {
+			failures = append(failures, fmt.Errorf("%s: %w", dev.Path, err))
+			continue
+		}
+		info, err := mountBottleFIDO2(context.Background(), bottle, secret)
+		if err != errWrongYubiKey {
+			return info, err
+		}
+		failures = append(failures, fmt.Errorf("%s: %w", dev.Path, err))
+	}
+	return nil, fido2KeysFailed(failures)
+}
+
+// cmdLockAll closes every bottle in a set, like lock
+func cmdLockAll(set string, force bool) error {
+	bottles, err := bottleSet(set)
+	if err != nil {
+		return err
+	}
+	results := make([]batchResult, len(bottles))
+	for i, bottle := range bottles {
+		results[i] = batchResult{bottle: bottle, status: "locked"}
+		if _, err := os.Stat(bottle); err != nil {
+			results[i].err = errBottleNotFound
+			continue
+		}
+		results[i].err = lockSessions(bottle, force)
+	}
+	return printBatchSummary(results)
+}
+
+// printBatchSummary prints one line per bottle and returns an error if any failed
+func printBatchSummary(results []batchResult) error {
+	width := 0
+	for _, r := range results {
+		width = max(width, len(bottleName(r.bottle)))
+	}
+	failed := 0
+	fmt.Println()
+	for _, r := range results {
+		status := r.status
+		if r.err != nil {
+			failed++
+			status = "FAILED: " + r.err.Error()
+		}
+		fmt.Printf("  %-*s  %s\n", width, bottleName(r.bottle), status)
+	}
+	if failed > 0 {
+		return &bottleError{op: "batch", msg: fmt.Sprintf("%d of %d bottles failed", failed, len(results))}
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+// I/O benchmark: throughput and latency inside a bottle, to compare backends and settings.
+package app
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Block sizes and counts of the benchmark's tests
+const (
+	benchSeqBlock   = 1 << 20 // sequential reads and writes
+	benchSmallBlock = 4 << 10 // random reads and synced writes
+	benchSmallOps   = 200
+)
+
+// DefaultBenchSize is the size of the benchmark's test file
+const DefaultBenchSize = "256M"
+
+// benchResult holds one run of the benchmark in one directory
+type benchResult struct {
+	SeqWrite, SeqRead   float64         // bytes per second
+	SyncWrite, RandRead []time.Duration // per-operation latencies, sorted
+}
+
+// runBench measures I/O in dir with a test file of size bytes, which it
+// removes again. Reads evict the file from the page cache first, so they hit
+// the bottle's storage rather than memory.
+func runBench(dir string, size int64) (benchResult, error) {
+	var res benchResult
+	path := filepath.Join(dir, fmt.Sprintf(".bottle-launch-bench-%d", os.Getpid()))
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return res, err
+	}
+	defer os.Remove(path)
+	defer f.Close()
+
+	buf := make([]byte, benchSeqBlock)
+	for i := range buf {
+		buf[i] = byte(rand.IntN(256))
+	}
+
+	// Sequential write, including the flush to storage
+	start := time.Now()
+	for written := int64(0); written < size; written += benchSeqBlock {
+		if _, err := f.Write(buf); err != nil {
+			return res, err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return res, err
+	}
+	res.SeqWrite = float64(size) / time.Since(start).Seconds()
+
+	// Sequential read
+	_ = unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_DONTNEED)
+	if _, err := f.Seek(0, 0); err != nil {
+		return res, err
+	}
+	start = time.Now()
+	for read := int64(0); read < size; read += benchSeqBlock {
+		if _, err := f.Read(buf); err != nil {
+			return res, err
+		}
+	}
+	res.SeqRead = float64(size) / time.Since(start).Seconds()
+
+	// Small writes each synced to storage, like databases and mail stores do
+	blocks := size / benchSmallBlock
+	small := buf[:benchSmallBlock]
+	for range benchSmallOps {
+		off := rand.Int64N(blocks) * benchSmallBlock
+		start := time.Now()
+		if _, err := f.WriteAt(small, off); err != nil {
+			return res, err
+		}
+		if err := unix.Fdatasync(int(f.Fd())); err != nil {
+			return res, err
+		}
+		res.SyncWrite = append(res.SyncWrite, time.Since(start))
+	}
+
+	// Small random reads
+	_ = unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_DONTNEED)
+	for range benchSmallOps {
+		off := rand.Int64N(blocks) * benchSmallBlock
+		start := time.Now()
+		if _, err := f.ReadAt(small, off); err != nil {
+			return res, err
+		}
+		res.RandRead = append(res.RandRead, time.Since(start))
+	}
+
+	slices.Sort(res.SyncWrite)
+	slices.Sort(res.RandRead)
+	return res, nil
+}
+
+// percentile returns the p-th percentile of sorted latencies
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[min(len(sorted)*p/100, len(sorted)-1)]
+}
+
+// formatRate formats a throughput in bytes per second
+func formatRate(bytesPerSec float64) string {
+	return formatSize(int64(bytesPerSec)) + "/s"
+}
+
+// formatLatency formats a latency with a precision that fits its size
+func formatLatency(d time.Duration) string {
+	if d < time.Millisecond {
+		return fmt.Sprintf("%.0f µs", float64(d)/float64(time.Microsecond))
+	}
+	return fmt.Sprintf("%.1f ms", float64(d)/float64(time.Millisecond))
+}
+
+// filesystemName returns the type of the filesystem at path, e.g. "ext4"
+func filesystemName(path string) string {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return "unknown"
+	}
+	switch st.Type {
+	case unix.EXT4_SUPER_MAGIC:
+		return "ext4"
+	case unix.BTRFS_SUPER_MAGIC:
+		return "btrfs"
+	case unix.XFS_SUPER_MAGIC:
+		return "xfs"
+	case unix.F2FS_SUPER_MAGIC:
+		return "f2fs"
+	case unix.TMPFS_MAGIC:
+		return "tmpfs"
+	case unix.FUSE_SUPER_MAGIC:
+		return "fuse"
+	}
+	return fmt.Sprintf("0x%x", st.Type)
+}
+
+// luksCipher returns a LUKS image's cipher and key size from its header,
+// e.g. "aes-xts-plain64, 512 bits" ("" if it can't be read)
+func luksCipher(bottle string) string {
+	out, err := command("cryptsetup", "luksDump", bottle).Output()
+	if err != nil {
+		return ""
+	}
+	var cipher, keyBits string
+	for _, line := range strings.Split(string(out), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "cipher":
+			if cipher == "" {
+				cipher = value
+			}
+		case "Cipher key":
+			if keyBits == "" {
+				keyBits = value
+			}
+		}
+	}
+	if keyBits != "" {
+		cipher += ", " + keyBits
+	}
+	return cipher
+}
+
+// cmdBench mounts a bottle and benchmarks I/O inside it; with compare it
+// runs the same test in the bottle's directory on the host for reference
+func cmdBench(bottle, size string, compare bool) error {
+	bottle = resolveBottlePath(bottle)
+	if _, err := os.Stat(bottle); err != nil {
+		return errBottleNotFound
+	}
+	bytes, err := parseSize(size)
+	if err != nil {
+		return err
+	}
+	bytes = max(bytes/benchSeqBlock*benchSeqBlock, benchSeqBlock)
+
+	var caveats []string
+	lock, err := acquireBottleLock(bottle, "bench")
+	var inUse *bottleInUseError
+	if errors.As(err, &inUse) {
+		lock, err = joinBottleLock(bottle)
+		caveats = append(caveats, "an app is using the bottle, so its I/O skews the results")
+	}
+	if err != nil {
+		return err
+	}
+	perms := loadPermissions(getConfigPath(bottle))
+	mountInfo, _, err := mountForRun(bottle, perms)
+	if err != nil {
+		lock.Release()
+		return err
+	}
+	lock.Share()
+	defer func() {
+		if err := releaseBottle(mountInfo, lock); err != nil {
+			notice("Warning: " + err.Error())
+		}
+	}()
+
+	if free, _, err := filesystemSpace(mountInfo.MountPoint); err == nil && free < bytes+bytes/10 {
+		return &bottleError{op: "bench", msg: "not enough free space in " + bottleName(bottle) + " for a " +
+			formatSize(bytes) + " test file (use --size=)"}
+	}
+
+	backend := bottleBackend(bottle)
+	setup := backend + ", " + filesystemName(mountInfo.MountPoint)
+	if backend == BackendLUKS && blockDevicePath(bottle) == "" {
+		if cipher := luksCipher(bottle); cipher != "" {
+			setup += ", " + cipher
+		}
+	}
+	fmt.Printf("Benchmarking %s (%s) with a %s test file...\n", bottleName(bottle), setup, formatSize(bytes))
+	inBottle, err := runBench(mountInfo.MountPoint, bytes)
+	if err != nil {
+		return &bottleError{op: "bench", msg: err.Error()}
+	}
+
+	results := []benchResult{inBottle}
+	header := fmt.Sprintf("%-22s %-22s", "", "bottle")
+	if compare {
+		hostDir := filepath.Dir(bottle)
+		fmt.Printf("Running the same test on the host (%s, %s)...\n", hostDir, filesystemName(hostDir))
+		host, err := runBench(hostDir, bytes)
+		if err != nil {
+			return &bottleError{op: "bench", msg: "host: " + err.Error()}
+		}
+		results = append(results, host)
+		header += " host"
+	}
+
+	row := func(label string, cell func(benchResult) string) {
+		line := fmt.Sprintf("%-22s", label)
+		for _, r := range results {
+			line += fmt.Sprintf(" %-22s", cell(r))
+		}
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+	fmt.Println()
+	fmt.Println(strings.TrimRight(header, " "))
+	row("Sequential write", func(r benchResult) string { return formatRate(r.SeqWrite) })
+	row("Sequential read", func(r benchResult) string { return formatRate(r.SeqRead) })
+	row("4K synced write", func(r benchResult) string {
+		return formatLatency(percentile(r.SyncWrite, 50)) + " (p99 " + formatLatency(percentile(r.SyncWrite, 99)) + ")"
+	})
+	row("4K random read", func(r benchResult) string {
+		return formatLatency(percentile(r.RandRead, 50)) + " (p99 " + formatLatency(percentile(r.RandRead, 99)) + ")"
+	})
+
+	caveats = append(caveats,
+		"a single run with one file: repeat it, and compare bottles on the same disk",
+		"reads may still be served from caches below the bottle (the host's page cache for image bottles, the disk's own cache)",
+		"the SSD's state, other programs' I/O, and how full the bottle is all change the numbers")
+	fmt.Println()
+	fmt.Println("Caveats:")
+	for _, c := range caveats {
+		fmt.Println("  - " + c)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+// Block device bottles: whole partitions, USB sticks, or LVM volumes used as bottles.
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"bottle-launch/internal/sysfs"
+)
+
+// errBlockDevice refuses what needs a bottle file; a block device bottle is
+// a <name>.bottle link to /dev/disk/by-uuid/<LUKS UUID>
+var errBlockDevice = &bottleError{op: "bottle", msg: "not supported for block device bottles"}
+
+// blockDevicePath returns the device node behind a block device bottle
+// (following symlinks), or "" if the bottle is a regular file
+func blockDevicePath(bottle string) string {
+	dev, err := filepath.EvalSymlinks(bottle)
+	if err != nil {
+		return ""
+	}
+	fi, err := os.Stat(dev)
+	if err != nil || fi.Mode()&os.ModeDevice == 0 || fi.Mode()&os.ModeCharDevice != 0 {
+		return ""
+	}
+	return dev
+}
+
+// findLoopForFile finds the loop device associated with a bottle. For block
+// device bottles it returns the device itself while it is unlocked.
+func findLoopForFile(bottle string) string {
+	if dev := blockDevicePath(bottle); dev != "" {
+		if sysfs.CryptHolder(dev) != "" {
+			return dev
+		}
+		return ""
+	}
+	return sysfs.LoopForFile(bottle)
+}
+
+// isLoopDevice reports whether a device is a loop device (which must be
+// deleted on lock) rather than a bottle's own block device
+func isLoopDevice(dev string) bool {
+	return strings.HasPrefix(dev, "/dev/loop")
+}
+
+// luksUUID returns the LUKS UUID of a device as udev reports it, or ""
+func luksUUID(dev string) string {
+	out, err := command("lsblk", "-ndo", "UUID", dev).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// blockDeviceSize returns the size of a block device in bytes
+func blockDeviceSize(dev string) (int64, error) {
+	out, err := command("lsblk", "-bndo", "SIZE", dev).Output()
+	if err != nil {
+		return 0, &bottleError{op: "lsblk", msg: err.Error()}
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+}
+
+// deviceInUse reports whether a device or any of its partitions is mounted
+func deviceInUse(dev string) bool {
+	out, err := command("lsblk", "-nlo", "MOUNTPOINT", dev).Output()
+	if err != nil {
+		return true
+	}
+	return strings.TrimSpace(string(out)) != ""
+}
+
+// createBlockDeviceBottle LUKS-formats a block device and links it into the
+// bottle directory as name. cryptsetup asks for confirmation before erasing
+// the device, and for the new password.
+func createBlockDeviceBottle(name, device string) error {
+	if name == "" {
+		return errBottlePathRequired
+	}
+	if !strings.HasSuffix(name, ".bottle") {
+		name += ".bottle"
+	}
+	bottle := filepath.Join(bottleDir, filepath.Base(name))
+	if _, err := os.Lstat(bottle); err == nil {
+		return errBottleExists
+	}
+
+	dev := blockDevicePath(device)
+	if dev == "" {
+		return &bottleError{op: "device", msg: device + " is not a block device"}
+	}
+	if deviceInUse(dev) {
+		return &bottleError{op: "device", msg: dev + " (or one of its partitions) is mounted"}
+	}
+	size, err := blockDeviceSize(dev)
+	if err != nil {
+		return err
+	}
+	if size < minBottleSize() {
+		return &bottleError{op: "size", msg: "must be at least " + formatSize(minBottleSize())}
+	}
+
+	// cryptsetup prompts on the terminal, so leave it attached
+	format := cryptsetupCmd(luksFormatArgs("--type", "luks2", dev)...)
+	format.Stdin, format.Stdout, format.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := format.Run(); err != nil {
+		return &bottleError{op: "LUKS format", msg: err.Error()}
+	}
+
+	// The by-uuid link survives the device being renamed (e.g. sdb -> sdc)
+	out, err := cryptsetupCmd("luksUUID", dev).Output()
+	uuid := strings.TrimSpace(string(out))
+	if err != nil || uuid == "" {
+		return &bottleError{op: "LUKS UUID", msg: "could not read the new LUKS UUID of " + dev}
+	}
+	link := filepath.Join("/dev/disk/by-uuid", uuid)
+
+	mapperName := getMapperName(dev)
+	open := cryptsetupCmd("open", dev, mapperName)
+	open.Stdin, open.Stdout, open.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := open.Run(); err != nil {
+		return &bottleError{op: "LUKS open", msg: err.Error()}
+	}
+	if out, err := privCmd("mkfs.ext4", "-q", "-E", ext4RootOwner(), "-L", getFSLabel(bottle), "/dev/mapper/"+mapperName).CombinedOutput(); err != nil {
+		cryptsetupCmd("close", mapperName).Run()
+		return &bottleError{op: "mkfs", msg: string(out)}
+	}
+	cryptsetupCmd("close", mapperName).Run()
+
+	os.MkdirAll(bottleDir, 0700)
+	return os.Symlink(link, bottle)
+}
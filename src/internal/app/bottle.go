@@ -0,0 +1,811 @@
+// Bottle management: listing, creation, deletion, and path handling for encrypted containers.
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/sys/unix"
+)
+
+// DefaultMinBottleSize is the smallest bottle that can hold the LUKS2 header
+// and a usable ext4 filesystem. Override with MIN_BOTTLE_SIZE in the global config.
+const DefaultMinBottleSize = "64M"
+
+var (
+	bottleDir string
+	configDir string
+)
+
+func init() {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		// Fall back to /tmp if home directory is unavailable
+		home = "/tmp"
+	}
+
+	// BOTTLE_DIR environment variable or default
+	bottleDir = os.Getenv("BOTTLE_DIR")
+	if bottleDir == "" {
+		bottleDir = filepath.Join(home, ".local", "share", "bottles")
+	}
+
+	// Config dir follows XDG
+	xdgConfig := os.Getenv("XDG_CONFIG_HOME")
+	if xdgConfig == "" {
+		xdgConfig = filepath.Join(home, ".config")
+	}
+	configDir = filepath.Join(xdgConfig, "bottle-launch")
+
+	// Global settings live alongside the per-bottle configs
+	globalConfig = loadGlobalConfig(globalConfigPath())
+}
+
+// globalConfigPath returns the path of the user-wide config file
+func globalConfigPath() string {
+	return filepath.Join(configDir, "config")
+}
+
+// listBottles returns all bottles (.bottle files, links, and directories)
+// in the bottle directory
+func listBottles() []string {
+	os.MkdirAll(bottleDir, 0700)
+
+	entries, err := os.ReadDir(bottleDir)
+	if err != nil {
+		return nil
+	}
+
+	var bottles []string
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".bottle") {
+			bottles = append(bottles, filepath.Join(bottleDir, e.Name()))
+		}
+	}
+
+	sort.Strings(bottles)
+	return bottles
+}
+
+// resolveBottlePath maps a CLI bottle argument to a path. Arguments with a
+// directory component are used as-is; bare names refer to the bottle directory
+// unless a file of that name exists in the current directory.
+func resolveBottlePath(bottle string) string {
+	if strings.Contains(bottle, string(os.PathSeparator)) {
+		return bottle
+	}
+	if _, err := os.Stat(bottle); err == nil {
+		return bottle
+	}
+	if !strings.HasSuffix(bottle, ".bottle") {
+		bottle += ".bottle"
+	}
+	return filepath.Join(bottleDir, bottle)
+}
+
+// bottleName returns just the filename of a bottle path
+func bottleName(path string) string {
+	return filepath.Base(path)
+}
+
+// getBottleHash returns a 12-char hash of the bottle's real path.
+// Block device bottles are keyed by LUKS UUID instead, so their config
+// follows the device whichever path (link, /dev/sdX) names it.
+func getBottleHash(bottle string) string {
+	realPath, err := filepath.Abs(bottle)
+	if err != nil {
+		realPath = bottle
+	}
+	if dev := blockDevicePath(bottle); dev != "" {
+		if uuid := luksUUID(dev); uuid != "" {
+			realPath = "luks:" + uuid
+		}
+	}
+
+	hash := sha256.Sum256([]byte(realPath))
+	return hex.EncodeToString(hash[:])[:12]
+}
+
+// getMapperName returns the dm-crypt mapper name for a bottle
+func getMapperName(bottle string) string {
+	return "bottle-" + getBottleHash(bottle)
+}
+
+// getConfigPath returns the config file path for a bottle
+func getConfigPath(bottle string) string {
+	return filepath.Join(configDir, getBottleHash(bottle)+".conf")
+}
+
+// getFSLabel returns a filesystem label derived from the bottle name.
+// ext4 labels are limited to 16 bytes, and udisks mounts at
+// /run/media/<user>/<label>. Letters and digits of any script are kept as
+// UTF-8, along with '-', '_', '.' and other non-ASCII symbols such as
+// emoji; whitespace becomes '_' and ASCII punctuation is dropped ("My Work
+// Stuff" -> My_Work_Stuff, "Café" -> Café). A name that has to be cut to
+// fit, or has nothing usable left, gets a short hash of the full name, so
+// such bottles don't end up with the same label.
+func getFSLabel(bottle string) string {
+	const maxLabel = 16
+	full := strings.TrimSuffix(filepath.Base(bottle), ".bottle")
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r == '-' || r == '_' || r == '.' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+			return r
+		case unicode.IsSpace(r):
+			return '_'
+		case r >= utf8.RuneSelf && r != utf8.RuneError && unicode.IsGraphic(r):
+			return r
+		}
+		return -1
+	}, full)
+	if len(name) <= maxLabel && strings.Trim(name, "_.") != "" {
+		return name
+	}
+
+	sum := sha256.Sum256([]byte(full))
+	suffix := "-" + hex.EncodeToString(sum[:2])
+	if strings.Trim(name, "_.") == "" {
+		return "bottle" + suffix
+	}
+	// Cut on a rune boundary
+	cut := maxLabel - len(suffix)
+	for cut > 0 && !utf8.RuneStart(name[cut]) {
+		cut--
+	}
+	return name[:cut] + suffix
+}
+
+// parseSize parses a human size like "750M", "3.5G" or "20G" into bytes.
+// Units are binary (K, M, G, T); a trailing "B" or "iB" is accepted.
+// A bare number is taken as bytes.
+func parseSize(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	str = strings.TrimSuffix(strings.TrimSuffix(str, "IB"), "B")
+	if str == "" {
+		return 0, errSizeRequired
+	}
+
+	multiplier := int64(1)
+	switch str[len(str)-1] {
+	case 'K':
+		multiplier = 1 << 10
+	case 'M':
+		multiplier = 1 << 20
+	case 'G':
+		multiplier = 1 << 30
+	case 'T':
+		multiplier = 1 << 40
+	}
+	if multiplier > 1 {
+		str = str[:len(str)-1]
+	}
+
+	n, err := strconv.ParseFloat(str, 64)
+	// Sizes past int64 would convert to garbage, so they are rejected too
+	bytes := n * float64(multiplier)
+	if err != nil || n <= 0 || math.IsInf(n, 0) || math.IsNaN(n) || bytes >= math.MaxInt64 {
+		return 0, &bottleError{op: "size", msg: "invalid size " + strconv.Quote(s) + " (use e.g. 750M, 3.5G)"}
+	}
+	return int64(bytes), nil
+}
+
+// minBottleSize returns the configured minimum bottle size in bytes
+func minBottleSize() int64 {
+	minSize, err := parseSize(globalConfig.GetDefault("MIN_BOTTLE_SIZE", DefaultMinBottleSize))
+	if err != nil {
+		minSize, _ = parseSize(DefaultMinBottleSize)
+	}
+	return minSize
+}
+
+// validateBottleSize parses a size and checks it against the configured minimum
+func validateBottleSize(s string) (int64, error) {
+	size, err := parseSize(s)
+	if err != nil {
+		return 0, err
+	}
+	if minSize := minBottleSize(); size < minSize {
+		return 0, &bottleError{op: "size", msg: "must be at least " + formatSize(minSize)}
+	}
+	return size, nil
+}
+
+// hostFreeSpace returns the bytes available to unprivileged users on the
+// filesystem containing dir
+func hostFreeSpace(dir string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
+
+// preallocate is set by create --preallocate
+var preallocate bool
+
+// preallocating reports whether new bottle files get their whole size up
+// front (create --preallocate, or PREALLOCATE=1)
+func preallocating() bool {
+	return preallocate || globalConfig.Get("PREALLOCATE") == "1"
+}
+
+// integrity is set by create --integrity or the creation forms
+var integrity bool
+
+// luksFormatArgs returns the cryptsetup arguments formatting a new bottle.
+// With integrity, it gets LUKS2 authenticated encryption (dm-integrity), so
+// data changed behind dm-crypt's back fails to read instead of decrypting
+// to garbage.
+func luksFormatArgs(args ...string) []string {
+	if integrity {
+		args = append([]string{"--integrity", "hmac-sha256"}, args...)
+	}
+	return append([]string{"luksFormat"}, args...)
+}
+
+// luksIntegrity reports whether a LUKS bottle was created with integrity
+func luksIntegrity(bottle string) bool {
+	out, err := command("cryptsetup", "luksDump", bottle).Output()
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if key, _, ok := strings.Cut(strings.TrimSpace(line), ":"); ok && key == "integrity" {
+			return true
+		}
+	}
+	return false
+}
+
+// createBottleFile sizes the bottle image file claimed by startCreating. It
+// is sparse, taking host space only as it fills, unless preallocating: then
+// fallocate reserves it all, so a full host disk can't make writes inside
+// the bottle fail later. Integrity bottles are preallocated too, since
+// formatting them writes every sector.
+func createBottleFile(ctx context.Context, f *os.File, sizeBytes int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if preallocating() || integrity {
+		if free, err := hostFreeSpace(filepath.Dir(f.Name())); err == nil && sizeBytes > free {
+			return &bottleError{op: "create file", msg: "can't preallocate " + formatSize(sizeBytes) + ": only " + formatSize(free) + " free on the host filesystem"}
+		}
+		if err := unix.Fallocate(int(f.Fd()), 0, 0, sizeBytes); err != nil {
+			return &bottleError{op: "create file", msg: "fallocate: " + err.Error()}
+		}
+		return nil
+	}
+	if err := f.Truncate(sizeBytes); err != nil {
+		return &bottleError{op: "create file", msg: err.Error()}
+	}
+	return nil
+}
+
+// creatingPath returns the temporary name a bottle is built under, next to
+// it so it can be renamed into place. Being hidden, it isn't listed.
+func creatingPath(bottle string) string {
+	return filepath.Join(filepath.Dir(bottle), "."+filepath.Base(bottle)+".creating")
+}
+
+// startCreating claims the temporary file to build bottle in by creating
+// it, failing if another creation (or a crashed one that gc hasn't cleared)
+// has it. The ciphertext is nobody else's business: it is created 0600.
+func startCreating(bottle string) (*os.File, error) {
+	f, err := os.OpenFile(creatingPath(bottle), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return nil, errCreationInProgress
+	}
+	if err != nil {
+		return nil, &bottleError{op: "create file", msg: err.Error()}
+	}
+	return f, nil
+}
+
+// finishCreating renames a fully built bottle from tmp into place, without
+// replacing a bottle that appeared meanwhile
+func finishCreating(tmp, bottle string) error {
+	err := unix.Renameat2(unix.AT_FDCWD, tmp, unix.AT_FDCWD, bottle, unix.RENAME_NOREPLACE)
+	if errors.Is(err, unix.EINVAL) || errors.Is(err, unix.ENOSYS) {
+		// Filesystems without RENAME_NOREPLACE
+		if _, statErr := os.Lstat(bottle); statErr == nil {
+			err = unix.EEXIST
+		} else {
+			err = os.Rename(tmp, bottle)
+		}
+	}
+	if err != nil {
+		os.Remove(tmp)
+		if errors.Is(err, unix.EEXIST) {
+			return errBottleExists
+		}
+		return &bottleError{op: "rename", msg: err.Error()}
+	}
+	return nil
+}
+
+// saveNewConfig writes a new bottle's config in the background while the
+// slow steps of creating it run, and returns a function that waits for the
+// write. The journal records the config, so a crash removes it with the rest.
+func saveNewConfig(j *journal, bottle string, perms *Permissions) func() error {
+	path := getConfigPath(bottle)
+	j.setConfig(path)
+	done := make(chan error, 1)
+	go func() { done <- savePermissions(path, perms) }()
+	var err error
+	waited := false
+	return func() error {
+		if !waited {
+			err, waited = <-done, true
+		}
+		return err
+	}
+}
+
+// warnHostSpace warns when a new bottle of size could outgrow the free space
+// on the host filesystem
+func warnHostSpace(size string) {
+	sizeBytes, err := parseSize(size)
+	if err != nil || preallocating() || integrity {
+		return // reported when creating
+	}
+	if free, err := hostFreeSpace(bottleDir); err == nil && sizeBytes > free {
+		notice("Warning: only " + formatSize(free) + " free on the host filesystem for a " + formatSize(sizeBytes) +
+			" bottle; it fills up gradually and writes in it fail once the host disk is full (--preallocate reserves the space now)")
+	}
+}
+
+// bottleDiskUsage returns the apparent size and the space actually allocated
+// on disk for a (sparse) bottle file
+func bottleDiskUsage(bottle string) (apparent, allocated int64, err error) {
+	if dev := blockDevicePath(bottle); dev != "" {
+		size, err := blockDeviceSize(dev)
+		return size, size, err
+	}
+
+	fi, err := os.Stat(bottle)
+	if err != nil {
+		return 0, 0, err
+	}
+	if fi.IsDir() {
+		return dirDiskUsage(bottle)
+	}
+	apparent = fi.Size()
+	allocated = apparent
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		allocated = st.Blocks * 512
+	}
+	return apparent, allocated, nil
+}
+
+// BottleState describes how far a bottle is currently opened
+type BottleState int
+
+const (
+	StateLocked   BottleState = iota // not attached, or attached but still encrypted
+	StateUnlocked                    // dm-crypt device open but not mounted
+	StateMounted                     // filesystem mounted
+)
+
+// getBottleState returns the bottle's state and, when mounted, its mount point
+func getBottleState(bottle string) (BottleState, string) {
+	info := currentMount(bottle)
+	switch {
+	case info == nil:
+		return StateLocked, ""
+	case info.MountPoint != "":
+		return StateMounted, info.MountPoint
+	case info.CleartextDevice != "":
+		return StateUnlocked, ""
+	}
+	return StateLocked, ""
+}
+
+// findMountForBottle returns the mount point of a bottle, or "" if it is not mounted
+func findMountForBottle(bottle string) string {
+	_, mount := getBottleState(bottle)
+	return mount
+}
+
+// openInFileManager opens a directory in the host's default file manager
+func openInFileManager(path string) error {
+	if out, err := command("xdg-open", path).CombinedOutput(); err != nil {
+		return &bottleError{op: "xdg-open", msg: strings.TrimSpace(string(out) + " " + err.Error())}
+	}
+	return nil
+}
+
+// createBottleBase creates a new bottle file with LUKS encryption, its
+// filesystem labeled label (or after the bottle's name if ""). Cancelling
+// ctx stops it at the next step (or interrupts the current one where that
+// is possible) and removes what it made.
+func createBottleBase(ctx context.Context, bottle, size, password, label string, interactive bool) (err error) {
+	// Ensure bottle directory exists (for CLI create on fresh install)
+	os.MkdirAll(bottleDir, 0700)
+
+	if bottle == "" {
+		return errBottlePathRequired
+	}
+	if size == "" {
+		return errSizeRequired
+	}
+
+	// Ensure .bottle extension
+	if !strings.HasSuffix(bottle, ".bottle") {
+		bottle += ".bottle"
+	}
+
+	// If just a name, put in bottle dir
+	if !strings.Contains(bottle, string(os.PathSeparator)) {
+		bottle = filepath.Join(bottleDir, bottle)
+	}
+
+	if _, err := os.Stat(bottle); err == nil {
+		return errBottleExists
+	}
+
+	sizeBytes, err := validateBottleSize(size)
+	if err != nil {
+		return err
+	}
+
+	realPath, err := filepath.Abs(bottle)
+	if err != nil {
+		return &bottleError{op: "path", msg: err.Error()}
+	}
+	mapperName := getMapperName(realPath)
+
+	claim, err := startCreating(realPath)
+	if err != nil {
+		return err
+	}
+	defer claim.Close()
+	tmp := claim.Name()
+	j, err := beginJournal("create", realPath)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	defer j.finish()
+	j.setTemp(tmp)
+
+	// The config is signed (which may wait on the keyring) and written while
+	// the image is allocated and formatted
+	configSaved := saveNewConfig(j, realPath, defaultPermissions())
+
+	// Any failure, or cancelling, undoes what was done so far. The config is
+	// kept if the bottle turned out to exist: it is that bottle's.
+	loopDev, opened := "", false
+	defer func() {
+		if err == nil {
+			return
+		}
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		if opened {
+			cryptsetupCmd("close", mapperName).Run()
+		}
+		if loopDev != "" {
+			privCmd("losetup", "-d", loopDev).Run()
+		}
+		os.Remove(tmp)
+		if configSaved() == nil && err != errBottleExists {
+			os.Remove(getConfigPath(realPath))
+		}
+	}()
+
+	if err = j.next(ctx, "allocate"); err != nil {
+		return err
+	}
+	if err = createBottleFile(ctx, claim, sizeBytes); err != nil {
+		return err
+	}
+
+	// LUKS format
+	if err = j.next(ctx, "format"); err != nil {
+		return err
+	}
+	var luksCmd *exec.Cmd
+	if password != "" {
+		luksCmd = privCmdContext(ctx, "cryptsetup", luksFormatArgs("--type", "luks2", "--batch-mode", tmp, "-")...)
+		luksCmd.Stdin = strings.NewReader(password)
+	} else {
+		luksCmd = privCmdContext(ctx, "cryptsetup", luksFormatArgs("--type", "luks2", tmp)...)
+	}
+	if out, cmdErr := luksCmd.CombinedOutput(); cmdErr != nil {
+		return &bottleError{op: "LUKS format", msg: string(out)}
+	}
+
+	// Setup loop device
+	if err = j.next(ctx, "loop setup"); err != nil {
+		return err
+	}
+	loopOut, cmdErr := privCmdContext(ctx, "losetup", "--find", "--show", "--", tmp).Output()
+	if cmdErr != nil {
+		return &bottleError{op: "loop setup", msg: cmdErr.Error()}
+	}
+	loopDev = strings.TrimSpace(string(loopOut))
+	j.setLoop(loopDev)
+
+	// Open LUKS
+	j.setMapper(mapperName)
+	if err = j.next(ctx, "open"); err != nil {
+		return err
+	}
+	var openCmd *exec.Cmd
+	if password != "" {
+		openCmd = privCmdContext(ctx, "cryptsetup", "open", "--key-file=-", loopDev, mapperName)
+		openCmd.Stdin = strings.NewReader(password)
+	} else {
+		openCmd = privCmdContext(ctx, "cryptsetup", "open", loopDev, mapperName)
+	}
+	if out, cmdErr := openCmd.CombinedOutput(); cmdErr != nil {
+		return &bottleError{op: "LUKS open", msg: string(out)}
+	}
+	opened = true
+
+	// Create filesystem with label for consistent mount point naming
+	if err = j.next(ctx, "mkfs"); err != nil {
+		return err
+	}
+	if label == "" {
+		label = getFSLabel(realPath)
+	}
+	if out, cmdErr := privCmdContext(ctx, "mkfs.ext4", "-q", "-E", ext4RootOwner(), "-L", label, "/dev/mapper/"+mapperName).CombinedOutput(); cmdErr != nil {
+		return &bottleError{op: "mkfs", msg: string(out)}
+	}
+
+	// Cleanup
+	cryptsetupCmd("close", mapperName).Run()
+	privCmd("losetup", "-d", loopDev).Run()
+	opened, loopDev = false, ""
+
+	if saveErr := configSaved(); saveErr != nil {
+		return &bottleError{op: "save config", msg: saveErr.Error()}
+	}
+	if err = j.next(ctx, "rename"); err != nil {
+		return err
+	}
+	err = finishCreating(tmp, realPath)
+	return err
+}
+
+// deleteBottle removes a bottle file (or gocryptfs directory) and its config
+func deleteBottle(bottle string) error {
+	// Check if mounted
+	if currentMount(bottle) != nil {
+		return errBottleMounted
+	}
+	// Only ever remove the link of a block device bottle, never the device node
+	if fi, err := os.Lstat(bottle); err == nil && fi.Mode()&os.ModeDevice != 0 {
+		return errBlockDevice
+	}
+
+	remove := os.Remove
+	if bottleBackend(bottle) != BackendLUKS {
+		// Directory bottles; locked fscrypt files can be deleted without the key
+		remove = os.RemoveAll
+	}
+	if err := remove(bottle); err != nil {
+		return err
+	}
+
+	// Also remove the decoy, config, and usage stats
+	if decoy, id := findDecoy(bottle); decoy != "" {
+		_ = deleteBottle(decoy)
+		os.Remove(filepath.Dir(decoy))
+		_ = storeDuressAction(id, "")
+	}
+	os.Remove(getConfigPath(bottle))
+	os.Remove(getStatsPath(bottle))
+	return nil
+}
+
+// Errors
+type bottleError struct {
+	op    string
+	msg   string
+	usage bool       // a bad argument (ExitUsage)
+	class errorClass // kind of failure, if not classError
+}
+
+func (e *bottleError) Error() string {
+	return e.op + ": " + e.msg
+}
+
+func (e *bottleError) category() errorClass {
+	if e.usage || e.op == "usage" {
+		return classUsage
+	}
+	return e.class
+}
+
+// badArgument marks err as a bad argument, such as a value that doesn't
+// parse, so the CLI exits with ExitUsage
+func badArgument(op string, err error) error {
+	var bottleErr *bottleError
+	if errors.As(err, &bottleErr) {
+		return &bottleError{op: bottleErr.op, msg: bottleErr.msg, usage: true}
+	}
+	return &bottleError{op: op, msg: err.Error(), usage: true}
+}
+
+var (
+	errBottlePathRequired = &bottleError{op: "bottle", msg: "path required"}
+	errSizeRequired       = &bottleError{op: "bottle", msg: "size required"}
+	errBottleExists       = &bottleError{op: "bottle", msg: "already exists"}
+	errCreationInProgress = &bottleError{op: "bottle", msg: "is already being created (if not, a failed creation left its temporary file: run bottle-launch gc)"}
+	errBottleNotFound     = &bottleError{op: "bottle", msg: "not found", class: classNotFound}
+	errBottleMounted      = &bottleError{op: "bottle", msg: "currently mounted - close any running apps first", class: classInUse}
+	errPasswordMismatch   = &bottleError{op: "password", msg: "passwords do not match"}
+)
+
+// CreateBottleWithYubiKey creates a new bottle encrypted with FIDO2/YubiKey
+// The FIDO2 secret is the ONLY LUKS passphrase - no password is ever set.
+// Cancelling ctx stops it and removes what it made, like createBottleBase.
+func CreateBottleWithYubiKey(ctx context.Context, bottle, size string, fido2Secret []byte, bottleID, credID, salt, rpID, user, deviceHint string) (err error) {
+	if bottle == "" {
+		return errBottlePathRequired
+	}
+	if size == "" {
+		return errSizeRequired
+	}
+	if len(fido2Secret) != 32 {
+		return &bottleError{op: "fido2", msg: "invalid secret length", class: classFIDO2}
+	}
+	if mockMode {
+		perms := defaultPermissions()
+		perms.FIDO2BottleID, perms.FIDO2CredentialID = bottleID, credID
+		perms.FIDO2Salt, perms.FIDO2DeviceHint = salt, deviceHint
+		perms.FIDO2RPID, perms.FIDO2User = rpID, user
+		return mockCreate(bottle, size, hex.EncodeToString(fido2Secret), perms)
+	}
+
+	// Ensure .bottle extension
+	if !strings.HasSuffix(bottle, ".bottle") {
+		bottle += ".bottle"
+	}
+
+	// If just a name, put in bottle dir
+	if !strings.Contains(bottle, string(os.PathSeparator)) {
+		bottle = filepath.Join(bottleDir, bottle)
+	}
+
+	if _, err := os.Stat(bottle); err == nil {
+		return errBottleExists
+	}
+
+	sizeBytes, err := validateBottleSize(size)
+	if err != nil {
+		return err
+	}
+
+	realPath, err := filepath.Abs(bottle)
+	if err != nil {
+		return &bottleError{op: "path", msg: err.Error()}
+	}
+	mapperName := getMapperName(realPath)
+	configPath := getConfigPath(realPath)
+
+	claim, err := startCreating(realPath)
+	if err != nil {
+		return err
+	}
+	defer claim.Close()
+	tmp := claim.Name()
+	j, err := beginJournal("create", realPath)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	defer j.finish()
+	j.setTemp(tmp)
+
+	// The config with the FIDO2 fields must exist before the image is
+	// formatted, so recovery data is never missing. It is signed (which may
+	// wait on the keyring) and written while the image is allocated.
+	perms := defaultPermissions()
+	perms.FIDO2BottleID = bottleID
+	perms.FIDO2CredentialID = credID
+	perms.FIDO2Salt = salt
+	perms.FIDO2DeviceHint = deviceHint
+	perms.FIDO2RPID = rpID
+	perms.FIDO2User = user
+	configSaved := saveNewConfig(j, realPath, perms)
+
+	// Any failure, or cancelling, undoes what was done so far. The config is
+	// kept if the bottle turned out to exist: it is that bottle's.
+	loopDev, opened := "", false
+	defer func() {
+		if err == nil {
+			return
+		}
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		if opened {
+			cryptsetupCmd("close", mapperName).Run()
+		}
+		if loopDev != "" {
+			privCmd("losetup", "-d", loopDev).Run()
+		}
+		os.Remove(tmp)
+		if configSaved() == nil && err != errBottleExists {
+			os.Remove(configPath)
+		}
+	}()
+
+	if err = j.next(ctx, "allocate"); err != nil {
+		return err
+	}
+	if err = createBottleFile(ctx, claim, sizeBytes); err != nil {
+		return err
+	}
+
+	if err = j.next(ctx, "save config"); err != nil {
+		return err
+	}
+	if saveErr := configSaved(); saveErr != nil {
+		return &bottleError{op: "save config", msg: saveErr.Error()}
+	}
+
+	// LUKS format with FIDO2 secret
+	if err = j.next(ctx, "format"); err != nil {
+		return err
+	}
+	if err = FormatBottleWithFIDO2(ctx, tmp, fido2Secret); err != nil {
+		return err
+	}
+
+	// Setup loop device
+	if err = j.next(ctx, "loop setup"); err != nil {
+		return err
+	}
+	loopOut, cmdErr := privCmdContext(ctx, "losetup", "--find", "--show", "--", tmp).Output()
+	if cmdErr != nil {
+		return &bottleError{op: "loop setup", msg: cmdErr.Error()}
+	}
+	loopDev = strings.TrimSpace(string(loopOut))
+	j.setLoop(loopDev)
+
+	// Open LUKS with FIDO2 secret
+	j.setMapper(mapperName)
+	if err = j.next(ctx, "open"); err != nil {
+		return err
+	}
+	if err = OpenLUKSWithFIDO2(ctx, loopDev, mapperName, fido2Secret); err != nil {
+		return err
+	}
+	opened = true
+
+	// Create filesystem with label for consistent mount point naming
+	if err = j.next(ctx, "mkfs"); err != nil {
+		return err
+	}
+	if out, cmdErr := privCmdContext(ctx, "mkfs.ext4", "-q", "-E", ext4RootOwner(), "-L", getFSLabel(realPath), "/dev/mapper/"+mapperName).CombinedOutput(); cmdErr != nil {
+		return &bottleError{op: "mkfs", msg: string(out)}
+	}
+
+	// Cleanup
+	cryptsetupCmd("close", mapperName).Run()
+	privCmd("losetup", "-d", loopDev).Run()
+	opened, loopDev = false, ""
+
+	if err = j.next(ctx, "rename"); err != nil {
+		return err
+	}
+	err = finishCreating(tmp, realPath)
+	return err
+}
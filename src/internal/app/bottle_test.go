@@ -0,0 +1,130 @@
+// Tests for bottle naming and creation: sizes, filesystem labels, and claiming the temporary file.
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64 // 0 = rejected
+	}{
+		{"750M", 750 << 20},
+		{"3.5G", 7 << 29},
+		{"20GiB", 20 << 30},
+		{"1t", 1 << 40},
+		{"4096", 4096},
+		{"1e3K", 1000 << 10},
+		// Rejected
+		{"", 0},
+		{"0", 0},
+		{"-1G", 0},
+		{"lots", 0},
+		{"NaN", 0},
+		{"Inf", 0},
+		// Past int64
+		{"9.3e18", 0},
+		{"1e19", 0},
+		{"8E", 0},
+		{"1e10T", 0},
+		{"8388608T", 0},
+		{"8388607T", 8388607 << 40},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if tt.want == 0 {
+			if err == nil {
+				t.Errorf("parseSize(%q) = %d, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestGetFSLabel(t *testing.T) {
+	tests := []struct {
+		bottle string
+		want   string
+	}{
+		{"work.bottle", "work"},
+		{"/home/me/.local/share/bottles/My Work Stuff.bottle", "My_Work_Stuff"},
+		{"tab\there.bottle", "tab_here"},
+		{"two  spaces.bottle", "two__spaces"},
+		{"v1.2-beta_3.bottle", "v1.2-beta_3"},
+		{"what?!.bottle", "what"},
+		// Non-ASCII names stay UTF-8
+		{"Café.bottle", "Café"},
+		{"日本語.bottle", "日本語"},
+		{"Работа.bottle", "Работа"},
+		{"🍷 wine.bottle", "🍷_wine"},
+		// ext4 labels hold 16 bytes: cut on a rune boundary, plus a hash
+		{"a-very-long-bottle-name.bottle", "a-very-long-5256"},
+		{"Über Größe Test Bottle Name.bottle", "Über_Grö-276a"},
+		{"日本語のとても長い名前.bottle", "日本語-f12c"},
+		{"Личные документы.bottle", "Личны-f7fe"},
+		// Nothing usable left
+		{"   .bottle", "bottle-0aad"},
+		{"._.bottle", "bottle-30b6"},
+	}
+	for _, tt := range tests {
+		got := getFSLabel(tt.bottle)
+		if got != tt.want {
+			t.Errorf("getFSLabel(%q) = %q, want %q", tt.bottle, got, tt.want)
+		}
+		if len(got) > 16 {
+			t.Errorf("getFSLabel(%q) = %q, longer than 16 bytes", tt.bottle, got)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("getFSLabel(%q) = %q, not valid UTF-8", tt.bottle, got)
+		}
+	}
+}
+
+func TestGetFSLabelCollisions(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		// Same first 16 bytes
+		{"a-very-long-bottle-name.bottle", "a-very-long-bottle-name-2.bottle"},
+		{"Личные документы.bottle", "Личные фотографии.bottle"},
+		// Names with nothing usable
+		{"   .bottle", "\t.bottle"},
+		{"!!!.bottle", "???.bottle"},
+	}
+	for _, tt := range tests {
+		if a, b := getFSLabel(tt.a), getFSLabel(tt.b); a == b {
+			t.Errorf("getFSLabel(%q) and getFSLabel(%q) are both %q", tt.a, tt.b, a)
+		}
+	}
+}
+
+func TestStartCreatingClaims(t *testing.T) {
+	bottle := filepath.Join(t.TempDir(), "work.bottle")
+	claim, err := startCreating(bottle)
+	if err != nil {
+		t.Fatalf("startCreating() = %v", err)
+	}
+	defer claim.Close()
+	if fi, err := os.Stat(claim.Name()); err != nil || fi.Mode().Perm()&0077 != 0 {
+		t.Errorf("claimed file = %v, %v; want it private", fi, err)
+	}
+	if _, err := startCreating(bottle); err != errCreationInProgress {
+		t.Errorf("second startCreating() error = %v, want %v", err, errCreationInProgress)
+	}
+	if err := finishCreating(claim.Name(), bottle); err != nil {
+		t.Fatalf("finishCreating() = %v", err)
+	}
+	// Once renamed into place, the name is free for the next creation
+	again, err := startCreating(bottle)
+	if err != nil {
+		t.Fatalf("startCreating() after finishCreating = %v", err)
+	}
+	again.Close()
+}
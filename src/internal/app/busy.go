@@ -0,0 +1,137 @@
+// Busy mounts: finding and stopping the processes that keep a bottle from being unmounted.
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"bottle-launch/internal/sysfs"
+	"bottle-launch/internal/wait"
+)
+
+// busyProcess is a process holding files open inside a mount
+type busyProcess struct {
+	PID  int
+	Name string // command name from /proc/<pid>/comm
+	Path string // one of the files it holds, for display
+}
+
+func (p busyProcess) String() string {
+	return p.Name + " (pid " + strconv.Itoa(p.PID) + ")"
+}
+
+// busyError means a bottle could not be unmounted because processes still
+// have files open in it
+type busyError struct {
+	MountPoint string
+	Procs      []busyProcess
+}
+
+func (e *busyError) Error() string {
+	names := make([]string, len(e.Procs))
+	for i, p := range e.Procs {
+		names[i] = p.String()
+	}
+	return "unmount: " + e.MountPoint + " is busy - still in use by " + strings.Join(names, ", ")
+}
+
+// findBusyProcesses scans /proc for processes whose working directory, root,
+// executable, open files, or memory mappings are inside mountPoint
+func findBusyProcesses(mountPoint string) []busyProcess {
+	if mountPoint == "" {
+		return nil
+	}
+	inside := func(path string) bool {
+		return path == mountPoint || strings.HasPrefix(path, mountPoint+"/")
+	}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	var procs []busyProcess
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		dir := filepath.Join("/proc", e.Name())
+
+		var held string
+		links := []string{filepath.Join(dir, "cwd"), filepath.Join(dir, "root"), filepath.Join(dir, "exe")}
+		if fds, err := filepath.Glob(filepath.Join(dir, "fd", "*")); err == nil {
+			links = append(links, fds...)
+		}
+		for _, link := range links {
+			if target, err := os.Readlink(link); err == nil && inside(target) {
+				held = target
+				break
+			}
+		}
+		if held == "" {
+			held = mappedPathInside(filepath.Join(dir, "maps"), inside)
+		}
+		if held == "" {
+			continue
+		}
+
+		procs = append(procs, busyProcess{PID: pid, Name: sysfs.ReadAttr(filepath.Join(dir, "comm")), Path: held})
+	}
+	return procs
+}
+
+// mappedPathInside returns the first memory-mapped file in a /proc/<pid>/maps
+// file that matches inside, or ""
+func mappedPathInside(maps string, inside func(string) bool) string {
+	data, err := os.ReadFile(maps)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		// Format: <range> <perms> <offset> <dev> <inode> <path>, where
+		// the path may contain spaces
+		rest := line
+		for range 5 {
+			_, rest, _ = strings.Cut(strings.TrimLeft(rest, " "), " ")
+		}
+		if path := strings.TrimLeft(rest, " "); path != "" && inside(path) {
+			return path
+		}
+	}
+	return ""
+}
+
+// checkBusy returns a *busyError listing the processes using mountPoint, or
+// nil if there are none (the unmount failed for another reason)
+func checkBusy(mountPoint string) error {
+	if procs := findBusyProcesses(mountPoint); len(procs) > 0 {
+		return &busyError{MountPoint: mountPoint, Procs: procs}
+	}
+	return nil
+}
+
+// killBusyProcesses asks procs to exit with SIGTERM, and kills those still
+// running after BusyKillGrace
+func killBusyProcesses(procs []busyProcess) {
+	if len(procs) == 0 {
+		return
+	}
+	var pids []int
+	for _, p := range procs {
+		if syscall.Kill(p.PID, syscall.SIGTERM) == nil {
+			pids = append(pids, p.PID)
+		}
+	}
+	if wait.ForExits(pids, BusyKillGrace) {
+		return
+	}
+	for _, pid := range pids {
+		_ = syscall.Kill(pid, syscall.SIGKILL)
+	}
+	// Their files are closed once they have exited
+	wait.ForExits(pids, time.Second)
+}
@@ -0,0 +1,64 @@
+// Tests for busy-process detection: /proc/<pid>/maps paths containing spaces.
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMappedPathInside(t *testing.T) {
+	const mount = "/run/media/me/My Work Stuff"
+	inside := func(path string) bool {
+		return path == mount || strings.HasPrefix(path, mount+"/")
+	}
+	tests := []struct {
+		name string
+		maps string
+		want string
+	}{
+		{
+			name: "path with spaces",
+			maps: "55d0c000-55d0d000 r-xp 00000000 08:01 42                         /usr/bin/app\n" +
+				"7f3a1000-7f3a2000 r--p 00000000 fd:03 1234                       /run/media/me/My Work Stuff/lib/libx.so\n",
+			want: "/run/media/me/My Work Stuff/lib/libx.so",
+		},
+		{
+			name: "double space kept",
+			maps: "7f3a1000-7f3a2000 rw-s 00000000 fd:03 77 /run/media/me/My Work Stuff/a  b.db\n",
+			want: "/run/media/me/My Work Stuff/a  b.db",
+		},
+		{
+			name: "unicode name",
+			maps: "7f3a1000-7f3a2000 r--p 00000000 fd:03 9 /run/media/me/My Work Stuff/Café.sqlite\n",
+			want: "/run/media/me/My Work Stuff/Café.sqlite",
+		},
+		{
+			name: "anonymous and pseudo mappings",
+			maps: "7f3a1000-7f3a2000 rw-p 00000000 00:00 0 \n" +
+				"7ffd1000-7ffd2000 rw-p 00000000 00:00 0                          [stack]\n",
+			want: "",
+		},
+		{
+			name: "sibling directory with the same prefix",
+			maps: "7f3a1000-7f3a2000 r--p 00000000 fd:04 5 /run/media/me/My Work Stuff 2/lib.so\n",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maps := filepath.Join(t.TempDir(), "maps")
+			if err := os.WriteFile(maps, []byte(tt.maps), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if got := mappedPathInside(maps, inside); got != tt.want {
+				t.Errorf("mappedPathInside() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := mappedPathInside(filepath.Join(t.TempDir(), "gone"), inside); got != "" {
+		t.Errorf("mappedPathInside(missing file) = %q, want \"\"", got)
+	}
+}
@@ -0,0 +1,112 @@
+// App categories: suggested permissions for an app's first launch in a bottle, by its desktop categories.
+package app
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// permissionPreset is the suggested permission set for a kind of app
+type permissionPreset struct {
+	category string   // freedesktop main or additional category
+	label    string   // e.g. "web browsers"
+	enable   []string // config keys of the permissions it turns on; all others are off
+}
+
+// permissionPresets in order of precedence: an app in several categories
+// gets the first matching preset
+var permissionPresets = []permissionPreset{
+	{category: "WebBrowser", label: "web browsers",
+		enable: []string{"PREF_NETWORK", "PREF_AUDIO", "PREF_GPU", "PREF_WAYLAND", "PREF_X11", "PREF_PORTALS", "PREF_NOTIFICATIONS", "PREF_MPRIS"}},
+	{category: "InstantMessaging", label: "chat apps",
+		enable: []string{"PREF_NETWORK", "PREF_AUDIO", "PREF_GPU", "PREF_WAYLAND", "PREF_X11", "PREF_CAMERA", "PREF_PORTALS", "PREF_NOTIFICATIONS"}},
+	{category: "Email", label: "mail clients",
+		enable: []string{"PREF_NETWORK", "PREF_WAYLAND", "PREF_X11", "PREF_PORTALS", "PREF_NOTIFICATIONS", "PREF_PRINTING"}},
+	{category: "Game", label: "games",
+		enable: []string{"PREF_AUDIO", "PREF_GPU", "PREF_WAYLAND", "PREF_X11"}},
+	{category: "Office", label: "office apps",
+		enable: []string{"PREF_GPU", "PREF_WAYLAND", "PREF_X11", "PREF_PORTALS", "PREF_PRINTING"}},
+	{category: "AudioVideo", label: "media players",
+		enable: []string{"PREF_NETWORK", "PREF_AUDIO", "PREF_GPU", "PREF_WAYLAND", "PREF_X11", "PREF_PORTALS", "PREF_MPRIS"}},
+	{category: "Graphics", label: "graphics apps",
+		enable: []string{"PREF_GPU", "PREF_WAYLAND", "PREF_X11", "PREF_PORTALS", "PREF_PRINTING"}},
+	{category: "Development", label: "development tools",
+		enable: []string{"PREF_NETWORK", "PREF_GPU", "PREF_WAYLAND", "PREF_X11", "PREF_PORTALS"}},
+}
+
+// mockAppCategories are the desktop categories of the mock apps
+var mockAppCategories = map[string][]string{
+	"org.gnome.TextEditor": {"GNOME", "GTK", "Utility", "TextEditor"},
+	"org.mozilla.firefox":  {"Network", "WebBrowser"},
+	"org.videolan.VLC":     {"AudioVideo", "Player", "Video"},
+}
+
+// appCategories returns an app's desktop categories, from the .desktop file
+// flatpak exports for it
+func appCategories(app FlatpakApp) []string {
+	if mockMode {
+		return mockAppCategories[app.ID]
+	}
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, _ := os.UserHomeDir()
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	dirs := []string{filepath.Join(dataHome, "flatpak", "exports", "share", "applications"),
+		"/var/lib/flatpak/exports/share/applications"}
+	if app.Installation == "system" {
+		slices.Reverse(dirs)
+	}
+	for _, dir := range dirs {
+		file, err := os.Open(filepath.Join(dir, app.ID+".desktop"))
+		if err != nil {
+			continue
+		}
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if value, ok := strings.CutPrefix(scanner.Text(), "Categories="); ok {
+				return splitKeyList(value)
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+// suggestedPreset returns the preset for an app's categories, or nil
+func suggestedPreset(categories []string) *permissionPreset {
+	for i, p := range permissionPresets {
+		if slices.Contains(categories, p.category) {
+			return &permissionPresets[i]
+		}
+	}
+	return nil
+}
+
+// apply sets perms to the preset
+func (p *permissionPreset) apply(perms *Permissions) {
+	for _, def := range permissionDefs {
+		*permissionToggle(perms, def.Config) = slices.Contains(p.enable, def.Config)
+	}
+}
+
+// matches reports whether perms already are the preset
+func (p *permissionPreset) matches(perms *Permissions) bool {
+	for _, def := range permissionDefs {
+		if *permissionToggle(perms, def.Config) != slices.Contains(p.enable, def.Config) {
+			return false
+		}
+	}
+	return true
+}
+
+// summary lists the permissions the preset turns on, like Permissions.Summary
+func (p *permissionPreset) summary() string {
+	perms := &Permissions{}
+	p.apply(perms)
+	return perms.Summary()
+}
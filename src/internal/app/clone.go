@@ -0,0 +1,70 @@
+// Clone: a new bottle starting as a copy of another, instant on btrfs and XFS.
+package app
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// cmdClone copies a locked bottle to a new one named name
+func cmdClone(bottle, name string) error {
+	bottle = resolveBottlePath(bottle)
+	if _, err := os.Stat(bottle); err != nil {
+		return errBottleNotFound
+	}
+	if err := requireSnapshotBottle(bottle); err != nil {
+		return err
+	}
+	if currentMount(bottle) != nil {
+		return errBottleMounted
+	}
+	clone := newBottlePath(name)
+	if _, err := os.Lstat(clone); err == nil {
+		return errBottleExists
+	}
+	lock, err := acquireBottleLock(bottle, "clone")
+	var inUse *bottleInUseError
+	if errors.As(err, &inUse) {
+		return errBottleMounted
+	}
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	reflinked, err := copySnapshot(bottle, clone)
+	if err != nil {
+		return err
+	}
+	if bottleBackend(bottle) == BackendLUKS {
+		uuid, err := os.ReadFile("/proc/sys/kernel/random/uuid")
+		if err == nil {
+			var out []byte
+			out, err = cryptsetupCmd("luksUUID", "--batch-mode", "--uuid", strings.TrimSpace(string(uuid)), clone).CombinedOutput()
+			if err != nil {
+				err = &bottleError{op: "LUKS UUID", msg: strings.TrimSpace(string(out))}
+			}
+		}
+		if err != nil {
+			os.Remove(clone)
+			return err
+		}
+	}
+
+	perms := loadPermissions(getConfigPath(bottle))
+	perms.Locked = lockedState{}
+	if err := savePermissions(getConfigPath(clone), perms); err != nil {
+		os.RemoveAll(clone)
+		return err
+	}
+	_ = recordLockedState(clone)
+
+	_, allocated, _ := bottleDiskUsage(clone)
+	how := "a full copy, " + formatSize(allocated) + " on disk"
+	if reflinked {
+		how = "a reflink: it shares its blocks with " + bottleName(bottle) + " until they differ"
+	}
+	say("Cloned " + bottleName(bottle) + " to " + bottleName(clone) + " (" + how + ").")
+	return nil
+}
@@ -0,0 +1,528 @@
+// Bubbletea commands: async operations for mounting, app execution, and FIDO2 workflows.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Message types
+
+type errMsg struct {
+	err error
+}
+
+type bottlesLoadedMsg struct {
+	bottles []string
+}
+
+// bottlesChangedMsg signals that the bottle directory or device-mapper state changed
+type bottlesChangedMsg struct{}
+
+type appsLoadedMsg struct {
+	apps []FlatpakApp
+}
+
+// malwareScanMsg carries the result of the scan before a bottle is locked
+type malwareScanMsg struct {
+	result scanResult
+}
+
+// appPermissionsMsg carries an app's metadata permissions (nil if unreadable)
+// and desktop categories
+type appPermissionsMsg struct {
+	ref        string
+	static     *keyFile
+	categories []string
+}
+
+type mountSuccessMsg struct {
+	info *MountInfo
+}
+
+type mountFailedMsg struct {
+	err           error
+	wrongPassword bool
+}
+
+// secretLookupMsg carries a passphrase fetched from a password manager
+type secretLookupMsg struct {
+	password string
+	err      error
+}
+
+// keyDriveMsg carries a key drive bottle's key, or why it couldn't be read;
+// poll tells stale results from an earlier visit to the view apart
+type keyDriveMsg struct {
+	poll int
+	key  string
+	err  error
+}
+
+type appFinishedMsg struct {
+	err error
+}
+
+// shutdownTickMsg drives the wait for an app asked to exit on quit
+type shutdownTickMsg struct{}
+
+// unmountRetriedMsg reports another attempt to release a busy bottle
+type unmountRetriedMsg struct {
+	err error
+}
+
+// staleBottlesMsg lists bottles left behind by a previous session
+type staleBottlesMsg struct {
+	bottles []staleBottle
+}
+
+type bottleRecoveredMsg struct {
+	path string
+	err  error
+}
+
+// sessionTickMsg drives the time-limit countdown while an app runs
+type sessionTickMsg struct{}
+
+// flathubResultsMsg carries the results of a Flathub search
+type flathubResultsMsg struct {
+	query string
+	apps  []remoteApp
+	err   error
+}
+
+// installProgressMsg is a progress line from flatpak install; events
+// delivers the next one
+type installProgressMsg struct {
+	line   string
+	events <-chan tea.Msg
+}
+
+// installDoneMsg reports the end of an app installation
+type installDoneMsg struct {
+	app remoteApp
+	err error
+}
+
+// runningStatsMsg carries a resource sample of the running app and its bottle
+type runningStatsMsg struct {
+	pid         int
+	mountPoint  string
+	usage       appUsage
+	free, total int64
+	used        int64
+}
+
+type fileManagerOpenedMsg struct {
+	err error
+}
+
+// snapshotsLoadedMsg carries a bottle's snapshots, newest first
+type snapshotsLoadedMsg struct {
+	snapshots []bottleSnapshot
+	mounted   bool // the bottle is open, so it can't be restored
+}
+
+// snapshotDoneMsg reports the end of taking, restoring, or deleting a snapshot
+type snapshotDoneMsg struct {
+	status string
+	err    error
+}
+
+type bottleCreatedMsg struct {
+	path string
+}
+
+// bottleCreateCancelledMsg reports a creation cancelled and rolled back
+type bottleCreateCancelledMsg struct{}
+
+// taskCancelledMsg reports a mount, key touch or app listing cancelled
+// and undone
+type taskCancelledMsg struct{}
+
+type bottleDeletedMsg struct {
+	path string
+}
+
+// FIDO2 message types
+
+type fido2DevicesMsg struct {
+	devices []FIDO2Device
+	err     error
+}
+
+type fido2CredentialCreatedMsg struct {
+	credID string
+	salt   string
+	err    error
+}
+
+type fido2SecretReadyMsg struct {
+	secret []byte
+	err    error
+}
+
+type fido2BottleCreatedMsg struct {
+	path string
+	err  error
+}
+
+type fido2UnlockSuccessMsg struct {
+	info *MountInfo
+}
+
+type fido2UnlockFailedMsg struct {
+	err     error
+	tryNext bool // the key didn't unlock the bottle; another may
+}
+
+// Commands
+
+func loadBottlesCmd() tea.Cmd {
+	return func() tea.Msg {
+		bottles := listBottles()
+		return bottlesLoadedMsg{bottles: bottles}
+	}
+}
+
+// waitForBottleChangeCmd blocks until the watcher reports a change.
+// It must be re-issued after each bottlesChangedMsg to keep listening.
+func waitForBottleChangeCmd(changes <-chan struct{}) tea.Cmd {
+	if changes == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		<-changes
+		return bottlesChangedMsg{}
+	}
+}
+
+func findStaleBottlesCmd() tea.Cmd {
+	return func() tea.Msg {
+		return staleBottlesMsg{bottles: findStaleBottles()}
+	}
+}
+
+func recoverBottleCmd(s staleBottle, lock bool) tea.Cmd {
+	return func() tea.Msg {
+		return bottleRecoveredMsg{path: s.path, err: recoverStaleBottle(s, lock)}
+	}
+}
+
+func loadAppsCmd(ctx context.Context) tea.Cmd {
+	return func() tea.Msg {
+		apps := listFlatpakAppsContext(ctx)
+		if ctx.Err() != nil {
+			return taskCancelledMsg{}
+		}
+		return appsLoadedMsg{apps: apps}
+	}
+}
+
+// loadAppPermissionsCmd reads an app's metadata permissions and categories
+func loadAppPermissionsCmd(app FlatpakApp) tea.Cmd {
+	return func() tea.Msg {
+		static, _ := appStaticPermissions(app)
+		return appPermissionsMsg{ref: app.Ref(), static: static, categories: appCategories(app)}
+	}
+}
+
+func searchFlathubCmd(query string) tea.Cmd {
+	return func() tea.Msg {
+		apps, err := searchFlathub(query)
+		return flathubResultsMsg{query: query, apps: apps, err: err}
+	}
+}
+
+// installAppCmd installs app from Flathub in the background, reporting each
+// progress line as an installProgressMsg and finishing with installDoneMsg
+func installAppCmd(app remoteApp) tea.Cmd {
+	events := make(chan tea.Msg, 16)
+	go func() {
+		err := installFlathubApp(app.ID, func(line string) {
+			events <- installProgressMsg{line: line, events: events}
+		})
+		events <- installDoneMsg{app: app, err: err}
+	}()
+	return waitForInstallCmd(events)
+}
+
+// waitForInstallCmd delivers the next installation event
+func waitForInstallCmd(events <-chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		return <-events
+	}
+}
+
+func mountBottleCmd(ctx context.Context, bottle, password string) tea.Cmd {
+	return func() tea.Msg {
+		return mountResultMsg(mountBottle(ctx, bottle, password))
+	}
+}
+
+// mountTypedPasswordCmd mounts with a typed password, which may be the
+// bottle's duress passphrase
+func mountTypedPasswordCmd(ctx context.Context, bottle, password string) tea.Cmd {
+	return func() tea.Msg {
+		return mountResultMsg(mountTypedPassword(ctx, bottle, password))
+	}
+}
+
+// mountResultMsg turns a mount result into a success, failure or
+// cancellation message
+func mountResultMsg(info *MountInfo, err error) tea.Msg {
+	if errors.Is(err, context.Canceled) {
+		return taskCancelledMsg{}
+	}
+	if err != nil {
+		if err == errWrongPassword {
+			return mountFailedMsg{err: err, wrongPassword: true}
+		}
+		return mountFailedMsg{err: err}
+	}
+	return mountSuccessMsg{info: info}
+}
+
+// readDriveKeyCmd reads a bottle's key from its key drive, after a second's
+// wait when polling for the drive to be plugged in
+func readDriveKeyCmd(perms *Permissions, poll int, wait bool) tea.Cmd {
+	read := func() tea.Msg {
+		key, err := readDriveKey(perms)
+		return keyDriveMsg{poll: poll, key: key, err: err}
+	}
+	if !wait {
+		return read
+	}
+	return tea.Tick(time.Second, func(time.Time) tea.Msg { return read() })
+}
+
+// lookupSecretCmd fetches the bottle passphrase from a password manager
+func lookupSecretCmd(ctx context.Context, ref *secretRef, master string) tea.Cmd {
+	return func() tea.Msg {
+		password, err := lookupSecret(ctx, ref, master)
+		if errors.Is(err, context.Canceled) {
+			return taskCancelledMsg{}
+		}
+		return secretLookupMsg{password: password, err: err}
+	}
+}
+
+// startFlatpakCmd starts the app in the background so the TUI stays interactive
+// while it runs. The app's output is discarded to keep it from drawing over the TUI.
+// The returned command waits for the app and reports appFinishedMsg.
+func startFlatpakCmd(app FlatpakApp, mountPoint string, perms *Permissions, extraArgs []string) (tea.Cmd, *exec.Cmd) {
+	c := buildFlatpakCommand(app, mountPoint, perms, extraArgs, nil)
+	if err := c.Start(); err != nil {
+		return func() tea.Msg {
+			return appFinishedMsg{err: err}
+		}, nil
+	}
+	return func() tea.Msg {
+		return appFinishedMsg{err: c.Wait()}
+	}, c
+}
+
+// malwareScanCmd scans a bottle before it is locked
+func malwareScanCmd(info *MountInfo) tea.Cmd {
+	return func() tea.Msg {
+		return malwareScanMsg{result: scanBeforeLock(info)}
+	}
+}
+
+// retryUnmountCmd stops procs (if any), then tries to release the bottle again
+func retryUnmountCmd(info *MountInfo, lock *BottleLock, procs []busyProcess) tea.Cmd {
+	return func() tea.Msg {
+		killBusyProcesses(procs)
+		return unmountRetriedMsg{err: releaseBottle(info, lock)}
+	}
+}
+
+func shutdownTickCmd() tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg {
+		return shutdownTickMsg{}
+	})
+}
+
+func sessionTickCmd() tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg {
+		return sessionTickMsg{}
+	})
+}
+
+// runningStatsCmd samples the app's process tree and the bottle's free and used space
+// after delay
+func runningStatsCmd(pid int, mountPoint string, delay time.Duration) tea.Cmd {
+	sample := func() tea.Msg {
+		msg := runningStatsMsg{pid: pid, mountPoint: mountPoint, usage: sampleAppUsage(pid)}
+		msg.free, msg.total, _ = filesystemSpace(mountPoint)
+		msg.used, _ = bottleUsed(mountPoint)
+		return msg
+	}
+	if delay <= 0 {
+		return sample
+	}
+	return tea.Tick(delay, func(time.Time) tea.Msg { return sample() })
+}
+
+func loadSnapshotsCmd(bottle string) tea.Cmd {
+	return func() tea.Msg {
+		return snapshotsLoadedMsg{snapshots: listSnapshots(bottle), mounted: currentMount(bottle) != nil}
+	}
+}
+
+func takeSnapshotCmd(bottle string) tea.Cmd {
+	return func() tea.Msg {
+		s, err := takeSnapshot(bottle)
+		if err != nil {
+			return snapshotDoneMsg{err: err}
+		}
+		status := "Saved snapshot " + s.Name()
+		pruned, err := pruneSnapshots(bottle)
+		if len(pruned) > 0 {
+			status += fmt.Sprintf(", pruned %d old one(s)", len(pruned))
+		}
+		return snapshotDoneMsg{status: status, err: err}
+	}
+}
+
+func restoreSnapshotCmd(bottle string, s bottleSnapshot) tea.Cmd {
+	return func() tea.Msg {
+		kept, err := restoreSnapshot(bottle, s)
+		if err != nil {
+			return snapshotDoneMsg{err: err}
+		}
+		return snapshotDoneMsg{status: "Restored " + s.Name() + "; the previous version is snapshot " + kept.Name()}
+	}
+}
+
+func deleteSnapshotCmd(s bottleSnapshot) tea.Cmd {
+	return func() tea.Msg {
+		return snapshotDoneMsg{status: "Deleted " + s.Name(), err: deleteSnapshot(s)}
+	}
+}
+
+func openFileManagerCmd(path string) tea.Cmd {
+	return func() tea.Msg {
+		return fileManagerOpenedMsg{err: openInFileManager(path)}
+	}
+}
+
+func createBottleCmd(ctx context.Context, backend, name, size, password string) tea.Cmd {
+	return func() tea.Msg {
+		// Ensure .bottle extension
+		if filepath.Ext(name) != ".bottle" {
+			name += ".bottle"
+		}
+
+		bottlePath := filepath.Join(bottleDir, name)
+
+		b, err := getBackend(backend)
+		if err == nil {
+			err = b.Create(ctx, bottlePath, size, password)
+		}
+		if errors.Is(err, context.Canceled) {
+			return bottleCreateCancelledMsg{}
+		}
+		if err != nil {
+			return errMsg{err: err}
+		}
+		return bottleCreatedMsg{path: bottlePath}
+	}
+}
+
+func deleteBottleCmd(bottle string) tea.Cmd {
+	return func() tea.Msg {
+		err := deleteBottle(bottle)
+		if err != nil {
+			return errMsg{err: err}
+		}
+		return bottleDeletedMsg{path: bottle}
+	}
+}
+
+// FIDO2 commands
+
+func enumerateFIDO2DevicesCmd() tea.Cmd {
+	return func() tea.Msg {
+		devices, err := EnumerateFIDO2Devices()
+		return fido2DevicesMsg{devices: devices, err: err}
+	}
+}
+
+// unlockFIDO2DevicesCmd finds the connected keys, in the order to try them
+// for unlocking a bottle
+func unlockFIDO2DevicesCmd(perms *Permissions) tea.Cmd {
+	return func() tea.Msg {
+		devices, err := EnumerateFIDO2Devices()
+		return fido2DevicesMsg{devices: orderFIDO2Devices(devices, perms), err: err}
+	}
+}
+
+func createFIDO2CredentialCmd(ctx context.Context, device, rpID, user, bottleID string) tea.Cmd {
+	return func() tea.Msg {
+		credID, salt, err := CreateFIDO2Credential(ctx, device, rpID, user, bottleID)
+		if errors.Is(err, context.Canceled) {
+			return taskCancelledMsg{}
+		}
+		return fido2CredentialCreatedMsg{credID: credID, salt: salt, err: err}
+	}
+}
+
+func getFIDO2SecretCmd(ctx context.Context, device, rpID, bottleID, credID, salt string) tea.Cmd {
+	return func() tea.Msg {
+		secret, err := GetFIDO2Secret(ctx, device, rpID, bottleID, credID, salt)
+		if errors.Is(err, context.Canceled) {
+			return taskCancelledMsg{}
+		}
+		return fido2SecretReadyMsg{secret: secret, err: err}
+	}
+}
+
+func createBottleYubiKeyCmd(ctx context.Context, name, size string, secret []byte, bottleID, credID, salt, rpID, user, device string) tea.Cmd {
+	return func() tea.Msg {
+		// Ensure .bottle extension
+		if filepath.Ext(name) != ".bottle" {
+			name += ".bottle"
+		}
+
+		bottlePath := filepath.Join(bottleDir, name)
+
+		err := CreateBottleWithYubiKey(ctx, bottlePath, size, secret, bottleID, credID, salt, rpID, user, device)
+		if errors.Is(err, context.Canceled) {
+			return bottleCreateCancelledMsg{}
+		}
+		if err != nil {
+			return fido2BottleCreatedMsg{err: err}
+		}
+		return fido2BottleCreatedMsg{path: bottlePath}
+	}
+}
+
+func mountBottleFIDO2Cmd(ctx context.Context, bottle, device, rpID, bottleID, credID, salt string) tea.Cmd {
+	return func() tea.Msg {
+		// Get FIDO2 secret (requires touch)
+		secret, err := GetFIDO2Secret(ctx, device, rpID, bottleID, credID, salt)
+		if errors.Is(err, context.Canceled) {
+			return taskCancelledMsg{}
+		}
+		if err != nil {
+			return fido2UnlockFailedMsg{err: err, tryNext: true}
+		}
+
+		// Mount using the secret
+		info, err := mountBottleFIDO2(ctx, bottle, secret)
+		if errors.Is(err, context.Canceled) {
+			return taskCancelledMsg{}
+		}
+		if err != nil {
+			return fido2UnlockFailedMsg{err: err, tryNext: err == errWrongYubiKey}
+		}
+		return fido2UnlockSuccessMsg{info: info}
+	}
+}
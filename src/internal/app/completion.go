@@ -0,0 +1,257 @@
+// Shell completion: bash, zsh and fish scripts, completed by bottle-launch itself.
+package app
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// completionCommands are the commands offered for the first word
+var completionCommands = []string{
+	"tui", "create", "key-drives", "run", "profiles", "list", "status", "stats", "bench", "recovery",
+	"mountpoint", "quota", "reserve", "allow", "forensics", "untrusted", "hidden", "duress", "trust",
+	"config", "audit", "mime-register", "sandbox", "flatpak-override", "secret", "verify", "sync",
+	"fido2", "migrate", "archive", "unarchive", "snapshot", "snapshots", "retention", "prune", "snapshot-timer",
+	"restore", "open", "lock", "unlock-all", "lock-all", "workspace", "daemon", "tray", "help",
+	"version", "self-update", "completion", "doctor", "install-udev-rules", "dedupe-report",
+	"clone", "watch", "gc",
+}
+
+// bottleFirstCommands take a bottle as their first argument
+var bottleFirstCommands = []string{
+	"run", "status", "stats", "bench", "recovery", "mountpoint", "quota", "reserve", "allow",
+	"forensics", "untrusted", "hidden", "duress", "trust", "audit", "mime-register", "sandbox",
+	"secret", "verify", "sync", "archive", "snapshot", "snapshots", "retention", "prune", "restore",
+	"open", "lock", "clone",
+}
+
+// completeWords returns the candidates for the last of words, the
+// arguments typed so far (without the program name)
+func completeWords(words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	current := words[len(words)-1]
+	if strings.HasPrefix(current, "-") {
+		return nil // options are listed by help
+	}
+	var args []string // positional arguments before the current one
+	for _, w := range words[:len(words)-1] {
+		if w == "--" {
+			return nil // the app's own arguments
+		}
+		if !strings.HasPrefix(w, "-") {
+			args = append(args, w)
+		}
+	}
+
+	var candidates []string
+	if len(args) == 0 {
+		candidates = completionCommands
+	} else {
+		showHidden := strings.HasPrefix(current, ".") || slices.Contains(words, "--show-hidden")
+		candidates = completeArgument(args[0], args[1:], showHidden)
+	}
+	return slices.DeleteFunc(slices.Clone(candidates), func(c string) bool {
+		return !strings.HasPrefix(c, current)
+	})
+}
+
+// completeArgument returns the candidates for a command's next argument,
+// given the arguments before it
+func completeArgument(cmd string, args []string, showHidden bool) []string {
+	n := len(args)
+	switch cmd {
+	case "config":
+		switch n {
+		case 0:
+			return []string{"get", "set"}
+		case 1:
+			return completionBottles(showHidden)
+		case 2:
+			keys := make([]string, 0, len(configSettings)+len(permissionDefs))
+			for _, def := range permissionDefs {
+				keys = append(keys, def.Config)
+			}
+			for _, s := range configSettings {
+				keys = append(keys, s.Key)
+			}
+			return keys
+		}
+	case "flatpak-override":
+		switch n {
+		case 0:
+			return []string{"export", "import"}
+		case 1:
+			return completionBottles(showHidden)
+		case 2:
+			return completionApps()
+		}
+	case "fido2":
+		switch n {
+		case 0:
+			return []string{"rotate"}
+		case 1:
+			return completionBottles(showHidden)
+		}
+	case "migrate":
+		switch {
+		case n == 0:
+			return []string{"export", "import", "reenroll"}
+		case n == 1 && args[0] != "import":
+			return completionBottles(showHidden)
+		}
+	case "unarchive":
+		if n == 0 {
+			var names []string
+			for _, a := range listArchivedBottles() {
+				names = append(names, strings.TrimSuffix(bottleName(a), archiveSuffix))
+			}
+			return names
+		}
+	case "unlock-all", "lock-all":
+		if n == 0 {
+			return completionKeyNames("BOTTLE_SET_")
+		}
+	case "workspace":
+		if n == 0 {
+			return completionKeyNames("WORKSPACE_")
+		}
+	case "dedupe-report":
+		return completionBottles(showHidden)
+	case "watch":
+		if n == 0 {
+			return []string{"--json"}
+		}
+	case "gc":
+		if n == 0 {
+			return []string{"--dry-run"}
+		}
+	case "help":
+		if n == 0 {
+			return []string{"exit-codes"}
+		}
+	case "completion":
+		if n == 0 {
+			return []string{"bash", "zsh", "fish"}
+		}
+	}
+
+	if !slices.Contains(bottleFirstCommands, cmd) {
+		return nil
+	}
+	if n == 0 {
+		if cmd == "run" {
+			candidates := completionBottles(showHidden)
+			for _, p := range listProfiles() {
+				candidates = append(candidates, "@"+p.Name)
+			}
+			return candidates
+		}
+		return completionBottles(showHidden)
+	}
+	if n == 1 && !strings.HasPrefix(args[0], "@") {
+		switch cmd {
+		case "run", "sandbox", "mime-register", "allow":
+			return completionApps()
+		case "forensics", "untrusted", "hidden":
+			return []string{"on", "off"}
+		case "restore":
+			var names []string
+			for _, s := range listSnapshots(resolveBottlePath(args[0])) {
+				names = append(names, s.Name())
+			}
+			return names
+		}
+	}
+	if n > 1 && cmd == "allow" {
+		return completionApps()
+	}
+	return nil
+}
+
+// completionBottles returns the names of the bottles, hidden ones only if
+// showHidden is set
+func completionBottles(showHidden bool) []string {
+	var names []string
+	for _, b := range listBottles() {
+		if !showHidden && completionHidden(b) {
+			continue
+		}
+		names = append(names, bottleName(b))
+	}
+	return names
+}
+
+// completionHidden reports whether a bottle is hidden, from its config as
+// it is: checking its signature could ask for the keyring on every TAB
+func completionHidden(bottle string) bool {
+	return isHiddenBottle(bottle, readPermissions(getConfigPath(bottle)))
+}
+
+// completionApps returns the IDs of the installed Flatpak apps
+func completionApps() []string {
+	var ids []string
+	for _, app := range listFlatpakApps() {
+		if !slices.Contains(ids, app.ID) {
+			ids = append(ids, app.ID)
+		}
+	}
+	return ids
+}
+
+// completionKeyNames returns the names of the global config keys with a
+// prefix, such as the sets of BOTTLE_SET_<NAME>
+func completionKeyNames(prefix string) []string {
+	var names []string
+	for _, key := range globalConfig.KeysWithPrefix(prefix) {
+		names = append(names, strings.ToLower(strings.TrimPrefix(key, prefix)))
+	}
+	return names
+}
+
+const bashCompletion = `# bash completion for bottle-launch
+_bottle_launch() {
+    local IFS=$'\n'
+    COMPREPLY=($(bottle-launch __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -o filenames -F _bottle_launch bottle-launch
+`
+
+const zshCompletion = `#compdef bottle-launch
+# zsh completion for bottle-launch
+_bottle_launch() {
+    local -a candidates
+    candidates=(${(f)"$(bottle-launch __complete "${(@)words[2,CURRENT]}" 2>/dev/null)"})
+    if (( ${#candidates} )); then
+        compadd -a candidates
+    else
+        _files
+    fi
+}
+compdef _bottle_launch bottle-launch
+`
+
+const fishCompletion = `# fish completion for bottle-launch
+function __bottle_launch_complete
+    set -l words (commandline -opc) (commandline -ct)
+    bottle-launch __complete $words[2..-1] 2>/dev/null
+end
+complete -c bottle-launch -a '(__bottle_launch_complete)'
+`
+
+// cmdCompletion prints the completion script for a shell
+func cmdCompletion(shell string) error {
+	switch shell {
+	case "bash":
+		fmt.Print(bashCompletion)
+	case "zsh":
+		fmt.Print(zshCompletion)
+	case "fish":
+		fmt.Print(fishCompletion)
+	default:
+		return &bottleError{op: "usage", msg: "bottle-launch completion bash|zsh|fish"}
+	}
+	return nil
+}
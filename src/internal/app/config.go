@@ -0,0 +1,94 @@
+// Global configuration: user-wide settings shared by all bottles.
+package app
+
+import (
+	"bufio"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GlobalConfig holds settings from the global config file.
+// The file uses the same KEY=VALUE format as per-bottle configs.
+type GlobalConfig struct {
+	values map[string]string
+}
+
+// globalConfig is loaded once at startup (see init in bottle.go)
+var globalConfig = &GlobalConfig{values: map[string]string{}}
+
+// loadGlobalConfig reads the global config file.
+// A missing or unreadable file yields an empty config (all defaults).
+func loadGlobalConfig(path string) *GlobalConfig {
+	c := &GlobalConfig{values: map[string]string{}}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return c
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		key := strings.TrimSpace(parts[0])
+		val := strings.Trim(strings.TrimSpace(parts[1]), `"`)
+		c.values[key] = val
+	}
+
+	return c
+}
+
+// Get returns the raw value for key, or "" if unset
+func (c *GlobalConfig) Get(key string) string {
+	return c.values[key]
+}
+
+// GetDefault returns the value for key, or def if unset
+func (c *GlobalConfig) GetDefault(key, def string) string {
+	if v, ok := c.values[key]; ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// GetInt returns the integer value for key, or def if unset or invalid
+func (c *GlobalConfig) GetInt(key string, def int) int {
+	if v, err := strconv.Atoi(c.values[key]); err == nil {
+		return v
+	}
+	return def
+}
+
+// KeysWithPrefix returns the keys starting with prefix, sorted
+func (c *GlobalConfig) KeysWithPrefix(prefix string) []string {
+	var keys []string
+	for k := range c.values {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GetList returns a comma-separated value split into trimmed, non-empty items
+func (c *GlobalConfig) GetList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(c.values[key], ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,190 @@
+// Config command: reading and changing a bottle's settings from scripts.
+package app
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// configSetting is a key `config set` accepts, and how its value is checked
+type configSetting struct {
+	Key  string
+	Kind string // bool, int, percent, size, duration, string, list, dns, hosts
+}
+
+var configSettings = []configSetting{
+	{"PREF_DEFAULT_APP", "string"},
+	{"PREF_ALLOWED_APPS", "list"},
+	{"PREF_TIMEOUT", "duration"},
+	{"PREF_DNS", "dns"},
+	{"PREF_HOSTS", "hosts"},
+	{"PREF_QUOTA", "size"},
+	{"PREF_GROW_BY", "size"},
+	{"PREF_GROW_AT", "percent"},
+	{"PREF_GROW_MAX", "size"},
+	{"PREF_GROW_PAUSED", "bool"},
+	{"PREF_SNAPSHOT_KEEP_LAST", "int"},
+	{"PREF_SNAPSHOT_KEEP_DAILY", "int"},
+	{"PREF_SNAPSHOT_KEEP_WEEKLY", "int"},
+	{"PREF_FORENSICS", "bool"},
+	{"PREF_UNTRUSTED", "bool"},
+	{"PREF_HIDDEN", "bool"},
+	{"PREF_OVERLAY", "bool"},
+	{"PREF_DESCRIPTION", "string"},
+}
+
+// findConfigSetting returns the settable key, permissions included
+func findConfigSetting(key string) (configSetting, bool) {
+	for _, def := range permissionDefs {
+		if def.Config == key {
+			return configSetting{key, "bool"}, true
+		}
+	}
+	i := slices.IndexFunc(configSettings, func(s configSetting) bool { return s.Key == key })
+	if i < 0 {
+		return configSetting{}, false
+	}
+	return configSettings[i], true
+}
+
+// configValue checks a value for a setting and returns it as written in
+// the config
+func configValue(s configSetting, value string) (string, error) {
+	bad := func(want string) error {
+		return &bottleError{op: "config", msg: s.Key + " takes " + want + ", got " + strconv.Quote(value), usage: true}
+	}
+	switch s.Kind {
+	case "bool":
+		switch strings.ToLower(value) {
+		case "1", "true", "on", "yes":
+			return "1", nil
+		case "0", "false", "off", "no":
+			return "0", nil
+		}
+		return "", bad("1 or 0")
+	case "int":
+		if n, err := strconv.Atoi(value); err != nil || n < 0 {
+			return "", bad("a whole number")
+		}
+	case "percent":
+		if n, err := strconv.Atoi(value); err != nil || n < 0 || n > 100 {
+			return "", bad("a percentage from 0 to 100")
+		}
+	case "size":
+		if value == "" || value == "0" {
+			return "0", nil
+		}
+		n, err := parseSize(value)
+		if err != nil {
+			return "", bad("a size such as 8G")
+		}
+		return strconv.FormatInt(n, 10), nil
+	case "duration":
+		d, err := parseTimeout(value)
+		if err != nil {
+			return "", bad("a duration such as 2h or 90m")
+		}
+		return d.String(), nil
+	case "dns":
+		if _, err := parseDNSServers(value); err != nil {
+			return "", badArgument("config", err)
+		}
+	case "hosts":
+		if _, err := parseHostsEntries(value); err != nil {
+			return "", badArgument("config", err)
+		}
+	}
+	if s.Kind != "int" && s.Kind != "percent" {
+		return strconv.Quote(value), nil
+	}
+	return value, nil
+}
+
+// configGet prints one key of a bottle's config, or the whole config
+func configGet(bottle, key string) error {
+	bottle = resolveBottlePath(bottle)
+	if _, err := os.Stat(bottle); err != nil {
+		return errBottleNotFound
+	}
+	lines := permissionLines(loadPermissions(getConfigPath(bottle)))
+	if key == "" {
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+		return nil
+	}
+	for _, line := range lines {
+		if k, val, _ := strings.Cut(line, "="); k == key {
+			if unquoted, err := strconv.Unquote(val); err == nil {
+				val = unquoted
+			}
+			fmt.Println(val)
+			return nil
+		}
+	}
+	if _, ok := findConfigSetting(key); ok {
+		fmt.Println() // a setting that isn't set
+		return nil
+	}
+	return &bottleError{op: "config", msg: "no key " + key + " in the config of " + bottleName(bottle)}
+}
+
+// configSet changes one setting of a bottle's config
+func configSet(bottle, key, value string) error {
+	bottle = resolveBottlePath(bottle)
+	if _, err := os.Stat(bottle); err != nil {
+		return errBottleNotFound
+	}
+	s, ok := findConfigSetting(key)
+	if !ok {
+		return &bottleError{op: "config", msg: key + " can't be set with config set - see bottle-launch help", usage: true}
+	}
+	written, err := configValue(s, value)
+	if err != nil {
+		return err
+	}
+
+	// Replace the line and read the config back, so the value is parsed
+	// exactly as it will be at load
+	configPath := getConfigPath(bottle)
+	perms := loadPermissions(configPath)
+	lines := slices.DeleteFunc(permissionLines(perms), func(line string) bool {
+		return strings.HasPrefix(line, key+"=")
+	})
+	lines = append(lines, key+"="+written)
+	updated := parsePermissions([]byte(strings.Join(lines, "\n")))
+	updated.Tampered = perms.Tampered
+	return savePermissions(configPath, updated)
+}
+
+// cmdConfig runs `config get` and `config set`
+func cmdConfig(args []string) error {
+	usage := &bottleError{op: "usage", msg: "bottle-launch config get <bottle> [KEY] | set <bottle> KEY VALUE"}
+	if len(args) < 2 {
+		return usage
+	}
+	switch args[0] {
+	case "get":
+		switch len(args) {
+		case 2:
+			return configGet(args[1], "")
+		case 3:
+			return configGet(args[1], args[2])
+		}
+		return usage
+	case "set":
+		// KEY VALUE or KEY=VALUE
+		if len(args) == 3 && strings.Contains(args[2], "=") {
+			key, value, _ := strings.Cut(args[2], "=")
+			return configSet(args[1], key, value)
+		}
+		if len(args) != 4 {
+			return usage
+		}
+		return configSet(args[1], args[2], args[3])
+	}
+	return usage
+}
@@ -0,0 +1,80 @@
+// Tests for config set: which keys it takes and how values are checked.
+package app
+
+import "testing"
+
+func TestFindConfigSetting(t *testing.T) {
+	tests := []struct {
+		key  string
+		kind string // "" = not settable
+	}{
+		{"PREF_NETWORK", "bool"}, // a permission
+		{"PREF_QUOTA", "size"},
+		{"PREF_TIMEOUT", "duration"},
+		{"PREF_SNAPSHOT_KEEP_DAILY", "int"},
+		// State kept by bottle-launch itself
+		{"PREF_LAST_APP", ""},
+		{"PREF_LAST_UNLOCK_AT", ""},
+		{"PREF_LOCKED_SIZE", ""},
+		{"pref_network", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		s, ok := findConfigSetting(tt.key)
+		if ok != (tt.kind != "") || s.Kind != tt.kind {
+			t.Errorf("findConfigSetting(%q) = %q, %v, want %q", tt.key, s.Kind, ok, tt.kind)
+		}
+	}
+}
+
+func TestConfigValue(t *testing.T) {
+	tests := []struct {
+		kind  string
+		value string
+		want  string // as written in the config; "" = rejected
+	}{
+		{"bool", "1", "1"},
+		{"bool", "Yes", "1"},
+		{"bool", "off", "0"},
+		{"bool", "maybe", ""},
+		{"bool", "", ""},
+		{"int", "7", "7"},
+		{"int", "0", "0"},
+		{"int", "-1", ""},
+		{"int", "seven", ""},
+		{"percent", "90", "90"},
+		{"percent", "100", "100"},
+		{"percent", "101", ""},
+		{"size", "8G", "8589934592"},
+		{"size", "512M", "536870912"},
+		{"size", "0", "0"},
+		{"size", "", "0"},
+		{"size", "lots", ""},
+		{"size", "-1G", ""},
+		{"duration", "90m", "1h30m0s"},
+		{"duration", "0", "0s"},
+		{"duration", "soon", ""},
+		{"duration", "-5m", ""},
+		{"string", "Work stuff", `"Work stuff"`},
+		{"string", `say "hi"`, `"say \"hi\""`},
+		{"list", "org.mozilla.firefox,org.gnome.Evince", `"org.mozilla.firefox,org.gnome.Evince"`},
+		{"dns", "1.1.1.1, 9.9.9.9", `"1.1.1.1, 9.9.9.9"`},
+		{"dns", "dns.example", ""},
+		{"hosts", "10.0.0.2 nas, 10.0.0.3 printer", `"10.0.0.2 nas, 10.0.0.3 printer"`},
+		{"hosts", "nas", ""},
+	}
+	for _, tt := range tests {
+		got, err := configValue(configSetting{Key: "PREF_TEST", Kind: tt.kind}, tt.value)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("configValue(%s, %q) = %q, want an error", tt.kind, tt.value, got)
+			} else if class := classifyError(err); class != classUsage {
+				t.Errorf("configValue(%s, %q) error is %s, want %s", tt.kind, tt.value, class.Name, classUsage.Name)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("configValue(%s, %q) = %q, %v, want %q", tt.kind, tt.value, got, err, tt.want)
+		}
+	}
+}
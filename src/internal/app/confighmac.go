@@ -0,0 +1,254 @@
+// Config signing: an HMAC over each bottle config, so changes made outside bottle-launch are noticed.
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/x/term"
+)
+
+// configHMACKey starts a config's last line: the HMAC of the lines above,
+// keyed by a secret in the keyring
+const configHMACKey = "CONFIG_HMAC="
+
+// secret-tool attributes of the signing key
+var configKeyAttrs = []string{"application", "bottle-launch", "key", "config-hmac"}
+
+var configKey struct {
+	once    sync.Once
+	key     []byte // nil if unavailable
+	unknown bool   // configs are signed but the key can't be read: trust none
+	missing bool   // the keyring has no key at all, so trust may create one
+}
+
+// errConfigKeyUnreadable is returned when the signing key exists but can't
+// be read, e.g. because the keyring is locked
+var errConfigKeyUnreadable = &bottleError{op: "config", msg: "the config signing key can't be read - unlock the keyring and try again"}
+
+// mockConfigKeyPath is where mock mode keeps the signing key
+func mockConfigKeyPath() string {
+	return filepath.Join(lockDir(), "mock", "config-hmac.key")
+}
+
+// configSigningKey returns the signing key, creating it only while no config
+// is signed yet (nil if there is no keyring to keep it in, or it can't be read)
+func configSigningKey() []byte {
+	created := false
+	configKey.once.Do(func() {
+		stored, err := readConfigKey()
+		if err == nil {
+			if key, decodeErr := hex.DecodeString(stored); decodeErr == nil && len(key) > 0 {
+				configKey.key = key
+				return
+			}
+			err = errConfigKeyUnreadable
+		}
+		signed := anyConfigSigned()
+		configKey.missing = err == errSecretNotFound
+		if configKey.missing && !signed {
+			configKey.key = createConfigKey()
+			created = configKey.key != nil
+			return
+		}
+		// No keyring and nothing signed: configs aren't checked. Otherwise
+		// the key is locked away or gone, and no config can be trusted.
+		configKey.unknown = signed
+	})
+	if created {
+		// Sign what is there now (outside once.Do, which savePermissions needs)
+		paths, _ := filepath.Glob(filepath.Join(configDir, "*.conf"))
+		for _, path := range paths {
+			p := loadPermissions(path)
+			p.Tampered = false
+			_ = savePermissions(path, p)
+		}
+	}
+	return configKey.key
+}
+
+// readConfigKey returns the stored signing key, or errSecretNotFound only
+// when the keyring definitely has none
+func readConfigKey() (string, error) {
+	if mockMode {
+		data, err := os.ReadFile(mockConfigKeyPath())
+		if os.IsNotExist(err) {
+			return "", errSecretNotFound
+		}
+		return strings.TrimSpace(string(data)), err
+	}
+	ref := &secretRef{Kind: secretServiceRef, Attrs: configKeyAttrs}
+	stored, err := lookupSecret(context.Background(), ref, "")
+	if err != errSecretNotFound {
+		return stored, err
+	}
+	// secret-tool lookup exits 1 silently for a locked keyring and a
+	// dismissed unlock prompt too, so ask whether the entry exists at all
+	if exists, searchErr := secretServiceHasItem(context.Background(), configKeyAttrs); searchErr != nil || exists {
+		return "", errConfigKeyUnreadable
+	}
+	return "", errSecretNotFound
+}
+
+// anyConfigSigned reports whether some bottle config already carries an HMAC
+func anyConfigSigned() bool {
+	paths, _ := filepath.Glob(filepath.Join(configDir, "*.conf"))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if bytes.HasPrefix(data, []byte(configHMACKey)) || bytes.Contains(data, []byte("\n"+configHMACKey)) {
+			return true
+		}
+	}
+	return false
+}
+
+// createConfigKey generates and stores a new signing key
+func createConfigKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil
+	}
+	encoded := hex.EncodeToString(key)
+	if mockMode {
+		os.MkdirAll(filepath.Dir(mockConfigKeyPath()), 0700)
+		if os.WriteFile(mockConfigKeyPath(), []byte(encoded+"\n"), 0600) != nil {
+			return nil
+		}
+	} else {
+		cmd := command("secret-tool", append([]string{"store", "--label=bottle-launch config signing key"}, configKeyAttrs...)...)
+		cmd.Stdin = strings.NewReader(encoded)
+		if cmd.Run() != nil {
+			return nil
+		}
+	}
+	return key
+}
+
+// configMAC returns the HMAC of a config's contents, bound to its file name
+// so configs can't be swapped between bottles
+func configMAC(key []byte, path string, content []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(filepath.Base(path) + "\n"))
+	mac.Write(content)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signConfig returns the CONFIG_HMAC line for a config's contents ("" if
+// there is no key)
+func signConfig(path string, content []byte) string {
+	key := configSigningKey()
+	if key == nil {
+		return ""
+	}
+	return configHMACKey + configMAC(key, path, content)
+}
+
+// configTampered reports whether a config's HMAC is missing or doesn't match,
+// or can't be checked because the signing key is unreadable
+func configTampered(path string, data []byte) bool {
+	key := configSigningKey()
+	if key == nil {
+		return configKey.unknown
+	}
+	i := bytes.LastIndex(data, []byte(configHMACKey))
+	if i < 0 || (i > 0 && data[i-1] != '\n') {
+		return true
+	}
+	mac := strings.TrimSpace(string(data[i+len(configHMACKey):]))
+	return !hmac.Equal([]byte(mac), []byte(configMAC(key, path, data[:i])))
+}
+
+// configLines returns a config's settings for review, without its HMAC
+func configLines(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" && !strings.HasPrefix(line, configHMACKey) {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// trustConfig accepts a config as it is now by signing it again. If the
+// keyring lost the signing key, a new one is created for it; the other
+// configs then stay Tampered until they are trusted too.
+func trustConfig(path string) error {
+	if configSigningKey() == nil && configKey.unknown {
+		if !configKey.missing {
+			return errConfigKeyUnreadable
+		}
+		if configKey.key = createConfigKey(); configKey.key == nil {
+			return &bottleError{op: "config", msg: "could not store a new config signing key"}
+		}
+		configKey.unknown, configKey.missing = false, false
+	}
+	p := loadPermissions(path)
+	p.Tampered = false
+	return savePermissions(path, p)
+}
+
+// errConfigTampered is returned by the CLI for a config changed outside
+// bottle-launch
+func errConfigTampered(bottle string) error {
+	return &bottleError{op: "config", msg: "the config of " + bottleName(bottle) + " was changed outside bottle-launch - review it with `bottle-launch trust " + bottleName(bottle) + "`", class: classConfigChanged}
+}
+
+// cmdTrust shows a bottle's config and, if confirmed, accepts it
+func cmdTrust(bottle string, yes bool) error {
+	bottle = resolveBottlePath(bottle)
+	configPath := getConfigPath(bottle)
+	if _, err := os.Stat(configPath); err != nil {
+		return &bottleError{op: "trust", msg: bottleName(bottle) + " has no config"}
+	}
+	if configSigningKey() == nil && !configKey.unknown {
+		return &bottleError{op: "trust", msg: "no keyring to keep the signing key in - configs aren't checked"}
+	}
+	if configKey.unknown && !configKey.missing {
+		return errConfigKeyUnreadable
+	}
+	if !loadPermissions(configPath).Tampered {
+		fmt.Println(bottleName(bottle) + ": config unchanged")
+		return nil
+	}
+
+	fmt.Println("The config of " + bottleName(bottle) + " was changed outside bottle-launch:")
+	fmt.Println()
+	for _, line := range configLines(configPath) {
+		fmt.Println("  " + line)
+	}
+	fmt.Println()
+	if !yes {
+		if !term.IsTerminal(os.Stdin.Fd()) {
+			return &bottleError{op: "trust", msg: "confirm on a terminal, or pass --yes"}
+		}
+		fmt.Print("Trust these settings? [y/N] ")
+		var answer string
+		fmt.Scanln(&answer)
+		if !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+			return &bottleError{op: "trust", msg: "not trusted; the config stays blocked"}
+		}
+	}
+	if err := trustConfig(configPath); err != nil {
+		return err
+	}
+	fmt.Println("Trusted.")
+	return nil
+}
@@ -0,0 +1,150 @@
+// Tests for config signing: HMAC checks and the signing key on first use.
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// resetConfigKey forgets the signing key, so the next use looks it up
+// again, and does the same once the test is over
+func resetConfigKey(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		configKey.once = sync.Once{}
+		configKey.key, configKey.unknown, configKey.missing = nil, false, false
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+// useConfigKey makes key the signing key, unknown or not
+func useConfigKey(t *testing.T, key []byte, unknown bool) {
+	t.Helper()
+	resetConfigKey(t)
+	configKey.once.Do(func() {})
+	configKey.key, configKey.unknown = key, unknown
+}
+
+func TestConfigMAC(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	content := []byte("PREF_NETWORK=off\n")
+	mac := configMAC(key, "/c/aaaa.conf", content)
+	if len(mac) != 64 {
+		t.Errorf("configMAC() = %q, want 64 hex digits", mac)
+	}
+	tests := []struct {
+		name    string
+		key     []byte
+		path    string
+		content []byte
+		same    bool
+	}{
+		{"same config", key, "/c/aaaa.conf", content, true},
+		{"other directory", key, "/elsewhere/aaaa.conf", content, true},
+		{"other file name", key, "/c/bbbb.conf", content, false},
+		{"other content", key, "/c/aaaa.conf", []byte("PREF_NETWORK=on\n"), false},
+		{"other key", []byte("fedcba9876543210fedcba9876543210"), "/c/aaaa.conf", content, false},
+	}
+	for _, tt := range tests {
+		if got := configMAC(tt.key, tt.path, tt.content) == mac; got != tt.same {
+			t.Errorf("%s: MAC matches = %v, want %v", tt.name, got, tt.same)
+		}
+	}
+}
+
+func TestConfigTampered(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	path := "/c/aaaa.conf"
+	body := "PREF_NETWORK=off\nPREF_AUDIO=on\n"
+	signed := body + configHMACKey + configMAC(key, path, []byte(body)) + "\n"
+	tests := []struct {
+		name     string
+		key      []byte
+		unknown  bool
+		path     string
+		data     string
+		tampered bool
+	}{
+		{"signed", key, false, path, signed, false},
+		{"no trailing newline", key, false, path, strings.TrimSuffix(signed, "\n"), false},
+		{"setting changed", key, false, path, strings.Replace(signed, "NETWORK=off", "NETWORK=on", 1), true},
+		{"setting added", key, false, path, "PREF_GPU=on\n" + signed, true},
+		{"setting after the MAC", key, false, path, signed + "PREF_GPU=on\n", true},
+		{"missing MAC", key, false, path, body, true},
+		{"empty MAC", key, false, path, body + configHMACKey + "\n", true},
+		{"MAC not on its own line", key, false, path, "PREF_X=" + signed[len(body):], true},
+		{"moved to another bottle", key, false, "/c/bbbb.conf", signed, true},
+		{"other key", []byte("fedcba9876543210fedcba9876543210"), false, path, signed, true},
+		// Without a key
+		{"no keyring", nil, false, path, body, false},
+		{"key unreadable", nil, true, path, signed, true},
+	}
+	for _, tt := range tests {
+		useConfigKey(t, tt.key, tt.unknown)
+		if got := configTampered(tt.path, []byte(tt.data)); got != tt.tampered {
+			t.Errorf("%s: configTampered() = %v, want %v", tt.name, got, tt.tampered)
+		}
+	}
+}
+
+// mockConfigSandbox points config and runtime dirs at a fresh mock sandbox
+func mockConfigSandbox(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", filepath.Join(dir, "run"))
+	wasMock, oldConfig := mockMode, configDir
+	t.Cleanup(func() { mockMode, configDir = wasMock, oldConfig })
+	mockMode = true
+	configDir = filepath.Join(dir, "config")
+	if err := os.MkdirAll(configDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	resetConfigKey(t)
+}
+
+func TestConfigSigningKeyFirstUse(t *testing.T) {
+	mockConfigSandbox(t)
+	path := filepath.Join(configDir, "aaaa.conf")
+	if err := os.WriteFile(path, []byte("PREF_NETWORK=off\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Nothing signed and no key: one is created and the config signed
+	if configSigningKey() == nil {
+		t.Fatal("configSigningKey() = nil on first use")
+	}
+	if _, err := os.Stat(mockConfigKeyPath()); err != nil {
+		t.Errorf("signing key not stored: %v", err)
+	}
+	if data, _ := os.ReadFile(path); configTampered(path, data) {
+		t.Errorf("config not signed on first use:\n%s", data)
+	}
+}
+
+func TestConfigSigningKeyLost(t *testing.T) {
+	mockConfigSandbox(t)
+	path := filepath.Join(configDir, "aaaa.conf")
+	if err := os.WriteFile(path, []byte("PREF_NETWORK=off\n"+configHMACKey+"00\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// A config is signed but the key is gone: nothing is re-signed
+	if configSigningKey() != nil {
+		t.Error("configSigningKey() created a key although configs are signed")
+	}
+	if _, err := os.Stat(mockConfigKeyPath()); !os.IsNotExist(err) {
+		t.Errorf("signing key stored: %v", err)
+	}
+	if data, _ := os.ReadFile(path); !configTampered(path, data) {
+		t.Error("config trusted without a signing key")
+	}
+	// trust creates a new key and signs just that config
+	if err := trustConfig(path); err != nil {
+		t.Fatalf("trustConfig() = %v", err)
+	}
+	if data, _ := os.ReadFile(path); configTampered(path, data) {
+		t.Errorf("config still tampered after trust:\n%s", data)
+	}
+}
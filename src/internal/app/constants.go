@@ -0,0 +1,88 @@
+// Package app implements bottle-launch, a TUI/CLI application for launching
+// Flatpak applications with data stored in encrypted LUKS2 containers.
+package app
+
+import "time"
+
+const (
+	// ExitSIGINT is the exit code when terminated by SIGINT (128 + signal number per POSIX).
+	ExitSIGINT = 130
+
+	// ExitStatusUnlocked, ExitStatusLocked, and ExitStatusMissing are the exit
+	// codes of `status` for a bottle that is not mounted (0 means mounted).
+	ExitStatusUnlocked = 3
+	ExitStatusLocked   = 4
+	ExitStatusMissing  = 5
+
+	// Exit codes of the other commands, one per kind of failure (see
+	// `bottle-launch help exit-codes`). They don't overlap with status's.
+	ExitError         = 1  // anything not listed below
+	ExitUsage         = 2  // bad arguments
+	ExitWrongPassword = 10 // the password, or key file, didn't unlock the bottle
+	ExitNotFound      = 11 // no such bottle, profile, or file
+	ExitInUse         = 12 // the bottle is mounted or in use by another session
+	ExitMissingTool   = 13 // udisks2, cryptsetup, flatpak, or libfido2 is missing
+	ExitFIDO2         = 14 // no security key, or the wrong one
+	ExitAppFailed     = 15 // the app exited with an error or crashed
+	ExitConfigChanged = 16 // the bottle's config was changed outside bottle-launch
+
+	// UnmountReleaseWait is how long locking keeps trying after an unmount,
+	// while the kernel releases the device.
+	UnmountReleaseWait = 2 * time.Second
+
+	// UnmountRetryDelay is the longest wait between lock attempts; a change
+	// to the device retries sooner.
+	UnmountRetryDelay = 500 * time.Millisecond
+
+	// BusyKillGrace is how long processes holding a busy bottle get to exit
+	// after SIGTERM before they are killed.
+	BusyKillGrace = 3 * time.Second
+
+	// RunningStatsInterval is how often the running view refreshes the app's
+	// CPU and memory use and the bottle's free space.
+	RunningStatsInterval = 3 * time.Second
+
+	// TrayRefreshInterval is how often the tray icon checks which bottles are open.
+	TrayRefreshInterval = 5 * time.Second
+
+	// DaemonSessionKeep is how long the daemon remembers how a session's app
+	// exited, for clients that wait for it after it is gone.
+	DaemonSessionKeep = time.Minute
+
+	// DefaultLowSpacePercent is the free space, in percent of the bottle, under
+	// which launching an app warns first (LOW_SPACE_PERCENT in the global config).
+	DefaultLowSpacePercent = 5
+
+	// DefaultGrowAtPercent is how full a bottle with a growth policy gets
+	// before it grows at mount.
+	DefaultGrowAtPercent = 90
+
+	// SessionWarningLead is how long before a session time limit the user is warned.
+	SessionWarningLead = 5 * time.Minute
+
+	// SessionKillGrace is how long an app gets to exit after SIGTERM at the time limit.
+	SessionKillGrace = 10 * time.Second
+
+	// LockSessionWait is how long `lock` waits for the sessions using a bottle
+	// to close their apps and unmount before killing them.
+	LockSessionWait = SessionKillGrace + 10*time.Second
+
+	// DefaultFIDO2RPID is the relying party ID for FIDO2 credential creation.
+	DefaultFIDO2RPID = "bottle-launch"
+
+	// DefaultFIDO2User is the user name for FIDO2 credential creation.
+	DefaultFIDO2User = "bottle-user"
+
+	// DefaultFIDO2TouchTimeout is how long each FIDO2 assertion waits for touch.
+	DefaultFIDO2TouchTimeout = 30 * time.Second
+
+	// DefaultFIDO2Retries is how many more assertions follow a missed touch.
+	DefaultFIDO2Retries = 1
+
+	// FIDO2ProbeTimeout bounds asking a key whether it holds a credential.
+	FIDO2ProbeTimeout = 5 * time.Second
+
+	// CancelWaitDelay is how long a cancelled command's output is waited for
+	// after it was stopped, in case a child it left behind holds it open.
+	CancelWaitDelay = 2 * time.Second
+)
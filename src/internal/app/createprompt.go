@@ -0,0 +1,237 @@
+// Interactive create: plain terminal prompts for `create` run without all of its arguments.
+package app
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/x/term"
+)
+
+// promptReader reads answers to the prompts from stdin
+var promptReader = bufio.NewReader(os.Stdin)
+
+// promptLine asks a question and returns the trimmed answer, or def if it
+// is empty
+func promptLine(prompt, def string) (string, error) {
+	fmt.Print(prompt)
+	line, err := promptReader.ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Println()
+		return "", &bottleError{op: "create", msg: "cancelled"}
+	}
+	if line = strings.TrimSpace(line); line != "" {
+		return line, nil
+	}
+	return def, nil
+}
+
+// newBottlePath turns a bottle name into the path `create` will use
+func newBottlePath(bottle string) string {
+	if !strings.HasSuffix(bottle, ".bottle") {
+		bottle += ".bottle"
+	}
+	if !strings.Contains(bottle, string(os.PathSeparator)) {
+		bottle = filepath.Join(bottleDir, bottle)
+	}
+	return bottle
+}
+
+// cmdCreateInteractive asks for whatever `create` wasn't given, then
+// creates the bottle
+func cmdCreateInteractive(ctx context.Context, backend, bottle, size string) error {
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		return &bottleError{op: "create", msg: "no terminal to ask on - pass the bottle and its size"}
+	}
+	b, err := getBackend(backend)
+	if err != nil {
+		return err
+	}
+
+	for bottle == "" {
+		if bottle, err = promptLine("Bottle name: ", ""); err != nil {
+			return err
+		}
+		if _, statErr := os.Lstat(newBottlePath(bottle)); bottle != "" && statErr == nil {
+			fmt.Println("  " + bottleName(newBottlePath(bottle)) + " already exists")
+			bottle = ""
+		}
+	}
+
+	for backend == BackendSquashfs && size == "" {
+		if size, err = promptLine("Directory to pack: ", ""); err != nil {
+			return err
+		}
+		if fi, statErr := os.Stat(size); size != "" && (statErr != nil || !fi.IsDir()) {
+			fmt.Println("  " + size + " is not a directory")
+			size = ""
+		}
+	}
+	if backend == BackendSquashfs {
+		if !squashfsEncrypt {
+			answer, err := promptLine("Encrypt it? [y/N] ", "n")
+			if err != nil {
+				return err
+			}
+			squashfsEncrypt = strings.EqualFold(answer, "y") || strings.EqualFold(answer, "yes")
+		}
+		if !squashfsEncrypt {
+			if err := b.Create(ctx, bottle, size, ""); err != nil {
+				return err
+			}
+			say("Created " + bottleName(newBottlePath(bottle)) + ".")
+			return nil
+		}
+	}
+
+	for backend == BackendLUKS && size == "" {
+		if size, err = promptLine("Size (e.g. 750M, 3.5G; default 2G): ", "2G"); err != nil {
+			return err
+		}
+		if strings.HasPrefix(size, "/dev/") {
+			break // a block device; its size is the device's
+		}
+		bytes, sizeErr := validateBottleSize(size)
+		if sizeErr != nil {
+			fmt.Println("  " + sizeErr.Error())
+			size = ""
+		} else if free, err := hostFreeSpace(bottleDir); err == nil && bytes > free {
+			fmt.Println("  Warning: only " + formatSize(free) + " free on the host filesystem; the bottle fills up gradually")
+		}
+	}
+
+	if backend == BackendLUKS && !integrity {
+		answer, err := promptLine("Detect tampering (LUKS2 integrity: much slower writes, takes the whole size now)? [y/N] ", "n")
+		if err != nil {
+			return err
+		}
+		integrity = strings.EqualFold(answer, "y") || strings.EqualFold(answer, "yes")
+	}
+
+	for backend == BackendLUKS && !strings.HasPrefix(size, "/dev/") {
+		method, err := promptLine("Unlock with a password or a YubiKey? [P/y] ", "p")
+		if err != nil {
+			return err
+		}
+		method = strings.ToLower(method)
+		if method == "y" || method == "yubikey" {
+			return createFIDO2BottleCLI(ctx, bottle, size, "")
+		}
+		if method == "p" || method == "password" {
+			break
+		}
+	}
+
+	password, err := promptNewPassword()
+	if err != nil {
+		return err
+	}
+	if err := b.Create(ctx, bottle, size, password); err != nil {
+		return err
+	}
+	say("Created " + bottleName(newBottlePath(bottle)) + ".")
+	return nil
+}
+
+// promptNewPassword asks for a new bottle password twice, showing its
+// strength, until both match
+func promptNewPassword() (string, error) {
+	if p, err := generatePassphrase(); err == nil {
+		fmt.Println("Suggestion: " + p)
+	}
+	for {
+		fmt.Print("Encryption password: ")
+		password, err := term.ReadPassword(os.Stdin.Fd())
+		fmt.Println()
+		if err != nil {
+			return "", err
+		}
+		if len(password) == 0 {
+			continue
+		}
+		fmt.Println("  " + passwordStrength(string(password)))
+		fmt.Print("Confirm password: ")
+		confirm, err := term.ReadPassword(os.Stdin.Fd())
+		fmt.Println()
+		if err != nil {
+			return "", err
+		}
+		if string(confirm) == string(password) {
+			return string(password), nil
+		}
+		fmt.Println("  " + errPasswordMismatch.Error())
+	}
+}
+
+// createFIDO2BottleCLI creates a YubiKey bottle from the terminal, on the
+// given FIDO2 device or the only (or chosen) one connected
+func createFIDO2BottleCLI(ctx context.Context, bottle, size, device string) error {
+	if err := CheckFIDO2Available(); err != nil {
+		return err
+	}
+	if err := CheckPrivilegeEscalation(); err != nil {
+		return err
+	}
+	bottle = newBottlePath(bottle)
+	if _, err := os.Lstat(bottle); err == nil {
+		return errBottleExists
+	}
+	if _, err := validateBottleSize(size); err != nil {
+		return err
+	}
+
+	if device == "" {
+		devices, err := EnumerateFIDO2Devices()
+		if err != nil {
+			return err
+		}
+		switch {
+		case len(devices) == 0:
+			return errNoFIDO2Device
+		case len(devices) == 1:
+			device = devices[0].Path
+		case !term.IsTerminal(os.Stdin.Fd()):
+			return &bottleError{op: "fido2", msg: "several security keys are connected - pick one with --device", class: classFIDO2}
+		default:
+			for i, dev := range devices {
+				fmt.Printf("  %d) %s (%s)\n", i+1, dev.Description, dev.Path)
+			}
+			for device == "" {
+				answer, err := promptLine("Which key? ", "1")
+				if err != nil {
+					return err
+				}
+				if i, err := strconv.Atoi(answer); err == nil && i >= 1 && i <= len(devices) {
+					device = devices[i-1].Path
+				}
+			}
+		}
+	}
+
+	bottleID, err := generateBottleID()
+	if err != nil {
+		return err
+	}
+	rpID, user := newFIDO2Party()
+	fmt.Println("Touch your key when it blinks (1/2: creating a credential)...")
+	credID, salt, err := CreateFIDO2Credential(ctx, device, rpID, user, bottleID)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Touch your key again (2/2: deriving the unlock secret)...")
+	secret, err := GetFIDO2Secret(ctx, device, rpID, bottleID, credID, salt)
+	if err != nil {
+		return err
+	}
+	say("Creating " + bottleName(bottle) + "...")
+	if err := CreateBottleWithYubiKey(ctx, bottle, size, secret, bottleID, credID, salt, rpID, user, device); err != nil {
+		return err
+	}
+	say("Created " + bottleName(bottle) + "; it unlocks with the key at " + device + ".")
+	return nil
+}
@@ -0,0 +1,442 @@
+// Daemon: a background process that owns app sessions, controlled over a JSON-RPC unix socket.
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// daemonSocketPath returns the daemon's control socket
+func daemonSocketPath() string {
+	return filepath.Join(lockDir(), "daemon.sock")
+}
+
+// BottleArgs names a bottle by absolute path
+type BottleArgs struct {
+	Bottle string
+}
+
+// LockArgs are the arguments of Bottles.Lock
+type LockArgs struct {
+	Bottle string
+	Force  bool // also stop other processes keeping the bottle busy
+}
+
+// LaunchArgs are the arguments of Bottles.Launch, like those of `run`
+type LaunchArgs struct {
+	Bottle  string
+	App     string        // app ID or full ref
+	Args    []string      // extra arguments for the app
+	Open    []string      // absolute paths of host files to open
+	Join    bool          // share a bottle already in use
+	AnyApp  bool          // ignore the bottle's allowed apps
+	Timeout time.Duration // session time limit; -1 = use the bottle's setting
+	Profile string        // launch profile name, whose permissions and arguments apply
+	Env     []string      // the caller's environment, for the app; empty = the daemon's
+	Dir     string        // the caller's working directory, for the app
+}
+
+// SessionInfo describes an app the daemon is running
+type SessionInfo struct {
+	ID      int
+	Bottle  string
+	App     string
+	PID     int
+	Started int64
+}
+
+// SessionArgs names a session
+type SessionArgs struct {
+	ID int
+}
+
+// WaitReply is how a session's app exited
+type WaitReply struct {
+	ExitCode int
+	Error    string // empty if the app exited successfully
+}
+
+// daemonSession is a session the daemon started
+type daemonSession struct {
+	info SessionInfo
+	run  *runSession
+	done chan struct{} // closed once the app exited and the bottle was released
+	err  error         // the app's exit error, set before done is closed
+}
+
+// Bottles is the daemon's RPC service
+type Bottles struct {
+	mu       sync.Mutex
+	nextID   int
+	sessions map[int]*daemonSession
+}
+
+// List returns the state of every bottle, like `status --all`
+func (b *Bottles) List(_ struct{}, reply *statusReport) error {
+	*reply = collectStatusReport()
+	return nil
+}
+
+// Status returns the state of one bottle
+func (b *Bottles) Status(args BottleArgs, reply *bottleStatus) error {
+	*reply = collectBottleStatus(args.Bottle)
+	return nil
+}
+
+// Mounts returns the mounted bottles, like `list`
+func (b *Bottles) Mounts(_ struct{}, reply *[]MountInfo) error {
+	*reply = mountedBottles()
+	return nil
+}
+
+// Sessions returns the apps the daemon is running
+func (b *Bottles) Sessions(_ struct{}, reply *[]SessionInfo) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	*reply = []SessionInfo{}
+	for _, s := range b.sessions {
+		select {
+		case <-s.done:
+		default:
+			*reply = append(*reply, s.info)
+		}
+	}
+	return nil
+}
+
+// Launch starts an app in a bottle, like `run`. It doesn't ask for
+// passwords: the bottle must be unlocked already, or need no secret. It
+// returns once the app has started; Wait waits for it to exit.
+func (b *Bottles) Launch(args LaunchArgs, reply *SessionInfo) error {
+	opts := runOptions{join: args.Join, anyApp: args.AnyApp, timeout: args.Timeout, open: args.Open, dir: args.Dir}
+	if len(args.Env) > 0 {
+		opts.env = args.Env
+	}
+	if args.Profile != "" {
+		profile, err := loadProfile(args.Profile)
+		if err != nil {
+			return toDaemonError(err)
+		}
+		opts.profile = profile
+	}
+	run, err := startRunSession(args.Bottle, args.App, opts, args.Args, false)
+	if err != nil {
+		return toDaemonError(err)
+	}
+
+	b.mu.Lock()
+	b.nextID++
+	s := &daemonSession{
+		info: SessionInfo{ID: b.nextID, Bottle: run.bottle, App: args.App, PID: run.cmd.Process.Pid, Started: run.started.Unix()},
+		run:  run,
+		done: make(chan struct{}),
+	}
+	b.sessions[s.info.ID] = s
+	b.mu.Unlock()
+
+	go func() {
+		s.err = run.cmd.Wait()
+		run.finish()
+		close(s.done)
+		// Kept a while so a client that attaches late still gets the result
+		time.AfterFunc(DaemonSessionKeep, func() {
+			b.mu.Lock()
+			delete(b.sessions, s.info.ID)
+			b.mu.Unlock()
+		})
+	}()
+	*reply = s.info
+	return nil
+}
+
+// Wait waits for a session's app to exit and its bottle to be released
+func (b *Bottles) Wait(args SessionArgs, reply *WaitReply) error {
+	s, err := b.session(args.ID)
+	if err != nil {
+		return toDaemonError(err)
+	}
+	<-s.done
+	if s.err != nil {
+		reply.Error = s.err.Error()
+		reply.ExitCode = newAppExitError(s.info.App, s.err).code
+	}
+	return nil
+}
+
+// Stop closes a session's app (killing it after SessionKillGrace) and
+// waits until its bottle is released
+func (b *Bottles) Stop(args SessionArgs, _ *struct{}) error {
+	s, err := b.session(args.ID)
+	if err != nil {
+		return toDaemonError(err)
+	}
+	stopDaemonSessions([]*daemonSession{s})
+	return nil
+}
+
+// Lock closes the daemon's sessions in a bottle, then locks it like `lock`
+func (b *Bottles) Lock(args LockArgs, _ *struct{}) error {
+	hash := getBottleHash(args.Bottle)
+	stopDaemonSessions(b.running(func(s *daemonSession) bool {
+		return getBottleHash(s.run.bottle) == hash
+	}))
+	return toDaemonError(lockBottle(args.Bottle, args.Force))
+}
+
+// session looks up a session by ID
+func (b *Bottles) session(id int) (*daemonSession, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, ok := b.sessions[id]
+	if !ok {
+		return nil, &bottleError{op: "daemon", msg: fmt.Sprintf("no session %d", id)}
+	}
+	return s, nil
+}
+
+// running returns the sessions whose app is still running that match keep
+func (b *Bottles) running(keep func(*daemonSession) bool) []*daemonSession {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var sessions []*daemonSession
+	for _, s := range b.sessions {
+		select {
+		case <-s.done:
+		default:
+			if keep(s) {
+				sessions = append(sessions, s)
+			}
+		}
+	}
+	return sessions
+}
+
+// stopDaemonSessions closes the apps of several sessions at once and waits
+// until their bottles are released
+func stopDaemonSessions(sessions []*daemonSession) {
+	for _, s := range sessions {
+		go stopAppGracefully(s.run.cmd, nil)
+	}
+	for _, s := range sessions {
+		<-s.done
+	}
+}
+
+// cmdDaemon serves the control socket until it is stopped by a signal, then
+// closes the apps it started and releases their bottles
+func cmdDaemon() error {
+	path := daemonSocketPath()
+	if client := dialDaemon(); client != nil {
+		client.Close()
+		return &bottleError{op: "daemon", msg: "already running (" + path + ")"}
+	}
+	if err := ensureLockDir(); err != nil {
+		return err
+	}
+	// Left behind by a daemon that was killed
+	_ = os.Remove(path)
+	// Created 0600, never reachable by others even for a moment
+	oldMask := syscall.Umask(0177)
+	listener, err := net.Listen("unix", path)
+	syscall.Umask(oldMask)
+	if err != nil {
+		return &bottleError{op: "daemon", msg: err.Error()}
+	}
+
+	service := &Bottles{sessions: map[int]*daemonSession{}}
+	server := rpc.NewServer()
+	if err := server.Register(service); err != nil {
+		listener.Close()
+		return &bottleError{op: "daemon", msg: err.Error()}
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigChan)
+	go func() {
+		<-sigChan
+		listener.Close()
+	}()
+
+	notice("bottle-launch daemon listening on " + path)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			break
+		}
+		go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	}
+
+	stopDaemonSessions(service.running(func(*daemonSession) bool { return true }))
+	_ = os.Remove(path)
+	return nil
+}
+
+// dialDaemon connects to the daemon, or returns nil if it isn't running
+func dialDaemon() *rpc.Client {
+	// The socket is only trusted in a lock directory that is ours
+	if checkLockDir() != nil {
+		return nil
+	}
+	conn, err := net.DialTimeout("unix", daemonSocketPath(), time.Second)
+	if err != nil {
+		return nil
+	}
+	return jsonrpc.NewClient(conn)
+}
+
+// daemonCall calls a daemon method if the daemon is running. It reports
+// false if it isn't, so the caller does the work itself.
+func daemonCall(method string, args, reply any) (bool, error) {
+	client := dialDaemon()
+	if client == nil {
+		return false, nil
+	}
+	defer client.Close()
+	return true, callDaemon(client, method, args, reply)
+}
+
+// callDaemon calls a daemon method, turning the error it returns back into
+// one of its class
+func callDaemon(client *rpc.Client, method string, args, reply any) error {
+	err := client.Call("Bottles."+method, args, reply)
+	var serverErr rpc.ServerError
+	if !errors.As(err, &serverErr) {
+		return err
+	}
+	if name, msg, ok := strings.Cut(string(serverErr), "] "); ok && strings.HasPrefix(name, "[") {
+		if class, known := classNamed(name[1:]); known {
+			return &daemonError{msg: msg, class: class}
+		}
+	}
+	return &daemonError{msg: string(serverErr)}
+}
+
+// daemonError is an error the daemon returned. On the socket its message
+// starts with its category in brackets: "[wrong_password] unlock: wrong password".
+type daemonError struct {
+	msg   string
+	class errorClass
+}
+
+func (e *daemonError) Error() string {
+	return e.msg
+}
+
+func (e *daemonError) category() errorClass {
+	return e.class
+}
+
+// toDaemonError prefixes a method's error with its category for the client
+func toDaemonError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return errors.New("[" + classifyError(err).Name + "] " + err.Error())
+}
+
+// lockSessions locks a bottle like lockBottle, through the daemon if it is
+// running so its sessions in the bottle are closed first
+func lockSessions(bottle string, force bool) error {
+	ok, err := daemonCall("Lock", LockArgs{Bottle: absBottlePath(bottle), Force: force}, &struct{}{})
+	if !ok {
+		err = lockBottle(bottle, force)
+	}
+	return err
+}
+
+// absBottlePath resolves a CLI bottle argument to an absolute path, since
+// the daemon's working directory isn't the caller's
+func absBottlePath(bottle string) string {
+	bottle = resolveBottlePath(bottle)
+	if abs, err := filepath.Abs(bottle); err == nil {
+		return abs
+	}
+	return bottle
+}
+
+// daemonRun runs an app through the daemon and waits for it to exit. The
+// bottle is unlocked here, so prompts use this terminal, and the app gets
+// this process's environment and working directory. ctrl+c stops the app,
+// as it does when run locally.
+func daemonRun(client *rpc.Client, bottle, appID string, opts runOptions, extraArgs []string) error {
+	defer client.Close()
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	args := LaunchArgs{
+		Bottle:  absBottlePath(bottle),
+		App:     appID,
+		Args:    extraArgs,
+		Join:    true, // with the hold below
+		AnyApp:  opts.anyApp,
+		Timeout: opts.timeout,
+		Env:     os.Environ(),
+		Dir:     dir,
+	}
+	if opts.profile != nil {
+		args.Profile = opts.profile.Name
+	}
+	for _, f := range opts.open {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return &bottleError{op: "open", msg: err.Error()}
+		}
+		args.Open = append(args.Open, abs)
+	}
+
+	hold, err := holdBottle(args.Bottle, parseAppRef(appID).ID, opts.join)
+	if err != nil {
+		return err
+	}
+	var session SessionInfo
+	err = callDaemon(client, "Launch", args, &session)
+	hold.release()
+	if err != nil {
+		return err
+	}
+	notice(fmt.Sprintf("Running %s in %s through the daemon (pid %d)", appID, bottleName(session.Bottle), session.PID))
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigChan)
+	done := make(chan struct{})
+	stopped := make(chan os.Signal, 1)
+	go func() {
+		select {
+		case sig := <-sigChan:
+			notice("Closing the app...")
+			stopped <- sig
+			_ = callDaemon(client, "Stop", SessionArgs{ID: session.ID}, &struct{}{})
+		case <-done:
+		}
+	}()
+
+	var result WaitReply
+	err = callDaemon(client, "Wait", SessionArgs{ID: session.ID}, &result)
+	close(done)
+	select {
+	case sig := <-stopped:
+		// Exit like the local signal handler does
+		os.Exit(128 + int(sig.(syscall.Signal)))
+	default:
+	}
+	if err != nil {
+		return err
+	}
+	if result.Error != "" {
+		return &appExitError{app: appID, err: errors.New(result.Error), code: result.ExitCode}
+	}
+	return nil
+}
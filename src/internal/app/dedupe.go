@@ -0,0 +1,237 @@
+// Dedupe report: large files duplicated across mounted bottles, and reflinking them where the filesystem allows.
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"syscall"
+)
+
+// DefaultDedupeMinSize is the smallest file the report looks at
+const DefaultDedupeMinSize = "1M"
+
+// dedupeFile is a file found in a bottle
+type dedupeFile struct {
+	bottle string
+	path   string
+	size   int64
+	dev    uint64
+}
+
+// dedupeGroup is a set of identical files in more than one bottle
+type dedupeGroup struct {
+	size  int64
+	files []dedupeFile
+}
+
+// savings returns what keeping one copy would save
+func (g dedupeGroup) savings() int64 {
+	return g.size * int64(len(g.files)-1)
+}
+
+// dedupeBottles returns the bottles to scan: the given ones, a set's, or
+// every mounted bottle
+func dedupeBottles(names []string, set string) ([]string, error) {
+	if set != "" {
+		return bottleSet(set)
+	}
+	if len(names) > 0 {
+		bottles := make([]string, len(names))
+		for i, n := range names {
+			bottles[i] = resolveBottlePath(n)
+		}
+		return bottles, nil
+	}
+	var bottles []string
+	for _, b := range listBottles() {
+		if findMountForBottle(b) != "" {
+			bottles = append(bottles, b)
+		}
+	}
+	return bottles, nil
+}
+
+// scanBottleFiles lists the regular files of at least minSize in a mounted bottle
+func scanBottleFiles(bottle, mountPoint string, minSize int64) []dedupeFile {
+	var files []dedupeFile
+	filepath.WalkDir(mountPoint, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // unreadable directories are skipped
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil || fi.Size() < minSize {
+			return nil
+		}
+		f := dedupeFile{bottle: bottle, path: path, size: fi.Size()}
+		if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+			f.dev = st.Dev
+		}
+		files = append(files, f)
+		return nil
+	})
+	return files
+}
+
+// hashFile returns the SHA-256 of a file's contents
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// findDuplicates groups identical files that occur in more than one
+// bottle, largest savings first. Only files sharing a size are hashed.
+func findDuplicates(files []dedupeFile) []dedupeGroup {
+	bySize := map[int64][]dedupeFile{}
+	for _, f := range files {
+		bySize[f.size] = append(bySize[f.size], f)
+	}
+	var groups []dedupeGroup
+	for size, same := range bySize {
+		if len(same) < 2 {
+			continue
+		}
+		byHash := map[string][]dedupeFile{}
+		for _, f := range same {
+			if sum, err := hashFile(f.path); err == nil {
+				byHash[sum] = append(byHash[sum], f)
+			}
+		}
+		for _, dups := range byHash {
+			bottles := map[string]bool{}
+			for _, f := range dups {
+				bottles[f.bottle] = true
+			}
+			if len(bottles) > 1 {
+				groups = append(groups, dedupeGroup{size: size, files: dups})
+			}
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].savings() > groups[j].savings() })
+	return groups
+}
+
+// reflinkFile makes dst share src's blocks: a clone of src replaces dst
+// (keeping dst's mode), so dst is never half-written
+func reflinkFile(src, dst string) error {
+	fi, err := os.Stat(dst)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(dst), ".dedupe-"+filepath.Base(dst))
+	if err := cloneFile(src, tmp); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, fi.Mode().Perm()); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// cmdDedupeReport reports files duplicated across bottles and, with
+// reflink, makes the copies on a shared copy-on-write filesystem share
+// their blocks
+func cmdDedupeReport(names []string, set string, minSize int64, reflink bool) error {
+	bottles, err := dedupeBottles(names, set)
+	if err != nil {
+		return err
+	}
+
+	var files []dedupeFile
+	scanned := 0
+	for _, bottle := range bottles {
+		mountPoint := findMountForBottle(bottle)
+		if mountPoint == "" {
+			notice("Skipping " + bottleName(bottle) + ": not mounted (unlock it first, e.g. bottle-launch unlock-all)")
+			continue
+		}
+		if reflink {
+			// Don't swap files under a running app
+			lock, err := acquireBottleLock(bottle, "dedupe")
+			var inUse *bottleInUseError
+			if errors.As(err, &inUse) {
+				notice("Skipping " + bottleName(bottle) + ": in use by " + inUse.owner.String())
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			defer lock.Release()
+		}
+		files = append(files, scanBottleFiles(bottle, mountPoint, minSize)...)
+		scanned++
+	}
+	if scanned < 2 {
+		return &bottleError{op: "dedupe", msg: "need at least two mounted bottles to compare"}
+	}
+
+	groups := findDuplicates(files)
+	if len(groups) == 0 {
+		say(fmt.Sprintf("No duplicate files of %s or more across %d bottles.", formatSize(minSize), scanned))
+		return nil
+	}
+
+	var total, reclaimed int64
+	linked, unshareable := 0, 0
+	for _, g := range groups {
+		total += g.savings()
+		fmt.Printf("%s x%d (%s to save):\n", formatSize(g.size), len(g.files), formatSize(g.savings()))
+		for _, f := range g.files {
+			rel, _ := filepath.Rel(findMountForBottle(f.bottle), f.path)
+			fmt.Printf("    %s: %s\n", bottleName(f.bottle), rel)
+		}
+		if !reflink {
+			continue
+		}
+		src := g.files[0]
+		for _, f := range g.files[1:] {
+			if f.dev != src.dev {
+				unshareable++
+				continue
+			}
+			if err := reflinkFile(src.path, f.path); err != nil {
+				unshareable++
+				continue
+			}
+			linked++
+			reclaimed += g.size
+		}
+	}
+
+	say("")
+	summary := fmt.Sprintf("%d sets of duplicates", len(groups))
+	if len(groups) == 1 {
+		summary = "1 set of duplicates"
+	}
+	say(fmt.Sprintf("%s across %d bottles; %s could be saved.", summary, scanned, formatSize(total)))
+	if reflink {
+		say("Reflinked " + strconv.Itoa(linked) + " files, freeing up to " + formatSize(reclaimed) + ".")
+		if unshareable > 0 {
+			say(strconv.Itoa(unshareable) + " copies are on different filesystems, or one without reflink support (each LUKS bottle is its own filesystem), and were left as they are.")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+// DNS overrides: a bottle's own name servers and hosts entries, bound over the sandbox's /etc.
+package app
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// bwrapWrapperName is the symlink's name, which main checks os.Args[0] for
+const bwrapWrapperName = "bottle-launch-bwrap"
+
+// parseDNSServers parses a comma- or space-separated list of name server addresses
+func parseDNSServers(s string) ([]string, error) {
+	var servers []string
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if net.ParseIP(f) == nil {
+			return nil, &bottleError{op: "dns", msg: f + " is not an IP address"}
+		}
+		servers = append(servers, f)
+	}
+	return servers, nil
+}
+
+// parseHostsEntries parses comma-separated hosts entries ("<ip> <name>...")
+func parseHostsEntries(s string) ([]string, error) {
+	var entries []string
+	for _, e := range strings.Split(s, ",") {
+		fields := strings.Fields(e)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 || net.ParseIP(fields[0]) == nil {
+			return nil, &bottleError{op: "hosts", msg: "expected <ip> <name>, got " + strings.TrimSpace(e)}
+		}
+		entries = append(entries, strings.Join(fields, " "))
+	}
+	return entries, nil
+}
+
+// dnsSummary describes a bottle's DNS overrides in one line (empty if none)
+func (p *Permissions) dnsSummary() string {
+	var parts []string
+	if len(p.DNS) > 0 {
+		parts = append(parts, "DNS "+strings.Join(p.DNS, ", "))
+	}
+	switch len(p.Hosts) {
+	case 0:
+	case 1:
+		parts = append(parts, "hosts: "+p.Hosts[0])
+	default:
+		parts = append(parts, fmt.Sprintf("%d hosts entries", len(p.Hosts)))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// dnsOverrideDir returns where the override files of the bottle mounted at
+// mountPoint are kept while it runs
+func dnsOverrideDir(mountPoint string) string {
+	return filepath.Join(lockDir(), "dns", fmt.Sprintf("%x", sha256.Sum256([]byte(mountPoint)))[:12])
+}
+
+// prepareDNSOverrides writes a bottle's resolv.conf and hosts files and
+// returns the wrapper to use as $FLATPAK_BWRAP ("" if there are no overrides)
+func prepareDNSOverrides(mountPoint string, perms *Permissions) (string, error) {
+	if len(perms.DNS) == 0 && len(perms.Hosts) == 0 {
+		return "", nil
+	}
+	dir := dnsOverrideDir(mountPoint)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", &bottleError{op: "dns", msg: err.Error()}
+	}
+
+	files := map[string]string{}
+	if len(perms.DNS) > 0 {
+		var sb strings.Builder
+		sb.WriteString("# Written by bottle-launch for this bottle\n")
+		for _, s := range perms.DNS {
+			sb.WriteString("nameserver " + s + "\n")
+		}
+		files["resolv.conf"] = sb.String()
+	}
+	if len(perms.Hosts) > 0 {
+		// Keep the host's entries (localhost, the machine's name) first
+		hosts, err := os.ReadFile("/etc/hosts")
+		if err != nil {
+			hosts = []byte("127.0.0.1 localhost\n::1 localhost\n")
+		}
+		files["hosts"] = strings.TrimRight(string(hosts), "\n") + "\n\n# bottle-launch\n" + strings.Join(perms.Hosts, "\n") + "\n"
+	}
+	for _, name := range []string{"resolv.conf", "hosts"} {
+		path := filepath.Join(dir, name)
+		content, ok := files[name]
+		if !ok {
+			os.Remove(path)
+			continue
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return "", &bottleError{op: "dns", msg: err.Error()}
+		}
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return "", &bottleError{op: "dns", msg: "could not find the bottle-launch executable: " + err.Error()}
+	}
+	wrapper := filepath.Join(dir, bwrapWrapperName)
+	os.Remove(wrapper)
+	if err := os.Symlink(exe, wrapper); err != nil {
+		return "", &bottleError{op: "dns", msg: err.Error()}
+	}
+	return wrapper, nil
+}
+
+// runBwrapWrapper adds the override binds from the wrapper's directory to
+// flatpak's bwrap arguments and execs the real bwrap. It doesn't return.
+func runBwrapWrapper() {
+	dir := filepath.Dir(os.Args[0])
+	args := os.Args[1:]
+
+	// flatpak passes its options as --args <fd> and then the command; the
+	// binds go after those options so they win over flatpak's own /etc binds
+	i := 0
+	for i+1 < len(args) && args[i] == "--args" {
+		i += 2
+	}
+	// flatpak also runs bwrap to rebuild the runtime's ld.so.cache, whose
+	// sandbox has no /etc to bind into
+	if i >= len(args) || filepath.Base(args[i]) != "ldconfig" {
+		var binds []string
+		for _, name := range []string{"resolv.conf", "hosts"} {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err == nil {
+				binds = append(binds, "--ro-bind", path, "/etc/"+name)
+			}
+		}
+		args = append(args[:i:i], append(binds, args[i:]...)...)
+	}
+
+	// flatpak may start bwrap without PATH, so try its usual places first
+	bwrap := ""
+	for _, path := range []string{"/usr/libexec/flatpak-bwrap", "/usr/bin/bwrap"} {
+		if _, err := os.Stat(path); err == nil {
+			bwrap = path
+			break
+		}
+	}
+	if bwrap == "" {
+		var err error
+		if bwrap, err = exec.LookPath("bwrap"); err != nil {
+			fmt.Fprintln(os.Stderr, "bottle-launch: bwrap not found")
+			os.Exit(1)
+		}
+	}
+	err := unix.Exec(bwrap, append([]string{bwrap}, args...), os.Environ())
+	fmt.Fprintln(os.Stderr, "bottle-launch: "+err.Error())
+	os.Exit(1)
+}
@@ -0,0 +1,150 @@
+// Doctor: checking the system for what bottle-launch needs, with a fix for each problem.
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// doctorReport prints check results and counts the problems
+type doctorReport struct {
+	problems int
+}
+
+func (r *doctorReport) ok(msg string) {
+	say("  ok    " + msg)
+}
+
+func (r *doctorReport) warn(msg string) {
+	say("  warn  " + msg)
+}
+
+func (r *doctorReport) fail(msg string) {
+	r.problems++
+	fmt.Println("  FAIL  " + msg)
+}
+
+// doctorChecks run in order; each reports on one area
+var doctorChecks = []struct {
+	title string
+	run   func(r *doctorReport)
+}{
+	{"Tools", checkTools},
+	{"FIDO2 keys", checkFIDO2Access},
+	{"Security modules", checkSecurityModules},
+	{"Storage", checkStorage},
+}
+
+// cmdDoctor runs every check and fails if any found a problem
+func cmdDoctor() error {
+	r := &doctorReport{}
+	for i, check := range doctorChecks {
+		if i > 0 {
+			say("")
+		}
+		say(check.title + ":")
+		check.run(r)
+	}
+	switch r.problems {
+	case 0:
+		return nil
+	case 1:
+		return &bottleError{op: "doctor", msg: "found 1 problem"}
+	}
+	return &bottleError{op: "doctor", msg: "found " + strconv.Itoa(r.problems) + " problems"}
+}
+
+// checkTools looks for the programs bottle-launch runs
+func checkTools(r *doctorReport) {
+	for _, tool := range []struct{ name, need string }{
+		{"cryptsetup", "LUKS bottles"},
+		{"udisksctl", "unlocking and mounting LUKS bottles"},
+		{"flatpak", "running apps"},
+	} {
+		if _, err := exec.LookPath(tool.name); err != nil {
+			r.fail(tool.name + " not found - needed for " + tool.need)
+		} else {
+			r.ok(tool.name)
+		}
+	}
+	if err := CheckFIDO2Available(); err != nil {
+		r.warn(err.Error() + " (only YubiKey bottles need it)")
+	} else {
+		r.ok("libfido2 tools")
+	}
+}
+
+// checkFIDO2Access checks the connected FIDO2 keys can be opened by this user
+func checkFIDO2Access(r *doctorReport) {
+	nodes := fido2HidrawNodes()
+	if len(nodes) == 0 {
+		r.ok("none connected (plug one in to check it can be used)")
+		return
+	}
+	_, rulesErr := os.Stat(udevRulesPath)
+	for _, node := range nodes {
+		f, err := os.OpenFile(node, os.O_RDWR, 0)
+		if err == nil {
+			f.Close()
+			r.ok(node + " can be used")
+			continue
+		}
+		switch {
+		case !errors.Is(err, os.ErrPermission):
+			r.fail(node + " can't be opened: " + err.Error())
+		case rulesErr == nil:
+			r.fail(node + " is not accessible to you - unplug the key and plug it back in to apply " + udevRulesPath)
+		default:
+			r.fail(node + " is not accessible to you - run bottle-launch install-udev-rules")
+		}
+	}
+}
+
+// checkSecurityModules reports SELinux/AppArmor and their denials for bottle
+// files in this boot
+func checkSecurityModules(r *doctorReport) {
+	switch {
+	case selinuxEnforcing():
+		r.ok("SELinux enforcing")
+	case selinuxEnabled():
+		r.ok("SELinux permissive (denials are logged, not enforced)")
+	}
+	if apparmorEnabled() {
+		r.ok("AppArmor enabled")
+	}
+	if !selinuxEnabled() && !apparmorEnabled() {
+		r.ok("no SELinux or AppArmor")
+		return
+	}
+
+	denials, ok := bottleDenials()
+	switch {
+	case !ok:
+		r.warn("can't read the journal or audit log to look for denials (try as root: journalctl -b --grep denied)")
+	case len(denials) == 0:
+		r.ok("no denials for bottle files since boot")
+	default:
+		fix := "see the AppArmor profile named in it"
+		if selinuxEnabled() {
+			fix = "set SELINUX_CONTEXT (e.g. system_u:object_r:user_home_t:s0) and remount"
+		}
+		r.fail(strconv.Itoa(len(denials)) + " denials for bottle files since boot - " + fix + "; the latest:")
+		fmt.Println("        " + denials[len(denials)-1])
+	}
+}
+
+// checkStorage reports the bottle directory's filesystem and whether
+// snapshots and clones there can be reflinks
+func checkStorage(r *doctorReport) {
+	os.MkdirAll(bottleDir, 0700)
+	fs := filesystemName(bottleDir)
+	if reflinkSupported(bottleDir) {
+		r.ok(bottleDir + " is on " + fs + " with reflinks: snapshots and clones are instant")
+		return
+	}
+	r.ok(bottleDir + " is on " + fs)
+	r.warn("no reflinks there: snapshots and clones are full copies (btrfs or XFS would make them instant)")
+}
@@ -0,0 +1,249 @@
+// Duress passphrase: a second passphrase that opens a decoy bottle instead of the real one.
+package app
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/charmbracelet/x/term"
+)
+
+// defaultDecoySize is the decoy bottle's size when none is given
+const defaultDecoySize = "128M"
+
+var errDuressNeedsKeyring = &bottleError{op: "duress", msg: "a duress passphrase needs a Secret Service keyring for the config signing key"}
+
+// decoyID names a bottle's decoy, unlinkable to it without the signing key
+func decoyID(bottle string) (string, error) {
+	key := configSigningKey()
+	if key == nil {
+		if configKey.unknown {
+			return "", errConfigKeyUnreadable
+		}
+		return "", errDuressNeedsKeyring
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("duress\n" + absBottlePath(bottle)))
+	return hex.EncodeToString(mac.Sum(nil))[:16], nil
+}
+
+// decoyBottlePath returns where a bottle's decoy lives. Its name is the
+// ID, not the bottle's; its filesystem carries the bottle's label instead,
+// so it mounts where the bottle would.
+func decoyBottlePath(id string) string {
+	return filepath.Join(bottleDir, "."+id, id+".bottle")
+}
+
+// findDecoy returns a bottle's decoy and its ID, or "" if it has none (or
+// the signing key can't be read). Decoys made before were named after the
+// bottle.
+func findDecoy(bottle string) (decoy, id string) {
+	id, err := decoyID(bottle)
+	if err != nil {
+		return "", ""
+	}
+	for _, decoy := range []string{decoyBottlePath(id), filepath.Join(bottleDir, "."+id, bottleName(absBottlePath(bottle)))} {
+		if _, err := os.Lstat(decoy); err == nil {
+			return decoy, id
+		}
+	}
+	return "", ""
+}
+
+// duressActionAttrs are the secret-tool attributes of a decoy's action
+func duressActionAttrs(id string) []string {
+	return []string{"application", "bottle-launch", "key", "duress-action", "decoy", id}
+}
+
+// mockDuressActionPath is where mock mode keeps a decoy's action
+func mockDuressActionPath(id string) string {
+	return filepath.Join(lockDir(), "mock", "duress-"+id)
+}
+
+// loadDuressAction returns the action run when a decoy opens ("" = none)
+func loadDuressAction(id string) string {
+	if mockMode {
+		data, _ := os.ReadFile(mockDuressActionPath(id))
+		return string(data)
+	}
+	action, _ := lookupSecret(context.Background(), &secretRef{Kind: secretServiceRef, Attrs: duressActionAttrs(id)}, "")
+	return action
+}
+
+// storeDuressAction keeps a decoy's action, or clears it if action is ""
+func storeDuressAction(id, action string) error {
+	if mockMode {
+		if action == "" {
+			if err := os.Remove(mockDuressActionPath(id)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return nil
+		}
+		os.MkdirAll(filepath.Dir(mockDuressActionPath(id)), 0700)
+		return os.WriteFile(mockDuressActionPath(id), []byte(action), 0600)
+	}
+	if action == "" {
+		// secret-tool clear exits 1 when nothing matched
+		_ = command("secret-tool", append([]string{"clear"}, duressActionAttrs(id)...)...).Run()
+		return nil
+	}
+	cmd := command("secret-tool", append([]string{"store", "--label=bottle-launch"}, duressActionAttrs(id)...)...)
+	cmd.Stdin = strings.NewReader(action)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return &bottleError{op: "duress", msg: "could not store the action in the keyring: " + strings.TrimSpace(string(out))}
+	}
+	return nil
+}
+
+// mountTypedPassword mounts a bottle with a password the user typed, or its
+// decoy if the password is the duress passphrase. The returned info is the
+// decoy's in that case; callers treat it like the real bottle's.
+func mountTypedPassword(ctx context.Context, bottle, password string) (*MountInfo, error) {
+	info, err := mountBottle(ctx, bottle, password)
+	if err != errWrongPassword {
+		return info, err
+	}
+	decoy, id := findDecoy(bottle)
+	// An open decoy would take any password
+	if decoy == "" || currentMount(decoy) != nil {
+		return nil, err
+	}
+	info, decoyErr := mountBottle(ctx, decoy, password)
+	if decoyErr != nil {
+		return nil, err
+	}
+	runDuressAction(bottle, id)
+	return info, nil
+}
+
+// runDuressAction starts the decoy's action, detached and silent. A config
+// changed outside bottle-launch runs nothing: whoever can write it must not
+// get to run commands by typing a wrong password.
+func runDuressAction(bottle, id string) {
+	if loadPermissions(getConfigPath(bottle)).Tampered {
+		return
+	}
+	action := loadDuressAction(id)
+	if action == "" {
+		return
+	}
+	cmd := command("sh", "-c", action)
+	cmd.Env = append(os.Environ(), "BOTTLE_LAUNCH_BOTTLE="+absBottlePath(bottle))
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if cmd.Start() == nil {
+		go func() { _ = cmd.Wait() }()
+	}
+}
+
+// promptDuressPassphrase asks for the new duress passphrase twice
+func promptDuressPassphrase() (string, error) {
+	if mockMode {
+		return mockPromptPassword("Duress passphrase: ")
+	}
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		return "", &bottleError{op: "duress", msg: "the passphrase is asked on a terminal"}
+	}
+	var answers [2]string
+	for i, prompt := range []string{"Duress passphrase: ", "Again: "} {
+		fmt.Fprint(os.Stderr, prompt)
+		pass, err := term.ReadPassword(os.Stdin.Fd())
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		answers[i] = string(pass)
+	}
+	if answers[0] == "" {
+		return "", &bottleError{op: "duress", msg: "empty passphrase"}
+	}
+	if answers[0] != answers[1] {
+		return "", &bottleError{op: "duress", msg: "the passphrases don't match"}
+	}
+	return answers[0], nil
+}
+
+// cmdDuress shows, sets up, or removes a bottle's duress passphrase
+func cmdDuress(bottle, size, action string, remove bool) error {
+	bottle = resolveBottlePath(bottle)
+	if _, err := os.Stat(bottle); err != nil {
+		return errBottleNotFound
+	}
+	perms := loadPermissions(getConfigPath(bottle))
+	if perms.Tampered {
+		return errConfigTampered(bottle)
+	}
+	id, err := decoyID(bottle)
+	if err != nil {
+		return err
+	}
+	decoy, _ := findDecoy(bottle)
+
+	switch {
+	case remove:
+		if decoy == "" {
+			return &bottleError{op: "duress", msg: bottleName(bottle) + " has no duress passphrase"}
+		}
+		if err := deleteBottle(decoy); err != nil && !os.IsNotExist(err) {
+			return &bottleError{op: "duress", msg: "could not delete the decoy: " + err.Error()}
+		}
+		os.Remove(filepath.Dir(decoy))
+		return storeDuressAction(id, "")
+
+	case decoy != "" && size == "":
+		if action != "" {
+			return storeDuressAction(id, action)
+		}
+		fmt.Println(bottleName(bottle) + ": duress passphrase opens " + decoy)
+		if action := loadDuressAction(id); action != "" {
+			fmt.Println("  and runs: " + action)
+		}
+		return nil
+
+	case decoy != "":
+		return &bottleError{op: "duress", msg: bottleName(bottle) + " already has a duress passphrase - --remove it first"}
+	}
+
+	if isFIDO2, _ := IsFIDO2Bottle(perms); isFIDO2 || perms.KeyDriveUUID != "" {
+		return &bottleError{op: "duress", msg: "only bottles unlocked with a typed password can have a duress passphrase"}
+	}
+	// Directory backends mount under the bottle's name, which the decoy
+	// doesn't share
+	if bottleBackend(bottle) != BackendLUKS {
+		return &bottleError{op: "duress", msg: "only LUKS bottles can have a duress passphrase"}
+	}
+	if size == "" {
+		size = defaultDecoySize
+	}
+	password, err := promptDuressPassphrase()
+	if err != nil {
+		return err
+	}
+
+	decoy = decoyBottlePath(id)
+	if err := os.MkdirAll(filepath.Dir(decoy), 0700); err != nil {
+		return &bottleError{op: "duress", msg: err.Error()}
+	}
+	create := func() error {
+		return createBottleBase(context.Background(), decoy, size, password, getFSLabel(bottle), false)
+	}
+	if mockMode {
+		create = func() error { return mockBackend{}.Create(context.Background(), decoy, size, password) }
+	}
+	if err := create(); err != nil {
+		os.Remove(filepath.Dir(decoy))
+		return err
+	}
+	if err := storeDuressAction(id, action); err != nil {
+		return err
+	}
+	say("Created the decoy " + decoy + ".")
+	fmt.Println("Fill it with plausible files: bottle-launch run " + decoy + " <app_id> (it takes the duress passphrase).")
+	return nil
+}
@@ -0,0 +1,176 @@
+// Error explanations: recognizing common cryptsetup/udisks/mount failures and suggesting fixes.
+package app
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// errorExplanation describes a recognized failure in plain words
+type errorExplanation struct {
+	Title string   // what went wrong
+	Cause string   // why it usually happens
+	Steps []string // what to try, in order
+}
+
+// errorPattern recognizes a failure by the text cryptsetup, udisks, mount,
+// or the kernel report (matched case-insensitively)
+type errorPattern struct {
+	match []string
+	errorExplanation
+}
+
+var errorPatterns = []errorPattern{
+	{
+		match: []string{"wrong password", "no key available with this passphrase"},
+		errorExplanation: errorExplanation{
+			Title: "Wrong password",
+			Cause: "The passphrase didn't match any key slot of the bottle.",
+			Steps: []string{
+				"Check the keyboard layout and caps lock, then try again",
+				"If the password comes from a password manager, check its entry (bottle-launch secret <bottle>)",
+				"A recovery key works as a password too, if you made one",
+			},
+		},
+	},
+	{
+		match: []string{"wrong yubikey", "none of the connected security keys"},
+		errorExplanation: errorExplanation{
+			Title: "Wrong YubiKey",
+			Cause: "The connected key isn't the one this bottle was created with.",
+			Steps: []string{
+				"Insert the key that created the bottle and try again",
+				"If that key is lost, unlock with a recovery key (bottle-launch recovery)",
+			},
+		},
+	},
+	{
+		match: []string{"wasn't touched in time"},
+		errorExplanation: errorExplanation{
+			Title: "YubiKey not touched in time",
+			Cause: "The key waits a limited time for the touch, and no touch came.",
+			Steps: []string{
+				"Try again and touch the key's contact while it blinks",
+				"For more time, raise FIDO2_TOUCH_TIMEOUT or FIDO2_RETRIES in ~/.config/bottle-launch/config",
+			},
+		},
+	},
+	{
+		match: []string{"no security key connected"},
+		errorExplanation: errorExplanation{
+			Title: "No YubiKey found",
+			Cause: "No FIDO2 key is connected, or it can't be accessed.",
+			Steps: []string{
+				"Plug in the YubiKey and try again",
+				"If it is plugged in, run bottle-launch doctor to check your user can use it (bottle-launch install-udev-rules fixes that)",
+			},
+		},
+	},
+	{
+		match: []string{"notauthorized", "not authorized", "authentication is required"},
+		errorExplanation: errorExplanation{
+			Title: "Permission denied by polkit",
+			Cause: "The authentication dialog was cancelled, or polkit doesn't allow your user to unlock or mount devices.",
+			Steps: []string{
+				"Try again and enter your password in the authentication dialog",
+				"Make sure a polkit agent is running in your session (most desktops start one)",
+				"On a headless system, add a polkit rule for udisks2 or use a rootless backend (create --backend=gocryptfs)",
+			},
+		},
+	},
+	{
+		match: []string{"loop-control", "free loop device", "set up loop device", "setup loop device", "creating loop device"},
+		errorExplanation: errorExplanation{
+			Title: "Could not set up a loop device",
+			Cause: "Image bottles are attached as loop devices, and the kernel's loop support is missing or out of devices.",
+			Steps: []string{
+				"Load the loop module: sudo modprobe loop",
+				"If it is loaded, detach unused loop devices: losetup -l, then sudo losetup -d /dev/loopN",
+				"After a kernel update, reboot so the module matches the running kernel",
+			},
+		},
+	},
+	{
+		match: []string{"no space left on device", "disk quota exceeded"},
+		errorExplanation: errorExplanation{
+			Title: "No space left",
+			Cause: "The bottle, or the disk holding it, is full.",
+			Steps: []string{
+				"Free space on the disk holding the bottle (bottles grow as they are written)",
+				"Delete files inside the bottle, or grow it with a larger new bottle and copy the data over",
+			},
+		},
+	},
+	{
+		match: []string{"wrong fs type", "bad superblock", "structure needs cleaning", "needs journal recovery", "run fsck"},
+		errorExplanation: errorExplanation{
+			Title: "The bottle's filesystem needs checking",
+			Cause: "The bottle was probably not unmounted cleanly, e.g. after a crash or power loss, and the kernel refuses to mount it until it is repaired.",
+			Steps: []string{
+				"Unlock it without mounting: udisksctl loop-setup -f <bottle>, then udisksctl unlock -b /dev/loopN",
+				"Repair it: sudo fsck -y /dev/mapper/luks-... (the device udisksctl printed)",
+				"Lock it again (udisksctl lock, udisksctl loop-delete) and launch as usual",
+			},
+		},
+	},
+	{
+		match: []string{"target is busy", "device or resource busy"},
+		errorExplanation: errorExplanation{
+			Title: "The bottle is busy",
+			Cause: "A process still has files open in the bottle.",
+			Steps: []string{
+				"Close apps and terminals using files in the bottle, then retry",
+				"Lock it with bottle-launch lock --force <bottle> to stop them",
+			},
+		},
+	},
+	{
+		match: []string{"serviceunknown", "org.freedesktop.udisks2 was not provided", "udisksctl: not found", "\"udisksctl\": executable file not found"},
+		errorExplanation: errorExplanation{
+			Title: "udisks2 is not available",
+			Cause: "bottle-launch unlocks and mounts bottles through the udisks2 service, which isn't installed or running.",
+			Steps: []string{
+				"Install udisks2 and start it: sudo systemctl enable --now udisks2",
+				"Without udisks2, bottle-launch falls back to cryptsetup and mount through sudo",
+			},
+		},
+	},
+	{
+		match: []string{"\"cryptsetup\": executable file not found", "cryptsetup: not found", "cryptsetup: command not found"},
+		errorExplanation: errorExplanation{
+			Title: "cryptsetup is not installed",
+			Cause: "Creating and opening LUKS bottles needs cryptsetup.",
+			Steps: []string{"Install cryptsetup with your package manager and try again"},
+		},
+	},
+}
+
+// explainError recognizes a common failure and explains it. ok is false
+// when the error isn't one it knows.
+func explainError(err error, text string) (errorExplanation, bool) {
+	lower := strings.ToLower(text)
+	if err != nil {
+		lower += "\n" + strings.ToLower(err.Error())
+	}
+	for _, p := range errorPatterns {
+		for _, m := range p.match {
+			if strings.Contains(lower, m) {
+				return p.errorExplanation, true
+			}
+		}
+	}
+	return errorExplanation{}, false
+}
+
+// printErrorHint explains a recognized error on stderr, after the error itself
+func printErrorHint(err error) {
+	explained, ok := explainError(err, "")
+	if !ok {
+		return
+	}
+	fmt.Fprintln(os.Stderr, explained.Title+". "+explained.Cause)
+	for _, step := range explained.Steps {
+		fmt.Fprintln(os.Stderr, "  - "+step)
+	}
+}
@@ -0,0 +1,140 @@
+// Exit codes: a distinct exit status, and a category name, for each kind of failure.
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+)
+
+// errorClass is a kind of failure
+type errorClass struct {
+	Name string // category in --json output
+	Code int
+	Desc string
+}
+
+var (
+	classError         = errorClass{"error", ExitError, "any other failure"}
+	classUsage         = errorClass{"usage", ExitUsage, "bad arguments"}
+	classWrongPassword = errorClass{"wrong_password", ExitWrongPassword, "the password, password manager entry, or key file didn't unlock the bottle"}
+	classNotFound      = errorClass{"not_found", ExitNotFound, "no such bottle, profile, or file"}
+	classInUse         = errorClass{"in_use", ExitInUse, "the bottle is mounted, or in use by another session"}
+	classMissingTool   = errorClass{"missing_tool", ExitMissingTool, "udisks2, cryptsetup, flatpak, libfido2, or another tool is missing"}
+	classFIDO2         = errorClass{"fido2", ExitFIDO2, "no security key connected, the wrong one, or it wasn't touched"}
+	classAppFailed     = errorClass{"app_failed", ExitAppFailed, "the app exited with an error or crashed"}
+	classConfigChanged = errorClass{"config_changed", ExitConfigChanged, "the bottle's config was changed outside bottle-launch"}
+)
+
+// errorClasses lists the classes for `help exit-codes`
+var errorClasses = []errorClass{classError, classUsage, classWrongPassword, classNotFound, classInUse,
+	classMissingTool, classFIDO2, classAppFailed, classConfigChanged}
+
+// classifiedError is an error that carries its kind of failure
+type classifiedError interface {
+	error
+	category() errorClass
+}
+
+// appExitError is an app that exited unsuccessfully
+type appExitError struct {
+	app  string
+	err  error
+	code int // the app's exit status; -1 if a signal killed it
+}
+
+// newAppExitError wraps the error an app's command exited with
+func newAppExitError(app string, err error) *appExitError {
+	code := 1
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.ExitCode()
+	}
+	return &appExitError{app: app, err: err, code: code}
+}
+
+func (e *appExitError) Error() string {
+	return e.app + ": " + e.err.Error()
+}
+
+func (e *appExitError) Unwrap() error {
+	return e.err
+}
+
+// classifyError returns the kind of a failure
+func classifyError(err error) errorClass {
+	var classified classifiedError
+	var inUse *bottleInUseError
+	var appErr *appExitError
+	switch {
+	case errors.As(err, &classified) && classified.category() != (errorClass{}):
+		return classified.category()
+	case errors.As(err, &appErr):
+		return classAppFailed
+	case errors.As(err, &inUse):
+		return classInUse
+	case errors.Is(err, exec.ErrNotFound):
+		return classMissingTool
+	case errors.Is(err, os.ErrNotExist):
+		return classNotFound
+	}
+	return classError
+}
+
+// classNamed returns the class with a category name
+func classNamed(name string) (errorClass, bool) {
+	i := slices.IndexFunc(errorClasses, func(c errorClass) bool { return c.Name == name })
+	if i < 0 {
+		return errorClass{}, false
+	}
+	return errorClasses[i], true
+}
+
+// jsonErrors reports whether --json is given before any "--", so errors
+// are reported as JSON (arguments after "--" belong to the app)
+func jsonErrors() bool {
+	args := os.Args[1:]
+	if i := slices.Index(args, "--"); i >= 0 {
+		args = args[:i]
+	}
+	return slices.Contains(args, "--json")
+}
+
+// exitWithError reports a failed command, explaining it if it is a
+// recognized failure, and exits with its class's code. With --json on the
+// command line, the error goes to stdout as JSON.
+func exitWithError(err error) {
+	class := classifyError(err)
+	if jsonErrors() {
+		var appExit *int
+		var appErr *appExitError
+		if errors.As(err, &appErr) {
+			appExit = &appErr.code
+		}
+		_ = writeStatusJSON(os.Stdout, struct {
+			Error       string `json:"error"`
+			Category    string `json:"category"`
+			ExitCode    int    `json:"exit_code"`
+			AppExitCode *int   `json:"app_exit_code,omitempty"`
+		}{err.Error(), class.Name, class.Code, appExit})
+	} else {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		printErrorHint(err)
+	}
+	os.Exit(class.Code)
+}
+
+// printExitCodes documents the exit codes, for `help exit-codes`
+func printExitCodes() {
+	fmt.Println("Exit codes (the category is the \"category\" field of --json errors):")
+	fmt.Println()
+	fmt.Printf("  %3d  %-16s %s\n", 0, "", "success")
+	for _, c := range errorClasses {
+		fmt.Printf("  %3d  %-16s %s\n", c.Code, c.Name, c.Desc)
+	}
+	fmt.Printf("  %3d  %-16s %s\n", ExitSIGINT, "", "interrupted (ctrl+c)")
+	fmt.Println()
+	fmt.Println("status has its own codes: 0 mounted, 3 unlocked, 4 locked, 5 missing.")
+}
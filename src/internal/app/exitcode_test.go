@@ -0,0 +1,111 @@
+// Tests for exit codes: which class each kind of failure falls in.
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	_, atoiErr := strconv.Atoi("ten")
+	tests := []struct {
+		name string
+		err  error
+		want errorClass
+	}{
+		{"plain error", errors.New("something broke"), classError},
+		{"bottle error", &bottleError{op: "create", msg: "disk full"}, classError},
+		// Bad arguments
+		{"usage op", &bottleError{op: "usage", msg: "missing bottle name"}, classUsage},
+		{"usage flag", &bottleError{op: "config", msg: "bad value", usage: true}, classUsage},
+		{"bad argument", badArgument("config", atoiErr), classUsage},
+		{"bad argument keeps op", badArgument("run", &bottleError{op: "timeout", msg: "not a duration"}), classUsage},
+		{"wrapped bad argument", fmt.Errorf("work: %w", badArgument("config", atoiErr)), classUsage},
+		// Everything else
+		{"app exit", &appExitError{app: "firefox", err: errors.New("exit status 1")}, classAppFailed},
+		{"wrapped app exit", fmt.Errorf("run: %w", &appExitError{app: "firefox", err: errors.New("exit status 1")}), classAppFailed},
+		{"missing executable", &exec.Error{Name: "cryptsetup", Err: exec.ErrNotFound}, classMissingTool},
+		{"no security key", errNoFIDO2Device, classFIDO2},
+		{"wrong password", errWrongPassword, classWrongPassword},
+		{"wrong password from daemon", &daemonError{msg: "unlock: wrong password", class: classWrongPassword}, classWrongPassword},
+		{"wrapped wrong password", fmt.Errorf("mount: %w", errWrongPassword), classWrongPassword},
+		{"wrong key file", &bottleError{op: "key drive", msg: "didn't unlock", class: classWrongPassword}, classWrongPassword},
+		{"missing libfido2", &bottleError{op: "fido2", msg: "fido2-assert not found - install libfido2", class: classMissingTool}, classMissingTool},
+		{"udisks service down", udisksFailure("loop-setup", []byte("Error: The name org.freedesktop.UDisks2 was not provided")), classMissingTool},
+		{"udisks other failure", udisksFailure("loop-setup", []byte("Error: no such file")), classError},
+		// Matched by type, not by wording
+		{"checksum mismatch", &bottleError{op: "self-update", msg: "checksum mismatch for bottle-launch - not installed"}, classError},
+		{"message only", errors.New("unlock: wrong password"), classError},
+		{"not found", errBottleNotFound, classNotFound},
+		{"missing file", &os.PathError{Op: "open", Path: "x", Err: os.ErrNotExist}, classNotFound},
+		{"mounted", errBottleMounted, classInUse},
+		{"journal held", errJournalHeld, classInUse},
+		{"in use", &bottleInUseError{bottle: "work.bottle"}, classInUse},
+		{"config changed", errConfigTampered("work.bottle"), classConfigChanged},
+		{"unknown error from daemon", &daemonError{msg: "rpc: can't find method"}, classError},
+	}
+	for _, tt := range tests {
+		if got := classifyError(tt.err); got != tt.want {
+			t.Errorf("%s: classifyError(%v) = %s, want %s", tt.name, tt.err, got.Name, tt.want.Name)
+		}
+	}
+}
+
+func TestDaemonErrorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want errorClass
+	}{
+		{"wrong password", errWrongPassword, classWrongPassword},
+		{"in use", &bottleInUseError{bottle: "work.bottle"}, classInUse},
+		{"plain", errors.New("disk full"), classError},
+	}
+	for _, tt := range tests {
+		sent := toDaemonError(tt.err).Error()
+		name, msg, _ := strings.Cut(sent, "] ")
+		class, ok := classNamed(strings.TrimPrefix(name, "["))
+		if !ok || class != tt.want || msg != tt.err.Error() {
+			t.Errorf("%s: sent %q, want category %s and message %q", tt.name, sent, tt.want.Name, tt.err.Error())
+		}
+	}
+	if toDaemonError(nil) != nil {
+		t.Error("toDaemonError(nil) != nil")
+	}
+}
+
+func TestNewAppExitError(t *testing.T) {
+	err := exec.Command("sh", "-c", "exit 3").Run()
+	if got := newAppExitError("firefox", err); got.code != 3 || classifyError(got) != classAppFailed {
+		t.Errorf("newAppExitError(exit 3) = code %d, class %s", got.code, classifyError(got).Name)
+	}
+	if got := newAppExitError("firefox", errors.New("failed")); got.code != 1 {
+		t.Errorf("newAppExitError(not an exit) = code %d, want 1", got.code)
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"bottle-launch", "run", "work", "org.mozilla.firefox", "--json"}, true},
+		{[]string{"bottle-launch", "bench", "--json", "work"}, true},
+		{[]string{"bottle-launch", "run", "work", "org.mozilla.firefox"}, false},
+		// The app's own --json
+		{[]string{"bottle-launch", "run", "work", "org.example.Tool", "--", "--json"}, false},
+	}
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	for _, tt := range tests {
+		os.Args = tt.args
+		if got := jsonErrors(); got != tt.want {
+			t.Errorf("jsonErrors() with %q = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
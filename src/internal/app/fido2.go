@@ -0,0 +1,565 @@
+// FIDO2/YubiKey support: device enumeration, credential creation, and hmac-secret retrieval.
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// newFIDO2Party returns the RP ID and user name for a new bottle's credential
+func newFIDO2Party() (rpID, user string) {
+	return globalConfig.GetDefault("FIDO2_RP_ID", DefaultFIDO2RPID), globalConfig.GetDefault("FIDO2_USER", DefaultFIDO2User)
+}
+
+// bottleFIDO2Party returns the RP ID and user name a bottle was enrolled with
+func bottleFIDO2Party(perms *Permissions) (rpID, user string) {
+	rpID, user = perms.FIDO2RPID, perms.FIDO2User
+	if rpID == "" {
+		rpID = DefaultFIDO2RPID
+	}
+	if user == "" {
+		user = DefaultFIDO2User
+	}
+	return rpID, user
+}
+
+// fido2TouchPolicy returns the touch timeout per attempt and the retry count
+func fido2TouchPolicy() (timeout time.Duration, retries int) {
+	timeout = DefaultFIDO2TouchTimeout
+	if d, err := parseTimeout(globalConfig.Get("FIDO2_TOUCH_TIMEOUT")); err == nil && d > 0 {
+		timeout = d
+	}
+	return timeout, max(globalConfig.GetInt("FIDO2_RETRIES", DefaultFIDO2Retries), 0)
+}
+
+// fido2TouchWindow is how long an assertion waits for touch, retries included
+func fido2TouchWindow() time.Duration {
+	timeout, retries := fido2TouchPolicy()
+	return timeout * time.Duration(retries+1)
+}
+
+// FIDO2Device represents an available authenticator
+type FIDO2Device struct {
+	Path        string // e.g., "/dev/hidraw3"
+	Description string // e.g., "Yubico YubiKey"
+}
+
+// CheckFIDO2Available verifies libfido2 tools are installed
+func CheckFIDO2Available() error {
+	if mockMode {
+		return nil
+	}
+	for _, tool := range []string{"fido2-token", "fido2-cred", "fido2-assert"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			return &bottleError{op: "fido2", msg: tool + " not found - install libfido2", class: classMissingTool}
+		}
+	}
+	return nil
+}
+
+// CheckPrivilegeEscalation verifies pkexec or sudo is available
+func CheckPrivilegeEscalation() error {
+	if mockMode {
+		return nil
+	}
+	if _, err := exec.LookPath("pkexec"); err == nil {
+		return nil
+	}
+	if _, err := exec.LookPath("sudo"); err == nil {
+		return nil
+	}
+	return fmt.Errorf("neither pkexec nor sudo found - cannot create LUKS volume")
+}
+
+// EnumerateFIDO2Devices lists connected FIDO2 authenticators
+func EnumerateFIDO2Devices() ([]FIDO2Device, error) {
+	if mockMode {
+		return []FIDO2Device{{Path: "/dev/null", Description: "Mock FIDO2 key"}}, nil
+	}
+	out, err := command("fido2-token", "-L").Output()
+	if err != nil {
+		return nil, fmt.Errorf("fido2-token -L failed: %w", err)
+	}
+
+	var devices []FIDO2Device
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		// Format: /dev/hidraw3: vendor=0x1050, product=0x0407 (Description)
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) >= 1 {
+			dev := FIDO2Device{Path: strings.TrimSpace(parts[0])}
+			if len(parts) >= 2 {
+				dev.Description = strings.TrimSpace(parts[1])
+			}
+			devices = append(devices, dev)
+		}
+	}
+	return devices, nil
+}
+
+// generateBottleID creates a random 32-byte ID for a new bottle (base64 encoded)
+// This is stored in config and used as clientDataHash for FIDO2 operations
+func generateBottleID() (string, error) {
+	id := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate bottle ID: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(id), nil
+}
+
+// CreateFIDO2Credential creates a credential and returns (credentialID, salt)
+// bottleID should be generated fresh via generateBottleID() and saved to config
+func CreateFIDO2Credential(ctx context.Context, device, rpID, user, bottleID string) (credID, salt string, err error) {
+	if mockMode {
+		return mockFIDO2Credential()
+	}
+	clientData := bottleID // bottleID is already base64-encoded 32 bytes
+
+	// Generate random 32-byte salt
+	saltBytes := make([]byte, 32)
+	if _, err := rand.Read(saltBytes); err != nil {
+		return "", "", fmt.Errorf("generate salt: %w", err)
+	}
+	salt = base64.StdEncoding.EncodeToString(saltBytes)
+
+	// Create temp input file with restricted permissions
+	inputFile, err := os.CreateTemp("", "fido2-cred-input-")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.Remove(inputFile.Name())
+	os.Chmod(inputFile.Name(), 0600)
+
+	// Write input: cdh, rpid, user_name, user_id
+	fmt.Fprintf(inputFile, "%s\n%s\n%s\n%s\n",
+		clientData, rpID, user, clientData)
+	inputFile.Close()
+
+	// Run fido2-cred with input file
+	input, err := os.Open(inputFile.Name())
+	if err != nil {
+		return "", "", err
+	}
+	defer input.Close()
+
+	var stdout, stderr bytes.Buffer
+	cmd := commandContext(ctx, "fido2-cred", "-M", "-h", device, "es256")
+	cmd.Stdin = input
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", "", ctx.Err()
+		}
+		return "", "", fmt.Errorf("fido2-cred failed: %s", stderr.String())
+	}
+
+	// Parse output - credential_id is line 5 (0-indexed: 4)
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) < 5 {
+		return "", "", fmt.Errorf("unexpected fido2-cred output format: expected at least 5 lines, got %d", len(lines))
+	}
+	credID = strings.TrimSpace(lines[4])
+
+	return credID, salt, nil
+}
+
+// GetFIDO2Secret retrieves the hmac-secret (requires touch)
+// bottleID comes from config.FIDO2BottleID
+// Returns raw 32-byte secret; cancelling ctx stops waiting for the touch
+func GetFIDO2Secret(ctx context.Context, device, rpID, bottleID, credID, salt string) ([]byte, error) {
+	if mockMode {
+		return mockFIDO2Secret(rpID, bottleID, credID, salt), nil
+	}
+	clientData := bottleID // bottleID is already base64-encoded 32 bytes
+
+	// Input: cdh, rpid, cred_id, hmac_salt
+	inputPath, err := fido2InputFile(clientData, rpID, credID, salt)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(inputPath)
+
+	// Run fido2-assert, again after a missed touch
+	timeout, retries := fido2TouchPolicy()
+	var stdout string
+	for attempt := 0; ; attempt++ {
+		var timedOut bool
+		stdout, timedOut, err = runFIDO2Assert(ctx, inputPath, timeout, "-G", "-h", device, "es256")
+		if !timedOut {
+			break
+		}
+		if attempt == retries {
+			return nil, &bottleError{op: "fido2", msg: fmt.Sprintf(
+				"the security key wasn't touched in time (%s, %d attempts) - touch it while it blinks, or raise FIDO2_TOUCH_TIMEOUT or FIDO2_RETRIES",
+				timeout, attempt+1)}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse output - hmac_secret is last line (may be line 4 or 5 depending on flags)
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) < 5 {
+		return nil, fmt.Errorf("unexpected fido2-assert output: expected at least 5 lines, got %d", len(lines))
+	}
+	hmacSecretB64 := strings.TrimSpace(lines[len(lines)-1])
+
+	// Decode base64 to raw bytes
+	secret, err := base64.StdEncoding.DecodeString(hmacSecretB64)
+	if err != nil {
+		return nil, fmt.Errorf("decode hmac-secret: %w", err)
+	}
+	if len(secret) != 32 {
+		return nil, fmt.Errorf("unexpected hmac-secret length: %d", len(secret))
+	}
+
+	return secret, nil
+}
+
+// fido2InputFile writes the input of a fido2 tool, one value per line, to a
+// private temp file and returns its path
+func fido2InputFile(values ...string) (string, error) {
+	inputFile, err := os.CreateTemp("", "fido2-assert-input-")
+	if err != nil {
+		return "", err
+	}
+	defer inputFile.Close()
+	os.Chmod(inputFile.Name(), 0600)
+	for _, v := range values {
+		fmt.Fprintln(inputFile, v)
+	}
+	return inputFile.Name(), nil
+}
+
+// runFIDO2Assert runs fido2-assert on an input file, killing it after
+// timeout. timedOut is set when the touch window passed, whether the key or
+// the timeout ended it. Cancelling ctx stops it with ctx's error.
+func runFIDO2Assert(ctx context.Context, inputPath string, timeout time.Duration, args ...string) (stdout string, timedOut bool, err error) {
+	input, err := os.Open(inputPath)
+	if err != nil {
+		return "", false, err
+	}
+	defer input.Close()
+
+	var out, stderr bytes.Buffer
+	cmd := commandContext(ctx, "fido2-assert", args...)
+	cmd.Stdin = input
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return "", false, err
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err = <-done:
+	case <-time.After(timeout):
+		cmd.Process.Kill()
+		<-done
+		return "", true, nil
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", false, ctx.Err()
+		}
+		// The key's own window is fixed; it reports FIDO_ERR_ACTION_TIMEOUT
+		if strings.Contains(stderr.String(), "ACTION_TIMEOUT") {
+			return "", true, nil
+		}
+		return "", false, fmt.Errorf("fido2-assert failed: %s", stderr.String())
+	}
+	return out.String(), false, nil
+}
+
+// fido2HoldsCredential asks a key, without a touch, whether it holds a
+// bottle's credential. ok is false if the key couldn't tell.
+func fido2HoldsCredential(device, rpID, bottleID, credID string) (holds, ok bool) {
+	if mockMode {
+		return true, true
+	}
+	inputPath, err := fido2InputFile(bottleID, rpID, credID)
+	if err != nil {
+		return false, false
+	}
+	defer os.Remove(inputPath)
+	// A silent assertion (up=false) needs no touch; only the key that
+	// created the credential can use its ID
+	_, timedOut, err := runFIDO2Assert(context.Background(), inputPath, FIDO2ProbeTimeout, "-G", "-t", "up=false", device, "es256")
+	switch {
+	case err == nil && !timedOut:
+		return true, true
+	case err != nil && strings.Contains(err.Error(), "NO_CREDENTIALS"):
+		return false, true
+	}
+	return false, false
+}
+
+// orderFIDO2Devices sorts connected keys for trying to unlock a bottle: the
+// keys holding its credential first, then the one at the recorded device
+// path, then the rest, and last the keys that said they don't hold it
+func orderFIDO2Devices(devices []FIDO2Device, perms *Permissions) []FIDO2Device {
+	if len(devices) < 2 {
+		return devices
+	}
+	rpID, _ := bottleFIDO2Party(perms)
+	rank := make(map[string]int, len(devices))
+	for _, dev := range devices {
+		holds, ok := fido2HoldsCredential(dev.Path, rpID, perms.FIDO2BottleID, perms.FIDO2CredentialID)
+		switch {
+		case holds:
+			rank[dev.Path] = 0
+		case ok:
+			rank[dev.Path] = 3
+		case dev.Path == perms.FIDO2DeviceHint:
+			rank[dev.Path] = 1
+		default:
+			rank[dev.Path] = 2
+		}
+	}
+	ordered := slices.Clone(devices)
+	slices.SortStableFunc(ordered, func(a, b FIDO2Device) int {
+		return rank[a.Path] - rank[b.Path]
+	})
+	return ordered
+}
+
+// privCmd creates a command with appropriate privilege escalation
+// Tries pkexec first (graphical polkit prompt), falls back to sudo
+func privCmd(name string, args ...string) *exec.Cmd {
+	return privCmdContext(context.Background(), name, args...)
+}
+
+// privCmdContext is privCmd for a step that ctx can cancel
+func privCmdContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	if _, err := exec.LookPath("pkexec"); err == nil {
+		return commandContext(ctx, "pkexec", append([]string{name}, args...)...)
+	}
+	return commandContext(ctx, "sudo", append([]string{name}, args...)...)
+}
+
+// cryptsetupCmd creates a command with appropriate privilege escalation
+// Tries pkexec first (graphical polkit prompt), falls back to sudo
+func cryptsetupCmd(args ...string) *exec.Cmd {
+	return privCmd("cryptsetup", args...)
+}
+
+// writeSecretToTempFile writes binary secret to a temp file with mode 0600
+// Returns path and cleanup function
+func writeSecretToTempFile(secret []byte, prefix string) (string, func(), error) {
+	f, err := os.CreateTemp("", prefix)
+	if err != nil {
+		return "", nil, err
+	}
+	path := f.Name()
+	os.Chmod(path, 0600)
+	f.Write(secret)
+	f.Close()
+	cleanup := func() { os.Remove(path) }
+	return path, cleanup, nil
+}
+
+// FormatBottleWithFIDO2 creates a LUKS-encrypted bottle using FIDO2-derived secret
+func FormatBottleWithFIDO2(ctx context.Context, bottlePath string, fido2Secret []byte) error {
+	keyPath, cleanup, err := writeSecretToTempFile(fido2Secret, "fido2-luks-key-")
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	cmd := privCmdContext(ctx, "cryptsetup", luksFormatArgs(
+		"--type", "luks2",
+		"--batch-mode",
+		"--key-file", keyPath,
+		bottlePath)...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("luksFormat: %s", stderr.String())
+	}
+	return nil
+}
+
+// OpenLUKSWithFIDO2 opens a LUKS device using FIDO2-derived secret
+func OpenLUKSWithFIDO2(ctx context.Context, loopDev, mapperName string, fido2Secret []byte) error {
+	keyPath, cleanup, err := writeSecretToTempFile(fido2Secret, "fido2-luks-open-")
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	cmd := privCmdContext(ctx, "cryptsetup", "open",
+		"--key-file", keyPath,
+		loopDev, mapperName)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("cryptsetup open: %s", stderr.String())
+	}
+	return nil
+}
+
+// TestLUKSKeyFIDO2 checks that a FIDO2-derived secret unlocks a bottle
+// without activating it
+func TestLUKSKeyFIDO2(bottlePath string, fido2Secret []byte) error {
+	keyPath, cleanup, err := writeSecretToTempFile(fido2Secret, "fido2-luks-test-")
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	cmd := cryptsetupCmd("open", "--test-passphrase", "--key-file", keyPath, bottlePath)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("cryptsetup test-passphrase: %s", stderr.String())
+	}
+	return nil
+}
+
+// AddLUKSKeyFIDO2 adds a keyslot for newSecret, authorized by an existing secret
+func AddLUKSKeyFIDO2(bottlePath string, existingSecret, newSecret []byte) error {
+	return addLUKSKey(bottlePath, existingSecret, newSecret)
+}
+
+// addLUKSKey runs luksAddKey for newSecret with extra cryptsetup options
+func addLUKSKey(bottlePath string, existingSecret, newSecret []byte, extra ...string) error {
+	existingKeyPath, cleanupExisting, err := writeSecretToTempFile(existingSecret, "fido2-luks-old-")
+	if err != nil {
+		return err
+	}
+	defer cleanupExisting()
+	newKeyPath, cleanupNew, err := writeSecretToTempFile(newSecret, "fido2-luks-new-")
+	if err != nil {
+		return err
+	}
+	defer cleanupNew()
+
+	args := append([]string{"luksAddKey", "--batch-mode", "--key-file", existingKeyPath}, extra...)
+	cmd := cryptsetupCmd(append(args, bottlePath, newKeyPath)...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("luksAddKey: %s", stderr.String())
+	}
+	return nil
+}
+
+// luksKeyslots returns the numbers of a bottle's keyslots in use
+func luksKeyslots(bottlePath string) ([]int, error) {
+	out, err := command("cryptsetup", "luksDump", bottlePath).Output()
+	if err != nil {
+		return nil, fmt.Errorf("luksDump: %w", err)
+	}
+	return parseLUKSKeyslots(string(out)), nil
+}
+
+// parseLUKSKeyslots reads the keyslot numbers from LUKS2 luksDump output:
+// the "N: luks2" lines of its Keyslots section
+func parseLUKSKeyslots(dump string) []int {
+	var slots []int
+	inKeyslots := false
+	for _, line := range strings.Split(dump, "\n") {
+		if line != "" && line[0] != ' ' && line[0] != '\t' {
+			inKeyslots = line == "Keyslots:"
+			continue
+		}
+		num, _, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if n, err := strconv.Atoi(num); inKeyslots && ok && err == nil {
+			slots = append(slots, n)
+		}
+	}
+	return slots
+}
+
+// luks2Keyslots is how many keyslots a LUKS2 header has
+const luks2Keyslots = 32
+
+// freeLUKSKeyslot returns the lowest keyslot a LUKS2 bottle doesn't use
+func freeLUKSKeyslot(bottlePath string) (int, error) {
+	slots, err := luksKeyslots(bottlePath)
+	if err != nil {
+		return -1, err
+	}
+	for n := 0; n < luks2Keyslots; n++ {
+		if !slices.Contains(slots, n) {
+			return n, nil
+		}
+	}
+	return -1, &bottleError{op: "luks", msg: "all keyslots of " + bottleName(bottlePath) + " are in use"}
+}
+
+// luksKeyslotOf returns the keyslot a secret opens
+func luksKeyslotOf(bottlePath string, secret []byte) (int, error) {
+	keyPath, cleanup, err := writeSecretToTempFile(secret, "fido2-luks-test-")
+	if err != nil {
+		return -1, err
+	}
+	defer cleanup()
+
+	out, err := cryptsetupCmd("open", "--test-passphrase", "--verbose", "--key-file", keyPath, bottlePath).CombinedOutput()
+	if err != nil {
+		return -1, fmt.Errorf("cryptsetup test-passphrase: %s", out)
+	}
+	if m := keyslotUnlockedPattern.FindStringSubmatch(string(out)); m != nil {
+		return strconv.Atoi(m[1])
+	}
+	return -1, fmt.Errorf("cryptsetup test-passphrase didn't name the keyslot: %s", out)
+}
+
+// keyslotUnlockedPattern is cryptsetup --verbose's "Key slot 1 unlocked."
+var keyslotUnlockedPattern = regexp.MustCompile(`Key slot (\d+) unlocked`)
+
+// killLUKSKeyslot wipes a keyslot; batch mode needs no passphrase for it
+func killLUKSKeyslot(bottlePath string, slot int) error {
+	if out, err := cryptsetupCmd("luksKillSlot", "--batch-mode", bottlePath, strconv.Itoa(slot)).CombinedOutput(); err != nil {
+		return fmt.Errorf("luksKillSlot: %s", out)
+	}
+	return nil
+}
+
+// IsFIDO2Bottle checks if a bottle is configured to use FIDO2
+// Returns true if all FIDO2 fields are present, false if none are present
+// Returns error if partially configured (corrupted state)
+func IsFIDO2Bottle(perms *Permissions) (bool, error) {
+	hasBottleID := perms.FIDO2BottleID != ""
+	hasCredID := perms.FIDO2CredentialID != ""
+	hasSalt := perms.FIDO2Salt != ""
+
+	// All present = FIDO2 bottle
+	if hasBottleID && hasCredID && hasSalt {
+		return true, nil
+	}
+
+	// None present = password bottle
+	if !hasBottleID && !hasCredID && !hasSalt {
+		return false, nil
+	}
+
+	// Partial = corrupted config
+	return false, fmt.Errorf("config corrupted: FIDO2 data incomplete (bottle_id=%v, cred_id=%v, salt=%v)",
+		hasBottleID, hasCredID, hasSalt)
+}
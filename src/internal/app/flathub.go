@@ -0,0 +1,105 @@
+// Flathub: searching for apps that aren't installed and installing them for the user.
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+const (
+	flathubRemote  = "flathub"
+	flathubRepoURL = "https://dl.flathub.org/repo/flathub.flatpakrepo"
+)
+
+// remoteApp is a search result from Flathub
+type remoteApp struct {
+	ID      string
+	Name    string
+	Summary string
+}
+
+// searchFlathub searches the appstream data of the Flathub remote(s)
+// configured on this machine, user or system
+func searchFlathub(query string) ([]remoteApp, error) {
+	if mockMode {
+		return mockSearchFlathub(query), nil
+	}
+	out, err := command("flatpak", "search", "--columns=application,name,description,remotes", query).Output()
+	if err != nil {
+		var stderr string
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr = strings.TrimSpace(string(exitErr.Stderr))
+		}
+		return nil, &bottleError{op: "flathub search", msg: strings.TrimSpace(stderr + " " + err.Error())}
+	}
+
+	var apps []remoteApp
+	for _, line := range strings.Split(string(out), "\n") {
+		// Format: id\tname\tsummary\tremote1,remote2 ("No matches found" has no tabs)
+		fields := strings.Split(line, "\t")
+		if len(fields) < 4 {
+			continue
+		}
+		onFlathub := false
+		for _, remote := range strings.Split(fields[3], ",") {
+			if strings.TrimSpace(remote) == flathubRemote {
+				onFlathub = true
+			}
+		}
+		if onFlathub {
+			apps = append(apps, remoteApp{ID: fields[0], Name: fields[1], Summary: fields[2]})
+		}
+	}
+	return apps, nil
+}
+
+// installFlathubApp installs appID from Flathub into the user installation
+// (adding the remote there first if needed), passing each progress line
+// flatpak prints to progress
+func installFlathubApp(appID string, progress func(string)) error {
+	if mockMode {
+		return mockInstallApp(appID, progress)
+	}
+	if out, err := command("flatpak", "remote-add", "--user", "--if-not-exists", flathubRemote, flathubRepoURL).CombinedOutput(); err != nil {
+		return &bottleError{op: "flathub", msg: "adding the remote failed: " + strings.TrimSpace(string(out))}
+	}
+
+	cmd := command("flatpak", "install", "--user", "--noninteractive", "-y", flathubRemote, appID)
+	pr, pw := io.Pipe()
+	cmd.Stdout, cmd.Stderr = pw, pw
+	if err := cmd.Start(); err != nil {
+		return &bottleError{op: "install", msg: err.Error()}
+	}
+	go func() {
+		_ = pw.CloseWithError(cmd.Wait())
+	}()
+
+	// flatpak redraws its progress bar with \r, so split on that too
+	var last string
+	scanner := bufio.NewScanner(pr)
+	scanner.Split(scanProgressLines)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			last = line
+			progress(line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return &bottleError{op: "install", msg: strings.TrimSpace(last + " " + err.Error())}
+	}
+	return nil
+}
+
+// scanProgressLines is a bufio.SplitFunc that ends lines at \n or \r
+func scanProgressLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
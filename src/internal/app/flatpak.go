@@ -0,0 +1,243 @@
+// Flatpak integration: application listing and sandboxed execution.
+package app
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// FlatpakApp represents an installed Flatpak application
+type FlatpakApp struct {
+	ID   string
+	Name string
+
+	// Installation is where the app is installed: "user", "system", or the
+	// name of a custom installation (empty = let flatpak choose)
+	Installation string
+	Arch         string
+	Branch       string
+
+	// Duplicate is set when the same app ID is also installed elsewhere, so
+	// flatpak run must be told which installation to use
+	Duplicate bool
+}
+
+// Ref returns the app's full ref (app/<id>/<arch>/<branch>), which picks
+// one branch and arch when several are installed side by side, or just the
+// ID if they are unknown
+func (a FlatpakApp) Ref() string {
+	if a.Arch == "" || a.Branch == "" {
+		return a.ID
+	}
+	return "app/" + a.ID + "/" + a.Arch + "/" + a.Branch
+}
+
+// parseAppRef accepts an app ID or a full ref as written by Ref
+func parseAppRef(s string) FlatpakApp {
+	if parts := strings.Split(s, "/"); len(parts) == 4 && parts[0] == "app" {
+		return FlatpakApp{ID: parts[1], Name: parts[1], Arch: parts[2], Branch: parts[3]}
+	}
+	return FlatpakApp{ID: s, Name: s}
+}
+
+// Origin describes where the app is installed, e.g. "user, beta, i386"
+func (a FlatpakApp) Origin() string {
+	var parts []string
+	if a.Installation != "" {
+		parts = append(parts, a.Installation)
+	}
+	if a.Branch != "" && a.Branch != "stable" {
+		parts = append(parts, a.Branch)
+	}
+	if a.Arch != "" && a.Arch != hostFlatpakArch() {
+		parts = append(parts, a.Arch)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// hostFlatpakArch returns flatpak's name for the machine's architecture
+func hostFlatpakArch() string {
+	switch runtime.GOARCH {
+	case "amd64":
+		return "x86_64"
+	case "arm64":
+		return "aarch64"
+	case "386":
+		return "i386"
+	}
+	return runtime.GOARCH
+}
+
+// installationArgs selects the app's installation for flatpak run. Only
+// needed when it is installed in more than one; otherwise flatpak finds it.
+func (a FlatpakApp) installationArgs() []string {
+	if !a.Duplicate {
+		return nil
+	}
+	switch a.Installation {
+	case "":
+		return nil
+	case "user":
+		return []string{"--user"}
+	case "system":
+		return []string{"--system"}
+	}
+	return []string{"--installation=" + a.Installation}
+}
+
+// listFlatpakApps returns all installed Flatpak applications.
+// Returns nil if flatpak is not available or the command fails.
+func listFlatpakApps() []FlatpakApp {
+	return listFlatpakAppsContext(context.Background())
+}
+
+// listFlatpakAppsContext is listFlatpakApps for a listing ctx can cancel
+func listFlatpakAppsContext(ctx context.Context) []FlatpakApp {
+	if mockMode {
+		return markDuplicateApps(slices.Clone(mockApps))
+	}
+	out, err := commandContext(ctx, "flatpak", "list", "--app", "--columns=application,name,installation,arch,branch").Output()
+	if err != nil {
+		return nil
+	}
+
+	var apps []FlatpakApp
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		// Format: com.example.App\tApp Name\tuser\tx86_64\tstable
+		parts := strings.Split(line, "\t")
+		app := FlatpakApp{ID: parts[0], Name: parts[0]}
+		if len(parts) >= 2 && parts[1] != "" {
+			app.Name = parts[1]
+		}
+		if len(parts) >= 5 {
+			app.Installation, app.Arch, app.Branch = parts[2], parts[3], parts[4]
+		}
+		apps = append(apps, app)
+	}
+
+	sort.SliceStable(apps, func(i, j int) bool {
+		return apps[i].Name < apps[j].Name
+	})
+
+	return markDuplicateApps(apps)
+}
+
+// markDuplicateApps flags apps whose ID is installed more than once
+func markDuplicateApps(apps []FlatpakApp) []FlatpakApp {
+	installs := map[string]int{}
+	for _, app := range apps {
+		installs[app.ID]++
+	}
+	for i := range apps {
+		apps[i].Duplicate = installs[apps[i].ID] > 1
+	}
+	return apps
+}
+
+// buildFlatpakArgs builds the flatpak run command arguments
+func buildFlatpakArgs(app FlatpakApp, mountPoint string, perms *Permissions, extraArgs []string) []string {
+	args := append([]string{"run"}, app.installationArgs()...)
+	args = append(args,
+		"--sandbox",
+		"--filesystem="+mountPoint,
+	)
+
+	// Permissions
+	if perms.Network {
+		args = append(args, "--share=network")
+	}
+	if perms.Audio {
+		args = append(args, "--socket=pulseaudio")
+	}
+	if perms.GPU {
+		args = append(args, "--device=dri")
+	}
+	if perms.Wayland {
+		args = append(args, "--socket=wayland")
+	}
+	if perms.X11 {
+		args = append(args, "--socket=fallback-x11")
+	}
+	if perms.Camera {
+		args = append(args, "--device=video0")
+	}
+	if perms.Printing {
+		args = append(args, "--socket=cups")
+	}
+	if perms.Accessibility {
+		args = append(args, "--a11y-bus")
+	}
+	for _, t := range busToggles {
+		if *permissionToggle(perms, t.pref) {
+			for _, name := range t.names {
+				args = append(args, "--"+t.policy+"-name="+name)
+			}
+		}
+	}
+
+	// Environment
+	args = append(args,
+		"--env=GTK_USE_PORTAL=0",
+		"--env=HOME="+mountPoint,
+		"--env=XDG_DATA_HOME="+filepath.Join(mountPoint, ".local", "share"),
+		"--env=XDG_CONFIG_HOME="+filepath.Join(mountPoint, ".config"),
+		"--env=XDG_CACHE_HOME="+filepath.Join(mountPoint, ".cache"),
+		"--env=XDG_DOWNLOAD_DIR="+filepath.Join(mountPoint, "Downloads"),
+	)
+
+	args = append(args, app.Ref())
+	args = append(args, extraArgs...)
+
+	return args
+}
+
+// buildFlatpakCommand creates an exec.Cmd for running a Flatpak app, with
+// env as its environment (nil for this process's).
+func buildFlatpakCommand(app FlatpakApp, mountPoint string, perms *Permissions, extraArgs, env []string) *exec.Cmd {
+	// Create standard directories
+	dirs := []string{
+		"Downloads",
+		".config",
+		".local/share",
+		".cache",
+	}
+	for _, dir := range dirs {
+		os.MkdirAll(filepath.Join(mountPoint, dir), 0755)
+	}
+
+	var cmd *exec.Cmd
+	if mockMode {
+		cmd = mockFlatpakCommand(app.ID, mountPoint, extraArgs)
+	} else {
+		cmd = command("flatpak", buildFlatpakArgs(app, mountPoint, perms, extraArgs)...)
+	}
+	cmd.Env = env
+	wrapper, err := prepareDNSOverrides(mountPoint, perms)
+	if err != nil {
+		// Don't run with the host's DNS when the bottle asks for its own
+		cmd.Err = err
+	} else if wrapper != "" {
+		cmd.Env = append(cmd.Environ(), "FLATPAK_BWRAP="+wrapper)
+	}
+	return cmd
+}
+
+// runFlatpakApp runs a Flatpak app (blocking)
+func runFlatpakApp(app FlatpakApp, mountPoint string, perms *Permissions, extraArgs []string) error {
+	cmd := buildFlatpakCommand(app, mountPoint, perms, extraArgs, nil)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
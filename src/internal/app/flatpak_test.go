@@ -0,0 +1,36 @@
+// Tests for flatpak app refs.
+package app
+
+import "testing"
+
+func TestParseAppRef(t *testing.T) {
+	tests := []struct {
+		in   string
+		want FlatpakApp
+	}{
+		{"org.mozilla.firefox", FlatpakApp{ID: "org.mozilla.firefox", Name: "org.mozilla.firefox"}},
+		{"app/org.mozilla.firefox/x86_64/stable", FlatpakApp{ID: "org.mozilla.firefox", Name: "org.mozilla.firefox", Arch: "x86_64", Branch: "stable"}},
+		{"app/org.gimp.GIMP/aarch64/beta", FlatpakApp{ID: "org.gimp.GIMP", Name: "org.gimp.GIMP", Arch: "aarch64", Branch: "beta"}},
+		// Not full app refs: taken as IDs
+		{"runtime/org.freedesktop.Platform/x86_64/23.08", FlatpakApp{ID: "runtime/org.freedesktop.Platform/x86_64/23.08", Name: "runtime/org.freedesktop.Platform/x86_64/23.08"}},
+		{"app/org.mozilla.firefox/x86_64", FlatpakApp{ID: "app/org.mozilla.firefox/x86_64", Name: "app/org.mozilla.firefox/x86_64"}},
+		{"", FlatpakApp{}},
+	}
+	for _, tt := range tests {
+		if got := parseAppRef(tt.in); got != tt.want {
+			t.Errorf("parseAppRef(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAppRefRoundTrip(t *testing.T) {
+	for _, app := range []FlatpakApp{
+		{ID: "org.mozilla.firefox", Name: "org.mozilla.firefox"},
+		{ID: "org.mozilla.firefox", Name: "org.mozilla.firefox", Arch: "x86_64", Branch: "stable"},
+		{ID: "org.gimp.GIMP", Name: "org.gimp.GIMP", Arch: "i386", Branch: "beta"},
+	} {
+		if got := parseAppRef(app.Ref()); got != app {
+			t.Errorf("parseAppRef(%q) = %+v, want %+v", app.Ref(), got, app)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Forensics mode: a manifest of the files an app added, changed, or removed in its bottle, kept in the audit log.
+package app
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// fileState is what a scan remembers about a file
+type fileState struct {
+	size  int64
+	mtime int64
+	mode  fs.FileMode
+}
+
+// fileChange is one entry of a session's manifest
+type fileChange struct {
+	Kind string // "added", "modified", or "removed"
+	Path string // relative to the bottle root
+}
+
+// scanBottle records every file and directory under root; unreadable
+// directories are skipped
+func scanBottle(root string) map[string]fileState {
+	files := map[string]fileState{}
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == root {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		files[rel] = fileState{size: info.Size(), mtime: info.ModTime().UnixNano(), mode: info.Mode()}
+		return nil
+	})
+	return files
+}
+
+// diffScans lists what changed between two scans, sorted by path
+func diffScans(before, after map[string]fileState) []fileChange {
+	var changes []fileChange
+	for path, a := range after {
+		b, ok := before[path]
+		switch {
+		case !ok:
+			changes = append(changes, fileChange{Kind: "added", Path: path})
+		case a != b && !a.mode.IsDir():
+			// A directory's mtime changes with its entries, which are listed anyway
+			changes = append(changes, fileChange{Kind: "modified", Path: path})
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changes = append(changes, fileChange{Kind: "removed", Path: path})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// summarizeChanges counts a manifest's entries, e.g. "3 added, 1 modified, 0 removed"
+func summarizeChanges(changes []fileChange) string {
+	counts := map[string]int{}
+	for _, c := range changes {
+		counts[c.Kind]++
+	}
+	return fmt.Sprintf("%d added, %d modified, %d removed", counts["added"], counts["modified"], counts["removed"])
+}
+
+// startForensics scans a forensics bottle before its app starts. The returned
+// function scans it again, records the manifest in the audit log, and returns
+// a one-line summary ("" when forensics is off).
+func startForensics(bottle, appID, mountPoint string, perms *Permissions) func() string {
+	if !perms.Forensics {
+		return func() string { return "" }
+	}
+	before := scanBottle(mountPoint)
+	started := time.Now()
+	return func() string {
+		changes := diffScans(before, scanBottle(mountPoint))
+		summary := fmt.Sprintf("%s ran for %s: %s", appID, time.Since(started).Round(time.Second), summarizeChanges(changes))
+		entries := []auditEntry{{Kind: "session", Detail: summary}}
+		for _, c := range changes {
+			entries = append(entries, auditEntry{Kind: c.Kind, Detail: c.Path})
+		}
+		if err := appendAudit(bottle, entries...); err != nil {
+			return summary + " (could not write the audit log: " + err.Error() + ")"
+		}
+		return summary
+	}
+}
+
+// cmdForensics shows or sets whether a bottle records what its apps change
+func cmdForensics(bottle, value string) error {
+	bottle = resolveBottlePath(bottle)
+	if _, err := os.Stat(bottle); err != nil {
+		return errBottleNotFound
+	}
+	configPath := getConfigPath(bottle)
+	perms := loadPermissions(configPath)
+
+	switch value {
+	case "":
+		state := "off"
+		if perms.Forensics {
+			state = "on - review with `bottle-launch audit " + bottleName(bottle) + "`"
+		}
+		fmt.Println(bottleName(bottle) + ": forensics " + state)
+		return nil
+	case "on":
+		perms.Forensics = true
+	case "off":
+		perms.Forensics = false
+	default:
+		return &bottleError{op: "forensics", msg: "expected on or off, got " + value, usage: true}
+	}
+	return savePermissions(configPath, perms)
+}
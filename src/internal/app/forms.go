@@ -0,0 +1,229 @@
+// Form definitions using the huh library for bottle creation wizards and settings.
+package app
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/huh"
+)
+
+// boundString is a field value that a DescriptionFunc can read. huh calls
+// description funcs from a command goroutine while the field's Update sets
+// the value, so they read a guarded copy rather than the field's pointer.
+type boundString struct {
+	value *string // hashed by huh to notice changes; Update goroutine only
+
+	mu    sync.Mutex
+	bound string
+}
+
+func newBoundString() *boundString {
+	return &boundString{value: new(string)}
+}
+
+// Get returns the value (huh.Accessor)
+func (b *boundString) Get() string {
+	return *b.value
+}
+
+// Set stores the value (huh.Accessor)
+func (b *boundString) Set(value string) {
+	*b.value = value
+	b.mu.Lock()
+	b.bound = value
+	b.mu.Unlock()
+}
+
+// Load returns the value from any goroutine
+func (b *boundString) Load() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.bound
+}
+
+// sizePresets are offered as tab-completions in the size field
+var sizePresets = []string{"500M", "1G", "2G", "5G", "10G"}
+
+// sizeInput creates the free-form bottle size field shared by both creation forms.
+// Sizes below the configured minimum are rejected; sizes larger than the free
+// space on the bottle directory's filesystem only produce a warning, since
+// bottles are sparse and fill up gradually.
+func sizeInput() *huh.Input {
+	size := newBoundString()
+	return huh.NewInput().
+		Key("size").
+		Title("Bottle Size").
+		Placeholder("2G").
+		Suggestions(sizePresets).
+		Accessor(size).
+		DescriptionFunc(func() string {
+			desc := "e.g. 750M, 3.5G, 20G (minimum " + formatSize(minBottleSize()) + ")"
+			bytes, err := parseSize(size.Load())
+			if err != nil {
+				return desc
+			}
+			if free, err := hostFreeSpace(bottleDir); err == nil && bytes > free {
+				return desc + "\nWarning: only " + formatSize(free) + " free on the host filesystem"
+			}
+			return desc
+		}, size.value).
+		Validate(func(s string) error {
+			_, err := validateBottleSize(s)
+			return err
+		})
+}
+
+// integrityConfirm creates the advanced tamper-detection choice shared by
+// both creation forms
+func integrityConfirm() *huh.Confirm {
+	return huh.NewConfirm().
+		Key("integrity").
+		Title("Tamper Detection (advanced)").
+		Description("Authenticates every sector (LUKS2 integrity=hmac), so a corrupted or tampered\n" +
+			"bottle file fails to read instead of silently handing apps garbage.\n" +
+			"Costs: much slower writes, about 1% of the size for tags, the whole size\n" +
+			"is taken on the host and written while creating (slow for big bottles),\n" +
+			"no automatic growth, and a kernel with dm-integrity is needed to open it.").
+		Affirmative("Enable").
+		Negative("No")
+}
+
+// createBottleForm creates a huh form for creating a new bottle.
+// The storage backend is chosen first; directory bottles skip the size and
+// the tamper detection choice.
+// The password field shows a strength meter while typing, and a generated
+// passphrase suggestion while empty; the confirmation is checked inline.
+func createBottleForm() *huh.Form {
+	password := newBoundString()
+	backend := new(string)
+	var suggestion string
+	if p, err := generatePassphrase(); err == nil {
+		suggestion = "Suggestion: " + p
+	}
+
+	return huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Key("name").
+				Title("Bottle Name").
+				Placeholder("my-bottle").
+				Validate(func(s string) error {
+					if s == "" {
+						return errBottlePathRequired
+					}
+					return nil
+				}),
+		),
+		huh.NewGroup(
+			huh.NewSelect[string]().
+				Key("backend").
+				Title("Storage").
+				Options(
+					huh.NewOption("LUKS image (udisks, needs polkit rights)", BackendLUKS),
+					huh.NewOption("gocryptfs directory (rootless, FUSE)", BackendGocryptfs),
+					huh.NewOption("fscrypt directory (rootless, needs fscrypt on the home filesystem)", BackendFscrypt),
+				).
+				Value(backend),
+		),
+		huh.NewGroup(sizeInput(), integrityConfirm()).WithHideFunc(func() bool {
+			return *backend != BackendLUKS
+		}),
+		huh.NewGroup(
+			huh.NewInput().
+				Key("password").
+				Title("Encryption Password").
+				EchoMode(huh.EchoModePassword).
+				Accessor(password).
+				DescriptionFunc(func() string {
+					if pw := password.Load(); pw != "" {
+						return passwordStrength(pw)
+					}
+					return suggestion
+				}, password.value).
+				Validate(func(s string) error {
+					if s == "" {
+						return &bottleError{op: "password", msg: "required"}
+					}
+					return nil
+				}),
+			huh.NewInput().
+				Key("confirm").
+				Title("Confirm Password").
+				EchoMode(huh.EchoModePassword).
+				Validate(func(s string) error {
+					if s != password.Get() {
+						return errPasswordMismatch
+					}
+					return nil
+				}),
+		),
+	).WithShowHelp(true).WithShowErrors(true).WithTheme(formTheme())
+}
+
+// createBottleFormYubiKey creates a huh form for creating a YubiKey-protected bottle
+// This form only asks for name, size and tamper detection - no password
+// (YubiKey provides the key)
+func createBottleFormYubiKey() *huh.Form {
+	return huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Key("name").
+				Title("Bottle Name").
+				Placeholder("my-secure-bottle").
+				Validate(func(s string) error {
+					if s == "" {
+						return errBottlePathRequired
+					}
+					return nil
+				}),
+		),
+		huh.NewGroup(sizeInput(), integrityConfirm()),
+	).WithShowHelp(true).WithShowErrors(true).WithTheme(formTheme())
+}
+
+// descriptionForm edits a bottle's description
+func descriptionForm(perms *Permissions) *huh.Form {
+	description := perms.Description
+	return huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Key("description").
+				Title("Description").
+				Description("What the bottle holds, shown in the bottle list; empty = none").
+				Placeholder("Firefox profile for testing the shop's checkout").
+				CharLimit(200).
+				Value(&description),
+		),
+	).WithShowHelp(true).WithShowErrors(true).WithTheme(formTheme())
+}
+
+// dnsForm edits a bottle's DNS servers and hosts entries
+func dnsForm(perms *Permissions) *huh.Form {
+	dns := strings.Join(perms.DNS, ", ")
+	hosts := strings.Join(perms.Hosts, ", ")
+	return huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Key("dns").
+				Title("DNS Servers").
+				Description("Name servers the app uses instead of the host's; empty = the host's").
+				Placeholder("1.1.1.3, 1.0.0.3").
+				Value(&dns).
+				Validate(func(s string) error {
+					_, err := parseDNSServers(s)
+					return err
+				}),
+			huh.NewInput().
+				Key("hosts").
+				Title("Hosts Entries").
+				Description("Added to the app's /etc/hosts, comma-separated").
+				Placeholder("192.168.1.10 nas.lan, 0.0.0.0 ads.example.com").
+				Value(&hosts).
+				Validate(func(s string) error {
+					_, err := parseHostsEntries(s)
+					return err
+				}),
+		),
+	).WithShowHelp(true).WithShowErrors(true).WithTheme(formTheme())
+}
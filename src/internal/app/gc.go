@@ -0,0 +1,57 @@
+// Garbage collection: removes what failed bottle creations left behind.
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// staleCreations returns the temporary creation files in the bottle
+// directory that no running creation is using
+func staleCreations() []string {
+	entries, err := os.ReadDir(bottleDir)
+	if err != nil {
+		return nil
+	}
+	var stale []string
+	for _, e := range entries {
+		name, _, ok := strings.Cut(e.Name(), ".creating")
+		if !ok || !strings.HasPrefix(name, ".") {
+			continue
+		}
+		bottle := filepath.Join(bottleDir, strings.TrimPrefix(name, "."))
+		path := filepath.Join(bottleDir, e.Name())
+		if journalHeld(bottle) || findLoopForFile(path) != "" {
+			continue
+		}
+		stale = append(stale, path)
+	}
+	return stale
+}
+
+// cmdGC removes stale temporary creation files, or with dryRun lists them
+func cmdGC(dryRun bool) error {
+	stale := staleCreations()
+	if len(stale) == 0 {
+		say("Nothing to clean up.")
+		return nil
+	}
+	var freed int64
+	for _, path := range stale {
+		_, allocated, _ := bottleDiskUsage(path)
+		if dryRun {
+			say("Would remove " + path + " (" + formatSize(allocated) + ")")
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return &bottleError{op: "gc", msg: err.Error()}
+		}
+		freed += allocated
+		say("Removed " + path + " (" + formatSize(allocated) + ")")
+	}
+	if !dryRun {
+		say("Freed " + formatSize(freed) + ".")
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+// gocryptfs backend: rootless bottles stored as encrypted directories and mounted via FUSE.
+package app
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"bottle-launch/internal/sysfs"
+)
+
+// gocryptfsExitBadPassword is gocryptfs's exit code for a wrong password
+const gocryptfsExitBadPassword = 12
+
+// gocryptfsBackend implements Backend with gocryptfs
+type gocryptfsBackend struct{}
+
+// gocryptfsMountPoint returns where a gocryptfs bottle is mounted (its
+// fixed mount point if it has one)
+func gocryptfsMountPoint(bottle string) string {
+	if dir := fixedMountPoint(bottle); dir != "" {
+		return dir
+	}
+	return filepath.Join(lockDir(), "mnt", strings.TrimSuffix(bottleName(bottle), ".bottle"))
+}
+
+// isFuseMounted reports whether a gocryptfs filesystem is mounted at dir
+func isFuseMounted(dir string) bool {
+	for _, m := range sysfs.Mounts() {
+		if m.MountPoint == dir && m.FSType == "fuse.gocryptfs" {
+			return true
+		}
+	}
+	return false
+}
+
+// gocryptfsCmd runs gocryptfs with the password on stdin, or attached to the
+// terminal so gocryptfs can prompt if password is empty
+func gocryptfsCmd(ctx context.Context, password string, args ...string) *exec.Cmd {
+	if password != "" {
+		cmd := commandContext(ctx, "gocryptfs", append([]string{"-passfile", "/dev/stdin"}, args...)...)
+		cmd.Stdin = strings.NewReader(password + "\n")
+		return cmd
+	}
+	cmd := commandContext(ctx, "gocryptfs", args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd
+}
+
+// runGocryptfs runs cmd and turns failures into errors
+func runGocryptfs(op string, cmd *exec.Cmd) error {
+	var out []byte
+	var err error
+	if cmd.Stdout == nil {
+		out, err = cmd.CombinedOutput()
+	} else {
+		err = cmd.Run()
+	}
+	if err == nil {
+		return nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == gocryptfsExitBadPassword {
+		return errWrongPassword
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		return &mountError{op: op, msg: "gocryptfs is not installed", class: classMissingTool}
+	}
+	msg := strings.TrimSpace(string(out))
+	if msg == "" {
+		msg = err.Error()
+	}
+	return &mountError{op: op, msg: msg}
+}
+
+// Create initializes an empty gocryptfs directory as a bottle. gocryptfs
+// bottles grow as needed, so size is ignored.
+func (gocryptfsBackend) Create(ctx context.Context, bottle, size, password string) error {
+	if bottle == "" {
+		return errBottlePathRequired
+	}
+	if !strings.HasSuffix(bottle, ".bottle") {
+		bottle += ".bottle"
+	}
+	if !strings.Contains(bottle, string(os.PathSeparator)) {
+		bottle = filepath.Join(bottleDir, bottle)
+	}
+	if _, err := os.Lstat(bottle); err == nil {
+		return errBottleExists
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(bottle, 0700); err != nil {
+		return &bottleError{op: "create dir", msg: err.Error()}
+	}
+	perms := defaultPermissions()
+	perms.Backend = BackendGocryptfs
+	configSaved := saveNewConfig(nil, bottle, perms)
+	err := runGocryptfs("init", gocryptfsCmd(ctx, password, "-init", "-q", bottle))
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err == nil {
+		err = configSaved()
+	}
+	if err != nil {
+		_ = configSaved()
+		os.Remove(getConfigPath(bottle))
+		os.RemoveAll(bottle)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+// Mount mounts a gocryptfs bottle (or returns the existing mount)
+func (gocryptfsBackend) Mount(ctx context.Context, bottle, password string) (*MountInfo, error) {
+	realPath, err := filepath.Abs(bottle)
+	if err != nil {
+		return nil, err
+	}
+	info := &MountInfo{BottlePath: realPath, MountPoint: gocryptfsMountPoint(realPath), Backend: BackendGocryptfs}
+	if isFuseMounted(info.MountPoint) {
+		return info, nil
+	}
+
+	if err := os.MkdirAll(info.MountPoint, 0700); err != nil {
+		return nil, &mountError{op: "mount", msg: err.Error()}
+	}
+	// Same restrictions as LUKS mounts (FUSE adds nosuid,nodev itself)
+	if err := runGocryptfs("mount", gocryptfsCmd(ctx, password, "-q", "-ko", "noexec", realPath, info.MountPoint)); err != nil {
+		if ctx.Err() != nil {
+			// Stopped just as it mounted
+			if isFuseMounted(info.MountPoint) {
+				_ = fusermountCmd("-u", info.MountPoint).Run()
+			}
+			err = ctx.Err()
+		}
+		os.Remove(info.MountPoint)
+		return nil, err
+	}
+	info.Unlocked = true
+	return info, nil
+}
+
+// fusermountCmd runs fusermount3, or fusermount where only FUSE 2 is installed
+func fusermountCmd(args ...string) *exec.Cmd {
+	if _, err := exec.LookPath("fusermount3"); err != nil {
+		return command("fusermount", args...)
+	}
+	return command("fusermount3", args...)
+}
+
+// Unmount unmounts a gocryptfs bottle, which also locks it
+func (gocryptfsBackend) Unmount(info *MountInfo) error {
+	if info == nil || info.MountPoint == "" || !isFuseMounted(info.MountPoint) {
+		return nil
+	}
+
+	_ = command("sync", "-f", info.MountPoint).Run()
+
+	out, err := fusermountCmd("-u", info.MountPoint).CombinedOutput()
+	if err != nil {
+		if busy := checkBusy(info.MountPoint); busy != nil {
+			return busy
+		}
+		// Lazy unmount as fallback (stale handles with no process behind them)
+		out2, err2 := fusermountCmd("-u", "-z", info.MountPoint).CombinedOutput()
+		if err2 != nil {
+			return &mountError{op: "unmount", msg: string(out) + "; lazy: " + string(out2)}
+		}
+	}
+	os.Remove(info.MountPoint)
+	return nil
+}
+
+// Current returns the bottle's mount, or nil if it is locked
+func (gocryptfsBackend) Current(bottle string) *MountInfo {
+	realPath, err := filepath.Abs(bottle)
+	if err != nil {
+		realPath = bottle
+	}
+	mount := gocryptfsMountPoint(realPath)
+	if !isFuseMounted(mount) {
+		return nil
+	}
+	return &MountInfo{BottlePath: realPath, MountPoint: mount, Backend: BackendGocryptfs}
+}
+
+// dirDiskUsage returns the total size of the files in a directory and the
+// space they occupy on disk
+func dirDiskUsage(dir string) (apparent, allocated int64, err error) {
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		a, b, err := bottleDiskUsage(path)
+		apparent += a
+		allocated += b
+		return err
+	})
+	return apparent, allocated, err
+}
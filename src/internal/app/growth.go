@@ -0,0 +1,159 @@
+// Growth: enlarging a LUKS image bottle at mount when its growth policy says it is too full.
+package app
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"bottle-launch/internal/sysfs"
+)
+
+// growthError is a growth that failed after it touched the image file
+type growthError struct {
+	err error
+}
+
+func (e *growthError) Error() string {
+	return e.err.Error()
+}
+
+func (e *growthError) Unwrap() error {
+	return e.err
+}
+
+// growthTarget returns the size a mounted bottle should grow to under its
+// policy, or 0 if it shouldn't grow
+func growthTarget(bottle, mountPoint string, perms *Permissions) int64 {
+	if perms.GrowBy <= 0 || perms.GrowPaused || blockDevicePath(bottle) != "" {
+		return 0
+	}
+	free, total, err := filesystemSpace(mountPoint)
+	if err != nil || total == 0 {
+		return 0
+	}
+	at := perms.GrowAt
+	if at <= 0 {
+		at = DefaultGrowAtPercent
+	}
+	if (total-free)*100 < total*int64(at) || luksIntegrity(bottle) {
+		return 0
+	}
+	fi, err := os.Stat(bottle)
+	if err != nil {
+		return 0
+	}
+	target := fi.Size() + perms.GrowBy
+	if perms.GrowMax > 0 {
+		target = min(target, perms.GrowMax)
+	}
+	if target <= fi.Size() {
+		return 0
+	}
+	return target
+}
+
+// growBottle applies a freshly mounted bottle's growth policy. key is the
+// passphrase or FIDO2 secret it was unlocked with (empty: cryptsetup asks
+// on the terminal).
+func growBottle(info *MountInfo, key []byte) {
+	perms := loadPermissions(getConfigPath(info.BottlePath))
+	target := growthTarget(info.BottlePath, info.MountPoint, perms)
+	if target == 0 || info.LoopDevice == "" || info.CleartextDevice == "" {
+		return
+	}
+	fi, err := os.Stat(info.BottlePath)
+	if err != nil {
+		return
+	}
+	from := fi.Size()
+	if err := extendBottle(info, key, target); err != nil {
+		detail := "growing from " + formatSize(from) + " to " + formatSize(target) + " failed: " + err.Error()
+		var grown *growthError
+		if errors.As(err, &grown) {
+			perms.GrowPaused = true
+			if savePermissions(getConfigPath(info.BottlePath), perms) == nil {
+				detail += "; growth paused until PREF_GROW_PAUSED is set to 0"
+			}
+		}
+		appendAudit(info.BottlePath, auditEntry{Kind: "grow", Detail: detail})
+		return
+	}
+	appendAudit(info.BottlePath, auditEntry{Kind: "grow", Detail: "grew from " + formatSize(from) + " to " + formatSize(target)})
+}
+
+// extendBottle grows a mounted bottle's image file, loop device, LUKS
+// mapping and filesystem to size bytes. If that fails once the file was
+// extended, the file is cut back to its old size and a *growthError is
+// returned.
+func extendBottle(info *MountInfo, key []byte, size int64) error {
+	fi, err := os.Stat(info.BottlePath)
+	if err != nil {
+		return err
+	}
+	if free, err := hostFreeSpace(filepath.Dir(info.BottlePath)); err == nil && size-fi.Size() > free {
+		return &bottleError{op: "grow", msg: "only " + formatSize(free) + " free on the host filesystem"}
+	}
+	// The mapping's name, as cryptsetup wants it (udisks names it luks-<uuid>)
+	mapper := sysfs.ReadAttr(filepath.Join("/sys/class/block", sysfs.BlockDevName(info.CleartextDevice), "dm", "name"))
+	if mapper == "" {
+		return &bottleError{op: "grow", msg: "can't find the LUKS mapping of " + info.CleartextDevice}
+	}
+
+	j, err := beginJournal("grow", info.BottlePath)
+	if err != nil {
+		return err
+	}
+	defer j.finish()
+	j.setSize(fi.Size())
+
+	oldSize := strconv.FormatInt(fi.Size(), 10)
+	rollBack := func(msg string) error {
+		if err := os.Truncate(info.BottlePath, fi.Size()); err != nil {
+			msg += "; the image file stays at " + formatSize(size) + ": " + err.Error()
+		}
+		return &growthError{err: &bottleError{op: "grow", msg: msg}}
+	}
+	extend := command("truncate", "-s", strconv.FormatInt(size, 10), info.BottlePath)
+	if preallocating() {
+		extend = command("fallocate", "-l", strconv.FormatInt(size, 10), info.BottlePath)
+	}
+	j.step("extend")
+	if out, err := extend.CombinedOutput(); err != nil {
+		// fallocate may have extended part of the way
+		return rollBack(strings.TrimSpace(string(out)))
+	}
+
+	// One privileged shell, so there is one authentication prompt. If the
+	// mapping can't be resized, the loop device shrinks back with the file;
+	// once it was, only the filesystem is left to grow and the file stays.
+	keyFile := ""
+	if len(key) > 0 {
+		keyFile = " --key-file=-"
+	}
+	script := `losetup -c "$1" || exit 1
+if ! cryptsetup resize` + keyFile + ` "$2"; then truncate -s "$5" "$4"; losetup -c "$1"; exit 1; fi
+resize2fs "$3" || exit 2`
+	cmd := privCmd("sh", "-c", script, "sh", info.LoopDevice, mapper, info.CleartextDevice, info.BottlePath, oldSize)
+	if len(key) > 0 {
+		cmd.Stdin = bytes.NewReader(key)
+	} else {
+		cmd.Stdin = os.Stdin
+	}
+	// From here a crash may leave the mapping or filesystem grown, so
+	// recovery keeps the file's new size
+	j.step("resize")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		msg := strings.TrimSpace(string(out))
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 2 {
+			return &growthError{err: &bottleError{op: "grow", msg: msg + " (the LUKS mapping grew; run resize2fs " + info.CleartextDevice + " to use the space)"}}
+		}
+		return rollBack(msg)
+	}
+	return nil
+}
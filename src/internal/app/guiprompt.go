@@ -0,0 +1,104 @@
+// Graphical prompts for launches without a terminal (e.g. from a .desktop file).
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/charmbracelet/x/term"
+)
+
+// errNoGUIPrompt means no graphical prompt tool is installed
+var errNoGUIPrompt = errors.New("no graphical prompt available (install zenity or kdialog)")
+
+// errPromptCancelled means the user closed the dialog
+var errPromptCancelled = errors.New("cancelled")
+
+// needGUIPrompts reports whether prompts have to be graphical: there is no
+// terminal to ask on, but there is a desktop session. Mock bottles read their
+// passwords from stdin in scripts, so they never use dialogs.
+func needGUIPrompts() bool {
+	if mockMode || term.IsTerminal(os.Stdin.Fd()) {
+		return false
+	}
+	return os.Getenv("WAYLAND_DISPLAY") != "" || os.Getenv("DISPLAY") != ""
+}
+
+// guiAskPassword asks for a password in a dialog: zenity, kdialog, or
+// whatever password agent the desktop runs for systemd-ask-password
+func guiAskPassword(title, text string) (string, error) {
+	var cmd *exec.Cmd
+	if _, err := exec.LookPath("zenity"); err == nil {
+		cmd = command("zenity", "--entry", "--hide-text", "--title="+title, "--text="+html.EscapeString(text))
+	} else if _, err := exec.LookPath("kdialog"); err == nil {
+		cmd = command("kdialog", "--title", title, "--password", text)
+	} else if _, err := exec.LookPath("systemd-ask-password"); err == nil {
+		cmd = command("systemd-ask-password", "--user", "--no-tty", "--id=bottle-launch", title+": "+text)
+	} else {
+		return "", errNoGUIPrompt
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		// All of them exit non-zero when the prompt is cancelled
+		return "", errPromptCancelled
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// showTouchNotice tells the user to touch their key: on the terminal, or
+// without one in a dialog (a notification if there is no dialog tool).
+// The returned function closes the dialog once the touch is done.
+func showTouchNotice(text string) func() {
+	if !needGUIPrompts() {
+		fmt.Fprintln(os.Stderr, text)
+		return func() {}
+	}
+	var cmd *exec.Cmd
+	if _, err := exec.LookPath("zenity"); err == nil {
+		cmd = command("zenity", "--info", "--no-wrap", "--title=bottle-launch", "--text="+html.EscapeString(text))
+	} else if _, err := exec.LookPath("kdialog"); err == nil {
+		cmd = command("kdialog", "--title", "bottle-launch", "--msgbox", text)
+	}
+	if cmd == nil || cmd.Start() != nil {
+		sendNotification("bottle-launch", text)
+		return func() {}
+	}
+	exited := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(exited)
+	}()
+	return func() {
+		select {
+		case <-exited:
+		default:
+			_ = cmd.Process.Kill()
+			<-exited
+		}
+	}
+}
+
+// dialogPasswordAttempts is how often a wrong password is asked for again
+const dialogPasswordAttempts = 3
+
+// mountWithDialog unlocks a bottle with a password asked for in a dialog
+func mountWithDialog(bottle string) (*MountInfo, error) {
+	title := "Unlock " + bottleName(bottle)
+	for i := 0; i < dialogPasswordAttempts; i++ {
+		password, err := guiAskPassword(title, "Password for "+bottleName(bottle)+":")
+		if err != nil {
+			return nil, err
+		}
+		info, err := mountTypedPassword(context.Background(), bottle, password)
+		if err != errWrongPassword {
+			return info, err
+		}
+		title = "Wrong password - unlock " + bottleName(bottle)
+	}
+	return nil, errWrongPassword
+}
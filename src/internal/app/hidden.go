@@ -0,0 +1,41 @@
+// Hidden bottles: bottles the TUI leaves out of its list until they are revealed.
+package app
+
+import (
+	"fmt"
+	"strings"
+)
+
+// isHiddenBottle reports whether a bottle is left out of the default list
+func isHiddenBottle(bottle string, perms *Permissions) bool {
+	return strings.HasPrefix(bottleName(bottle), ".") || perms.Hidden
+}
+
+// cmdHidden shows or sets whether a bottle is hidden from the TUI's list
+func cmdHidden(bottle, value string) error {
+	bottle = resolveBottlePath(bottle)
+	configPath := getConfigPath(bottle)
+	perms := loadPermissions(configPath)
+
+	switch value {
+	case "":
+		state := "no"
+		if strings.HasPrefix(bottleName(bottle), ".") {
+			state = "yes (its name starts with a dot)"
+		} else if perms.Hidden {
+			state = "yes"
+		}
+		fmt.Println(bottleName(bottle) + ": hidden: " + state)
+		return nil
+	case "on":
+		perms.Hidden = true
+	case "off":
+		if strings.HasPrefix(bottleName(bottle), ".") {
+			return &bottleError{op: "hidden", msg: bottleName(bottle) + " is hidden by its name - rename it without the leading dot"}
+		}
+		perms.Hidden = false
+	default:
+		return &bottleError{op: "hidden", msg: "expected on or off, got " + value, usage: true}
+	}
+	return savePermissions(configPath, perms)
+}
@@ -0,0 +1,146 @@
+// Bottle file integrity: detects bottle files changed outside bottle-launch between sessions.
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+// lockedState is the bottle file's fingerprint recorded when it was last locked
+type lockedState struct {
+	Size     int64
+	MTime    int64  // unix nanoseconds
+	Checksum string // sha256 hex; empty unless computed
+}
+
+// fileFingerprint returns the current size and mtime of a bottle file
+func fileFingerprint(bottle string) (lockedState, error) {
+	fi, err := os.Stat(bottle)
+	if err != nil {
+		return lockedState{}, err
+	}
+	return lockedState{Size: fi.Size(), MTime: fi.ModTime().UnixNano()}, nil
+}
+
+// checksumBottle computes the sha256 of a bottle file. This reads the whole
+// file, holes included, so it takes a while for large bottles.
+func checksumBottle(bottle string) (string, error) {
+	f, err := os.Open(bottle)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// recordLockedState saves the bottle's fingerprint after it has been locked.
+// The checksum is only computed when CHECKSUM_ON_LOCK=1 in the global config.
+func recordLockedState(bottle string) error {
+	// A device node's size and mtime say nothing about its contents
+	if blockDevicePath(bottle) != "" {
+		return nil
+	}
+	state, err := fileFingerprint(bottle)
+	if err != nil {
+		return err
+	}
+	if globalConfig.Get("CHECKSUM_ON_LOCK") == "1" {
+		if state.Checksum, err = checksumBottle(bottle); err != nil {
+			return err
+		}
+	}
+
+	configPath := getConfigPath(bottle)
+	perms := loadPermissions(configPath)
+	perms.Locked = state
+	return savePermissions(configPath, perms)
+}
+
+// checkBottleChanged compares the bottle file against its recorded
+// fingerprint and returns a warning if it changed while locked ("" if not, or
+// if nothing was recorded yet). Only size and mtime are checked, so it's cheap
+// enough to run before every unlock.
+func checkBottleChanged(bottle string, perms *Permissions) string {
+	if perms.Locked.MTime == 0 || blockDevicePath(bottle) != "" {
+		return ""
+	}
+	// Already unlocked by another session: changes are expected
+	if findLoopForFile(bottle) != "" {
+		return ""
+	}
+
+	current, err := fileFingerprint(bottle)
+	if err != nil {
+		return ""
+	}
+	if current.Size != perms.Locked.Size || current.MTime != perms.Locked.MTime {
+		return fmt.Sprintf("%s changed since it was last locked by bottle-launch - if you didn't sync or restore it, run `bottle-launch verify --checksum %s`",
+			bottleName(bottle), bottleName(bottle))
+	}
+	return ""
+}
+
+// verifyResult describes the outcome of verifyBottle
+type verifyResult struct {
+	HasFingerprint   bool // a fingerprint was recorded at lock time
+	Changed          bool // size/mtime differ from the recorded fingerprint
+	ChecksumMismatch bool
+	ChecksumRecorded bool // no checksum was stored, so the current one was saved
+	Checksum         string
+}
+
+// verifyBottle checks a locked bottle against its recorded fingerprint and,
+// if withChecksum is set, its content hash. A missing checksum is recorded
+// rather than reported as a mismatch.
+func verifyBottle(bottle string, withChecksum bool) (verifyResult, error) {
+	var res verifyResult
+	if findLoopForFile(bottle) != "" {
+		return res, errBottleMounted
+	}
+	if err := requireImageBottle(bottle); err != nil {
+		return res, err
+	}
+
+	configPath := getConfigPath(bottle)
+	perms := loadPermissions(configPath)
+	current, err := fileFingerprint(bottle)
+	if err != nil {
+		return res, err
+	}
+	if perms.Locked.MTime != 0 {
+		res.HasFingerprint = true
+		res.Changed = current.Size != perms.Locked.Size || current.MTime != perms.Locked.MTime
+	}
+
+	if !withChecksum {
+		return res, nil
+	}
+
+	res.Checksum, err = checksumBottle(bottle)
+	if err != nil {
+		return res, err
+	}
+	if perms.Locked.Checksum == "" {
+		// First verification: trust the current file and record it
+		current.Checksum = res.Checksum
+		perms.Locked = current
+		res.ChecksumRecorded = true
+		return res, savePermissions(configPath, perms)
+	}
+	res.ChecksumMismatch = res.Checksum != perms.Locked.Checksum
+	if res.Changed && !res.ChecksumMismatch {
+		// Touched (e.g. re-synced) but identical: accept the new fingerprint
+		current.Checksum = res.Checksum
+		perms.Locked = current
+		return res, savePermissions(configPath, perms)
+	}
+	return res, nil
+}
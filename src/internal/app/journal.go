@@ -0,0 +1,371 @@
+// Journal: records multi-step operations as they go, so ones interrupted by a crash are rolled back or finished at the next start.
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// journal is an operation's entry, held open and locked while it runs
+type journal struct {
+	file  *os.File
+	entry journalEntry
+}
+
+// journalEntry is what an entry records
+type journalEntry struct {
+	Op      string // what the operation was: create, grow, rotate, reenroll, or import
+	Bottle  string // the bottle file the operation creates or changes
+	Temp    string // the temporary file (or import directory) it builds the bottle in
+	Config  string // the config file the operation created, if any
+	Step    string // the step it was taking
+	Loop    string // the loop device it attached
+	Mapper  string // the device mapper name it opened
+	Size    int64  // grow: the image's size before growing
+	OldSlot int    // rotate, reenroll: the keyslot being replaced; -1 if none
+	NewSlot int    // rotate, reenroll: the keyslot being added; -1 if none
+	Salt    string // rotate, reenroll: the salt the config has once switched to the new keyslot
+	Started int64
+}
+
+// journalDir returns where journal entries are kept
+func journalDir() string {
+	return filepath.Join(configDir, "journal")
+}
+
+// errJournalHeld means another operation holds the bottle's entry
+var errJournalHeld = &bottleError{op: "journal", msg: "another operation on this bottle is still running", class: classInUse}
+
+// beginJournal starts an entry for op on bottle. An entry held by another
+// running operation is an error: both can't be rolled back. Otherwise
+// journaling is best effort: if the entry can't be written, a nil journal
+// is returned, whose methods do nothing.
+func beginJournal(op, bottle string) (*journal, error) {
+	if err := os.MkdirAll(journalDir(), 0700); err != nil {
+		return nil, nil
+	}
+	path := filepath.Join(journalDir(), getBottleHash(bottle)+".journal")
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, nil
+		}
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			f.Close()
+			if errors.Is(err, syscall.EWOULDBLOCK) {
+				return nil, errJournalHeld
+			}
+			return nil, nil
+		}
+		// Recovery may have removed the entry between the open and the lock;
+		// a lock on a removed file protects nothing, so open it again
+		if !journalLinked(f, path) {
+			f.Close()
+			continue
+		}
+		j := &journal{file: f, entry: journalEntry{Op: op, Bottle: bottle, OldSlot: -1, NewSlot: -1, Started: time.Now().Unix()}}
+		j.step("begin")
+		return j, nil
+	}
+}
+
+// journalLinked reports whether the open entry f is still the file at path
+func journalLinked(f *os.File, path string) bool {
+	open, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	named, err := os.Stat(path)
+	return err == nil && os.SameFile(open, named)
+}
+
+// step records that the operation is about to take the named step, along
+// with the loop device, mapping and config it has so far
+func (j *journal) step(name string) {
+	if j == nil {
+		return
+	}
+	j.entry.Step = name
+	e := j.entry
+	content := fmt.Sprintf("OP=%s\nBOTTLE=%s\nTEMP=%s\nCONFIG=%s\nSTEP=%s\nLOOP=%s\nMAPPER=%s\nSIZE=%d\nOLD_SLOT=%d\nNEW_SLOT=%d\nSALT=%s\nSTARTED=%d\n",
+		e.Op, e.Bottle, e.Temp, e.Config, e.Step, e.Loop, e.Mapper, e.Size, e.OldSlot, e.NewSlot, e.Salt, e.Started)
+	// Rewritten in place: a new file would lose the lock
+	_ = j.file.Truncate(0)
+	_, _ = j.file.WriteAt([]byte(content), 0)
+	_ = j.file.Sync()
+}
+
+// next records the next step, unless ctx was cancelled: then it returns
+// ctx's error for the operation to roll back with
+func (j *journal) next(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	j.step(name)
+	return nil
+}
+
+// setLoop records the loop device the operation attached
+func (j *journal) setLoop(dev string) {
+	if j != nil {
+		j.entry.Loop = dev
+	}
+}
+
+// setTemp records the temporary file the operation builds the bottle in
+func (j *journal) setTemp(path string) {
+	if j != nil {
+		j.entry.Temp = path
+	}
+}
+
+// setMapper records the device mapper name the operation is opening
+func (j *journal) setMapper(name string) {
+	if j != nil {
+		j.entry.Mapper = name
+	}
+}
+
+// setSize records the image's size before growing
+func (j *journal) setSize(size int64) {
+	if j != nil {
+		j.entry.Size = size
+	}
+}
+
+// setKeyslots records the keyslot being replaced, the one being added, and
+// the salt the config will have once it uses the new one
+func (j *journal) setKeyslots(oldSlot, newSlot int, salt string) {
+	if j != nil {
+		j.entry.OldSlot, j.entry.NewSlot, j.entry.Salt = oldSlot, newSlot, salt
+	}
+}
+
+// setConfig records the config file the operation created
+func (j *journal) setConfig(path string) {
+	if j != nil {
+		j.entry.Config = path
+	}
+}
+
+// finish removes the entry: the operation completed, or failed and
+// cleaned up after itself
+func (j *journal) finish() {
+	if j == nil {
+		return
+	}
+	os.Remove(j.file.Name())
+	j.file.Close()
+}
+
+// readJournalEntry parses an entry file
+func readJournalEntry(f *os.File) journalEntry {
+	e := journalEntry{OldSlot: -1, NewSlot: -1}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "OP":
+			e.Op = value
+		case "BOTTLE":
+			e.Bottle = value
+		case "TEMP":
+			e.Temp = value
+		case "CONFIG":
+			e.Config = value
+		case "STEP":
+			e.Step = value
+		case "LOOP":
+			e.Loop = value
+		case "MAPPER":
+			e.Mapper = value
+		case "SIZE":
+			fmt.Sscan(value, &e.Size)
+		case "OLD_SLOT":
+			fmt.Sscan(value, &e.OldSlot)
+		case "NEW_SLOT":
+			fmt.Sscan(value, &e.NewSlot)
+		case "SALT":
+			e.Salt = value
+		case "STARTED":
+			fmt.Sscan(value, &e.Started)
+		}
+	}
+	return e
+}
+
+// recover rolls an interrupted operation back, or finishes it when it got
+// past the point of no return, and says what it did
+func (e journalEntry) recover() (string, error) {
+	what := "an interrupted " + e.Op + " of " + bottleName(e.Bottle)
+	switch e.Op {
+	case "grow":
+		return e.recoverGrowth(what)
+	case "rotate", "reenroll":
+		return e.recoverKeyswap(what)
+	case "import":
+		return e.recoverImport(what)
+	}
+	// Interrupted after its last step: the bottle is complete
+	if _, err := os.Stat(e.Bottle); err == nil && e.Temp != "" && e.Step == "rename" {
+		return "", nil
+	}
+	if err := e.rollBack(); err != nil {
+		return "", err
+	}
+	return "rolled back " + what + " (stopped at " + e.Step + "); create it again", nil
+}
+
+// recoverGrowth cuts an image back to its old size if growing stopped
+// before the mapping and filesystem were resized. Once they may have been,
+// cutting it would lose data, so the grown image is kept.
+func (e journalEntry) recoverGrowth(what string) (string, error) {
+	if e.Step != "extend" {
+		return "kept the grown image after " + what + "; if its space doesn't show once unlocked, run resize2fs on it", nil
+	}
+	if err := os.Truncate(e.Bottle, e.Size); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	return "rolled back " + what + " (cut it back to " + formatSize(e.Size) + ")", nil
+}
+
+// recoverKeyswap removes the new keyslot if the config still uses the old
+// one, or else finishes the swap by removing the old keyslot
+func (e journalEntry) recoverKeyswap(what string) (string, error) {
+	slots, err := luksKeyslots(e.Bottle)
+	if err != nil {
+		return "", err
+	}
+	if loadPermissions(getConfigPath(e.Bottle)).FIDO2Salt != e.Salt {
+		if e.NewSlot >= 0 && slices.Contains(slots, e.NewSlot) {
+			if err := killLUKSKeyslot(e.Bottle, e.NewSlot); err != nil {
+				return "", err
+			}
+		}
+		return "rolled back " + what + "; the old key still unlocks it", nil
+	}
+	if e.OldSlot >= 0 && slices.Contains(slots, e.OldSlot) {
+		if err := killLUKSKeyslot(e.Bottle, e.OldSlot); err != nil {
+			return "", err
+		}
+	}
+	return "finished " + what + " (removed the old keyslot)", nil
+}
+
+// recoverImport removes the unpacked bundle if the bottle wasn't moved into
+// place yet, or else installs the config and header backup it still needs
+func (e journalEntry) recoverImport(what string) (string, error) {
+	if _, err := os.Stat(e.Bottle); err != nil {
+		if err := os.RemoveAll(e.Temp); err != nil {
+			return "", err
+		}
+		return "rolled back " + what + "; import it again", nil
+	}
+	if err := installImported(e.Bottle, e.Temp); err != nil {
+		return "", err
+	}
+	if err := os.RemoveAll(e.Temp); err != nil {
+		return "", err
+	}
+	return "finished " + what, nil
+}
+
+// rollBack undoes what an interrupted creation did, as far as it got
+func (e journalEntry) rollBack() error {
+	if e.Mapper != "" {
+		if _, err := os.Stat("/dev/mapper/" + e.Mapper); err == nil {
+			if out, err := cryptsetupCmd("close", e.Mapper).CombinedOutput(); err != nil {
+				return &bottleError{op: "close " + e.Mapper, msg: strings.TrimSpace(string(out))}
+			}
+		}
+	}
+	// What the operation wrote to: the temporary file if it used one, which
+	// is only renamed to the bottle once complete
+	file := e.Bottle
+	if e.Temp != "" {
+		file = e.Temp
+	}
+	// Only the loop device that still backs the file: after a reboot the
+	// number may belong to something else
+	if e.Loop != "" && file != "" && findLoopForFile(file) == e.Loop {
+		if out, err := privCmd("losetup", "-d", e.Loop).CombinedOutput(); err != nil {
+			return &bottleError{op: "detach " + e.Loop, msg: strings.TrimSpace(string(out))}
+		}
+	}
+	// The operation checked that the file didn't exist before it began
+	if file != "" && e.Step != "begin" {
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if e.Config != "" {
+		os.Remove(e.Config)
+	}
+	return nil
+}
+
+// recoverJournals recovers the operations that were interrupted, and
+// returns what it did for the caller to show. Recovery may need a privilege
+// prompt, so only commands that change bottles call it.
+func recoverJournals() []string {
+	entries, err := os.ReadDir(journalDir())
+	if err != nil {
+		return nil
+	}
+	var messages []string
+	for _, de := range entries {
+		if !strings.HasSuffix(de.Name(), ".journal") {
+			continue
+		}
+		path := filepath.Join(journalDir(), de.Name())
+		f, err := os.OpenFile(path, os.O_RDWR, 0600)
+		if err != nil {
+			continue
+		}
+		// Locked before anything is read: held means the operation is still
+		// running, and a removed entry was already dealt with
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil || !journalLinked(f, path) {
+			f.Close()
+			continue
+		}
+		e := readJournalEntry(f)
+		// Created but not yet written by an operation that is just starting
+		if e.Op == "" {
+			f.Close()
+			continue
+		}
+		msg, err := e.recover()
+		if err != nil {
+			messages = append(messages, "could not recover an interrupted "+e.Op+" of "+bottleName(e.Bottle)+" ("+err.Error()+"); will try again next time")
+			f.Close()
+			continue
+		}
+		os.Remove(path)
+		f.Close()
+		if msg != "" {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// journalHeld reports whether a running operation holds bottle's entry
+func journalHeld(bottle string) bool {
+	f, err := os.Open(filepath.Join(journalDir(), getBottleHash(bottle)+".journal"))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB) != nil
+}
@@ -0,0 +1,206 @@
+// Tests for the journal: rolling back interrupted operations, and refusing held entries.
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJournalRollBack(t *testing.T) {
+	tests := []struct {
+		name       string
+		entry      journalEntry
+		bottleGone bool // the bottle file is removed
+		tempGone   bool // the temporary file is removed
+	}{
+		{"before any step", journalEntry{Op: "create", Step: "begin"}, false, false},
+		{"mid create", journalEntry{Op: "create", Step: "format"}, true, false},
+		{"temp file", journalEntry{Op: "create", Step: "mkfs", Temp: "temp"}, false, true},
+		{"temp file before any step", journalEntry{Op: "create", Step: "begin", Temp: "temp"}, false, false},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		bottle := filepath.Join(dir, "work.bottle")
+		temp := filepath.Join(dir, "work.bottle.tmp")
+		config := filepath.Join(dir, "work.conf")
+		for _, path := range []string{bottle, temp, config} {
+			if err := os.WriteFile(path, nil, 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		e := tt.entry
+		e.Bottle, e.Config = bottle, config
+		if e.Temp != "" {
+			e.Temp = temp
+		}
+		if err := e.rollBack(); err != nil {
+			t.Errorf("%s: rollBack() = %v", tt.name, err)
+			continue
+		}
+		for _, check := range []struct {
+			path string
+			gone bool
+		}{{bottle, tt.bottleGone}, {temp, tt.tempGone}, {config, true}} {
+			_, err := os.Stat(check.path)
+			if gone := os.IsNotExist(err); gone != check.gone {
+				t.Errorf("%s: %s removed = %v, want %v", tt.name, filepath.Base(check.path), gone, check.gone)
+			}
+		}
+	}
+}
+
+func TestJournalRollBackMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	e := journalEntry{Op: "create", Step: "format", Bottle: filepath.Join(dir, "gone.bottle"), Config: filepath.Join(dir, "gone.conf")}
+	if err := e.rollBack(); err != nil {
+		t.Errorf("rollBack() with nothing left to remove = %v", err)
+	}
+}
+
+func TestBeginJournalHeld(t *testing.T) {
+	oldConfig := configDir
+	t.Cleanup(func() { configDir = oldConfig })
+	configDir = t.TempDir()
+	bottle := filepath.Join(t.TempDir(), "work.bottle")
+
+	j, err := beginJournal("create", bottle)
+	if err != nil || j == nil {
+		t.Fatalf("beginJournal() = %v, %v", j, err)
+	}
+	if !journalHeld(bottle) {
+		t.Error("journalHeld() = false while an operation runs")
+	}
+	if _, err := beginJournal("delete", bottle); err != errJournalHeld {
+		t.Errorf("second beginJournal() error = %v, want %v", err, errJournalHeld)
+	}
+	// A running operation's entry is not rolled back
+	if messages := recoverJournals(); len(messages) != 0 {
+		t.Errorf("recoverJournals() = %q with the entry held", messages)
+	}
+	j.finish()
+	if journalHeld(bottle) {
+		t.Error("journalHeld() = true after finish")
+	}
+	j, err = beginJournal("delete", bottle)
+	if err != nil || j == nil {
+		t.Fatalf("beginJournal() after finish = %v, %v", j, err)
+	}
+	j.finish()
+}
+
+func TestRecoverJournals(t *testing.T) {
+	oldConfig := configDir
+	t.Cleanup(func() { configDir = oldConfig })
+	configDir = t.TempDir()
+	bottle := filepath.Join(t.TempDir(), "work.bottle")
+
+	j, err := beginJournal("create", bottle)
+	if err != nil || j == nil {
+		t.Fatalf("beginJournal() = %v, %v", j, err)
+	}
+	j.step("format")
+	if err := os.WriteFile(bottle, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	// The operation dies: its lock goes with it, the entry stays
+	j.file.Close()
+
+	messages := recoverJournals()
+	if len(messages) != 1 || !strings.Contains(messages[0], "rolled back an interrupted create of work.bottle") {
+		t.Errorf("recoverJournals() = %q", messages)
+	}
+	if _, err := os.Stat(bottle); !os.IsNotExist(err) {
+		t.Error("half-made bottle was not removed")
+	}
+	if entries, _ := os.ReadDir(journalDir()); len(entries) != 0 {
+		t.Errorf("%d journal entries left after recovery", len(entries))
+	}
+}
+
+func TestJournalRecoverGrowth(t *testing.T) {
+	tests := []struct {
+		step string
+		want int64 // the image's size after recovery
+	}{
+		{"extend", 1024},
+		{"resize", 4096},
+	}
+	for _, tt := range tests {
+		bottle := filepath.Join(t.TempDir(), "work.bottle")
+		if err := os.WriteFile(bottle, make([]byte, 4096), 0600); err != nil {
+			t.Fatal(err)
+		}
+		e := journalEntry{Op: "grow", Bottle: bottle, Step: tt.step, Size: 1024, OldSlot: -1, NewSlot: -1}
+		if _, err := e.recover(); err != nil {
+			t.Errorf("%s: recover() = %v", tt.step, err)
+			continue
+		}
+		if fi, err := os.Stat(bottle); err != nil || fi.Size() != tt.want {
+			t.Errorf("%s: image size after recovery = %v, %v; want %d", tt.step, fi.Size(), err, tt.want)
+		}
+	}
+}
+
+func TestJournalRecoverImport(t *testing.T) {
+	oldConfig := configDir
+	t.Cleanup(func() { configDir = oldConfig })
+
+	for _, moved := range []bool{false, true} {
+		configDir = t.TempDir()
+		dir := t.TempDir()
+		bottle := filepath.Join(dir, "work.bottle")
+		tmp := filepath.Join(dir, ".bottle-import-1")
+		if err := os.Mkdir(tmp, 0700); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{bundleConfig, bundleHeader} {
+			if err := os.WriteFile(filepath.Join(tmp, name), []byte("PREF_NETWORK=0\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if moved {
+			if err := os.WriteFile(bottle, nil, 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		e := journalEntry{Op: "import", Bottle: bottle, Temp: tmp, Step: "install", OldSlot: -1, NewSlot: -1}
+		if _, err := e.recover(); err != nil {
+			t.Errorf("moved=%v: recover() = %v", moved, err)
+			continue
+		}
+		if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+			t.Errorf("moved=%v: unpacked bundle left behind", moved)
+		}
+		_, err := os.Stat(getHeaderBackupPath(bottle))
+		if installed := err == nil; installed != moved {
+			t.Errorf("moved=%v: header backup installed = %v", moved, installed)
+		}
+	}
+}
+
+func TestParseLUKSKeyslots(t *testing.T) {
+	dump := `LUKS header information
+Version:       	2
+
+Data segments:
+  0: crypt
+	offset: 16777216 [bytes]
+
+Keyslots:
+  0: luks2
+	Key:        512 bits
+	Priority:   normal
+  3: luks2
+	Key:        512 bits
+Tokens:
+Digests:
+  0: pbkdf2
+	Hash:       sha256
+`
+	got := parseLUKSKeyslots(dump)
+	if len(got) != 2 || got[0] != 0 || got[1] != 3 {
+		t.Errorf("parseLUKSKeyslots() = %v, want [0 3]", got)
+	}
+}
@@ -0,0 +1,281 @@
+// Key drives: bottles unlocked by a random key file on a removable drive, so they only open where the drive is.
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"bottle-launch/internal/sysfs"
+)
+
+// keyFileDir is where key files live on the drive
+const keyFileDir = ".bottle-launch-keys"
+
+var errKeyDriveMissing = &bottleError{op: "key drive", msg: "the bottle's key drive is not plugged in", class: classNotFound}
+
+// removableDrive is a mountable filesystem on a removable device
+type removableDrive struct {
+	Device     string // e.g. /dev/sdb1
+	UUID       string // filesystem UUID
+	Label      string
+	MountPoint string // "" if not mounted
+}
+
+// Name describes the drive for prompts, e.g. "KEYS (/dev/sdb1)"
+func (d removableDrive) Name() string {
+	if d.Label != "" {
+		return d.Label + " (" + d.Device + ")"
+	}
+	return d.Device
+}
+
+// mockKeyDrive stands in for a USB stick in mock mode: the drive is
+// plugged in while the directory exists
+func mockKeyDrive() removableDrive {
+	return removableDrive{Device: "/dev/mock-usb1", UUID: "MOCK-USB", Label: "MOCKUSB",
+		MountPoint: filepath.Join(bottleDir, ".mock-usb")}
+}
+
+// diskLinks maps kernel device names (sdb1) to the names of their symlinks
+// in a /dev/disk directory (by-uuid, by-label)
+func diskLinks(dir string) map[string]string {
+	links := map[string]string{}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if target, err := filepath.EvalSymlinks(filepath.Join(dir, e.Name())); err == nil {
+			// by-label escapes spaces and slashes as \x20 etc.
+			links[filepath.Base(target)] = unescapeUdevName(e.Name())
+		}
+	}
+	return links
+}
+
+// unescapeUdevName decodes udev's \xNN escapes
+func unescapeUdevName(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		var b byte
+		if s[i] == '\\' && i+3 < len(s) && s[i+1] == 'x' {
+			if _, err := fmt.Sscanf(s[i+2:i+4], "%02x", &b); err == nil {
+				sb.WriteByte(b)
+				i += 3
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// listRemovableDrives returns the filesystems on removable and USB devices
+func listRemovableDrives() []removableDrive {
+	if mockMode {
+		if _, err := os.Stat(mockKeyDrive().MountPoint); err == nil {
+			return []removableDrive{mockKeyDrive()}
+		}
+		return nil
+	}
+	uuids := diskLinks("/dev/disk/by-uuid")
+	labels := diskLinks("/dev/disk/by-label")
+	disks, _ := os.ReadDir("/sys/block")
+	var drives []removableDrive
+	for _, disk := range disks {
+		sys := filepath.Join("/sys/block", disk.Name())
+		devPath, _ := filepath.EvalSymlinks(filepath.Join(sys, "device"))
+		if sysfs.ReadAttr(filepath.Join(sys, "removable")) != "1" && !strings.Contains(devPath, "/usb") {
+			continue
+		}
+		// The disk itself, or its partitions if it has any
+		names := []string{disk.Name()}
+		entries, _ := os.ReadDir(sys)
+		for _, e := range entries {
+			if strings.HasPrefix(e.Name(), disk.Name()) {
+				names = append(names, e.Name())
+			}
+		}
+		for _, name := range names {
+			if uuids[name] == "" {
+				continue
+			}
+			dev := "/dev/" + name
+			drives = append(drives, removableDrive{Device: dev, UUID: uuids[name], Label: labels[name],
+				MountPoint: sysfs.MountPoint(dev)})
+		}
+	}
+	return drives
+}
+
+// findKeyDrive returns the plugged-in drive with a filesystem UUID
+func findKeyDrive(uuid string) (removableDrive, bool) {
+	for _, d := range listRemovableDrives() {
+		if d.UUID == uuid {
+			return d, true
+		}
+	}
+	return removableDrive{}, false
+}
+
+// matchKeyDrive picks a drive by UUID, label, device, or mount point
+func matchKeyDrive(arg string) (removableDrive, error) {
+	drives := listRemovableDrives()
+	i := slices.IndexFunc(drives, func(d removableDrive) bool {
+		return arg == d.UUID || arg == d.Label || arg == d.Device || (d.MountPoint != "" && filepath.Clean(arg) == d.MountPoint)
+	})
+	if i < 0 {
+		return removableDrive{}, &bottleError{op: "key drive", msg: "no removable drive " + arg + " - see bottle-launch key-drives"}
+	}
+	return drives[i], nil
+}
+
+// mountKeyDrive mounts the drive through udisks if it isn't mounted yet
+func mountKeyDrive(d *removableDrive) error {
+	if d.MountPoint != "" {
+		return nil
+	}
+	out, err := command("udisksctl", "mount", "--no-user-interaction", "-b", d.Device).CombinedOutput()
+	if err != nil {
+		return &bottleError{op: "key drive", msg: "could not mount " + d.Name() + ": " + strings.TrimSpace(string(out))}
+	}
+	if d.MountPoint = sysfs.MountPoint(d.Device); d.MountPoint == "" {
+		return &bottleError{op: "key drive", msg: d.Name() + " mounted, but its mount point wasn't found"}
+	}
+	return nil
+}
+
+// readDriveKey reads a key drive bottle's passphrase from its drive, or
+// returns errKeyDriveMissing if the drive isn't plugged in
+func readDriveKey(perms *Permissions) (string, error) {
+	d, ok := findKeyDrive(perms.KeyDriveUUID)
+	if !ok {
+		return "", errKeyDriveMissing
+	}
+	if err := mountKeyDrive(&d); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(filepath.Join(d.MountPoint, perms.KeyDriveFile))
+	if err != nil {
+		return "", &bottleError{op: "key drive", msg: "no key file " + perms.KeyDriveFile + " on " + d.Name()}
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// keyDriveName describes a bottle's key drive by its label, or its UUID
+func keyDriveName(perms *Permissions) string {
+	if perms.KeyDriveLabel != "" {
+		return perms.KeyDriveLabel
+	}
+	return "the drive with UUID " + perms.KeyDriveUUID
+}
+
+// mountWithKeyDrive unlocks and mounts a key drive bottle with the key on
+// its drive
+func mountWithKeyDrive(bottle string, perms *Permissions) (*MountInfo, error) {
+	key := keyfileKey{bottle: bottle, perms: perms}
+	if bottleBackend(bottle) == BackendLUKS && !mockMode {
+		return mountLUKS(context.Background(), bottle, key)
+	}
+	secret, err := key.Key(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	info, err := mountBottle(context.Background(), bottle, string(secret))
+	if err == errWrongPassword {
+		return nil, key.WrongKey()
+	}
+	return info, err
+}
+
+// wrongDriveKeyError reports a key file that doesn't unlock its bottle
+func wrongDriveKeyError(perms *Permissions) error {
+	return &bottleError{op: "key drive", msg: "the key file on " + keyDriveName(perms) + " didn't unlock the bottle - was it replaced or edited?", class: classWrongPassword}
+}
+
+// createKeyDriveBottle creates a bottle whose passphrase is a new random key
+// file on a removable drive
+func createKeyDriveBottle(backend, bottle, size, drive string) error {
+	b, err := getBackend(backend)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(size, "/dev/") {
+		return &bottleError{op: "key drive", msg: "block device bottles can't use a key drive"}
+	}
+	d, err := matchKeyDrive(drive)
+	if err != nil {
+		return err
+	}
+	if err := mountKeyDrive(&d); err != nil {
+		return err
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return &bottleError{op: "key drive", msg: err.Error()}
+	}
+	key := base64.StdEncoding.EncodeToString(raw)
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	name := strings.TrimSuffix(filepath.Base(bottle), ".bottle")
+	rel := filepath.Join(keyFileDir, fmt.Sprintf("%s-%x.key", name, suffix))
+	path := filepath.Join(d.MountPoint, rel)
+
+	// Write and flush the key before the bottle depends on it
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return &bottleError{op: "key drive", msg: err.Error()}
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return &bottleError{op: "key drive", msg: err.Error()}
+	}
+	_, err = f.WriteString(key + "\n")
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return &bottleError{op: "key drive", msg: "could not write the key file: " + err.Error()}
+	}
+
+	if err := b.Create(context.Background(), bottle, size, key); err != nil {
+		os.Remove(path)
+		return err
+	}
+	bottle = resolveBottlePath(bottle)
+	if !strings.HasSuffix(bottle, ".bottle") {
+		bottle += ".bottle"
+	}
+	configPath := getConfigPath(bottle)
+	perms := loadPermissions(configPath)
+	perms.KeyDriveUUID, perms.KeyDriveLabel, perms.KeyDriveFile = d.UUID, d.Label, rel
+	if err := savePermissions(configPath, perms); err != nil {
+		return err
+	}
+	say(fmt.Sprintf("Created %s; its key is %s on %s.", bottleName(bottle), rel, d.Name()))
+	fmt.Println("The bottle only unlocks with the drive plugged in - keep a copy of the key file somewhere safe.")
+	return nil
+}
+
+// cmdKeyDrives lists the removable drives a key file can go on
+func cmdKeyDrives() {
+	drives := listRemovableDrives()
+	if len(drives) == 0 {
+		fmt.Println("No removable drives found - plug in a USB stick or SD card")
+		return
+	}
+	for _, d := range drives {
+		mount := d.MountPoint
+		if mount == "" {
+			mount = "not mounted"
+		}
+		fmt.Printf("%-12s %-16s %-38s %s\n", d.Device, orNone(d.Label), d.UUID, mount)
+	}
+}
@@ -0,0 +1,378 @@
+// Key bindings for TUI navigation and actions.
+package app
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+)
+
+type keyMap struct {
+	// Navigation (all views)
+	Up    key.Binding
+	Down  key.Binding
+	Enter key.Binding
+	Back  key.Binding
+	Help  key.Binding
+	Quit  key.Binding
+
+	// Bottle list
+	NewBottle    key.Binding
+	NewYubiKey   key.Binding
+	Sort         key.Binding
+	QuickLaunch  key.Binding
+	RevealHidden key.Binding
+
+	// Bottle actions and launch confirmation
+	Launch       key.Binding
+	Permissions  key.Binding
+	Delete       key.Binding
+	Info         key.Binding
+	Snapshots    key.Binding
+	HideBottle   key.Binding
+	SetDefault   key.Binding
+	AllowApp     key.Binding
+	UseSuggested key.Binding
+
+	// Bottle info
+	EditDescription key.Binding
+
+	// App selection
+	ShowAllApps   key.Binding
+	SearchFlathub key.Binding
+
+	// Snapshot browser
+	TakeSnapshot   key.Binding
+	DeleteSnapshot key.Binding
+
+	// Permissions editor
+	Toggle  key.Binding
+	EditDNS key.Binding
+
+	// Confirmation dialogs
+	Yes key.Binding
+	No  key.Binding
+
+	// Running app
+	OpenFolder key.Binding
+
+	// FIDO2 flows
+	Retry key.Binding
+
+	// Error screen
+	Details key.Binding
+
+	// Busy unmount
+	Terminate key.Binding
+
+	// Changed config review
+	Trust key.Binding
+
+	// Stale session recovery
+	Adopt      key.Binding
+	Unmount    key.Binding
+	LockBottle key.Binding
+}
+
+// newKeyMap returns the default bindings with user overrides applied
+func newKeyMap() keyMap {
+	k := defaultKeyMap()
+	k.applyKeyOverrides(globalConfig)
+	return k
+}
+
+func defaultKeyMap() keyMap {
+	return keyMap{
+		Up: key.NewBinding(
+			key.WithKeys("up", "k"),
+			key.WithHelp("↑/k", "up"),
+		),
+		Down: key.NewBinding(
+			key.WithKeys("down", "j"),
+			key.WithHelp("↓/j", "down"),
+		),
+		Enter: key.NewBinding(
+			key.WithKeys("enter"),
+			key.WithHelp("enter", "select"),
+		),
+		Back: key.NewBinding(
+			key.WithKeys("esc"),
+			key.WithHelp("esc", "back"),
+		),
+		Help: key.NewBinding(
+			key.WithKeys("?"),
+			key.WithHelp("?", "help"),
+		),
+		Quit: key.NewBinding(
+			key.WithKeys("q", "ctrl+c"),
+			key.WithHelp("q", "quit"),
+		),
+		NewBottle: key.NewBinding(
+			key.WithKeys("n", "+"),
+			key.WithHelp("n", "new bottle (password)"),
+		),
+		NewYubiKey: key.NewBinding(
+			key.WithKeys("y"),
+			key.WithHelp("y", "new bottle (YubiKey)"),
+		),
+		Sort: key.NewBinding(
+			key.WithKeys("s"),
+			key.WithHelp("s", "toggle sort order"),
+		),
+		QuickLaunch: key.NewBinding(
+			key.WithKeys("l"),
+			key.WithHelp("l", "quick launch default app"),
+		),
+		RevealHidden: key.NewBinding(
+			key.WithKeys("."),
+			key.WithHelp(".", "show/hide hidden bottles"),
+		),
+		Launch: key.NewBinding(
+			key.WithKeys("l", "1"),
+			key.WithHelp("l", "launch app"),
+		),
+		Permissions: key.NewBinding(
+			key.WithKeys("p", "2"),
+			key.WithHelp("p", "edit permissions"),
+		),
+		Delete: key.NewBinding(
+			key.WithKeys("d", "3"),
+			key.WithHelp("d", "delete bottle"),
+		),
+		Info: key.NewBinding(
+			key.WithKeys("i", "4"),
+			key.WithHelp("i", "bottle info"),
+		),
+		Snapshots: key.NewBinding(
+			key.WithKeys("s", "5"),
+			key.WithHelp("s", "snapshots"),
+		),
+		HideBottle: key.NewBinding(
+			key.WithKeys("h", "6"),
+			key.WithHelp("h", "hide/unhide bottle in the list"),
+		),
+		TakeSnapshot: key.NewBinding(
+			key.WithKeys("n"),
+			key.WithHelp("n", "take a snapshot now"),
+		),
+		DeleteSnapshot: key.NewBinding(
+			key.WithKeys("x"),
+			key.WithHelp("x", "delete snapshot"),
+		),
+		SetDefault: key.NewBinding(
+			key.WithKeys("f"),
+			key.WithHelp("f", "set/unset default app"),
+		),
+		AllowApp: key.NewBinding(
+			key.WithKeys("a"),
+			key.WithHelp("a", "allow/disallow app in this bottle"),
+		),
+		UseSuggested: key.NewBinding(
+			key.WithKeys("g"),
+			key.WithHelp("g", "use the suggested permissions for the app"),
+		),
+		ShowAllApps: key.NewBinding(
+			key.WithKeys("tab"),
+			key.WithHelp("tab", "show all apps / allowed only"),
+		),
+		EditDescription: key.NewBinding(
+			key.WithKeys("e"),
+			key.WithHelp("e", "edit the bottle's description"),
+		),
+		SearchFlathub: key.NewBinding(
+			key.WithKeys("i"),
+			key.WithHelp("i", "install an app from Flathub"),
+		),
+		Toggle: key.NewBinding(
+			key.WithKeys(" "),
+			key.WithHelp("space", "toggle permission"),
+		),
+		EditDNS: key.NewBinding(
+			key.WithKeys("h"),
+			key.WithHelp("h", "edit DNS servers and hosts entries"),
+		),
+		Yes: key.NewBinding(
+			key.WithKeys("y", "enter"),
+			key.WithHelp("y", "confirm"),
+		),
+		No: key.NewBinding(
+			key.WithKeys("n", "esc"),
+			key.WithHelp("n", "cancel"),
+		),
+		OpenFolder: key.NewBinding(
+			key.WithKeys("o"),
+			key.WithHelp("o", "open bottle in file manager"),
+		),
+		Retry: key.NewBinding(
+			key.WithKeys("r"),
+			key.WithHelp("r", "retry"),
+		),
+		Details: key.NewBinding(
+			key.WithKeys("d"),
+			key.WithHelp("d", "show/hide error details"),
+		),
+		Terminate: key.NewBinding(
+			key.WithKeys("t"),
+			key.WithHelp("t", "terminate processes using the bottle"),
+		),
+		Trust: key.NewBinding(
+			key.WithKeys("t"),
+			key.WithHelp("t", "trust the changed config"),
+		),
+		Adopt: key.NewBinding(
+			key.WithKeys("a"),
+			key.WithHelp("a", "adopt: launch an app in it"),
+		),
+		Unmount: key.NewBinding(
+			key.WithKeys("u"),
+			key.WithHelp("u", "unmount, keep unlocked"),
+		),
+		LockBottle: key.NewBinding(
+			key.WithKeys("x"),
+			key.WithHelp("x", "unmount and lock"),
+		),
+	}
+}
+
+// bindingsByName maps config names (KEY_<NAME>) to the bindings they override
+func (k *keyMap) bindingsByName() map[string]*key.Binding {
+	return map[string]*key.Binding{
+		"UP":               &k.Up,
+		"DOWN":             &k.Down,
+		"ENTER":            &k.Enter,
+		"BACK":             &k.Back,
+		"HELP":             &k.Help,
+		"QUIT":             &k.Quit,
+		"NEW_BOTTLE":       &k.NewBottle,
+		"NEW_YUBIKEY":      &k.NewYubiKey,
+		"SORT":             &k.Sort,
+		"QUICK_LAUNCH":     &k.QuickLaunch,
+		"REVEAL_HIDDEN":    &k.RevealHidden,
+		"LAUNCH":           &k.Launch,
+		"PERMISSIONS":      &k.Permissions,
+		"DELETE":           &k.Delete,
+		"INFO":             &k.Info,
+		"SNAPSHOTS":        &k.Snapshots,
+		"HIDE_BOTTLE":      &k.HideBottle,
+		"TAKE_SNAPSHOT":    &k.TakeSnapshot,
+		"DELETE_SNAPSHOT":  &k.DeleteSnapshot,
+		"SET_DEFAULT":      &k.SetDefault,
+		"ALLOW_APP":        &k.AllowApp,
+		"USE_SUGGESTED":    &k.UseSuggested,
+		"EDIT_DESCRIPTION": &k.EditDescription,
+		"SHOW_ALL_APPS":    &k.ShowAllApps,
+		"SEARCH_FLATHUB":   &k.SearchFlathub,
+		"TOGGLE":           &k.Toggle,
+		"EDIT_DNS":         &k.EditDNS,
+		"YES":              &k.Yes,
+		"NO":               &k.No,
+		"OPEN_FOLDER":      &k.OpenFolder,
+		"RETRY":            &k.Retry,
+		"DETAILS":          &k.Details,
+		"TERMINATE":        &k.Terminate,
+		"TRUST":            &k.Trust,
+		"ADOPT":            &k.Adopt,
+		"UNMOUNT":          &k.Unmount,
+		"LOCK_BOTTLE":      &k.LockBottle,
+	}
+}
+
+// applyKeyOverrides remaps bindings from the global config.
+// Each KEY_<NAME>=key1,key2 line replaces the keys of that binding; the first
+// key is shown in help and hint lines. Permission shortcuts are remapped with
+// KEY_PERM_<PERMISSION>=key.
+func (k *keyMap) applyKeyOverrides(cfg *GlobalConfig) {
+	for name, b := range k.bindingsByName() {
+		keys := parseKeyList(cfg.GetList("KEY_" + name))
+		if len(keys) == 0 {
+			continue
+		}
+		b.SetKeys(keys...)
+		b.SetHelp(keyHelpName(keys[0]), b.Help().Desc)
+	}
+
+	for i, def := range permissionDefs {
+		keys := parseKeyList(cfg.GetList("KEY_PERM_" + strings.ToUpper(def.Name)))
+		if len(keys) > 0 {
+			permissionDefs[i].Key = keys[0]
+		}
+	}
+}
+
+// parseKeyList converts config key names to bubbletea key strings
+func parseKeyList(names []string) []string {
+	keys := make([]string, 0, len(names))
+	for _, n := range names {
+		if strings.EqualFold(n, "space") {
+			n = " "
+		}
+		keys = append(keys, n)
+	}
+	return keys
+}
+
+// keyHelpName returns the display name of a key string
+func keyHelpName(k string) string {
+	if k == " " {
+		return "space"
+	}
+	return k
+}
+
+// hint renders a "[key] label" hint using the binding's configured key
+func hint(b key.Binding, label string) string {
+	return "[" + b.Help().Key + "] " + label
+}
+
+// ShortHelp returns keybindings to be shown in the mini help view
+func (k keyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Up, k.Down, k.Enter, k.Back, k.Help, k.Quit}
+}
+
+// FullHelp returns keybindings for the expanded help view
+func (k keyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.Up, k.Down},
+		{k.Enter, k.Back, k.Help, k.Quit},
+	}
+}
+
+// helpSection is a titled group of bindings shown in the help overlay
+type helpSection struct {
+	title    string
+	bindings []key.Binding
+}
+
+// HelpSections returns the per-view binding groups for the help overlay
+func (k keyMap) HelpSections() []helpSection {
+	return []helpSection{
+		{"General", []key.Binding{k.Up, k.Down, k.Enter, k.Back, k.Help, k.Quit}},
+		{"Bottle list", []key.Binding{k.QuickLaunch, k.NewBottle, k.NewYubiKey, k.Sort, k.RevealHidden}},
+		{"Bottle actions", []key.Binding{k.Launch, k.Permissions, k.Delete, k.Info, k.Snapshots, k.HideBottle}},
+		{"Bottle info", []key.Binding{k.EditDescription, k.Back}},
+		{"Snapshots", []key.Binding{k.TakeSnapshot, k.Enter, k.DeleteSnapshot, k.Back}},
+		{"Permissions", append([]key.Binding{k.Toggle, k.EditDNS}, permissionBindings()...)},
+		{"App selection", []key.Binding{k.ShowAllApps, k.SearchFlathub}},
+		{"Launch", []key.Binding{k.Launch, k.Permissions, k.SetDefault, k.AllowApp, k.UseSuggested}},
+		{"Confirmation dialogs", []key.Binding{k.Yes, k.No}},
+		{"Running app", []key.Binding{k.OpenFolder}},
+		{"YubiKey flows", []key.Binding{k.Enter, k.Retry, k.Toggle, k.Up, k.Down, k.Back}},
+		{"Error", []key.Binding{k.Details, k.Enter}},
+		{"Low space warning", []key.Binding{k.Yes, k.OpenFolder, k.Retry, k.No}},
+		{"Busy bottle", []key.Binding{k.Terminate, k.Retry, k.Back}},
+		{"Changed config", []key.Binding{k.Trust, k.Back}},
+		{"Session recovery", []key.Binding{k.Adopt, k.Unmount, k.LockBottle, k.Back}},
+	}
+}
+
+// permissionBindings returns a binding for each permission shortcut key
+func permissionBindings() []key.Binding {
+	bindings := make([]key.Binding, len(permissionDefs))
+	for i, def := range permissionDefs {
+		bindings[i] = key.NewBinding(
+			key.WithKeys(def.Key),
+			key.WithHelp(keyHelpName(def.Key), "toggle "+def.Label),
+		)
+	}
+	return bindings
+}
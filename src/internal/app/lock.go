@@ -0,0 +1,284 @@
+// Per-bottle session locking: prevents two sessions from mounting/unmounting the same bottle.
+package app
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// BottleLock is a held lock on a bottle
+type BottleLock struct {
+	file *os.File
+	path string
+}
+
+// LockOwner describes the session that holds a bottle's lock
+type LockOwner struct {
+	PID     int
+	App     string
+	Started int64
+}
+
+// String formats the owner for error messages, e.g. "pid 1234 (org.mozilla.firefox, since 14:02)"
+func (o LockOwner) String() string {
+	s := "pid " + strconv.Itoa(o.PID)
+	var details []string
+	if o.App != "" {
+		details = append(details, o.App)
+	}
+	if o.Started > 0 {
+		details = append(details, "since "+time.Unix(o.Started, 0).Format("15:04"))
+	}
+	if len(details) > 0 {
+		s += " (" + strings.Join(details, ", ") + ")"
+	}
+	return s
+}
+
+// bottleInUseError is returned when another session already holds a bottle
+type bottleInUseError struct {
+	bottle string
+	owner  LockOwner
+}
+
+func (e *bottleInUseError) Error() string {
+	return bottleName(e.bottle) + " is already in use by " + e.owner.String()
+}
+
+// errBottleBusy means the owning session is still unlocking the bottle, so it can't be joined yet
+var errBottleBusy = &bottleError{op: "join", msg: "bottle is still being unlocked by another session - try again shortly", class: classInUse}
+
+// lockDir returns the directory for lock files. Prefers $XDG_RUNTIME_DIR so
+// stale locks disappear on logout/reboot.
+func lockDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "bottle-launch")
+	}
+	return filepath.Join(os.TempDir(), "bottle-launch-"+strconv.Itoa(os.Getuid()))
+}
+
+// ensureLockDir creates the lock directory, which also holds the daemon
+// socket and mount points, and refuses one someone else controls. Without
+// $XDG_RUNTIME_DIR its path in /tmp is predictable: another user may have
+// created it first, or left a symlink there. A loose mode is fixed only
+// inside the runtime directory, which is private itself.
+func ensureLockDir() error {
+	dir := lockDir()
+	if err := os.Mkdir(dir, 0700); err == nil {
+		// Not narrowed by an unusual umask
+		_ = os.Chmod(dir, 0700)
+	} else if !errors.Is(err, os.ErrExist) {
+		return &bottleError{op: "runtime dir", msg: err.Error()}
+	}
+	return checkLockDir()
+}
+
+// checkLockDir refuses a lock directory someone else controls, without
+// creating it
+func checkLockDir() error {
+	dir := lockDir()
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return &bottleError{op: "runtime dir", msg: err.Error()}
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !fi.IsDir() || !ok || int(st.Uid) != os.Getuid() {
+		return &bottleError{op: "runtime dir", msg: dir + " is not a directory owned by you - remove it, or set XDG_RUNTIME_DIR"}
+	}
+	if fi.Mode().Perm() != 0700 && os.Getenv("XDG_RUNTIME_DIR") == "" {
+		return &bottleError{op: "runtime dir", msg: dir + " is not private (mode " + fmt.Sprintf("%04o", fi.Mode().Perm()) + ") - remove it, or set XDG_RUNTIME_DIR"}
+	}
+	return nil
+}
+
+// getLockPath returns the lock file path for a bottle
+func getLockPath(bottle string) string {
+	return filepath.Join(lockDir(), getBottleHash(bottle)+".lock")
+}
+
+func openLockFile(bottle string) (*os.File, string, error) {
+	path := getLockPath(bottle)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, "", err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, "", err
+	}
+	return f, path, nil
+}
+
+// acquireBottleLock takes the exclusive lock on a bottle for a new session.
+// Returns *bottleInUseError if another session holds it.
+func acquireBottleLock(bottle, appID string) (*BottleLock, error) {
+	f, path, err := openLockFile(bottle)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, &bottleInUseError{bottle: bottle, owner: readLockOwner(path)}
+		}
+		return nil, err
+	}
+
+	// Record ownership for other sessions' error messages
+	_ = f.Truncate(0)
+	_, _ = fmt.Fprintf(f, "PID=%d\nAPP=%s\nSTARTED=%d\n", os.Getpid(), appID, time.Now().Unix())
+
+	return &BottleLock{file: f, path: path}, nil
+}
+
+// joinBottleLock takes a shared lock on a bottle that another session has
+// mounted, so both sessions can run apps in it
+func joinBottleLock(bottle string) (*BottleLock, error) {
+	f, path, err := openLockFile(bottle)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_SH|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errBottleBusy
+		}
+		return nil, err
+	}
+
+	return &BottleLock{file: f, path: path}, nil
+}
+
+// bottleInUse reports whether any session currently holds the bottle's lock
+func bottleInUse(bottle string) bool {
+	// Only looked at: a bottle without a lock file was never opened
+	f, err := os.Open(getLockPath(bottle))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB) != nil
+}
+
+// lockHolders returns the PIDs of the sessions that have a bottle's lock file
+// open - the owner and any that joined it
+func lockHolders(bottle string) []int {
+	path := getLockPath(bottle)
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+	seen := map[int]bool{}
+	var pids []int
+	for _, fd := range fds {
+		if target, err := os.Readlink(fd); err != nil || target != path {
+			continue
+		}
+		pid, _ := strconv.Atoi(strings.Split(fd, "/")[2])
+		if pid != os.Getpid() && !seen[pid] {
+			seen[pid] = true
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// readLockOwner parses the owner info written by acquireBottleLock
+func readLockOwner(path string) LockOwner {
+	var owner LockOwner
+
+	file, err := os.Open(path)
+	if err != nil {
+		return owner
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, val, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "PID":
+			owner.PID, _ = strconv.Atoi(val)
+		case "APP":
+			owner.App = val
+		case "STARTED":
+			owner.Started, _ = strconv.ParseInt(val, 10, 64)
+		}
+	}
+
+	return owner
+}
+
+// Share downgrades the lock so other sessions can join
+func (l *BottleLock) Share() {
+	if l == nil {
+		return
+	}
+	_ = syscall.Flock(int(l.file.Fd()), syscall.LOCK_SH)
+}
+
+// tryExclusive reports whether this is the only session left on the bottle
+func (l *BottleLock) tryExclusive() bool {
+	return syscall.Flock(int(l.file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB) == nil
+}
+
+// Release drops the lock
+func (l *BottleLock) Release() {
+	if l == nil {
+		return
+	}
+	l.file.Close()
+}
+
+// keptOpenPath returns the marker file of a bottle that unlock-all left open
+func keptOpenPath(bottle string) string {
+	return filepath.Join(lockDir(), getBottleHash(bottle)+".open")
+}
+
+// markKeptOpen keeps a bottle mounted after its sessions end, until it is
+// locked explicitly
+func markKeptOpen(bottle string) {
+	_ = os.MkdirAll(lockDir(), 0700)
+	_ = os.WriteFile(keptOpenPath(bottle), nil, 0600)
+}
+
+// keptOpen reports whether a bottle was left open by unlock-all
+func keptOpen(bottle string) bool {
+	_, err := os.Stat(keptOpenPath(bottle))
+	return err == nil
+}
+
+// clearKeptOpen lets sessions lock the bottle on exit again
+func clearKeptOpen(bottle string) {
+	_ = os.Remove(keptOpenPath(bottle))
+}
+
+// releaseBottle unmounts the bottle unless other sessions are still using it
+// or it is kept open, then releases the lock. A nil lock always unmounts. If
+// processes keep the bottle busy, the lock is kept so the caller can retry.
+func releaseBottle(info *MountInfo, lock *BottleLock) error {
+	if lock == nil {
+		return unmountBottle(info)
+	}
+
+	if !lock.tryExclusive() || keptOpen(info.BottlePath) {
+		// Another session joined (the last one out unmounts), or unlock-all
+		// opened it for the rest of the day
+		lock.Release()
+		return nil
+	}
+	err := unmountBottle(info)
+	var busy *busyError
+	if !errors.As(err, &busy) {
+		lock.Release()
+	}
+	return err
+}
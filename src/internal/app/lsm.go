@@ -0,0 +1,98 @@
+// Security modules: SELinux labels on mounted bottles, and SELinux/AppArmor denials for doctor.
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"bottle-launch/internal/sysfs"
+)
+
+// selinuxEnabled reports whether SELinux is active (enforcing or permissive)
+func selinuxEnabled() bool {
+	_, err := os.Stat("/sys/fs/selinux/enforce")
+	return err == nil
+}
+
+// selinuxEnforcing reports whether SELinux denies what its policy forbids
+func selinuxEnforcing() bool {
+	return sysfs.ReadAttr("/sys/fs/selinux/enforce") == "1"
+}
+
+// apparmorEnabled reports whether AppArmor is active
+func apparmorEnabled() bool {
+	return sysfs.ReadAttr("/sys/module/apparmor/parameters/enabled") == "Y"
+}
+
+// mountContextOption returns the context= mount option for SELINUX_CONTEXT,
+// to append to the mount options ("" if none applies)
+func mountContextOption() string {
+	ctx := globalConfig.Get("SELINUX_CONTEXT")
+	if ctx == "" || !selinuxEnabled() {
+		return ""
+	}
+	return `,context="` + ctx + `"`
+}
+
+// selinuxLabel returns a file's SELinux label ("" if it has none)
+func selinuxLabel(path string) string {
+	buf := make([]byte, 256)
+	n, err := syscall.Getxattr(path, "security.selinux", buf)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimRight(string(buf[:n]), "\x00")
+}
+
+// relabelMount gives a bottle mounted without context= the SELinux labels
+// its apps need. Best-effort, like claimOwnership.
+func relabelMount(mountPoint string) {
+	if !selinuxEnabled() {
+		return
+	}
+	if ctx := globalConfig.Get("SELINUX_CONTEXT"); ctx != "" {
+		_ = command("chcon", "-R", ctx, mountPoint).Run()
+		return
+	}
+	if label := selinuxLabel(mountPoint); label == "" || strings.Contains(label, ":unlabeled_t:") {
+		_ = command("restorecon", "-R", mountPoint).Run()
+	}
+}
+
+// bottleDenials returns this boot's SELinux and AppArmor denials that
+// concern bottles: files on device-mapper devices (LUKS bottles) or under
+// the mount directories. ok is false if neither the journal nor the audit
+// log could be read.
+func bottleDenials() (denials []string, ok bool) {
+	out, err := command("journalctl", "-b", "--no-pager", "-o", "cat",
+		"--grep", `avc: +denied|apparmor="DENIED"`).Output()
+	if err != nil || len(out) == 0 {
+		// Without journald's copy, auditd's log (readable by root only)
+		if out, err = os.ReadFile("/var/log/audit/audit.log"); err != nil {
+			return nil, false
+		}
+	}
+
+	roots := []string{`dev="dm-`, "/run/media/", filepath.Join(lockDir(), "mnt") + "/"}
+	if dir := globalConfig.Get("MOUNT_DIR"); dir != "" {
+		roots = append(roots, expandHome(dir)+"/")
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.Contains(line, "denied") && !strings.Contains(line, `apparmor="DENIED"`) {
+			continue
+		}
+		for _, root := range roots {
+			if strings.Contains(line, root) {
+				denials = append(denials, line)
+				break
+			}
+		}
+	}
+	return denials, true
+}
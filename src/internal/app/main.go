@@ -0,0 +1,2234 @@
+// Main entry point: CLI argument parsing, signal handling, and TUI initialization.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/term"
+
+	"bottle-launch/internal/sysfs"
+	"bottle-launch/internal/wait"
+)
+
+// Global state for signal handler cleanup
+var (
+	currentMountInfo  *MountInfo
+	currentRunningCmd *exec.Cmd
+	currentBottleLock *BottleLock
+	mountMutex        sync.Mutex
+	cleanupOnce       sync.Once
+)
+
+// SetCurrentMountInfo updates the global mount info (for signal handler cleanup)
+func SetCurrentMountInfo(info *MountInfo) {
+	mountMutex.Lock()
+	currentMountInfo = info
+	mountMutex.Unlock()
+}
+
+// SetCurrentRunningCmd updates the global running command (for signal handler cleanup)
+func SetCurrentRunningCmd(cmd *exec.Cmd) {
+	mountMutex.Lock()
+	currentRunningCmd = cmd
+	mountMutex.Unlock()
+}
+
+// SetCurrentBottleLock updates the global bottle lock (for signal handler cleanup)
+func SetCurrentBottleLock(lock *BottleLock) {
+	mountMutex.Lock()
+	currentBottleLock = lock
+	mountMutex.Unlock()
+}
+
+// setupSignalHandler sets up signal handling to unmount on abnormal exit:
+// SIGTERM, SIGHUP and SIGQUIT, plus SIGINT when withInterrupt is set. The
+// TUI leaves SIGINT to Bubbletea; the CLI has nothing else to catch it.
+func setupSignalHandler(withInterrupt bool) {
+	sigs := []os.Signal{syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT}
+	if withInterrupt {
+		sigs = append(sigs, syscall.SIGINT)
+	}
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sigs...)
+	go func() {
+		sig := <-c
+		performCleanup(c)
+		// Exit the way a shell reports death by a signal: 128 + its number
+		if n, ok := sig.(syscall.Signal); ok {
+			os.Exit(128 + int(n))
+		}
+		os.Exit(ExitSIGINT)
+	}()
+}
+
+// performCleanup stops any running process and unmounts the bottle. The app
+// gets SessionKillGrace to exit (and save its data) unless another signal
+// arrives on hurry. Safe to call multiple times due to sync.Once.
+func performCleanup(hurry <-chan os.Signal) {
+	cleanupOnce.Do(func() {
+		mountMutex.Lock()
+		defer mountMutex.Unlock()
+
+		// Stop running Flatpak process first; unmounting under it loses data
+		if currentRunningCmd != nil {
+			stopAppGracefully(currentRunningCmd, hurry)
+			currentRunningCmd = nil
+		}
+
+		// Unmount the bottle (unless another session joined it)
+		if currentMountInfo != nil {
+			_ = releaseBottle(currentMountInfo, currentBottleLock)
+			currentMountInfo = nil
+		} else {
+			currentBottleLock.Release()
+		}
+		currentBottleLock = nil
+	})
+}
+
+// readOnlyCommands don't change bottles, so they leave interrupted
+// operations to the next command that does: rolling one back may ask for
+// privileges
+var readOnlyCommands = map[string]bool{
+	"-h": true, "--help": true, "help": true, "version": true, "--version": true,
+	"completion": true, "doctor": true, "key-drives": true, "profiles": true,
+	"list": true, "stats": true, "watch": true, "audit": true,
+}
+
+// Main runs the bottle-launch command line.
+func Main() {
+	// Started by flatpak as the bwrap of a bottle with DNS overrides
+	if filepath.Base(os.Args[0]) == bwrapWrapperName {
+		runBwrapWrapper()
+	}
+
+	// Asked by the completion scripts on every TAB; keep it quiet and quick
+	if len(os.Args) > 1 && os.Args[1] == "__complete" {
+		for _, c := range completeWords(os.Args[2:]) {
+			fmt.Println(c)
+		}
+		return
+	}
+
+	// A traced program, run by command() under --trace
+	if len(os.Args) > 1 && os.Args[1] == traceCommand {
+		runTraceWrapper(os.Args[2:])
+	}
+
+	os.Args = parseOutputFlags(os.Args)
+	if traceArg != "" {
+		if err := startTrace(traceArg); err != nil {
+			exitWithError(err)
+		}
+	}
+
+	// Polled by status bars: status only reads, so it skips the checks and
+	// repairs below (and never waits on the keyring for config signatures)
+	if len(os.Args) > 1 && os.Args[1] == "status" {
+		os.Exit(runStatus(os.Args[2:]))
+	}
+
+	// Locks, sockets and mount points go where nobody else can reach them
+	if err := ensureLockDir(); err != nil {
+		exitWithError(err)
+	}
+	// Keep our own files private; the TUI shows the warnings itself
+	warnings := selfCheck()
+	// Undo what a crash left half done (journal.go), before anything that
+	// could change bottles
+	if len(os.Args) == 1 || !readOnlyCommands[os.Args[1]] {
+		warnings = append(warnings, recoverJournals()...)
+	}
+	tuiMode := len(os.Args) == 1 || os.Args[1] == "tui" || os.Args[1] == "--show-hidden"
+	if tuiMode {
+		quiet, verbose = false, false
+	} else {
+		for _, w := range warnings {
+			notice("Warning: " + w)
+		}
+	}
+
+	// Parse CLI args - default to TUI mode
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "-h", "--help", "help":
+			if len(os.Args) > 2 && os.Args[2] == "exit-codes" {
+				printExitCodes()
+				return
+			}
+			printUsage()
+			return
+		case "version", "--version":
+			cmdVersion()
+			return
+		case "completion":
+			if len(os.Args) != 3 {
+				fmt.Fprintln(os.Stderr, "Usage: bottle-launch completion bash|zsh|fish")
+				os.Exit(ExitUsage)
+			}
+			if err := cmdCompletion(os.Args[2]); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "self-update":
+			checkOnly := false
+			for _, arg := range os.Args[2:] {
+				if arg != "--check" {
+					fmt.Fprintln(os.Stderr, "Usage: bottle-launch self-update [--check]")
+					os.Exit(ExitUsage)
+				}
+				checkOnly = true
+			}
+			if err := cmdSelfUpdate(checkOnly); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "doctor":
+			if err := cmdDoctor(); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "install-udev-rules":
+			printOnly := false
+			for _, arg := range os.Args[2:] {
+				if arg != "--print" {
+					fmt.Fprintln(os.Stderr, "Usage: bottle-launch install-udev-rules [--print]")
+					os.Exit(ExitUsage)
+				}
+				printOnly = true
+			}
+			if err := cmdInstallUdevRules(printOnly); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "create":
+			var args []string
+			backend, keyDrive, device := BackendLUKS, "", ""
+			fido2 := false
+			for i := 2; i < len(os.Args); i++ {
+				arg := os.Args[i]
+				if strings.HasPrefix(arg, "--backend=") {
+					backend = strings.TrimPrefix(arg, "--backend=")
+				} else if strings.HasPrefix(arg, "--key-drive=") {
+					keyDrive = strings.TrimPrefix(arg, "--key-drive=")
+				} else if arg == "--fido2" {
+					fido2 = true
+				} else if arg == "--preallocate" {
+					preallocate = true
+				} else if arg == "--integrity" {
+					integrity = true
+				} else if arg == "--encrypt" {
+					squashfsEncrypt = true
+				} else if arg == "--overlay" {
+					squashfsOverlay = true
+				} else if strings.HasPrefix(arg, "--device=") {
+					device = strings.TrimPrefix(arg, "--device=")
+				} else if arg == "--device" && i+1 < len(os.Args) {
+					i++
+					device = os.Args[i]
+				} else {
+					args = append(args, arg)
+				}
+			}
+			// Directory bottles grow as needed and take no size; squashfs
+			// bottles take the directory to pack instead
+			complete := len(args) >= 2 || (backend != BackendLUKS && backend != BackendSquashfs && len(args) == 1)
+			if !complete && (keyDrive != "" || fido2 || !term.IsTerminal(os.Stdin.Fd())) {
+				fmt.Fprintln(os.Stderr, "Usage: bottle-launch create [--backend=luks|gocryptfs|fscrypt] [--key-drive=<drive>] [--preallocate] [--integrity] <bottle> <size | /dev/...>")
+				fmt.Fprintln(os.Stderr, "       bottle-launch create --fido2 [--device /dev/hidrawN] [--preallocate] [--integrity] <bottle> <size>")
+				fmt.Fprintln(os.Stderr, "       bottle-launch create --backend=squashfs [--encrypt] [--overlay] <bottle> <directory>")
+				os.Exit(ExitUsage)
+			}
+			if device != "" && !fido2 {
+				fmt.Fprintln(os.Stderr, "Error: --device picks the security key for --fido2")
+				os.Exit(ExitUsage)
+			}
+			if fido2 && (backend != BackendLUKS || keyDrive != "") {
+				fmt.Fprintln(os.Stderr, "Error: --fido2 bottles are LUKS images, without a key drive")
+				os.Exit(ExitUsage)
+			}
+			if preallocate && backend != BackendLUKS {
+				fmt.Fprintln(os.Stderr, "Error: --preallocate is for LUKS image bottles; directory bottles have no size")
+				os.Exit(ExitUsage)
+			}
+			if integrity && backend != BackendLUKS {
+				fmt.Fprintln(os.Stderr, "Error: --integrity is for LUKS bottles")
+				os.Exit(ExitUsage)
+			}
+			if (squashfsEncrypt || squashfsOverlay) && backend != BackendSquashfs {
+				fmt.Fprintln(os.Stderr, "Error: --encrypt and --overlay are for squashfs bottles")
+				os.Exit(ExitUsage)
+			}
+			args = append(args, "", "")
+			if complete && backend == BackendLUKS && !strings.HasPrefix(args[1], "/dev/") {
+				warnHostSpace(args[1])
+			}
+			// ctrl+c cancels the creation, which then removes what it made
+			ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+			defer stop()
+			var err error
+			if !complete {
+				// Ask for the rest on the terminal
+				err = cmdCreateInteractive(ctx, backend, args[0], args[1])
+			} else if fido2 {
+				err = createFIDO2BottleCLI(ctx, args[0], args[1], device)
+			} else if keyDrive != "" {
+				err = createKeyDriveBottle(backend, args[0], args[1], keyDrive)
+			} else {
+				err = cmdCreate(ctx, backend, args[0], args[1])
+			}
+			if errors.Is(err, context.Canceled) {
+				notice("Cancelled; the partly created bottle was removed.")
+				os.Exit(ExitSIGINT)
+			}
+			if err != nil {
+				exitWithError(err)
+			}
+			return
+		case "run":
+			profileRun := len(os.Args) > 2 && strings.HasPrefix(os.Args[2], "@")
+			if len(os.Args) < 4 && !profileRun {
+				fmt.Fprintln(os.Stderr, "Usage: bottle-launch run <bottle> <app_id> [--join] [--any-app] [--timeout=DURATION] [--open <file>] [--json] [-- args...]")
+				fmt.Fprintln(os.Stderr, "       bottle-launch run @<profile> [options] [-- args...]")
+				os.Exit(ExitUsage)
+			}
+			var bottle, appID string
+			var extraArgs []string
+			opts := runOptions{timeout: -1}
+			first := 4
+			if profileRun {
+				profile, err := loadProfile(os.Args[2])
+				if err != nil {
+					exitWithError(err)
+				}
+				bottle, appID, opts.profile = profile.Bottle, profile.App, profile
+				first = 3
+			} else {
+				bottle, appID = os.Args[2], os.Args[3]
+			}
+			for i := first; i < len(os.Args); i++ {
+				arg := os.Args[i]
+				if arg == "--" {
+					extraArgs = os.Args[i+1:]
+					break
+				}
+				switch {
+				case arg == "--join":
+					opts.join = true
+				case arg == "--json":
+					// Errors as JSON, see exitWithError
+				case arg == "--any-app":
+					opts.anyApp = true
+				case arg == "--open" && i+1 < len(os.Args):
+					i++
+					opts.open = append(opts.open, os.Args[i])
+				case strings.HasPrefix(arg, "--open="):
+					opts.open = append(opts.open, strings.TrimPrefix(arg, "--open="))
+				case strings.HasPrefix(arg, "--timeout="):
+					d, err := parseTimeout(strings.TrimPrefix(arg, "--timeout="))
+					if err != nil {
+						exitWithError(badArgument("timeout", err))
+					}
+					opts.timeout = d
+				default:
+					fmt.Fprintf(os.Stderr, "Unknown option: %s\n", arg)
+					os.Exit(ExitUsage)
+				}
+			}
+			if err := cmdRun(bottle, appID, opts, extraArgs); err != nil {
+				if needGUIPrompts() && !jsonErrors() {
+					sendNotification("Could not launch "+appID, err.Error())
+				}
+				exitWithError(err)
+			}
+			return
+		case "list":
+			cmdList()
+			return
+		case "archive":
+			if len(os.Args) < 3 {
+				cmdListArchived()
+				return
+			}
+			if err := cmdArchive(os.Args[2]); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "snapshot", "snapshots":
+			if len(os.Args) == 3 && os.Args[1] == "snapshot" && os.Args[2] == "--all" {
+				if err := cmdSnapshotScheduled(); err != nil {
+					exitWithError(err)
+				}
+				return
+			}
+			if len(os.Args) < 3 {
+				fmt.Fprintf(os.Stderr, "Usage: bottle-launch %s <bottle>\n", os.Args[1])
+				os.Exit(ExitUsage)
+			}
+			if os.Args[1] == "snapshots" {
+				cmdSnapshots(os.Args[2])
+				return
+			}
+			if err := cmdSnapshot(os.Args[2]); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "retention":
+			if len(os.Args) < 3 {
+				fmt.Fprintln(os.Stderr, "Usage: bottle-launch retention <bottle> [--last=N] [--daily=N] [--weekly=N] [--clear]")
+				os.Exit(ExitUsage)
+			}
+			if err := cmdRetention(os.Args[2], os.Args[3:]); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "prune":
+			args := os.Args[2:]
+			dryRun := len(args) > 0 && args[0] == "--dry-run"
+			if dryRun {
+				args = args[1:]
+			}
+			if len(args) != 1 {
+				fmt.Fprintln(os.Stderr, "Usage: bottle-launch prune [--dry-run] <bottle>")
+				os.Exit(ExitUsage)
+			}
+			if err := cmdPrune(args[0], dryRun); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "snapshot-timer":
+			onCalendar, remove := "daily", false
+			for _, arg := range os.Args[2:] {
+				switch {
+				case arg == "--remove":
+					remove = true
+				case strings.HasPrefix(arg, "--on-calendar="):
+					onCalendar = strings.TrimPrefix(arg, "--on-calendar=")
+				default:
+					fmt.Fprintln(os.Stderr, "Usage: bottle-launch snapshot-timer [--on-calendar=SPEC | --remove]")
+					os.Exit(ExitUsage)
+				}
+			}
+			if err := cmdSnapshotTimer(onCalendar, remove); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "bench":
+			var bottle string
+			size, compare := DefaultBenchSize, false
+			for _, arg := range os.Args[2:] {
+				switch {
+				case arg == "--json":
+					// Errors as JSON, see exitWithError
+				case arg == "--compare":
+					compare = true
+				case strings.HasPrefix(arg, "--size="):
+					size = strings.TrimPrefix(arg, "--size=")
+				default:
+					bottle = arg
+				}
+			}
+			if bottle == "" {
+				fmt.Fprintln(os.Stderr, "Usage: bottle-launch bench [--size=256M] [--compare] [--json] <bottle>")
+				os.Exit(ExitUsage)
+			}
+			if err := cmdBench(bottle, size, compare); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "dedupe-report":
+			var names []string
+			set, minSize, reflink := "", DefaultDedupeMinSize, false
+			for _, arg := range os.Args[2:] {
+				switch {
+				case arg == "--reflink":
+					reflink = true
+				case strings.HasPrefix(arg, "--set="):
+					set = strings.TrimPrefix(arg, "--set=")
+				case strings.HasPrefix(arg, "--min-size="):
+					minSize = strings.TrimPrefix(arg, "--min-size=")
+				case strings.HasPrefix(arg, "-"):
+					fmt.Fprintln(os.Stderr, "Usage: bottle-launch dedupe-report [--min-size=1M] [--reflink] [--set=<name> | <bottle>...]")
+					os.Exit(ExitUsage)
+				default:
+					names = append(names, arg)
+				}
+			}
+			minBytes, err := parseSize(minSize)
+			if err != nil {
+				exitWithError(badArgument("size", err))
+			}
+			if err := cmdDedupeReport(names, set, minBytes, reflink); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "watch":
+			asJSON := false
+			for _, arg := range os.Args[2:] {
+				if arg != "--json" {
+					fmt.Fprintln(os.Stderr, "Usage: bottle-launch watch [--json]")
+					os.Exit(ExitUsage)
+				}
+				asJSON = true
+			}
+			if err := cmdWatch(asJSON); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "gc":
+			dryRun := false
+			for _, arg := range os.Args[2:] {
+				if arg != "--dry-run" {
+					fmt.Fprintln(os.Stderr, "Usage: bottle-launch gc [--dry-run]")
+					os.Exit(ExitUsage)
+				}
+				dryRun = true
+			}
+			if err := cmdGC(dryRun); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "clone":
+			if len(os.Args) != 4 {
+				fmt.Fprintln(os.Stderr, "Usage: bottle-launch clone <bottle> <new bottle>")
+				os.Exit(ExitUsage)
+			}
+			if err := cmdClone(os.Args[2], os.Args[3]); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "restore":
+			if len(os.Args) < 4 {
+				fmt.Fprintln(os.Stderr, "Usage: bottle-launch restore <bottle> <snapshot>")
+				os.Exit(ExitUsage)
+			}
+			if err := cmdRestore(os.Args[2], os.Args[3]); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "unarchive":
+			if len(os.Args) < 3 {
+				fmt.Fprintln(os.Stderr, "Usage: bottle-launch unarchive <bottle>")
+				os.Exit(ExitUsage)
+			}
+			if err := cmdUnarchive(os.Args[2]); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "recovery":
+			var bottle, out string
+			newKey, qr := false, false
+			args := os.Args[2:]
+			for i := 0; i < len(args); i++ {
+				switch {
+				case args[i] == "--new-key":
+					newKey = true
+				case args[i] == "--qr":
+					qr = true
+				case args[i] == "--out" && i+1 < len(args):
+					i++
+					out = args[i]
+				case strings.HasPrefix(args[i], "--out="):
+					out = strings.TrimPrefix(args[i], "--out=")
+				default:
+					bottle = args[i]
+				}
+			}
+			if bottle == "" {
+				fmt.Fprintln(os.Stderr, "Usage: bottle-launch recovery [--new-key] [--qr] [--out <file>] <bottle>")
+				os.Exit(ExitUsage)
+			}
+			if err := cmdRecovery(bottle, newKey, qr, out); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "mountpoint":
+			if len(os.Args) < 3 {
+				fmt.Fprintln(os.Stderr, "Usage: bottle-launch mountpoint <bottle> [<dir> | --clear]")
+				os.Exit(ExitUsage)
+			}
+			dir := ""
+			if len(os.Args) > 3 {
+				dir = os.Args[3]
+			}
+			if err := cmdMountPoint(os.Args[2], dir); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "quota", "reserve":
+			if len(os.Args) < 3 {
+				if os.Args[1] == "quota" {
+					fmt.Fprintln(os.Stderr, "Usage: bottle-launch quota <bottle> [<size> | --clear]")
+				} else {
+					fmt.Fprintln(os.Stderr, "Usage: bottle-launch reserve <bottle> [<percent>]")
+				}
+				os.Exit(ExitUsage)
+			}
+			value := ""
+			if len(os.Args) > 3 {
+				value = os.Args[3]
+			}
+			cmd := cmdQuota
+			if os.Args[1] == "reserve" {
+				cmd = cmdReserve
+			}
+			if err := cmd(os.Args[2], value); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "forensics", "untrusted", "hidden":
+			if len(os.Args) < 3 {
+				fmt.Fprintln(os.Stderr, "Usage: bottle-launch "+os.Args[1]+" <bottle> [on | off]")
+				os.Exit(ExitUsage)
+			}
+			value := ""
+			if len(os.Args) > 3 {
+				value = os.Args[3]
+			}
+			cmd := cmdForensics
+			switch os.Args[1] {
+			case "untrusted":
+				cmd = cmdUntrusted
+			case "hidden":
+				cmd = cmdHidden
+			}
+			if err := cmd(os.Args[2], value); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "duress":
+			var bottle, size, action string
+			remove := false
+			for _, arg := range os.Args[2:] {
+				switch {
+				case strings.HasPrefix(arg, "--size="):
+					size = strings.TrimPrefix(arg, "--size=")
+				case strings.HasPrefix(arg, "--action="):
+					action = strings.TrimPrefix(arg, "--action=")
+				case arg == "--remove":
+					remove = true
+				default:
+					bottle = arg
+				}
+			}
+			if bottle == "" {
+				fmt.Fprintln(os.Stderr, "Usage: bottle-launch duress <bottle> [--size=SIZE] [--action=COMMAND] | --remove")
+				os.Exit(ExitUsage)
+			}
+			if err := cmdDuress(bottle, size, action, remove); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "trust":
+			yes := slices.Contains(os.Args[2:], "--yes")
+			args := slices.DeleteFunc(slices.Clone(os.Args[2:]), func(a string) bool { return a == "--yes" })
+			if len(args) != 1 {
+				fmt.Fprintln(os.Stderr, "Usage: bottle-launch trust [--yes] <bottle>")
+				os.Exit(ExitUsage)
+			}
+			if err := cmdTrust(args[0], yes); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "key-drives":
+			cmdKeyDrives()
+			return
+		case "audit":
+			bottle := ""
+			if len(os.Args) > 2 {
+				bottle = os.Args[2]
+			}
+			if err := cmdAudit(bottle); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "allow":
+			if len(os.Args) < 3 {
+				fmt.Fprintln(os.Stderr, "Usage: bottle-launch allow <bottle> [<app_id>... | --remove <app_id>... | --clear]")
+				os.Exit(ExitUsage)
+			}
+			if err := cmdAllow(os.Args[2], os.Args[3:]); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "mime-register":
+			args := os.Args[2:]
+			remove := len(args) > 0 && args[0] == "--remove"
+			if remove {
+				args = args[1:]
+			}
+			if len(args) < 2 || (!remove && len(args) < 3) {
+				fmt.Fprintln(os.Stderr, "Usage: bottle-launch mime-register <bottle> <app_id> <mimetype>... | --remove <bottle> <app_id>")
+				os.Exit(ExitUsage)
+			}
+			var err error
+			if remove {
+				err = cmdMimeUnregister(args[0], args[1])
+			} else {
+				err = cmdMimeRegister(args[0], args[1], args[2:])
+			}
+			if err != nil {
+				exitWithError(err)
+			}
+			return
+		case "secret":
+			if len(os.Args) < 3 {
+				fmt.Fprintln(os.Stderr, "Usage: bottle-launch secret <bottle> [<ref> | --clear]")
+				os.Exit(ExitUsage)
+			}
+			ref := ""
+			if len(os.Args) > 3 {
+				ref = os.Args[3]
+			}
+			if err := cmdSecret(os.Args[2], ref); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "verify":
+			var bottle string
+			withChecksum := false
+			for _, arg := range os.Args[2:] {
+				if arg == "--checksum" {
+					withChecksum = true
+				} else {
+					bottle = arg
+				}
+			}
+			if bottle == "" {
+				fmt.Fprintln(os.Stderr, "Usage: bottle-launch verify [--checksum] <bottle>")
+				os.Exit(ExitUsage)
+			}
+			if err := cmdVerify(bottle, withChecksum); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "sync":
+			var args []string
+			pull, force := false, false
+			for _, arg := range os.Args[2:] {
+				switch arg {
+				case "--pull":
+					pull = true
+				case "--force":
+					force = true
+				default:
+					args = append(args, arg)
+				}
+			}
+			if len(args) < 1 || len(args) > 2 {
+				fmt.Fprintln(os.Stderr, "Usage: bottle-launch sync [--pull] [--force] <bottle> [remote:path]")
+				os.Exit(ExitUsage)
+			}
+			remote := ""
+			if len(args) == 2 {
+				remote = args[1]
+			}
+			if err := cmdSync(args[0], remote, pull, force); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "config":
+			if err := cmdConfig(os.Args[2:]); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "fido2":
+			if len(os.Args) != 4 || os.Args[2] != "rotate" {
+				fmt.Fprintln(os.Stderr, "Usage: bottle-launch fido2 rotate <bottle>")
+				os.Exit(ExitUsage)
+			}
+			if err := cmdFIDO2Rotate(os.Args[3]); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "migrate":
+			if err := cmdMigrate(os.Args[2:]); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "stats":
+			bottle := ""
+			if len(os.Args) > 2 {
+				bottle = os.Args[2]
+			}
+			cmdStats(bottle)
+			return
+		case "open":
+			if len(os.Args) < 3 {
+				fmt.Fprintln(os.Stderr, "Usage: bottle-launch open <bottle>")
+				os.Exit(ExitUsage)
+			}
+			if err := cmdOpen(os.Args[2]); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "lock":
+			var bottle string
+			force := false
+			for _, arg := range os.Args[2:] {
+				if arg == "--force" {
+					force = true
+				} else {
+					bottle = arg
+				}
+			}
+			if bottle == "" {
+				fmt.Fprintln(os.Stderr, "Usage: bottle-launch lock [--force] <bottle>")
+				os.Exit(ExitUsage)
+			}
+			if err := cmdLock(bottle, force); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "unlock-all":
+			set := ""
+			if len(os.Args) > 2 {
+				set = os.Args[2]
+			}
+			if err := cmdUnlockAll(set); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "lock-all":
+			set, force := "", false
+			for _, arg := range os.Args[2:] {
+				if arg == "--force" {
+					force = true
+				} else {
+					set = arg
+				}
+			}
+			if err := cmdLockAll(set, force); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "profiles":
+			cmdProfiles()
+			return
+		case "sandbox":
+			if len(os.Args) < 4 {
+				fmt.Fprintln(os.Stderr, "Usage: bottle-launch sandbox <bottle> <app_id>")
+				os.Exit(ExitUsage)
+			}
+			if err := cmdSandbox(os.Args[2], os.Args[3]); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "flatpak-override":
+			if len(os.Args) < 5 {
+				fmt.Fprintln(os.Stderr, "Usage: bottle-launch flatpak-override export|import <bottle> <app_id>")
+				os.Exit(ExitUsage)
+			}
+			if err := cmdFlatpakOverride(os.Args[2], os.Args[3], os.Args[4]); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "workspace":
+			var err error
+			if len(os.Args) > 2 {
+				err = cmdWorkspace(os.Args[2])
+			} else {
+				err = cmdWorkspaces()
+			}
+			if err != nil {
+				exitWithError(err)
+			}
+			return
+		case "tray":
+			if len(os.Args) > 3 || (len(os.Args) == 3 && os.Args[2] != "--show-hidden") {
+				fmt.Fprintln(os.Stderr, "Usage: bottle-launch tray [--show-hidden]")
+				os.Exit(ExitUsage)
+			}
+			if err := cmdTray(len(os.Args) == 3); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "daemon":
+			if err := cmdDaemon(); err != nil {
+				exitWithError(err)
+			}
+			return
+		case "tui", "--show-hidden":
+			// Fall through to TUI mode
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown command: %s\n", os.Args[1])
+			printUsage()
+			os.Exit(ExitUsage)
+		}
+	}
+
+	// TUI mode
+	applyTheme(resolveTheme(globalConfig))
+	setupSignalHandler(false)
+
+	// Ensure cleanup happens on panic or unexpected exit
+	defer func() {
+		if r := recover(); r != nil {
+			performCleanup(nil)
+			panic(r) // Re-panic after cleanup
+		}
+	}()
+
+	showHidden := slices.Contains(os.Args[1:], "--show-hidden")
+	p := tea.NewProgram(initialModel(showHidden, warnings), tea.WithAltScreen())
+	if _, err := p.Run(); err != nil {
+		performCleanup(nil)
+		exitWithError(err)
+	}
+}
+
+func printUsage() {
+	fmt.Print(`Usage: bottle-launch <command> [options]
+
+Commands:
+    tui [--show-hidden]       Interactive TUI mode (default; --show-hidden:
+                              also list hidden bottles)
+    create <bottle> <size>    Create a new encrypted bottle (run on a terminal
+                              without the bottle or size to be asked for
+                              them, a password, or a YubiKey)
+    create <bottle> <device>  Format a block device (e.g. /dev/sdb1) as a bottle
+    create --backend=gocryptfs|fscrypt <bottle>
+                              Create a rootless directory bottle (no
+                              udisks/polkit rights needed)
+    create --key-drive=<drive> <bottle> <size>
+                              Create a bottle whose key is a random file on
+                              a USB drive; it only unlocks with the drive
+                              plugged in
+    create --fido2 [--device /dev/hidrawN] <bottle> <size>
+                              Create a bottle unlocked by touching a YubiKey
+                              or other FIDO2 key (--device: which key, if
+                              several are plugged in)
+    create --backend=squashfs [--encrypt] [--overlay] <bottle> <directory>
+                              Pack a directory into a read-only bottle to
+                              hand out (--encrypt: inside LUKS; --overlay:
+                              mount it with a writable layer on top)
+    create --preallocate ...  Reserve the bottle's whole size on the host now
+                              (fallocate) instead of creating a sparse file
+                              that can run out of host space later
+    create --integrity ...    Detect corruption and tampering of the bottle
+                              (LUKS2 integrity=hmac); slower writes, and the
+                              whole size is written while creating
+    key-drives                List the removable drives (UUID, label, mount)
+    run <bottle> <app_id> [options] [-- extra_args...]
+                              Run Flatpak app with data in bottle (app_id
+                              may be a full ref: app/<id>/<arch>/<branch>)
+                              --join: share a bottle already in use
+                              --any-app: ignore the bottle's allowed apps
+                              --timeout=2h: close app and lock after 2h
+                              --open <file>: copy a host file into the
+                              bottle's Inbox/ and open it in the app
+                              --json: report a failure as JSON on stdout
+    run @<profile> [options] [-- extra_args...]
+                              Run a launch profile's app in its bottle, with
+                              its permissions and arguments
+    profiles                  List the launch profiles
+    list                      List currently mounted bottles
+    status [--json] <bottle>  Print bottle state; exit 0 mounted, 3 unlocked,
+                              4 locked, 5 missing
+    status [--json] --all     Print the state of every bottle
+    stats [bottle]            Show launch counts and runtime per app
+    watch [--json]            Print bottles being unlocked, mounted, used, and
+                              locked as it happens, as text or JSON lines
+    gc [--dry-run]            Remove the temporary files of failed bottle
+                              creations
+    dedupe-report [--min-size=1M] [--reflink] [--set=<name> | <bottle>...]
+                              List large files duplicated across the mounted
+                              bottles and the space they take (--reflink:
+                              share the copies' blocks on btrfs/XFS)
+    bench [--size=256M] [--compare] [--json] <bottle>
+                              Measure read/write throughput and latency
+                              inside the bottle (--compare: also on the host)
+    recovery [--new-key] [--qr] [--out <file>] <bottle>
+                              Print a bottle's recovery material (YubiKey
+                              parameters; --new-key adds a recovery key) for
+                              offline storage, optionally as a QR code
+    mountpoint <bottle> [<dir> | --clear]
+                              Show, set, or clear a fixed mount point for the
+                              bottle (default: udisks picks one)
+    quota <bottle> [<size> | --clear]
+                              Show, set, or clear a soft quota, warned about
+                              while an app runs
+    reserve <bottle> [<percent>]
+                              Show or set the share of an unlocked LUKS
+                              bottle reserved for root (tune2fs -m)
+    allow <bottle> [<app_id>... | --remove <app_id>... | --clear]
+                              Show or edit the only apps the bottle offers
+                              and runs (default: any app)
+    forensics <bottle> [on | off]
+                              Show or set whether each session records the
+                              files it added, changed, and removed
+    untrusted <bottle> [on | off]
+                              Show or set whether the bottle holds untrusted
+                              downloads, scanned for malware (SCAN_COMMAND,
+                              default clamscan) before it is locked
+    hidden <bottle> [on | off]
+                              Show or set whether the TUI leaves the bottle
+                              out of its list until hidden bottles are
+                              revealed (names starting with . always are)
+    duress <bottle> [--size=128M] [--action=<command>]
+                              Add a duress passphrase: typed in the TUI or
+                              the password dialog, it opens a small decoy
+                              bottle instead (and runs the command, if any).
+                              LUKS bottles only. The decoy is a separate
+                              image in a hidden folder of the bottle
+                              directory, so its existence can be seen
+    duress <bottle> --remove  Remove the duress passphrase and its decoy
+    trust [--yes] <bottle>    Show a config changed outside bottle-launch
+                              (its signature doesn't match) and accept it
+    config get <bottle> [KEY] Print a config value (no KEY: the whole config)
+    config set <bottle> KEY VALUE
+                              Change a setting (KEY=VALUE works too): the
+                              permissions (PREF_NETWORK etc.), PREF_DEFAULT_APP,
+                              PREF_ALLOWED_APPS, PREF_TIMEOUT, PREF_DNS,
+                              PREF_HOSTS, PREF_QUOTA, PREF_SNAPSHOT_KEEP_*,
+                              PREF_FORENSICS, PREF_UNTRUSTED, PREF_HIDDEN,
+                              PREF_DESCRIPTION, PREF_GROW_BY, PREF_GROW_AT,
+                              PREF_GROW_MAX, PREF_GROW_PAUSED
+    audit [<bottle>]          Show the audit log (what forensics sessions
+                              changed, malware scan results), for one bottle
+                              or all of them
+    mime-register <bottle> <app_id> <mimetype>...
+                              Open files of these types from the host in the
+                              app inside the bottle (a password dialog asks
+                              to unlock it)
+    mime-register --remove <bottle> <app_id>
+                              Remove the file type handler again
+    sandbox <bottle> <app_id> Show the permissions the app's metadata asks
+                              for, and which of them the bottle grants
+    flatpak-override export|import <bottle> <app_id>
+                              Write the bottle's permissions to the app's
+                              flatpak override file (as Flatseal edits), or
+                              read them back from it
+    secret <bottle> [<ref> | --clear]
+                              Show, set, or clear where the bottle's password
+                              is kept in a password manager
+    verify [--checksum] <bottle>
+                              Check a locked bottle file for outside changes
+                              (--checksum: also compare its sha256)
+    sync [--pull] [--force] <bottle> [remote:path]
+                              Push (or pull) a locked bottle to an rclone
+                              remote; the remote is remembered per bottle
+    migrate export <bottle> [file]
+                              Bundle a bottle, its config, and a LUKS header
+                              backup into one file for another machine
+    migrate import <file> [name]
+                              Install a bundle and check the YubiKey works
+    migrate reenroll <bottle> Move a YubiKey bottle to a different key
+    fido2 rotate <bottle>     Give a YubiKey bottle a new salt, and so a new
+                              unlock secret, on the same key (two touches)
+    archive [bottle]          Compress a locked bottle into the archive
+                              directory (no argument: list archived bottles)
+    unarchive <bottle>        Restore an archived bottle
+    snapshot <bottle>         Save a point-in-time copy of a bottle, even
+                              while it is mounted (fsfreeze; a reflink clone
+                              on btrfs/XFS)
+    snapshot --all            Snapshot and prune every bottle with a
+                              retention policy (skips open LUKS bottles)
+    snapshots <bottle>        List a bottle's snapshots
+    retention <bottle> [--last=N] [--daily=N] [--weekly=N] [--clear]
+                              Show or set which snapshots are kept; bottles
+                              with a policy are pruned after each snapshot
+    prune [--dry-run] <bottle>
+                              Delete the snapshots the policy doesn't keep
+    snapshot-timer [--on-calendar=SPEC | --remove]
+                              Write a systemd user timer that runs
+                              snapshot --all (default: daily)
+    restore <bottle> <snapshot>
+                              Replace a locked bottle with a snapshot (the
+                              current version is snapshotted first)
+    clone <bottle> <new bottle>
+                              Copy a locked bottle, settings included, to a
+                              new one with the same password or key (instant
+                              on btrfs/XFS)
+    open <bottle>             Open a mounted bottle in the file manager
+    lock [--force] <bottle>   Close the sessions using a bottle, then unmount
+                              and lock it (--force: also stop other processes
+                              keeping it busy)
+    unlock-all [set]          Unlock and mount every bottle in BOTTLE_SET (or
+                              BOTTLE_SET_<SET>) and keep them open
+    lock-all [--force] [set]  Lock every bottle in the set
+    workspace [name]          Unlock the bottles of WORKSPACE_<NAME> one by one,
+                              then run all its apps at once (no name: list
+                              the workspaces)
+    daemon                    Run in the background and serve a JSON-RPC
+                              control socket; list, status, lock, and run go
+                              through it while it runs
+    tray [--show-hidden]      Show a tray icon listing open bottles, with
+                              lock, lock all, and favorite launch actions
+                              (needs yad; hidden bottles only with
+                              --show-hidden)
+    help exit-codes           List the exit codes, one per kind of failure
+    version                   Print the version, commit, build date, and the
+                              versions of cryptsetup, udisks2, flatpak and
+                              libfido2 (include it in bug reports)
+    self-update [--check]     Check GitHub for a newer release and install it
+                              (its SHA256SUMS catch corrupt downloads, but
+                              aren't signed); --check only reports
+    completion bash|zsh|fish  Print a shell completion script (completes
+                              bottles, profiles and installed apps too)
+    doctor                    Check for the tools bottle-launch needs, that
+                              the connected FIDO2 keys are accessible, and
+                              for SELinux/AppArmor denials of bottle files
+    install-udev-rules [--print]
+                              Install udev rules (with pkexec) that let you
+                              use FIDO2 keys (--print: only print them)
+
+Examples:
+    bottle-launch
+    bottle-launch tui
+    bottle-launch create myapp.bottle 2G
+    bottle-launch create --key-drive=KEYS vault.bottle 1G
+    bottle-launch create --fido2 secure.bottle 1G
+    bottle-launch run firefox.bottle org.mozilla.firefox
+    bottle-launch run firefox.bottle org.mozilla.firefox -- --private-window
+    bottle-launch run firefox.bottle org.freedesktop.Bustle --join
+    bottle-launch run work.bottle com.slack.Slack --timeout=8h
+    bottle-launch run docs.bottle org.gnome.Evince --open ~/Downloads/invoice.pdf
+    bottle-launch run @banking
+    bottle-launch mime-register docs.bottle org.gnome.Evince application/pdf
+    bottle-launch open firefox.bottle
+    bottle-launch lock firefox.bottle
+    bottle-launch unlock-all work
+    bottle-launch workspace morning
+    bottle-launch status firefox && echo mounted
+
+Options for every command:
+    -q, --quiet               Print only errors (and prompts): no progress,
+                              warnings, or messages; list prints just names
+    -v, --verbose             Also print each external command (udisksctl,
+                              cryptsetup, flatpak, ...) before running it
+    --trace <dir>             Save a transcript of each external command to
+                              <dir> for bug reports (secrets are left out)
+
+Bottle storage: ~/.local/share/bottles/
+Config storage: ~/.config/bottle-launch/
+
+Failed commands exit with a code for the kind of failure (wrong password,
+bottle not found, in use, missing tool, ...): see help exit-codes.
+
+Set BOTTLE_LAUNCH_MOCK=1 to try everything with fake, unencrypted bottles
+(no root, devices, Flatpak apps, or YubiKey needed).
+`)
+}
+
+// cmdCreate creates a new bottle from CLI.
+// For LUKS, a size starting with /dev/ names a block device to format instead.
+func cmdCreate(ctx context.Context, backend, bottle, size string) error {
+	b, err := getBackend(backend)
+	if err != nil {
+		return err
+	}
+	return b.Create(ctx, bottle, size, "")
+}
+
+// runOptions are the flags accepted by `run`
+type runOptions struct {
+	join    bool           // share a bottle already in use by another session
+	anyApp  bool           // run the app even if the bottle's allowlist excludes it
+	timeout time.Duration  // session time limit; -1 = use the bottle's setting
+	open    []string       // host files to copy into the bottle and open in the app
+	profile *launchProfile // launch profile whose permissions and arguments apply, if any
+	env     []string       // the app's environment; nil = this process's
+	dir     string         // the app's working directory; "" = this process's
+}
+
+// cmdRun runs an app in CLI mode. If the bottle is already in use by another
+// session, it is refused unless opts.join is set. When the daemon is running,
+// it runs the app instead.
+func cmdRun(bottle, appID string, opts runOptions, extraArgs []string) error {
+	if client := dialDaemon(); client != nil {
+		return daemonRun(client, bottle, appID, opts, extraArgs)
+	}
+	session, err := startRunSession(bottle, appID, opts, extraArgs, true)
+	if err != nil {
+		return err
+	}
+	defer session.finish()
+	if err := session.cmd.Wait(); err != nil {
+		return newAppExitError(session.app.ID, err)
+	}
+	return nil
+}
+
+// runSession is an app running in a bottle
+type runSession struct {
+	bottle        string
+	app           FlatpakApp
+	lock          *BottleLock
+	mountInfo     *MountInfo
+	cmd           *exec.Cmd
+	started       time.Time
+	stopTimer     func()        // cancels the time limit, if any
+	stopQuota     func()        // stops watching the bottle's quota
+	stopSync      func()        // stops flushing the bottle periodically
+	stopForensics func() string // records what the session changed, if forensics is on
+	foreground    bool
+}
+
+// startRunSession locks and mounts the bottle and starts the app in it. A
+// foreground session uses this process's terminal and is cleaned up by the
+// CLI signal handler; the daemon runs its sessions in the background.
+func startRunSession(bottle, appID string, opts runOptions, extraArgs []string, foreground bool) (*runSession, error) {
+	bottle = resolveBottlePath(bottle)
+	if _, err := os.Stat(bottle); err != nil {
+		return nil, errBottleNotFound
+	}
+
+	// Load default permissions
+	configPath := getConfigPath(bottle)
+	perms := loadPermissions(configPath)
+	if perms.Tampered {
+		return nil, errConfigTampered(bottle)
+	}
+	app := parseAppRef(appID)
+	if !perms.AllowsApp(app.ID) && !opts.anyApp {
+		return nil, &bottleError{op: "run", msg: app.ID + " is not allowed in " + bottleName(bottle) +
+			" (allowed: " + strings.Join(perms.AllowedApps, ", ") + "; use --any-app to run it anyway)"}
+	}
+	for _, f := range opts.open {
+		if err := checkOpenFile(f); err != nil {
+			return nil, err
+		}
+	}
+
+	lock, err := acquireBottleLock(bottle, app.ID)
+	var inUse *bottleInUseError
+	if errors.As(err, &inUse) && opts.join {
+		lock, err = joinBottleLock(bottle)
+	} else if errors.As(err, &inUse) {
+		return nil, fmt.Errorf("%w (use --join to share it)", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if foreground {
+		SetCurrentBottleLock(lock)
+		setupSignalHandler(true)
+	} else if currentMount(bottle) == nil && !opensWithoutSecret(bottle) {
+		// Nobody is at this process's terminal to answer a prompt
+		lock.Release()
+		return nil, errLockedInBackground(bottle)
+	}
+
+	if warning := checkBottleChanged(bottle, perms); warning != "" {
+		notice("Warning: " + warning)
+	}
+
+	mountInfo, method, err := mountForRun(bottle, perms)
+	if err != nil {
+		if foreground {
+			SetCurrentBottleLock(nil)
+		}
+		lock.Release()
+		return nil, err
+	}
+	if foreground {
+		SetCurrentMountInfo(mountInfo)
+	}
+	lock.Share()
+	if mountInfo.Unlocked {
+		recordUnlock(configPath, perms, method)
+	}
+	s := &runSession{bottle: bottle, app: app, lock: lock, mountInfo: mountInfo, stopTimer: func() {}, stopQuota: func() {}, stopSync: func() {}, stopForensics: func() string { return "" }, foreground: foreground}
+	if free, total, err := filesystemSpace(mountInfo.MountPoint); err == nil && spaceIsLow(free, total) {
+		msg := bottleName(bottle) + " is almost full (" + formatSize(free) + " free of " + formatSize(total) +
+			"); apps may corrupt their data if it fills up"
+		notice("Warning: " + msg)
+		if !foreground || needGUIPrompts() {
+			sendNotification("Bottle almost full", msg)
+		}
+	}
+
+	// Files to open go after the app's own arguments, at their in-bottle path
+	for _, f := range opts.open {
+		path, err := copyIntoBottle(f, mountInfo.MountPoint)
+		if err != nil {
+			s.release()
+			return nil, err
+		}
+		extraArgs = append(extraArgs, path)
+	}
+
+	// Build and run the app, tracking the command for signal cleanup
+	runPerms := perms
+	if opts.profile != nil {
+		runPerms = opts.profile.apply(perms)
+		extraArgs = append(slices.Clone(opts.profile.Args), extraArgs...)
+	}
+	s.cmd = buildFlatpakCommand(app, mountInfo.MountPoint, runPerms, extraArgs, opts.env)
+	s.cmd.Dir = opts.dir
+	if foreground {
+		s.cmd.Stdin = os.Stdin
+	}
+	s.cmd.Stdout = os.Stdout
+	s.cmd.Stderr = os.Stderr
+
+	if foreground {
+		SetCurrentRunningCmd(s.cmd)
+	}
+	s.stopForensics = startForensics(bottle, app.ID, mountInfo.MountPoint, perms)
+	if err := s.cmd.Start(); err != nil {
+		s.release()
+		return nil, err
+	}
+	s.started = time.Now()
+	if err := recordLastUsed(configPath, perms); err != nil {
+		notice("Warning: could not record the launch: " + err.Error())
+	}
+	s.stopSync = startSyncer(mountInfo.MountPoint)
+
+	timeout := perms.Timeout
+	if opts.timeout >= 0 {
+		timeout = opts.timeout
+	}
+	if timeout > 0 {
+		s.stopTimer = enforceTimeout(s.cmd, bottle, app.ID, timeout)
+	}
+	s.stopQuota = watchQuota(bottle, mountInfo.MountPoint, perms.Quota, func(msg string) {
+		notice("Warning: " + msg)
+		if !foreground || needGUIPrompts() {
+			sendNotification("Bottle over quota", msg)
+		}
+	})
+	return s, nil
+}
+
+// errLockedInBackground is a background session's bottle that needs a
+// password or key first
+func errLockedInBackground(bottle string) error {
+	return &bottleError{op: "run", msg: bottleName(bottle) + " is locked, and nothing here can ask for its password - unlock it first (run does, before handing the app to the daemon)"}
+}
+
+// mountForRun mounts a bottle for run with the password manager's passphrase
+// if there is one, or the YubiKey or key drive, otherwise udisks prompts for
+// it via polkit (or a dialog asks when there is no terminal). A recovery key
+// can stand in for a YubiKey or key drive that fails. It returns how it was
+// unlocked.
+func mountForRun(bottle string, perms *Permissions) (*MountInfo, string, error) {
+	password, method := "", UnlockPolkit
+	if perms.KeyDriveUUID != "" && currentMount(bottle) == nil {
+		// No password to fall back on: the drive is the point
+		mountInfo, err := mountWithKeyDrive(bottle, perms)
+		if key, ok := askRecoveryKey(bottle, err); ok {
+			mountInfo, err = mountLUKS(context.Background(), bottle, key)
+			return mountInfo, UnlockRecovery, err
+		}
+		return mountInfo, UnlockKeyDrive, err
+	}
+	if perms.SecretRef != "" && currentMount(bottle) == nil {
+		if secret, err := cliLookupSecret(perms.SecretRef); err != nil {
+			notice(fmt.Sprintf("Warning: password manager: %v", err))
+		} else {
+			password, method = secret, UnlockManager
+		}
+	}
+	var mountInfo *MountInfo
+	var err error
+	if password == "" && currentMount(bottle) == nil && !opensWithoutSecret(bottle) {
+		if isFIDO2, _ := IsFIDO2Bottle(perms); isFIDO2 {
+			method = UnlockYubiKey
+			mountInfo, err = mountWithYubiKey(bottle, perms)
+			if key, ok := askRecoveryKey(bottle, err); ok {
+				method = UnlockRecovery
+				mountInfo, err = mountLUKS(context.Background(), bottle, key)
+			}
+		} else if needGUIPrompts() {
+			// Started from a .desktop file: nowhere to type the password but a dialog
+			method = UnlockDialog
+			mountInfo, err = mountWithDialog(bottle)
+			if err == errNoGUIPrompt {
+				method, err = UnlockPolkit, nil
+			}
+		}
+	}
+	if mountInfo == nil && err == nil {
+		mountInfo, err = mountBottle(context.Background(), bottle, password)
+		if err == errWrongPassword && password != "" {
+			notice("Warning: the password manager entry didn't unlock " + bottleName(bottle) + "; asking for the password")
+			method = UnlockPolkit
+			mountInfo, err = mountBottle(context.Background(), bottle, "")
+		}
+	}
+	return mountInfo, method, err
+}
+
+// bottleHold keeps a bottle mounted while apps are started in it elsewhere
+type bottleHold struct {
+	mountInfo *MountInfo
+	lock      *BottleLock
+}
+
+// holdBottle mounts a bottle, asking for its password here, and keeps it
+// mounted until the hold is released. With join it shares a bottle another
+// session is using; without, that is refused like run does.
+func holdBottle(bottle, owner string, join bool) (bottleHold, error) {
+	if _, err := os.Stat(bottle); err != nil {
+		return bottleHold{}, errBottleNotFound
+	}
+	configPath := getConfigPath(bottle)
+	perms := loadPermissions(configPath)
+	if perms.Tampered {
+		return bottleHold{}, errConfigTampered(bottle)
+	}
+	lock, err := acquireBottleLock(bottle, owner)
+	var inUse *bottleInUseError
+	if errors.As(err, &inUse) && join {
+		lock, err = joinBottleLock(bottle)
+	} else if errors.As(err, &inUse) {
+		return bottleHold{}, fmt.Errorf("%w (use --join to share it)", err)
+	}
+	if err != nil {
+		return bottleHold{}, err
+	}
+	if warning := checkBottleChanged(bottle, perms); warning != "" {
+		notice("Warning: " + bottleName(bottle) + ": " + warning)
+	}
+	mountInfo, method, err := mountForRun(bottle, perms)
+	if err != nil {
+		lock.Release()
+		return bottleHold{}, err
+	}
+	lock.Share()
+	if mountInfo.Unlocked {
+		recordUnlock(configPath, perms, method)
+	}
+	return bottleHold{mountInfo: mountInfo, lock: lock}, nil
+}
+
+// release unmounts the held bottle unless a session started in it meanwhile
+func (h bottleHold) release() {
+	if err := releaseBottle(h.mountInfo, h.lock); err != nil {
+		notice("Warning: " + err.Error())
+	}
+}
+
+// finish records the run once the app has exited and releases the bottle
+func (s *runSession) finish() {
+	s.stopTimer()
+	s.stopQuota()
+	s.stopSync()
+	recordAppRun(s.bottle, s.app.ID, s.started)
+	if summary := s.stopForensics(); summary != "" {
+		notice("Forensics: " + summary)
+	}
+	s.release()
+}
+
+// release unmounts the bottle unless other sessions are still using it
+func (s *runSession) release() {
+	if s.foreground {
+		SetCurrentRunningCmd(nil)
+		SetCurrentMountInfo(nil)
+		SetCurrentBottleLock(nil)
+	}
+	if err := releaseBottle(s.mountInfo, s.lock); err != nil {
+		notice("Warning: " + err.Error())
+	}
+}
+
+// enforceTimeout warns before and terminates the app at the session time
+// limit. The returned function cancels the timers.
+func enforceTimeout(cmd *exec.Cmd, bottle, appID string, timeout time.Duration) func() {
+	lead := timeoutWarningLead(timeout)
+	warn := time.AfterFunc(timeout-lead, func() {
+		msg := appID + " will be closed and " + bottleName(bottle) + " locked in " + formatRemaining(lead)
+		notice("Warning: " + msg)
+		sendNotification("Bottle session ending soon", msg)
+	})
+	cutoff := time.AfterFunc(timeout, func() {
+		notice("Session time limit reached - closing " + appID)
+		terminateApp(cmd)
+	})
+	return func() {
+		warn.Stop()
+		cutoff.Stop()
+	}
+}
+
+// cmdOpen opens a mounted bottle in the host file manager
+func cmdOpen(bottle string) error {
+	bottle = resolveBottlePath(bottle)
+	mount := findMountForBottle(bottle)
+	if mount == "" {
+		return &bottleError{op: "open", msg: bottleName(bottle) + " is not mounted - launch an app in it first"}
+	}
+	return openInFileManager(mount)
+}
+
+// cmdLock closes a bottle that other sessions (or a crashed one) left open
+func cmdLock(bottle string, force bool) error {
+	bottle = resolveBottlePath(bottle)
+	if err := lockSessions(bottle, force); err != nil {
+		return err
+	}
+	fmt.Println(bottleName(bottle) + " is locked")
+	return nil
+}
+
+// lockBottle asks the sessions using a bottle to close their apps and
+// unmount, then unmounts, locks, and detaches whatever is still open. With
+// force, other processes keeping it busy are stopped too.
+func lockBottle(bottle string, force bool) error {
+	if err := closeBottleSessions(bottle); err != nil {
+		return err
+	}
+
+	lock, err := acquireBottleLock(bottle, "")
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	info := currentMount(bottle)
+	if info == nil {
+		clearKeptOpen(bottle)
+		return nil
+	}
+	err = unmountBottle(info)
+	var busy *busyError
+	if errors.As(err, &busy) && force {
+		for _, p := range busy.Procs {
+			notice("Stopping " + p.String())
+		}
+		killBusyProcesses(busy.Procs)
+		err = unmountBottle(info)
+	}
+	if errors.As(err, &busy) && !force {
+		return fmt.Errorf("%w (use --force to stop them)", err)
+	}
+	if err == nil {
+		clearKeptOpen(bottle)
+	}
+	return err
+}
+
+// closeBottleSessions asks every session holding the bottle's lock to exit,
+// which closes its app and releases the bottle, and kills sessions that are
+// still there after LockSessionWait
+func closeBottleSessions(bottle string) error {
+	// The daemon stops its own sessions before it locks a bottle
+	pids := slices.DeleteFunc(lockHolders(bottle), func(pid int) bool { return pid == os.Getpid() })
+	if len(pids) == 0 {
+		return nil
+	}
+	owner := readLockOwner(getLockPath(bottle))
+	for _, pid := range pids {
+		session := LockOwner{PID: pid}
+		if pid == owner.PID {
+			session = owner
+		}
+		notice("Closing session " + session.String())
+		if err := syscall.Kill(pid, syscall.SIGTERM); err != nil && err != syscall.ESRCH {
+			return &bottleError{op: "lock", msg: "cannot stop pid " + strconv.Itoa(pid) + ": " + err.Error()}
+		}
+	}
+
+	// A session releases the bottle and then exits
+	if wait.ForExits(pids, LockSessionWait) || !bottleInUse(bottle) {
+		return nil
+	}
+	var killed []int
+	for _, pid := range lockHolders(bottle) {
+		if pid == os.Getpid() {
+			continue
+		}
+		notice("Killing session pid " + strconv.Itoa(pid))
+		_ = syscall.Kill(pid, syscall.SIGKILL)
+		killed = append(killed, pid)
+	}
+	// Their apps may outlive them; unmounting finds those as busy processes
+	wait.ForExits(killed, time.Second)
+	return nil
+}
+
+// cmdStatus prints a bottle's state and returns the matching exit code
+func cmdStatus(bottle string, asJSON bool) int {
+	var status bottleStatus
+	if ok, err := daemonCall("Status", BottleArgs{Bottle: absBottlePath(bottle)}, &status); !ok || err != nil {
+		status = collectBottleStatus(resolveBottlePath(bottle))
+	}
+	if asJSON {
+		if err := writeStatusJSON(os.Stdout, status); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	} else if status.MountPoint != "" {
+		fmt.Println(status.State + " " + status.MountPoint)
+	} else {
+		fmt.Println(status.State)
+	}
+	return statusExitCode(status)
+}
+
+// runStatus parses the status command's arguments and returns its exit code
+func runStatus(args []string) int {
+	var bottle string
+	asJSON, all := false, false
+	for _, arg := range args {
+		switch arg {
+		case "--json":
+			asJSON = true
+		case "--all":
+			all = true
+		default:
+			bottle = arg
+		}
+	}
+	if bottle == "" && !all {
+		fmt.Fprintln(os.Stderr, "Usage: bottle-launch status [--json] <bottle> | --all")
+		return ExitUsage
+	}
+	if all {
+		return cmdStatusAll(asJSON)
+	}
+	return cmdStatus(bottle, asJSON)
+}
+
+// cmdStatusAll prints the state of every bottle in the bottle directory
+func cmdStatusAll(asJSON bool) int {
+	var report statusReport
+	if ok, err := daemonCall("List", struct{}{}, &report); !ok || err != nil {
+		report = collectStatusReport()
+	}
+
+	if asJSON {
+		if err := writeStatusJSON(os.Stdout, report); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	for _, status := range report.Bottles {
+		line := fmt.Sprintf("%-20s %s", status.Name, status.State)
+		if status.MountPoint != "" {
+			line += " " + status.MountPoint
+		}
+		fmt.Println(line)
+	}
+	return 0
+}
+
+// cmdStats prints usage statistics for one bottle, or all bottles (least used
+// first, so dead weight is easy to spot)
+func cmdStats(bottle string) {
+	bottles := listBottles()
+	if bottle != "" {
+		bottles = []string{resolveBottlePath(bottle)}
+	}
+
+	type bottleUsage struct {
+		path  string
+		stats []AppStats
+		total time.Duration
+	}
+	usage := make([]bottleUsage, len(bottles))
+	for i, b := range bottles {
+		stats := loadStats(getStatsPath(b))
+		usage[i] = bottleUsage{path: b, stats: stats, total: totalRuntime(stats)}
+	}
+	sort.SliceStable(usage, func(i, j int) bool {
+		return usage[i].total < usage[j].total
+	})
+
+	for _, u := range usage {
+		perms := loadPermissions(getConfigPath(u.path))
+		fmt.Printf("%s  (%s total, last used %s)\n", bottleName(u.path), formatRuntime(u.total), formatLastUsed(perms.LastUsed))
+		if len(u.stats) == 0 {
+			fmt.Println("  (no recorded runs)")
+		}
+		for _, s := range u.stats {
+			fmt.Printf("  %-32s %4d launches  %8s total  last %s\n",
+				s.AppID, s.Launches, formatRuntime(s.Runtime), formatLastUsed(s.LastRun))
+		}
+		fmt.Println()
+	}
+
+	if len(usage) == 0 {
+		fmt.Println("No bottles found.")
+	}
+}
+
+// cmdVerify checks a bottle file against the fingerprint recorded at lock time
+func cmdVerify(bottle string, withChecksum bool) error {
+	bottle = resolveBottlePath(bottle)
+	if withChecksum {
+		fmt.Printf("Hashing %s (this reads the whole file)...\n", bottleName(bottle))
+	}
+
+	res, err := verifyBottle(bottle, withChecksum)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case res.ChecksumMismatch:
+		return &bottleError{op: "verify", msg: "checksum mismatch - " + bottleName(bottle) + " was modified outside bottle-launch"}
+	case res.ChecksumRecorded:
+		fmt.Println("No checksum recorded yet; saved sha256 " + res.Checksum)
+	case withChecksum:
+		fmt.Println("Checksum OK: " + res.Checksum)
+	case res.Changed:
+		return &bottleError{op: "verify", msg: bottleName(bottle) + " changed since it was last locked - run with --checksum to compare contents"}
+	case !res.HasFingerprint:
+		fmt.Println("Nothing recorded yet; the file is fingerprinted each time bottle-launch locks it")
+	default:
+		fmt.Println("OK: unchanged since last lock")
+	}
+	return nil
+}
+
+// cmdSync pushes or pulls a bottle to/from an rclone remote
+func cmdSync(bottle, remote string, pull, force bool) error {
+	bottle = resolveBottlePath(bottle)
+
+	var result string
+	var err error
+	if pull {
+		fmt.Printf("Pulling %s...\n", bottleName(bottle))
+		result, err = syncPull(bottle, remote, force)
+	} else {
+		if _, statErr := os.Stat(bottle); statErr != nil {
+			return statErr
+		}
+		fmt.Printf("Pushing %s...\n", bottleName(bottle))
+		result, err = syncPush(bottle, remote, force)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(strings.ToUpper(result[:1]) + result[1:])
+	return nil
+}
+
+// cmdRecovery prints a bottle's recovery material for offline storage,
+// optionally generating a recovery key first and rendering a QR code
+func cmdRecovery(bottle string, newKey, qr bool, out string) error {
+	bottle = resolveBottlePath(bottle)
+	if _, err := os.Stat(bottle); err != nil {
+		return err
+	}
+	perms := loadPermissions(getConfigPath(bottle))
+	isFIDO2, err := IsFIDO2Bottle(perms)
+	if err != nil {
+		return err
+	}
+	if !isFIDO2 && !newKey {
+		return &bottleError{op: "recovery", msg: bottleName(bottle) + " is a password bottle, so its password is all you need - use --new-key to add a recovery key"}
+	}
+	if newKey && !hasKeyslots(bottle) {
+		return &bottleError{op: "recovery", msg: bottleName(bottle) + " is a " + bottleBackend(bottle) + " bottle, which has no LUKS keyslots for a recovery key"}
+	}
+
+	material := recoveryMaterial{Bottle: bottle, FIDO2Lines: fido2ConfigLines(perms)}
+	if newKey {
+		var existing []byte
+		if isFIDO2 {
+			fmt.Println("Touch your YubiKey to authorize the new recovery key...")
+			if _, existing, err = findFIDO2Key(bottle, perms); err != nil {
+				return err
+			}
+		} else if perms.KeyDriveUUID != "" {
+			key, err := readDriveKey(perms)
+			if err == errKeyDriveMissing {
+				return &bottleError{op: "recovery", msg: "plug in " + keyDriveName(perms) + " to authorize the new recovery key"}
+			}
+			if err != nil {
+				return err
+			}
+			existing = []byte(key)
+		} else {
+			fmt.Fprint(os.Stderr, "Current password for "+bottleName(bottle)+": ")
+			existing, err = term.ReadPassword(os.Stdin.Fd())
+			fmt.Fprintln(os.Stderr)
+			if err != nil {
+				return err
+			}
+		}
+		if material.RecoveryKey, err = addRecoveryKey(bottle, existing); err != nil {
+			return err
+		}
+	}
+
+	sheet := material.Text()
+	fmt.Print(sheet)
+
+	// Offer a QR code when run interactively
+	if !qr && term.IsTerminal(os.Stdin.Fd()) {
+		fmt.Print("\nShow as a QR code? [y/N] ")
+		var answer string
+		fmt.Scanln(&answer)
+		qr = strings.EqualFold(answer, "y") || strings.EqualFold(answer, "yes")
+	}
+	if qr {
+		code, err := renderQR(material.qrPayload(), "ANSIUTF8")
+		if err != nil {
+			return err
+		}
+		fmt.Print("\n" + code)
+	}
+
+	if out != "" {
+		if qr {
+			// Plain block characters print fine from a text editor
+			code, err := renderQR(material.qrPayload(), "UTF8")
+			if err != nil {
+				return err
+			}
+			sheet += "\n" + code
+		}
+		if err := os.WriteFile(out, []byte(sheet), 0600); err != nil {
+			return err
+		}
+		fmt.Println("\nWrote " + out + " - print it and delete the file")
+	}
+	if material.RecoveryKey != "" {
+		fmt.Println("\nKeep the recovery key offline. Anyone who has it can unlock the bottle.")
+	}
+	return nil
+}
+
+// cliLookupSecret fetches a bottle passphrase for the CLI, prompting for a
+// KeePassXC master password on the terminal if needed
+func cliLookupSecret(ref string) (string, error) {
+	r, err := parseSecretRef(ref)
+	if err != nil {
+		return "", err
+	}
+	return lookupSecretInteractive(r)
+}
+
+// cmdSecret shows, sets, or clears a bottle's password manager reference.
+// A new reference is looked up once so typos are caught right away.
+func cmdSecret(bottle, ref string) error {
+	bottle = resolveBottlePath(bottle)
+	configPath := getConfigPath(bottle)
+	perms := loadPermissions(configPath)
+
+	switch ref {
+	case "":
+		if perms.SecretRef == "" {
+			fmt.Println(bottleName(bottle) + ": no password manager reference (the password is typed at unlock)")
+		} else {
+			fmt.Println(bottleName(bottle) + ": " + perms.SecretRef)
+		}
+		return nil
+	case "--clear":
+		perms.SecretRef = ""
+		return savePermissions(configPath, perms)
+	}
+
+	if isFIDO2, err := IsFIDO2Bottle(perms); err != nil {
+		return err
+	} else if isFIDO2 {
+		return &bottleError{op: "secret", msg: bottleName(bottle) + " is unlocked with a YubiKey, not a password"}
+	}
+	if _, err := cliLookupSecret(ref); err != nil {
+		return err
+	}
+	perms.SecretRef = ref
+	if err := savePermissions(configPath, perms); err != nil {
+		return err
+	}
+	fmt.Println("Found the password; " + bottleName(bottle) + " will be unlocked with it from now on.")
+	return nil
+}
+
+// cmdMountPoint shows, sets, or clears a bottle's fixed mount point
+func cmdMountPoint(bottle, dir string) error {
+	bottle = resolveBottlePath(bottle)
+	configPath := getConfigPath(bottle)
+	perms := loadPermissions(configPath)
+
+	switch dir {
+	case "":
+		if mountPoint := fixedMountPoint(bottle); mountPoint != "" {
+			fmt.Println(bottleName(bottle) + ": " + mountPoint)
+		} else {
+			fmt.Println(bottleName(bottle) + ": no fixed mount point (udisks chooses one under /run/media)")
+		}
+		return nil
+	case "--clear":
+		perms.MountPoint = ""
+		return savePermissions(configPath, perms)
+	}
+
+	if currentMount(bottle) != nil {
+		return errBottleMounted
+	}
+	if !strings.HasPrefix(dir, "~/") {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		dir = abs
+	}
+	perms.MountPoint = dir
+	return savePermissions(configPath, perms)
+}
+
+// cmdAllow shows or edits the apps a bottle is restricted to
+func cmdAllow(bottle string, args []string) error {
+	bottle = resolveBottlePath(bottle)
+	configPath := getConfigPath(bottle)
+	perms := loadPermissions(configPath)
+
+	if len(args) == 0 {
+		if len(perms.AllowedApps) == 0 {
+			fmt.Println(bottleName(bottle) + ": any app")
+		} else {
+			fmt.Println(bottleName(bottle) + ": " + strings.Join(perms.AllowedApps, ", "))
+		}
+		return nil
+	}
+
+	switch args[0] {
+	case "--clear":
+		perms.AllowedApps = nil
+	case "--remove":
+		perms.AllowedApps = slices.DeleteFunc(perms.AllowedApps, func(id string) bool {
+			return slices.Contains(args[1:], id)
+		})
+	default:
+		for _, id := range args {
+			if !slices.Contains(perms.AllowedApps, id) {
+				perms.AllowedApps = append(perms.AllowedApps, id)
+			}
+		}
+	}
+	return savePermissions(configPath, perms)
+}
+
+// cmdMigrate handles the migrate export/import/reenroll subcommands
+func cmdMigrate(args []string) error {
+	usage := &bottleError{op: "usage", msg: "bottle-launch migrate export <bottle> [file] | import <file> [name] | reenroll <bottle>"}
+	if len(args) < 2 {
+		return usage
+	}
+
+	switch args[0] {
+	case "export":
+		out := ""
+		if len(args) > 2 {
+			out = args[2]
+		}
+		bottle := resolveBottlePath(args[1])
+		fmt.Printf("Exporting %s...\n", bottleName(bottle))
+		bundle, err := exportBottle(bottle, out)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Wrote " + bundle)
+		fmt.Println("Copy it to the other machine and run: bottle-launch migrate import " + filepath.Base(bundle))
+		return nil
+
+	case "import":
+		name := ""
+		if len(args) > 2 {
+			name = args[2]
+		}
+		bottle, err := importBottle(args[1], name)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Imported " + bottle)
+		fmt.Println("LUKS header backup: " + getHeaderBackupPath(bottle))
+		return checkImportedFIDO2(bottle)
+
+	case "reenroll":
+		return cmdReenroll(resolveBottlePath(args[1]))
+	}
+	return usage
+}
+
+// checkImportedFIDO2 verifies that a connected key can unlock an imported
+// YubiKey bottle, and explains what to do if not
+func checkImportedFIDO2(bottle string) error {
+	perms := loadPermissions(getConfigPath(bottle))
+	if isFIDO2, err := IsFIDO2Bottle(perms); err != nil || !isFIDO2 {
+		return err
+	}
+	if err := CheckFIDO2Available(); err != nil {
+		fmt.Println("This is a YubiKey bottle, but libfido2 tools are not installed here; install them before launching it.")
+		return nil
+	}
+
+	fmt.Println("This is a YubiKey bottle. Touch your key when it blinks to check it can unlock the bottle...")
+	_, _, err := findFIDO2Key(bottle, perms)
+	switch {
+	case err == nil:
+		fmt.Println("OK: your key unlocks " + bottleName(bottle) + " on this machine.")
+	case err == errNoFIDO2Device:
+		fmt.Println("No security key is connected. Plug in the key this bottle was created with, then run")
+		fmt.Println("  bottle-launch migrate reenroll " + bottleName(bottle))
+		fmt.Println("to check it (and optionally move the bottle to a different key).")
+	case errors.Is(err, errFIDO2CredentialMissing):
+		fmt.Println(err)
+		fmt.Println("None of the connected keys can unlock this bottle. YubiKey bottles can only be opened")
+		fmt.Println("with the key that created them (or one enrolled later with `migrate reenroll`).")
+		fmt.Println("Plug in that key and run: bottle-launch migrate reenroll " + bottleName(bottle))
+	default:
+		return err
+	}
+	return nil
+}
+
+// cmdReenroll interactively moves a YubiKey bottle to a different key
+func cmdReenroll(bottle string) error {
+	perms := loadPermissions(getConfigPath(bottle))
+	if isFIDO2, err := IsFIDO2Bottle(perms); err != nil {
+		return err
+	} else if !isFIDO2 {
+		return &bottleError{op: "reenroll", msg: bottleName(bottle) + " is a password bottle"}
+	}
+	if findLoopForFile(bottle) != "" {
+		return errBottleMounted
+	}
+	lock, err := acquireBottleLock(bottle, "reenroll")
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	fmt.Println("Step 1/2: insert the bottle's current key and touch it when it blinks.")
+	oldDevice, oldSecret, err := findFIDO2Key(bottle, perms)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Current key OK (" + oldDevice + ").")
+
+	fmt.Print("Step 2/2: insert the new key (you may remove the old one), then press Enter...")
+	fmt.Scanln()
+	devices, err := EnumerateFIDO2Devices()
+	if err != nil {
+		return err
+	}
+	newDevice := ""
+	for _, dev := range devices {
+		// Prefer a key other than the old one if both are plugged in
+		if newDevice == "" || dev.Path != oldDevice {
+			newDevice = dev.Path
+		}
+	}
+	if newDevice == "" {
+		return errNoFIDO2Device
+	}
+
+	fmt.Println("Touch the new key twice: once to create a credential, once to derive the unlock secret.")
+	if err := reenrollFIDO2(bottle, perms, oldSecret, newDevice); err != nil {
+		return err
+	}
+	fmt.Println("Done: " + bottleName(bottle) + " now unlocks with the key at " + newDevice + "; the old key no longer works.")
+	return nil
+}
+
+// cmdFIDO2Rotate gives a YubiKey bottle a new salt, and so a new unlock
+// secret, on the same key
+func cmdFIDO2Rotate(bottle string) error {
+	bottle = resolveBottlePath(bottle)
+	perms := loadPermissions(getConfigPath(bottle))
+	if isFIDO2, err := IsFIDO2Bottle(perms); err != nil {
+		return err
+	} else if !isFIDO2 {
+		return &bottleError{op: "rotate", msg: bottleName(bottle) + " is a password bottle"}
+	}
+	if perms.Tampered {
+		return errConfigTampered(bottle)
+	}
+	if findLoopForFile(bottle) != "" {
+		return errBottleMounted
+	}
+	lock, err := acquireBottleLock(bottle, "rotate")
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	fmt.Println("Step 1/2: touch the bottle's key when it blinks.")
+	device, oldSecret, err := findFIDO2Key(bottle, perms)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Step 2/2: touch it again to derive the new secret.")
+	if err := rotateFIDO2Salt(bottle, perms, device, oldSecret); err != nil {
+		return err
+	}
+	say("Done: " + bottleName(bottle) + " has a new salt; the old secret no longer unlocks it.")
+	return nil
+}
+
+// cmdArchive compresses a bottle into the archive directory
+func cmdArchive(bottle string) error {
+	bottle = resolveBottlePath(bottle)
+	_, allocated, _ := bottleDiskUsage(bottle)
+
+	fmt.Printf("Archiving %s...\n", bottleName(bottle))
+	archive, err := archiveBottle(bottle)
+	if err != nil {
+		return err
+	}
+
+	if fi, err := os.Stat(archive); err == nil {
+		fmt.Printf("Archived to %s (%s, was %s on disk)\n", archive, formatSize(fi.Size()), formatSize(allocated))
+	}
+	return nil
+}
+
+// cmdUnarchive restores an archived bottle
+func cmdUnarchive(name string) error {
+	fmt.Printf("Restoring %s...\n", name)
+	bottle, err := unarchiveBottle(resolveArchivePath(name))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored %s\n", bottle)
+	return nil
+}
+
+// cmdListArchived lists archived bottles
+func cmdListArchived() {
+	archives := listArchivedBottles()
+	fmt.Println("Archived bottles (" + archiveDir() + "):")
+	fmt.Println()
+	for _, a := range archives {
+		size := ""
+		if fi, err := os.Stat(a); err == nil {
+			size = formatSize(fi.Size())
+		}
+		fmt.Printf("  %-30s %s\n", strings.TrimSuffix(filepath.Base(a), archiveSuffix), size)
+	}
+	if len(archives) == 0 {
+		fmt.Println("  (none)")
+	}
+}
+
+// cmdSnapshot takes a snapshot of a bottle, mounted or not
+func cmdSnapshot(bottle string) error {
+	bottle = resolveBottlePath(bottle)
+	if currentMount(bottle) != nil {
+		fmt.Printf("Snapshotting %s (apps writing to it pause meanwhile)...\n", bottleName(bottle))
+	}
+	s, err := takeSnapshot(bottle)
+	if err != nil {
+		return err
+	}
+	if s.Reflinked {
+		fmt.Printf("Snapshot %s saved to %s (a reflink: it shares its blocks with the bottle until they differ)\n", s.Name(), s.Path)
+	} else {
+		fmt.Printf("Snapshot %s saved to %s (%s on disk)\n", s.Name(), s.Path, formatSize(s.Allocated))
+	}
+	pruned, err := pruneSnapshots(bottle)
+	for _, p := range pruned {
+		fmt.Println("Pruned " + p.Name())
+	}
+	return err
+}
+
+// cmdSnapshots lists a bottle's snapshots
+func cmdSnapshots(bottle string) {
+	bottle = resolveBottlePath(bottle)
+	snapshots := listSnapshots(bottle)
+	fmt.Println("Snapshots of " + bottleName(bottle) + " (" + snapshotDir(bottle) + "):")
+	fmt.Println()
+	for _, s := range snapshots {
+		fmt.Printf("  %-18s %-20s %s\n", s.Name(), s.Taken.Format("2006-01-02 15:04:05"), formatSize(s.Allocated))
+	}
+	if len(snapshots) == 0 {
+		fmt.Println("  (none)")
+	}
+}
+
+// cmdRestore replaces a locked bottle with one of its snapshots
+func cmdRestore(bottle, name string) error {
+	bottle = resolveBottlePath(bottle)
+	s, err := findSnapshot(bottle, name)
+	if err != nil {
+		return err
+	}
+	kept, err := restoreSnapshot(bottle, s)
+	if kept.Path != "" {
+		fmt.Printf("The previous version was kept as snapshot %s\n", kept.Name())
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored %s to snapshot %s\n", bottleName(bottle), s.Name())
+	return nil
+}
+
+// mountedBottles returns the mount info of every bottle that is attached,
+// unlocked, or mounted
+func mountedBottles() []MountInfo {
+	var mounts []MountInfo
+	for _, bottle := range listBottles() {
+		if info := currentMount(bottle); info != nil {
+			info.BottlePath = bottle
+			mounts = append(mounts, *info)
+		}
+	}
+	return mounts
+}
+
+// cmdList lists mounted bottles (just their names with -q)
+func cmdList() {
+	var mounts []MountInfo
+	if ok, err := daemonCall("Mounts", struct{}{}, &mounts); !ok || err != nil {
+		mounts = mountedBottles()
+	}
+	if quiet {
+		// Just the names, for scripts
+		for _, info := range mounts {
+			fmt.Println(bottleName(info.BottlePath))
+		}
+		return
+	}
+	fmt.Println("Currently mounted bottles:")
+	fmt.Println()
+
+	found := false
+	for _, info := range mounts {
+		bottle := info.BottlePath
+		found = true
+		fmt.Printf("  Bottle: %s\n", bottleName(bottle))
+		fmt.Printf("  File:   %s\n", bottle)
+		if info.Backend != BackendLUKS {
+			fmt.Printf("  Type:   %s\n", info.Backend)
+			fmt.Printf("  Mount:  %s\n", info.MountPoint)
+			fmt.Println()
+			continue
+		}
+		fmt.Printf("  Loop:   %s\n", info.LoopDevice)
+
+		cleartext := info.CleartextDevice
+		if cleartext != "" {
+			fmt.Printf("  Crypt:  %s\n", cleartext)
+			mount := sysfs.MountPoint(cleartext)
+			if mount != "" {
+				fmt.Printf("  Mount:  %s\n", mount)
+			} else {
+				fmt.Printf("  Mount:  (unlocked but not mounted)\n")
+			}
+		} else {
+			fmt.Printf("  Status: (locked)\n")
+		}
+		fmt.Println()
+	}
+
+	if !found {
+		fmt.Println("  (none)")
+	}
+}
@@ -0,0 +1,112 @@
+// Malware scan: running a virus scanner over an untrusted-downloads bottle before it is locked.
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// defaultScanCommand scans recursively and prints only infected files
+const defaultScanCommand = "clamscan -r --infected --no-summary"
+
+// scanResult is the outcome of a malware scan
+type scanResult struct {
+	Found  []string // the scanner's report lines, when it found something
+	Err    error    // the scan itself failed
+	Runner string   // the scanner's name, e.g. "clamscan"
+}
+
+// scanCommand returns the configured scanner command line
+func scanCommand() []string {
+	return strings.Fields(globalConfig.GetDefault("SCAN_COMMAND", defaultScanCommand))
+}
+
+// scanMountPoint runs the scanner over a mounted bottle
+func scanMountPoint(mountPoint string) scanResult {
+	args := scanCommand()
+	r := scanResult{Runner: filepath.Base(args[0])}
+	// Mock mode only runs a scanner configured for it
+	if mockMode && globalConfig.Get("SCAN_COMMAND") == "" {
+		return r
+	}
+	cmd := command(args[0], append(args[1:], mountPoint)...)
+	out, err := cmd.Output()
+	var exit *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exit) && exit.ExitCode() == 1:
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				// Report paths inside the bottle
+				r.Found = append(r.Found, strings.TrimPrefix(strings.TrimPrefix(line, mountPoint), "/"))
+			}
+		}
+		if len(r.Found) == 0 {
+			r.Found = []string{"(no details)"}
+		}
+	default:
+		r.Err = &bottleError{op: "scan", msg: r.Runner + ": " + err.Error()}
+	}
+	return r
+}
+
+// Summary describes the result in one line
+func (r scanResult) Summary() string {
+	switch {
+	case r.Err != nil:
+		return "scan failed: " + r.Err.Error()
+	case len(r.Found) == 1:
+		return r.Runner + " found: " + r.Found[0]
+	case len(r.Found) > 1:
+		return fmt.Sprintf("%s found %s and %d more", r.Runner, r.Found[0], len(r.Found)-1)
+	}
+	return "clean (" + r.Runner + ")"
+}
+
+// scanBeforeLock scans a bottle that is about to be locked and records the
+// result in the audit log
+func scanBeforeLock(info *MountInfo) scanResult {
+	info.Scanned = true
+	r := scanMountPoint(info.MountPoint)
+	entries := []auditEntry{{Kind: "scan", Detail: r.Summary()}}
+	for _, f := range r.Found {
+		entries = append(entries, auditEntry{Kind: "infected", Detail: f})
+	}
+	_ = appendAudit(info.BottlePath, entries...)
+	return r
+}
+
+// needsScan reports whether a bottle has to be scanned before it is locked
+func needsScan(info *MountInfo) bool {
+	if info == nil || info.Scanned || info.MountPoint == "" {
+		return false
+	}
+	return loadPermissions(getConfigPath(info.BottlePath)).Untrusted
+}
+
+// cmdUntrusted shows or sets whether a bottle is scanned before it is locked
+func cmdUntrusted(bottle, value string) error {
+	bottle = resolveBottlePath(bottle)
+	configPath := getConfigPath(bottle)
+	perms := loadPermissions(configPath)
+
+	switch value {
+	case "":
+		state := "no"
+		if perms.Untrusted {
+			state = "yes, scanned with " + strings.Join(scanCommand(), " ") + " before locking"
+		}
+		fmt.Println(bottleName(bottle) + ": untrusted downloads: " + state)
+		return nil
+	case "on":
+		perms.Untrusted = true
+	case "off":
+		perms.Untrusted = false
+	default:
+		return &bottleError{op: "untrusted", msg: "expected on or off, got " + value, usage: true}
+	}
+	return savePermissions(configPath, perms)
+}
@@ -0,0 +1,296 @@
+// Machine-to-machine migration: bundles a bottle with its config and LUKS header backup.
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrateSuffix is the extension of migration bundles
+const migrateSuffix = ".migrate.tar.zst"
+
+// Files inside a migration bundle (besides the bottle itself)
+const (
+	bundleManifest = "manifest"        // KEY=VALUE: NAME, AUTH, EXPORTED_AT, EXPORTED_FROM
+	bundleConfig   = "config.conf"     // the bottle's per-bottle config
+	bundleHeader   = "luks-header.img" // cryptsetup luksHeaderBackup
+)
+
+var (
+	errNoFIDO2Device          = &bottleError{op: "fido2", msg: "no security key connected", class: classFIDO2}
+	errFIDO2CredentialMissing = &bottleError{op: "fido2", msg: "none of the connected security keys can unlock this bottle", class: classFIDO2}
+)
+
+// getHeaderBackupPath returns where an imported bottle's LUKS header backup is kept
+func getHeaderBackupPath(bottle string) string {
+	return filepath.Join(configDir, getBottleHash(bottle)+".luks-header")
+}
+
+// exportBottle writes a migration bundle for a locked bottle to out (default:
+// <name>.migrate.tar.zst in the current directory) and returns its path
+func exportBottle(bottle, out string) (string, error) {
+	if findLoopForFile(bottle) != "" {
+		return "", errBottleMounted
+	}
+	if _, err := os.Stat(bottle); err != nil {
+		return "", err
+	}
+	if err := requireImageBottle(bottle); err != nil {
+		return "", err
+	}
+	lock, err := acquireBottleLock(bottle, "migrate")
+	if err != nil {
+		return "", err
+	}
+	defer lock.Release()
+
+	if out == "" {
+		out = strings.TrimSuffix(bottleName(bottle), ".bottle") + migrateSuffix
+	}
+	if _, err := os.Stat(out); err == nil {
+		return "", &bottleError{op: "migrate", msg: out + " already exists"}
+	}
+
+	tmp, err := os.MkdirTemp("", "bottle-migrate-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	// A header backup lets the bottle be recovered if its header is damaged in transit
+	if output, err := command("cryptsetup", "luksHeaderBackup", bottle,
+		"--header-backup-file", filepath.Join(tmp, bundleHeader)).CombinedOutput(); err != nil {
+		return "", &bottleError{op: "migrate", msg: "luksHeaderBackup: " + strings.TrimSpace(string(output))}
+	}
+
+	perms := loadPermissions(getConfigPath(bottle))
+	if err := savePermissions(filepath.Join(tmp, bundleConfig), perms); err != nil {
+		return "", err
+	}
+
+	auth := "password"
+	if isFIDO2, _ := IsFIDO2Bottle(perms); isFIDO2 {
+		auth = "yubikey"
+	}
+	host, _ := os.Hostname()
+	manifest := fmt.Sprintf("NAME=%s\nAUTH=%s\nEXPORTED_AT=%d\nEXPORTED_FROM=%s\n",
+		bottleName(bottle), auth, time.Now().Unix(), host)
+	if err := os.WriteFile(filepath.Join(tmp, bundleManifest), []byte(manifest), 0600); err != nil {
+		return "", err
+	}
+
+	partial := out + ".partial"
+	if output, err := command("tar", "--create", "--sparse", "--zstd", "--file", partial,
+		"--directory", tmp, bundleManifest, bundleConfig, bundleHeader,
+		"--directory", filepath.Dir(bottle), bottleName(bottle)).CombinedOutput(); err != nil {
+		os.Remove(partial)
+		return "", &bottleError{op: "migrate", msg: strings.TrimSpace(string(output))}
+	}
+	if err := os.Rename(partial, out); err != nil {
+		os.Remove(partial)
+		return "", err
+	}
+	return out, nil
+}
+
+// importBottle unpacks a migration bundle into the bottle directory, as name
+// if given, and installs its config and header backup. Returns the new bottle path.
+func importBottle(bundle, name string) (string, error) {
+	if err := os.MkdirAll(bottleDir, 0700); err != nil {
+		return "", err
+	}
+	tmp, err := os.MkdirTemp(bottleDir, ".bottle-import-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	if out, err := command("tar", "--extract", "--zstd", "--file", bundle,
+		"--directory", tmp).CombinedOutput(); err != nil {
+		return "", &bottleError{op: "migrate", msg: strings.TrimSpace(string(out))}
+	}
+
+	// The manifest uses the same KEY=VALUE format as the global config
+	manifest := loadGlobalConfig(filepath.Join(tmp, bundleManifest))
+	original := manifest.Get("NAME")
+	if original == "" || original != filepath.Base(original) {
+		return "", &bottleError{op: "migrate", msg: "not a bottle-launch migration bundle"}
+	}
+	if name == "" {
+		name = original
+	}
+	if !strings.HasSuffix(name, ".bottle") {
+		name += ".bottle"
+	}
+
+	bottle := filepath.Join(bottleDir, name)
+	if _, err := os.Stat(bottle); err == nil {
+		return "", errBottleExists
+	}
+	j, err := beginJournal("import", bottle)
+	if err != nil {
+		return "", err
+	}
+	defer j.finish()
+	j.setTemp(tmp)
+	j.step("install")
+	// Renamed under the journal's name so it is found in place afterwards
+	if err := os.Rename(filepath.Join(tmp, original), bottle); err != nil {
+		return "", err
+	}
+	return bottle, installImported(bottle, tmp)
+}
+
+// installImported installs an imported bottle's config and header backup
+// from the unpacked bundle in dir, unless they are installed already
+func installImported(bottle, dir string) error {
+	// Config and header backup are keyed by the bottle's new path
+	os.MkdirAll(configDir, 0700)
+	config := filepath.Join(dir, bundleConfig)
+	if _, err := os.Stat(config); err == nil {
+		if err := savePermissions(getConfigPath(bottle), loadPermissions(config)); err != nil {
+			return err
+		}
+		os.Remove(config)
+	}
+	header := filepath.Join(dir, bundleHeader)
+	if _, err := os.Stat(header); err == nil {
+		if err := os.Rename(header, getHeaderBackupPath(bottle)); err != nil {
+			return err
+		}
+	}
+	// The header holds the keyslots; keep it as private as the config
+	return os.Chmod(getHeaderBackupPath(bottle), 0600)
+}
+
+// findFIDO2Key looks for a connected security key that unlocks the bottle,
+// likeliest first (one touch per key tried). Fails with errNoFIDO2Device or
+// fido2KeysFailed.
+func findFIDO2Key(bottle string, perms *Permissions) (string, []byte, error) {
+	devices, err := EnumerateFIDO2Devices()
+	if err != nil {
+		return "", nil, err
+	}
+	if len(devices) == 0 {
+		return "", nil, errNoFIDO2Device
+	}
+
+	var failures []error
+	rpID, _ := bottleFIDO2Party(perms)
+	for _, dev := range orderFIDO2Devices(devices, perms) {
+		secret, err := GetFIDO2Secret(context.Background(), dev.Path, rpID, perms.FIDO2BottleID, perms.FIDO2CredentialID, perms.FIDO2Salt)
+		if err != nil {
+			failures = append(failures, fmt.Errorf("%s: %w", dev.Path, err))
+			continue
+		}
+		if err := TestLUKSKeyFIDO2(bottle, secret); err != nil {
+			failures = append(failures, fmt.Errorf("%s: %w", dev.Path, err))
+			continue
+		}
+		return dev.Path, secret, nil
+	}
+	return "", nil, fido2KeysFailed(failures)
+}
+
+// fido2KeysFailed is the error when none of the connected keys worked. A key
+// without the bottle's credential looks the same as one that failed, so it
+// is errFIDO2CredentialMissing along with why each key failed, e.g. a PIN
+// error, a timeout, or a missing fido2-assert. If every key gave a secret
+// that didn't unlock the bottle, it is errWrongYubiKey.
+func fido2KeysFailed(failures []error) error {
+	wrongKey := len(failures) > 0
+	for _, err := range failures {
+		wrongKey = wrongKey && errors.Is(err, errWrongYubiKey)
+	}
+	if wrongKey {
+		return errWrongYubiKey
+	}
+	return errors.Join(append([]error{errFIDO2CredentialMissing}, failures...)...)
+}
+
+// reenrollFIDO2 moves a bottle to a new security key: a credential is created
+// on newDevice, its secret added as a keyslot, the config updated, and only
+// then the old keyslot removed, so an interruption never locks the user out
+func reenrollFIDO2(bottle string, perms *Permissions, oldSecret []byte, newDevice string) error {
+	// The new key gets a credential for the same relying party
+	rpID, user := bottleFIDO2Party(perms)
+	credID, salt, err := CreateFIDO2Credential(context.Background(), newDevice, rpID, user, perms.FIDO2BottleID)
+	if err != nil {
+		return err
+	}
+	newSecret, err := GetFIDO2Secret(context.Background(), newDevice, rpID, perms.FIDO2BottleID, credID, salt)
+	if err != nil {
+		return err
+	}
+
+	perms.FIDO2CredentialID = credID
+	perms.FIDO2Salt = salt
+	perms.FIDO2DeviceHint = newDevice
+	perms.FIDO2RPID, perms.FIDO2User = rpID, user
+	return swapFIDO2Keyslot("reenroll", bottle, perms, oldSecret, newSecret)
+}
+
+// rotateFIDO2Salt replaces a bottle's hmac-secret salt, and so its unlock
+// secret, on the same key: the new secret is added as a keyslot and checked,
+// the config updated, and only then the old keyslot removed, so an
+// interruption never locks the user out
+func rotateFIDO2Salt(bottle string, perms *Permissions, device string, oldSecret []byte) error {
+	saltBytes := make([]byte, 32)
+	if _, err := rand.Read(saltBytes); err != nil {
+		return fmt.Errorf("generate salt: %w", err)
+	}
+	salt := base64.StdEncoding.EncodeToString(saltBytes)
+	rpID, _ := bottleFIDO2Party(perms)
+	newSecret, err := GetFIDO2Secret(context.Background(), device, rpID, perms.FIDO2BottleID, perms.FIDO2CredentialID, salt)
+	if err != nil {
+		return err
+	}
+
+	perms.FIDO2Salt = salt
+	return swapFIDO2Keyslot("rotate", bottle, perms, oldSecret, newSecret)
+}
+
+// swapFIDO2Keyslot replaces the keyslot oldSecret opens with one for
+// newSecret, and saves perms (which use the new secret) in between. It is
+// journaled: a crash before the config is saved is rolled back, one after
+// is finished by removing the old keyslot.
+func swapFIDO2Keyslot(op, bottle string, perms *Permissions, oldSecret, newSecret []byte) error {
+	j, err := beginJournal(op, bottle)
+	if err != nil {
+		return err
+	}
+	defer j.finish()
+	oldSlot, err := luksKeyslotOf(bottle, oldSecret)
+	if err != nil {
+		return err
+	}
+	newSlot, err := freeLUKSKeyslot(bottle)
+	if err != nil {
+		return err
+	}
+	j.setKeyslots(oldSlot, newSlot, perms.FIDO2Salt)
+
+	j.step("add-key")
+	if err := addLUKSKey(bottle, oldSecret, newSecret, "--key-slot", strconv.Itoa(newSlot)); err != nil {
+		return err
+	}
+	if err := TestLUKSKeyFIDO2(bottle, newSecret); err != nil {
+		killLUKSKeyslot(bottle, newSlot)
+		return &bottleError{op: op, msg: "the new secret didn't unlock the bottle; kept the old one: " + err.Error(), class: classWrongPassword}
+	}
+	j.step("save-config")
+	if err := savePermissionsAtomic(getConfigPath(bottle), perms); err != nil {
+		killLUKSKeyslot(bottle, newSlot)
+		return err
+	}
+	j.step("remove-key")
+	return killLUKSKeyslot(bottle, oldSlot)
+}
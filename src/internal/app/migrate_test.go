@@ -0,0 +1,37 @@
+// Tests for security key fallback: what is reported when no connected key works.
+package app
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFIDO2KeysFailed(t *testing.T) {
+	pinErr := fmt.Errorf("/dev/hidraw3: %w", errors.New("fido2-assert: FIDO_ERR_PIN_REQUIRED"))
+	wrongKey := fmt.Errorf("/dev/hidraw4: %w", errWrongYubiKey)
+	tests := []struct {
+		name     string
+		failures []error
+		is       error  // the error it must be
+		mentions string // a cause it must keep
+	}{
+		{"no key tried", nil, errFIDO2CredentialMissing, ""},
+		{"PIN error", []error{pinErr}, errFIDO2CredentialMissing, "FIDO_ERR_PIN_REQUIRED"},
+		{"every key wrong", []error{wrongKey, wrongKey}, errWrongYubiKey, ""},
+		{"wrong key and PIN error", []error{wrongKey, pinErr}, errFIDO2CredentialMissing, "FIDO_ERR_PIN_REQUIRED"},
+	}
+	for _, tt := range tests {
+		err := fido2KeysFailed(tt.failures)
+		if !errors.Is(err, tt.is) {
+			t.Errorf("%s: fido2KeysFailed() = %v, want %v", tt.name, err, tt.is)
+		}
+		if !strings.Contains(err.Error(), tt.mentions) {
+			t.Errorf("%s: fido2KeysFailed() = %q, want it to mention %q", tt.name, err, tt.mentions)
+		}
+		if classifyError(err) != classFIDO2 {
+			t.Errorf("%s: classifyError() = %s, want fido2", tt.name, classifyError(err).Name)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+// Desktop integration: .desktop entries and MIME associations that open host files in bottled apps.
+package app
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// mimeappsSections are the mimeapps.list sections a handler is listed in:
+// the default, and the "Open With" choices
+var mimeappsSections = []string{"[Default Applications]", "[Added Associations]"}
+
+// applicationsDir returns where user .desktop entries go
+func applicationsDir() string {
+	if mockMode {
+		return filepath.Join(bottleDir, ".applications")
+	}
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, _ := os.UserHomeDir()
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataHome, "applications")
+}
+
+// mimeappsPath returns the user's mimeapps.list
+func mimeappsPath() string {
+	if mockMode {
+		return filepath.Join(configDir, "mimeapps.list")
+	}
+	return filepath.Join(filepath.Dir(configDir), "mimeapps.list")
+}
+
+// handlerDesktopID names the .desktop entry that opens files with appID in a bottle
+func handlerDesktopID(bottle, appID string) string {
+	stem := strings.TrimSuffix(bottleName(bottle), ".bottle")
+	stem = strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r == '.' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+			return r
+		}
+		return '_'
+	}, stem)
+	return "bottle-launch-" + stem + "-" + appID + ".desktop"
+}
+
+// quoteExecArg quotes one argument of a .desktop Exec line
+func quoteExecArg(arg string) string {
+	arg = strings.ReplaceAll(arg, "%", "%%")
+	if !strings.ContainsAny(arg, " \t\n\"'\\><~|&;$*?#()`") {
+		return arg
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`", `$`, `\$`)
+	// The desktop file parser unescapes backslashes once more before Exec is split
+	return strings.ReplaceAll(`"`+r.Replace(arg)+`"`, `\`, `\\`)
+}
+
+// cmdMimeRegister makes a bottled app the handler for MIME types on the host:
+// double-clicking such a file runs the app in the bottle with the file copied
+// into its inbox, asking for the password in a dialog if the bottle is locked
+func cmdMimeRegister(bottle, appArg string, mimeTypes []string) error {
+	bottle = resolveBottlePath(bottle)
+	if _, err := os.Stat(bottle); err != nil {
+		return errBottleNotFound
+	}
+	absBottle, err := filepath.Abs(bottle)
+	if err != nil {
+		return &bottleError{op: "mime-register", msg: err.Error()}
+	}
+	app := parseAppRef(appArg)
+	perms := loadPermissions(getConfigPath(bottle))
+	if !perms.AllowsApp(app.ID) {
+		return &bottleError{op: "mime-register", msg: app.ID + " is not allowed in " + bottleName(bottle) +
+			" (allowed: " + strings.Join(perms.AllowedApps, ", ") + ")"}
+	}
+	for _, t := range mimeTypes {
+		if !strings.Contains(t, "/") {
+			return &bottleError{op: "mime-register", msg: "not a MIME type: " + t}
+		}
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return &bottleError{op: "mime-register", msg: err.Error()}
+	}
+	name := app.ID
+	for _, a := range listFlatpakApps() {
+		if a.ID == app.ID {
+			name = a.Name
+			break
+		}
+	}
+
+	dir := applicationsDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return &bottleError{op: "mime-register", msg: err.Error()}
+	}
+	id := handlerDesktopID(bottle, app.ID)
+	path := filepath.Join(dir, id)
+
+	// Registering more types for the same app adds to the entry
+	types := slices.Clone(mimeTypes)
+	for _, t := range desktopMimeTypes(path) {
+		if !slices.Contains(types, t) {
+			types = append(types, t)
+		}
+	}
+
+	execLine := strings.Join([]string{
+		quoteExecArg(exe), "run", quoteExecArg(absBottle), quoteExecArg(appArg), "--open", "%f",
+	}, " ")
+	entry := "[Desktop Entry]\n" +
+		"Type=Application\n" +
+		"Name=" + name + " (" + bottleName(bottle) + ")\n" +
+		"Comment=Open in " + name + " inside the encrypted bottle " + bottleName(bottle) + "\n" +
+		"Icon=" + app.ID + "\n" +
+		"Exec=" + execLine + "\n" +
+		"Terminal=false\n" +
+		"NoDisplay=true\n" +
+		"MimeType=" + strings.Join(types, ";") + ";\n" +
+		"X-Bottle-Launch-Bottle=" + absBottle + "\n"
+	if err := replaceFile(path, entry); err != nil {
+		return err
+	}
+	if err := updateMimeapps(id, mimeTypes, false); err != nil {
+		return err
+	}
+	refreshDesktopDatabase(dir)
+
+	fmt.Printf("%s now opens %s in %s\n", name, strings.Join(mimeTypes, ", "), bottleName(bottle))
+	fmt.Println("Wrote " + path)
+	return nil
+}
+
+// cmdMimeUnregister removes a handler entry and its associations
+func cmdMimeUnregister(bottle, appArg string) error {
+	bottle = resolveBottlePath(bottle)
+	id := handlerDesktopID(bottle, parseAppRef(appArg).ID)
+	dir := applicationsDir()
+	path := filepath.Join(dir, id)
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return &bottleError{op: "mime-register", msg: "no handler registered for " + appArg + " in " + bottleName(bottle)}
+		}
+		return &bottleError{op: "mime-register", msg: err.Error()}
+	}
+	if err := updateMimeapps(id, nil, true); err != nil {
+		return err
+	}
+	refreshDesktopDatabase(dir)
+	fmt.Println("Removed " + path)
+	return nil
+}
+
+// desktopMimeTypes returns the MimeType list of an existing .desktop entry
+func desktopMimeTypes(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if v, ok := strings.CutPrefix(line, "MimeType="); ok {
+			return slices.DeleteFunc(strings.Split(v, ";"), func(s string) bool { return s == "" })
+		}
+	}
+	return nil
+}
+
+// updateMimeapps puts desktopID first for each MIME type in mimeapps.list, or
+// with remove takes it out of every type, keeping everything else in the file
+func updateMimeapps(desktopID string, mimeTypes []string, remove bool) error {
+	path := mimeappsPath()
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return &bottleError{op: "mime-register", msg: err.Error()}
+	}
+	var lines []string
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	}
+
+	var out []string
+	section := ""
+	done := map[string]bool{} // "section\x00type" already written
+
+	// flush adds the types a section didn't list yet, at its end
+	flush := func() {
+		if remove || !slices.Contains(mimeappsSections, section) {
+			return
+		}
+		// Keep blank lines between sections after the new entries
+		end := len(out)
+		for end > 0 && strings.TrimSpace(out[end-1]) == "" {
+			end--
+		}
+		var added []string
+		for _, t := range mimeTypes {
+			if !done[section+"\x00"+t] {
+				added = append(added, t+"="+desktopID+";")
+				done[section+"\x00"+t] = true
+			}
+		}
+		out = append(out[:end], append(added, out[end:]...)...)
+	}
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			flush()
+			section = trimmed
+			out = append(out, line)
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || !slices.Contains(mimeappsSections, section) {
+			out = append(out, line)
+			continue
+		}
+		key = strings.TrimSpace(key)
+		listed := remove || slices.Contains(mimeTypes, key)
+		handlers := slices.DeleteFunc(strings.Split(value, ";"), func(s string) bool {
+			s = strings.TrimSpace(s)
+			return s == "" || (listed && s == desktopID)
+		})
+		if !remove && listed {
+			handlers = append([]string{desktopID}, handlers...)
+			done[section+"\x00"+key] = true
+		}
+		if len(handlers) > 0 {
+			out = append(out, key+"="+strings.Join(handlers, ";")+";")
+		}
+	}
+	flush()
+
+	// Sections the file didn't have yet
+	if !remove {
+		for _, s := range mimeappsSections {
+			if done[s+"\x00"+mimeTypes[0]] {
+				continue
+			}
+			if len(out) > 0 {
+				out = append(out, "")
+			}
+			section = s
+			out = append(out, s)
+			flush()
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return &bottleError{op: "mime-register", msg: err.Error()}
+	}
+	return replaceFile(path, strings.Join(out, "\n")+"\n")
+}
+
+// replaceFile writes a world-readable file through a temp file and rename, so
+// desktop environments never read half of it
+func replaceFile(path, content string) error {
+	tempFile, err := os.CreateTemp(filepath.Dir(path), ".bottle-launch-*.tmp")
+	if err != nil {
+		return &bottleError{op: "mime-register", msg: err.Error()}
+	}
+	tempPath := tempFile.Name()
+	_, err = tempFile.WriteString(content)
+	if err == nil {
+		err = tempFile.Chmod(0644)
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempPath, path)
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return &bottleError{op: "mime-register", msg: err.Error()}
+	}
+	return nil
+}
+
+// refreshDesktopDatabase updates the MIME cache of dir, if the tool is installed
+func refreshDesktopDatabase(dir string) {
+	if mockMode {
+		return
+	}
+	if _, err := exec.LookPath("update-desktop-database"); err == nil {
+		_ = command("update-desktop-database", dir).Run()
+	}
+}
@@ -0,0 +1,242 @@
+// Mock mode: fake storage, Flatpak, and FIDO2 for trying the UI and for scripted tests.
+package app
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/x/term"
+)
+
+// BackendMock is the backend of bottles created in mock mode
+const BackendMock = "mock"
+
+// mockMode is set from BOTTLE_LAUNCH_MOCK
+var mockMode = os.Getenv("BOTTLE_LAUNCH_MOCK") == "1"
+
+// mockRunSeconds is how long a mock app "runs"
+const mockRunSeconds = "3"
+
+var mockApps = []FlatpakApp{
+	{ID: "org.gnome.TextEditor", Name: "Text Editor", Installation: "system", Arch: "x86_64", Branch: "stable"},
+	{ID: "org.mozilla.firefox", Name: "Firefox", Installation: "system", Arch: "x86_64", Branch: "stable"},
+	{ID: "org.videolan.VLC", Name: "VLC", Installation: "system", Arch: "x86_64", Branch: "stable"},
+	{ID: "org.videolan.VLC", Name: "VLC", Installation: "user", Arch: "x86_64", Branch: "beta"},
+}
+
+// mockCatalog is what the mock Flathub offers
+var mockCatalog = []remoteApp{
+	{ID: "org.keepassxc.KeePassXC", Name: "KeePassXC", Summary: "Cross-platform password manager"},
+	{ID: "org.signal.Signal", Name: "Signal Desktop", Summary: "Private messenger"},
+	{ID: "org.mozilla.Thunderbird", Name: "Thunderbird", Summary: "Email, chat, calendar, and contacts"},
+}
+
+// mockStdin is shared so scripted runs can pipe one password per line
+var mockStdin = bufio.NewReader(os.Stdin)
+
+var errNotMockBottle = &mountError{op: "unlock", msg: "not a mock bottle"}
+
+func init() {
+	if mockMode {
+		// Runs after bottle.go's init, so this overrides the real directories
+		useMockSandbox()
+	}
+}
+
+// useMockSandbox points bottles and configs at the mock sandbox
+func useMockSandbox() {
+	root := os.Getenv("BOTTLE_DIR")
+	if root == "" {
+		root = filepath.Join(lockDir(), "mock", "bottles")
+	}
+	bottleDir = root
+	configDir = filepath.Join(root, ".config")
+	globalConfig = loadGlobalConfig(globalConfigPath())
+}
+
+// mockBackend implements Backend without encryption or mounts
+type mockBackend struct{}
+
+// mockHash returns the stored form of a mock bottle password
+func mockHash(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// mockMarker returns the runtime file that marks a mock bottle as unlocked
+func mockMarker(bottle string) string {
+	return filepath.Join(lockDir(), "mock", "unlocked", getBottleHash(bottle))
+}
+
+// mockCreate makes a mock bottle protected by password and saves perms as its config
+func mockCreate(bottle, size, password string, perms *Permissions) error {
+	if bottle == "" {
+		return errBottlePathRequired
+	}
+	if !strings.HasSuffix(bottle, ".bottle") {
+		bottle += ".bottle"
+	}
+	if !strings.Contains(bottle, string(os.PathSeparator)) {
+		bottle = filepath.Join(bottleDir, bottle)
+	}
+	if _, err := os.Lstat(bottle); err == nil {
+		return errBottleExists
+	}
+	if size != "" {
+		if _, err := validateBottleSize(size); err != nil {
+			return err
+		}
+	}
+	if password == "" {
+		var err error
+		if password, err = mockPromptPassword("New password for " + bottleName(bottle) + ": "); err != nil {
+			return &bottleError{op: "password", msg: err.Error()}
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Join(bottle, "data"), 0700); err != nil {
+		return &bottleError{op: "create dir", msg: err.Error()}
+	}
+	if err := os.WriteFile(filepath.Join(bottle, "key"), []byte(mockHash(password)+"\n"), 0600); err != nil {
+		os.RemoveAll(bottle)
+		return &bottleError{op: "create", msg: err.Error()}
+	}
+	perms.Backend = BackendMock
+	return savePermissions(getConfigPath(bottle), perms)
+}
+
+func (mockBackend) Create(ctx context.Context, bottle, size, password string) error {
+	return mockCreate(bottle, size, password, defaultPermissions())
+}
+
+func (mockBackend) Mount(ctx context.Context, bottle, password string) (*MountInfo, error) {
+	realPath, err := filepath.Abs(bottle)
+	if err != nil {
+		return nil, err
+	}
+	info := &MountInfo{BottlePath: realPath, MountPoint: filepath.Join(realPath, "data"), Backend: BackendMock}
+	if _, err := os.Stat(mockMarker(realPath)); err == nil {
+		return info, nil
+	}
+
+	stored, err := os.ReadFile(filepath.Join(realPath, "key"))
+	if err != nil {
+		return nil, errNotMockBottle
+	}
+	if password == "" {
+		if password, err = mockPromptPassword("Password for " + bottleName(realPath) + ": "); err != nil {
+			return nil, &mountError{op: "unlock", msg: err.Error()}
+		}
+	}
+	if strings.TrimSpace(string(stored)) != mockHash(password) {
+		return nil, errWrongPassword
+	}
+	os.MkdirAll(filepath.Dir(mockMarker(realPath)), 0700)
+	if err := os.WriteFile(mockMarker(realPath), nil, 0600); err != nil {
+		return nil, &mountError{op: "mount", msg: err.Error()}
+	}
+	info.Unlocked = true
+	return info, nil
+}
+
+func (mockBackend) Unmount(info *MountInfo) error {
+	if info == nil {
+		return nil
+	}
+	if err := os.Remove(mockMarker(info.BottlePath)); err != nil && !os.IsNotExist(err) {
+		return &mountError{op: "unmount", msg: err.Error()}
+	}
+	return nil
+}
+
+func (mockBackend) Current(bottle string) *MountInfo {
+	realPath, err := filepath.Abs(bottle)
+	if err != nil {
+		realPath = bottle
+	}
+	if _, err := os.Stat(mockMarker(realPath)); err != nil {
+		return nil
+	}
+	return &MountInfo{BottlePath: realPath, MountPoint: filepath.Join(realPath, "data"), Backend: BackendMock}
+}
+
+// mockPromptPassword asks for a password on the terminal, or reads a line
+// from stdin when it is not a terminal (scripted runs)
+func mockPromptPassword(prompt string) (string, error) {
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		line, err := mockStdin.ReadString('\n')
+		if line = strings.TrimRight(line, "\r\n"); line == "" {
+			return "", errors.Join(errors.New("no password on stdin"), err)
+		}
+		return line, nil
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Fprintln(os.Stderr)
+	return string(password), err
+}
+
+// mockFlatpakCommand stands in for `flatpak run`: it records the launch in
+// the bottle and exits after a few seconds
+func mockFlatpakCommand(appID, mountPoint string, extraArgs []string) *exec.Cmd {
+	script := `echo "$1 $(date)" > "$2/.mock-last-run"; exec sleep "$3"`
+	args := append([]string{"-c", script, "sh", appID, mountPoint, mockRunSeconds}, extraArgs...)
+	return command("sh", args...)
+}
+
+// mockSearchFlathub returns the catalog entries whose name or ID contains query
+func mockSearchFlathub(query string) []remoteApp {
+	var apps []remoteApp
+	for _, app := range mockCatalog {
+		if strings.Contains(strings.ToLower(app.Name+" "+app.ID), strings.ToLower(query)) {
+			apps = append(apps, app)
+		}
+	}
+	return apps
+}
+
+// mockInstallApp reports some progress, then adds the app to the installed list
+func mockInstallApp(appID string, progress func(string)) error {
+	for pct := 0; pct <= 100; pct += 20 {
+		progress(fmt.Sprintf("Installing %s... %d%%", appID, pct))
+		time.Sleep(300 * time.Millisecond)
+	}
+	for _, app := range mockCatalog {
+		if app.ID == appID {
+			mockApps = append(mockApps, FlatpakApp{ID: app.ID, Name: app.Name, Installation: "user", Arch: hostFlatpakArch(), Branch: "stable"})
+			return nil
+		}
+	}
+	return &bottleError{op: "install", msg: appID + " not found in remote flathub"}
+}
+
+// mockFIDO2Credential returns a random credential ID and salt
+func mockFIDO2Credential() (credID, salt string, err error) {
+	b := make([]byte, 64)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(b[:32]), base64.StdEncoding.EncodeToString(b[32:]), nil
+}
+
+// mockFIDO2Secret derives a stable 32-byte secret, like a real key would
+// (bound to the RP ID when it isn't the default)
+func mockFIDO2Secret(rpID, bottleID, credID, salt string) []byte {
+	input := bottleID + "\n" + credID + "\n" + salt
+	if rpID != DefaultFIDO2RPID {
+		input += "\n" + rpID
+	}
+	sum := sha256.Sum256([]byte(input))
+	return sum[:]
+}
@@ -0,0 +1,2296 @@
+// TUI model: state management and update handlers using the Bubbletea framework.
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/huh"
+
+	"bottle-launch/internal/wait"
+)
+
+type viewState int
+
+const (
+	viewBottleList viewState = iota
+	viewBottleActions
+	viewPermissions
+	viewAppSelect
+	viewLaunchConfirm
+	viewPasswordInput
+	viewCreateBottle
+	viewDeleteConfirm
+	viewRunning
+	viewError
+	viewCreateBottleYubiKey // YubiKey bottle creation wizard
+	viewFIDO2Unlock         // Touch to unlock
+	viewBottleInfo
+	viewHelp        // Full-screen keybinding overlay
+	viewBottleInUse // Bottle locked by another session: offer to join
+	viewRecovery    // Bottles left mounted/unlocked by a crashed session
+	viewUnmountBusy // Unmount blocked by processes with open files
+	viewFlathubSearch
+	viewFlathubInstall
+	viewLowSpace     // Bottle nearly full: ask before launching
+	viewSnapshots    // Snapshot browser: take, restore, delete
+	viewDNS          // DNS servers and hosts entries form
+	viewKeyDrive     // Waiting for the bottle's key drive
+	viewConfigReview // Config changed outside bottle-launch: trust it?
+	viewDescription  // Bottle description form
+)
+
+// bottleSortMode controls the ordering of the bottle list
+type bottleSortMode int
+
+const (
+	sortByName bottleSortMode = iota
+	sortByLastUsed
+)
+
+type model struct {
+	state     viewState
+	prevState viewState
+
+	// Components
+	help    help.Model
+	keys    keyMap
+	spinner spinner.Model
+
+	// Bottle selection
+	bottles        []string
+	bottleList     list.Model
+	selectedBottle string
+	quickLaunch    bool           // launched from the list with the default app
+	profile        *launchProfile // launched from the list with a profile
+	sortMode       bottleSortMode
+	showHidden     bool            // hidden bottles are listed too
+	bottleChanges  <-chan struct{} // fsnotify-driven refresh signal (nil if unavailable)
+
+	// App selection
+	apps        []FlatpakApp
+	appList     list.Model
+	selectedApp FlatpakApp
+	showAllApps bool              // list apps outside the bottle's allowlist too
+	appStatic   *keyFile          // the selected app's metadata permissions (nil until loaded)
+	appPreset   *permissionPreset // suggested permissions for the selected app's category, if any
+
+	// Flathub search and install
+	flathubQuery     textinput.Model
+	flathubResults   []remoteApp
+	flathubCursor    int
+	flathubSearching bool
+	flathubErr       string
+	installing       remoteApp
+	installProgress  string
+
+	// Permissions
+	permissions *Permissions
+	configPath  string
+
+	// Generic cursor for menu navigation (reused across views)
+	cursor int
+
+	// Forms
+	createForm      *huh.Form
+	dnsForm         *huh.Form
+	descriptionForm *huh.Form
+	passwordInput   textinput.Model
+	password        string
+
+	// Password manager unlock: vaultRef is set while the password input is
+	// asking for its master password; fromManager marks a looked-up passphrase
+	vaultRef    *secretRef
+	fromManager bool
+
+	// Key drive unlock: keyDrivePoll numbers visits to viewKeyDrive (stale
+	// polls are dropped), fromKeyDrive marks a key read from the drive
+	keyDrivePoll  int
+	keyDriveError string
+	fromKeyDrive  bool
+
+	// Changed config review: whether trusting it goes on to launch (or to
+	// the bottle actions)
+	reviewLaunch bool
+
+	// Error handling
+	err        error
+	errMsg     string
+	errDetails bool // raw error shown under the explanation
+
+	// Transient status line (e.g. result of opening the file manager)
+	statusMsg string
+
+	// Mount info for cleanup
+	mountInfo  *MountInfo
+	runningCmd *exec.Cmd
+	bottleLock *BottleLock // held from unlock until the bottle is released
+	inUseOwner LockOwner   // session holding the bottle (viewBottleInUse)
+
+	// Running session: start time (for usage stats) and time limit (zero deadline = unlimited)
+	launchedAt time.Time
+	deadline   time.Time
+	warned     bool
+	timedOut   bool
+
+	// Running app's latest resource samples (the previous one gives CPU use)
+	usage, prevUsage       appUsage
+	bottleFree, bottleSize int64
+	bottleUsedSpace        int64 // checked against the bottle's quota
+
+	// stopSync stops flushing the bottle periodically (nil if not running)
+	stopSync func()
+	// forensics records what the running app changed (nil if not running)
+	forensics func() string
+
+	// Busy unmount: the processes blocking it, and whether to quit once it succeeds
+	busy             *busyError
+	quitAfterUnmount bool
+
+	// Quitting with an app running: confirmQuit asks first, stoppingSince is
+	// when the app was asked to exit
+	confirmQuit   bool
+	stoppingSince time.Time
+
+	// Stale session recovery (shown at startup if needed)
+	staleBottles []staleBottle
+
+	// Snapshot browser: the selected bottle's snapshots, and the action
+	// ("restore" or "delete") waiting for confirmation on the selected one
+	snapshots       []bottleSnapshot
+	snapshotConfirm string
+	snapshotMounted bool // the bottle is open; restoring is refused
+
+	// Window size
+	width  int
+	height int
+
+	// Loading state
+	loading       bool
+	loadingMsg    string
+	touchDeadline time.Time          // while waiting for a FIDO2 touch, for the countdown
+	cancelTask    context.CancelFunc // stops the running creation, mount, key touch or app listing
+	taskCancelled bool               // the task was cancelled and is undoing its steps
+
+	// FIDO2
+	fido2Devices      []FIDO2Device
+	fido2DeviceSel    int    // selected device index
+	fido2Step         int    // wizard step (-1 error, 0 form, 1 device, 5 review, 2-4 enroll)
+	fido2BottleID     string // temp storage during creation
+	fido2CredID       string // temp storage during creation
+	fido2Salt         string // temp storage during creation
+	fido2RPID         string // relying party ID the new credential is for
+	fido2User         string // user name the new credential is for
+	fido2Secret       []byte // temp: derived secret (cleared after use)
+	fido2Error        string // last error message
+	fido2Acknowledged bool   // review step: the user accepted there is no recovery
+	bottleUsesYubiKey bool   // loaded from config
+
+	fido2Queue []FIDO2Device // keys still to try for the unlock, in order
+
+	// YubiKey bottle creation form values
+	fido2BottleName string
+	fido2BottleSize string
+}
+
+func initialModel(showHidden bool, warnings []string) model {
+	s := spinner.New()
+	s.Spinner = spinner.Dot
+	s.Style = spinnerStyle
+
+	ti := textinput.New()
+	ti.Placeholder = "Enter password"
+	ti.EchoMode = textinput.EchoPassword
+	ti.EchoCharacter = '*'
+	ti.Focus()
+
+	fq := textinput.New()
+	fq.Placeholder = "Search Flathub"
+
+	bottles := listBottles()
+	bl := list.New(buildBottleItems(bottles, sortByName, showHidden), bottleItemDelegate{}, 40, 15)
+	bl.Title = "Select Bottle"
+	bl.SetShowStatusBar(false)
+	bl.SetFilteringEnabled(false)
+	bl.Styles.Title = titleStyle
+	bl.SetShowHelp(false)
+
+	return model{
+		state:         viewBottleList,
+		help:          help.New(),
+		keys:          newKeyMap(),
+		spinner:       s,
+		bottles:       bottles,
+		bottleList:    bl,
+		showHidden:    showHidden,
+		bottleChanges: watchBottleDirs(),
+		passwordInput: ti,
+		flathubQuery:  fq,
+		permissions:   defaultPermissions(),
+		statusMsg:     strings.Join(warnings, "; "),
+	}
+}
+
+func (m model) Init() tea.Cmd {
+	return tea.Batch(m.spinner.Tick, tea.EnterAltScreen, waitForBottleChangeCmd(m.bottleChanges), findStaleBottlesCmd())
+}
+
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		m.help.Width = msg.Width
+		m.bottleList.SetSize(msg.Width-4, msg.Height-8)
+		if m.state == viewAppSelect {
+			m.appList.SetSize(msg.Width-4, msg.Height-8)
+		}
+		return m, nil
+
+	case tea.KeyMsg:
+		// ctrl+c or esc while a cancellable task runs cancels it instead,
+		// and the task's result takes us back to where it started
+		if m.cancelTask != nil && (msg.String() == "ctrl+c" || key.Matches(msg, m.keys.Back)) {
+			if !m.taskCancelled {
+				m.cancelTask()
+				m.taskCancelled = true
+				m.loadingMsg = "Cancelling..."
+				if m.state == viewCreateBottle || (m.state == viewCreateBottleYubiKey && m.fido2Step == 3) {
+					m.loadingMsg = "Cancelling - removing the partly created bottle..."
+				}
+			}
+			return m, nil
+		}
+
+		// Global quit handling - works from anywhere.
+		// ctrl+c always quits; other quit keys are ignored during text input or forms.
+		if msg.String() == "ctrl+c" || (key.Matches(msg, m.keys.Quit) && !m.textEntryActive()) {
+			if m.state == viewUnmountBusy {
+				// Already tried; quit and leave the bottle mounted
+				m.clearMount()
+				m.releaseLock()
+				return m, tea.Quit
+			}
+			if m.runningCmd != nil {
+				return m.quitWhileRunning()
+			}
+			// Unmount before quitting
+			if err := m.stopAndUnmount(); err != nil {
+				m.quitAfterUnmount = true
+				m.unmountFailed(err)
+				return m, nil
+			}
+			return m, tea.Quit
+		}
+
+		// Help overlay toggles from any view that isn't capturing text
+		if key.Matches(msg, m.keys.Help) && !m.textEntryActive() && !m.loading {
+			if m.state == viewHelp {
+				m.state = m.prevState
+			} else {
+				m.prevState = m.state
+				m.state = viewHelp
+			}
+			return m, nil
+		}
+
+	case errMsg:
+		m.endTask()
+		m.err = msg.err
+		m.errMsg = msg.err.Error()
+		m.state = viewError
+		m.loading = false
+		return m, nil
+
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+
+	case bottlesChangedMsg:
+		// Refresh in the background and keep listening
+		return m, tea.Batch(loadBottlesCmd(), waitForBottleChangeCmd(m.bottleChanges))
+
+	case bottlesLoadedMsg:
+		m.bottles = msg.bottles
+		m.bottleList.SetItems(buildBottleItems(msg.bottles, m.sortMode, m.showHidden))
+		m.loading = false
+		return m, nil
+
+	case appPermissionsMsg:
+		if msg.ref == m.selectedApp.Ref() {
+			m.appStatic = msg.static
+			m.appPreset = suggestedPreset(msg.categories)
+		}
+		return m, nil
+
+	case appsLoadedMsg:
+		m.endTask()
+		m.apps = msg.apps
+		m.showAllApps = false
+		al := list.New(nil, appItemDelegate{}, m.width-4, m.height-8)
+		al.SetShowStatusBar(true) // Show filter status
+		al.SetFilteringEnabled(true)
+		al.Styles.Title = titleStyle
+		al.SetShowHelp(true) // Show keybinding help for filtering
+		extraKeys := []key.Binding{m.keys.SearchFlathub}
+		if len(m.permissions.AllowedApps) > 0 {
+			extraKeys = append(extraKeys, m.keys.ShowAllApps)
+		}
+		al.AdditionalShortHelpKeys = func() []key.Binding { return extraKeys }
+		m.appList = al
+		m.setAppItems()
+		m.state = viewAppSelect
+		m.loading = false
+		return m, nil
+
+	case mountSuccessMsg:
+		m.endTask()
+		m.mountInfo = msg.info
+		SetCurrentMountInfo(msg.info) // Update global for signal handler
+		if msg.info.Unlocked {
+			method := UnlockPassword
+			if m.fromManager {
+				method = UnlockManager
+			} else if m.fromKeyDrive {
+				method = UnlockKeyDrive
+			}
+			recordUnlock(m.configPath, m.permissions, method)
+		}
+		m.loading = false
+		return m, m.launchOrWarn(msg.info.MountPoint)
+
+	case mountFailedMsg:
+		m.endTask()
+		m.loading = false
+		if msg.wrongPassword && m.fromKeyDrive {
+			// No password to fall back to
+			m.releaseLock()
+			m.err = wrongDriveKeyError(m.permissions)
+			m.errMsg = m.err.Error()
+			m.state = viewError
+		} else if msg.wrongPassword {
+			m.errMsg = "Wrong password. Please try again."
+			if m.fromManager {
+				m.errMsg = "The password manager entry didn't unlock this bottle. Enter the password:"
+				m.fromManager = false
+			}
+			m.passwordInput.Reset()
+			m.passwordInput.Focus()
+			m.state = viewPasswordInput
+		} else {
+			m.releaseLock()
+			m.err = msg.err
+			m.errMsg = msg.err.Error()
+			m.state = viewError
+		}
+		return m, nil
+
+	case appFinishedMsg:
+		// App finished running, unmount and return to bottle list
+		m.runningCmd = nil
+		SetCurrentRunningCmd(nil) // Clear global for signal handler
+		m.stopSyncer()
+		recordAppRun(m.selectedBottle, m.selectedApp.ID, m.launchedAt)
+		if m.forensics != nil {
+			if summary := m.forensics(); summary != "" {
+				m.statusMsg = "Forensics: " + summary + " - see bottle-launch audit"
+			}
+			m.forensics = nil
+		}
+		m.confirmQuit = false
+		m.stoppingSince = time.Time{}
+		if cmd := m.scanBeforeRelease(); cmd != nil {
+			return m, cmd
+		}
+		return m.releaseAfterApp()
+
+	case malwareScanMsg:
+		m.loading = false
+		if m.mountInfo != nil {
+			m.mountInfo.Scanned = true
+		}
+		status := "Malware scan: " + msg.result.Summary()
+		if m.statusMsg != "" {
+			status = m.statusMsg + "\n" + status
+		}
+		m.statusMsg = status
+		return m.releaseAfterApp()
+
+	case shutdownTickMsg:
+		if m.runningCmd == nil || m.stoppingSince.IsZero() {
+			return m, nil
+		}
+		if time.Since(m.stoppingSince) >= SessionKillGrace {
+			_ = m.runningCmd.Process.Kill()
+			return m, nil
+		}
+		return m, shutdownTickCmd()
+
+	case unmountRetriedMsg:
+		m.loading = false
+		var busy *busyError
+		if errors.As(msg.err, &busy) {
+			m.busy = busy
+			m.state = viewUnmountBusy
+			return m, nil
+		}
+		m.busy = nil
+		m.clearMount()
+		m.releaseLock()
+		if msg.err != nil {
+			m.errMsg = "Unmount failed: " + msg.err.Error()
+			m.state = viewError
+			return m, nil
+		}
+		if m.quitAfterUnmount {
+			return m, tea.Quit
+		}
+		m.state = viewBottleList
+		return m, loadBottlesCmd()
+
+	case keyDriveMsg:
+		if m.state != viewKeyDrive || msg.poll != m.keyDrivePoll {
+			return m, nil
+		}
+		if msg.err == errKeyDriveMissing {
+			m.keyDriveError = ""
+			return m, readDriveKeyCmd(m.permissions, m.keyDrivePoll, true)
+		}
+		if msg.err != nil {
+			// Keep polling: replugging the drive may fix it
+			m.keyDriveError = msg.err.Error()
+			return m, readDriveKeyCmd(m.permissions, m.keyDrivePoll, true)
+		}
+		m.keyDriveError = ""
+		m.fromKeyDrive = true
+		m.loading = true
+		m.loadingMsg = "Unlocking bottle..."
+		return m, mountBottleCmd(m.startTask(), m.selectedBottle, msg.key)
+
+	case secretLookupMsg:
+		m.endTask()
+		m.loading = false
+		if errors.Is(msg.err, errWrongMasterPassword) && m.vaultRef != nil {
+			m.errMsg = "Wrong master password. Please try again."
+			m.passwordInput.Reset()
+			m.state = viewPasswordInput
+			return m, nil
+		}
+		m.vaultRef = nil
+		if msg.err != nil {
+			// Fall back to typing the bottle password
+			m.errMsg = "Password manager: " + msg.err.Error()
+			m.passwordInput.Reset()
+			m.passwordInput.Focus()
+			m.state = viewPasswordInput
+			return m, textinput.Blink
+		}
+		m.fromManager = true
+		m.loading = true
+		m.loadingMsg = "Unlocking bottle..."
+		return m, mountBottleCmd(m.startTask(), m.selectedBottle, msg.password)
+
+	case staleBottlesMsg:
+		// Only interrupt if the user hasn't started doing something else
+		if len(msg.bottles) > 0 && m.state == viewBottleList {
+			m.staleBottles = msg.bottles
+			m.cursor = 0
+			m.statusMsg = ""
+			m.state = viewRecovery
+		}
+		return m, nil
+
+	case snapshotsLoadedMsg:
+		m.loading = false
+		m.snapshots = msg.snapshots
+		m.snapshotMounted = msg.mounted
+		m.cursor = min(m.cursor, max(len(m.snapshots)-1, 0))
+		return m, nil
+
+	case snapshotDoneMsg:
+		m.loading = false
+		m.statusMsg = msg.status
+		if msg.err != nil {
+			m.statusMsg = msg.err.Error()
+		}
+		return m, loadSnapshotsCmd(m.selectedBottle)
+
+	case bottleRecoveredMsg:
+		m.loading = false
+		if msg.err != nil {
+			m.statusMsg = bottleName(msg.path) + ": " + msg.err.Error()
+			return m, nil
+		}
+		m.statusMsg = ""
+		m.removeStaleBottle(msg.path)
+		if len(m.staleBottles) == 0 {
+			m.state = viewBottleList
+		}
+		return m, loadBottlesCmd()
+
+	case sessionTickMsg:
+		if m.state != viewRunning || m.deadline.IsZero() {
+			return m, nil
+		}
+		remaining := time.Until(m.deadline)
+		switch {
+		case remaining <= 0 && !m.timedOut:
+			m.timedOut = true
+			m.statusMsg = "Session time limit reached - closing " + m.selectedApp.Name
+			terminateApp(m.runningCmd)
+		case remaining <= timeoutWarningLead(m.permissions.Timeout) && !m.warned:
+			m.warned = true
+			sendNotification("Bottle session ending soon",
+				m.selectedApp.Name+" will be closed and "+bottleName(m.selectedBottle)+" locked in "+formatRemaining(remaining))
+		}
+		return m, sessionTickCmd()
+
+	case flathubResultsMsg:
+		if msg.query != m.flathubQuery.Value() {
+			return m, nil // superseded by a newer search
+		}
+		m.flathubSearching = false
+		m.flathubResults, m.flathubCursor, m.flathubErr = msg.apps, 0, ""
+		if msg.err != nil {
+			m.flathubErr = msg.err.Error()
+		} else if len(msg.apps) > 0 {
+			m.flathubQuery.Blur()
+		}
+		return m, nil
+
+	case installProgressMsg:
+		m.installProgress = msg.line
+		return m, waitForInstallCmd(msg.events)
+
+	case installDoneMsg:
+		if msg.err != nil {
+			m.flathubErr = "Installing " + msg.app.Name + " failed: " + msg.err.Error()
+			m.state = viewFlathubSearch
+			return m, nil
+		}
+		// Continue straight to launching the new app
+		m.apps = listFlatpakApps()
+		m.setAppItems()
+		m.selectedApp = FlatpakApp{ID: msg.app.ID, Name: msg.app.Name}
+		for _, app := range m.apps {
+			if app.ID == msg.app.ID && app.Installation == "user" {
+				m.selectedApp = app
+			}
+		}
+		m.permissions.LastApp = m.selectedApp.Ref()
+		savePermissions(m.configPath, m.permissions)
+		m.state = viewLaunchConfirm
+		m.appStatic, m.appPreset = nil, nil
+		return m, loadAppPermissionsCmd(m.selectedApp)
+
+	case runningStatsMsg:
+		if m.state != viewRunning || m.runningCmd == nil || m.runningCmd.Process.Pid != msg.pid {
+			return m, nil
+		}
+		m.prevUsage, m.usage = m.usage, msg.usage
+		m.bottleFree, m.bottleSize = msg.free, msg.total
+		m.bottleUsedSpace = msg.used
+		return m, runningStatsCmd(msg.pid, msg.mountPoint, RunningStatsInterval)
+
+	case fileManagerOpenedMsg:
+		if msg.err != nil {
+			m.statusMsg = "Could not open file manager: " + msg.err.Error()
+		} else {
+			m.statusMsg = ""
+		}
+		return m, nil
+
+	case bottleCreatedMsg:
+		m.loading = false
+		m.endTask()
+		m.state = viewBottleList
+		return m, loadBottlesCmd()
+
+	case bottleCreateCancelledMsg:
+		m.fido2Secret = nil
+		m.loading = false
+		m.endTask()
+		m.statusMsg = "Creation cancelled"
+		m.state = viewBottleList
+		return m, loadBottlesCmd()
+
+	case taskCancelledMsg:
+		m.endTask()
+		m.loading = false
+		m.touchDeadline = time.Time{}
+		m.fido2Queue = nil
+		m.fido2Secret = nil
+		switch m.state {
+		case viewPasswordInput:
+			// Back to typing the password (or master password)
+			m.passwordInput.Reset()
+			m.passwordInput.Focus()
+			return m, textinput.Blink
+		case viewFIDO2Unlock, viewCreateBottleYubiKey:
+			m.fido2Error = "Cancelled"
+		case viewKeyDrive:
+			m.releaseLock()
+			m.state = m.unlockBackState()
+		default:
+			// A cancelled mount leaves nothing open to keep the lock for
+			if m.mountInfo == nil {
+				m.releaseLock()
+			}
+		}
+		return m, nil
+
+	case bottleDeletedMsg:
+		m.loading = false
+		m.state = viewBottleList
+		return m, loadBottlesCmd()
+
+	case fido2DevicesMsg:
+		m.fido2Devices = msg.devices
+		m.fido2Error = ""
+		m.loading = false
+		if msg.err != nil {
+			m.fido2Error = msg.err.Error()
+		}
+		return m, nil
+
+	case fido2CredentialCreatedMsg:
+		m.endTask()
+		m.loading = false
+		if msg.err != nil {
+			m.fido2Error = msg.err.Error()
+			return m, nil
+		}
+		m.fido2CredID = msg.credID
+		m.fido2Salt = msg.salt
+		m.fido2Step = 2 // Move to "get secret" step
+		m.fido2Error = ""
+		return m, nil
+
+	case fido2SecretReadyMsg:
+		m.endTask()
+		m.loading = false
+		m.touchDeadline = time.Time{}
+		if msg.err != nil {
+			m.fido2Error = msg.err.Error()
+			return m, nil
+		}
+		m.fido2Secret = msg.secret
+		m.fido2Step = 3 // Move to "create bottle" step
+		m.fido2Error = ""
+		return m, nil
+
+	case fido2BottleCreatedMsg:
+		// Clear sensitive data
+		m.fido2Secret = nil
+		m.loading = false
+		m.endTask()
+		if msg.err != nil {
+			m.fido2Error = msg.err.Error()
+			return m, nil
+		}
+		m.fido2Step = 4 // Success step
+		m.fido2Error = ""
+		return m, nil
+
+	case fido2UnlockSuccessMsg:
+		m.endTask()
+		m.mountInfo = msg.info
+		SetCurrentMountInfo(msg.info) // Update global for signal handler
+		if msg.info.Unlocked {
+			recordUnlock(m.configPath, m.permissions, UnlockYubiKey)
+		}
+		m.loading = false
+		m.touchDeadline = time.Time{}
+		m.fido2Secret = nil // Clear sensitive data
+		return m, m.launchOrWarn(msg.info.MountPoint)
+
+	case fido2UnlockFailedMsg:
+		m.endTask()
+		if msg.tryNext && len(m.fido2Queue) > 0 {
+			return m, m.unlockWithNextFIDO2Device()
+		}
+		m.fido2Queue = nil
+		m.loading = false
+		m.touchDeadline = time.Time{}
+		m.fido2Secret = nil
+		m.fido2Error = msg.err.Error()
+		m.state = viewFIDO2Unlock
+		return m, nil
+	}
+
+	// Delegate to current view
+	switch m.state {
+	case viewBottleList:
+		return m.updateBottleList(msg)
+	case viewBottleActions:
+		return m.updateBottleActions(msg)
+	case viewPermissions:
+		return m.updatePermissions(msg)
+	case viewDNS:
+		return m.updateDNS(msg)
+	case viewDescription:
+		return m.updateDescription(msg)
+	case viewAppSelect:
+		return m.updateAppSelect(msg)
+	case viewLaunchConfirm:
+		return m.updateLaunchConfirm(msg)
+	case viewPasswordInput:
+		return m.updatePasswordInput(msg)
+	case viewCreateBottle:
+		return m.updateCreateBottle(msg)
+	case viewDeleteConfirm:
+		return m.updateDeleteConfirm(msg)
+	case viewError:
+		return m.updateError(msg)
+	case viewLowSpace:
+		return m.updateLowSpace(msg)
+	case viewCreateBottleYubiKey:
+		return m.updateCreateBottleYubiKey(msg)
+	case viewFIDO2Unlock:
+		return m.updateFIDO2Unlock(msg)
+	case viewKeyDrive:
+		return m.updateKeyDrive(msg)
+	case viewConfigReview:
+		return m.updateConfigReview(msg)
+	case viewBottleInfo:
+		return m.updateBottleInfo(msg)
+	case viewHelp:
+		return m.updateHelp(msg)
+	case viewBottleInUse:
+		return m.updateBottleInUse(msg)
+	case viewRecovery:
+		return m.updateRecovery(msg)
+	case viewUnmountBusy:
+		return m.updateUnmountBusy(msg)
+	case viewRunning:
+		return m.updateRunning(msg)
+	case viewFlathubSearch:
+		return m.updateFlathubSearch(msg)
+	case viewSnapshots:
+		return m.updateSnapshots(msg)
+	}
+
+	return m, nil
+}
+
+func (m model) updateBottleList(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, m.keys.Enter):
+			if i, ok := m.bottleList.SelectedItem().(profileItem); ok {
+				return m.launchProfile(i.profile)
+			}
+			if i, ok := m.bottleList.SelectedItem().(bottleItem); ok {
+				m.selectedBottle = i.path
+				m.configPath = getConfigPath(i.path)
+				m.permissions = loadPermissions(m.configPath)
+				m.quickLaunch = false
+				m.profile = nil
+				m.statusMsg = ""
+				m.cursor = 0
+				m.state = viewBottleActions
+				if m.permissions.Tampered {
+					m.reviewLaunch = false
+					m.state = viewConfigReview
+				}
+				return m, nil
+			}
+		case key.Matches(msg, m.keys.QuickLaunch):
+			// Skip straight to unlocking with the bottle's default app
+			if i, ok := m.bottleList.SelectedItem().(profileItem); ok {
+				return m.launchProfile(i.profile)
+			}
+			if i, ok := m.bottleList.SelectedItem().(bottleItem); ok {
+				m.selectedBottle = i.path
+				m.configPath = getConfigPath(i.path)
+				m.permissions = loadPermissions(m.configPath)
+				if m.permissions.DefaultApp == "" {
+					m.statusMsg = "No default app set for " + i.name + " - choose one in the launch screen"
+					return m, nil
+				}
+				m.statusMsg = ""
+				m.quickLaunch = true
+				m.profile = nil
+				m.selectedApp = parseAppRef(m.permissions.DefaultApp)
+				m.permissions.LastApp = m.permissions.DefaultApp
+				savePermissions(m.configPath, m.permissions)
+				return m.beginLaunch()
+			}
+		case key.Matches(msg, m.keys.NewBottle):
+			// New bottle (password)
+			m.createForm = createBottleForm()
+			m.state = viewCreateBottle
+			return m, m.createForm.Init()
+		case key.Matches(msg, m.keys.NewYubiKey):
+			// New bottle (YubiKey)
+			m.fido2Step = 0
+			m.fido2BottleName = ""
+			m.fido2BottleSize = ""
+			m.fido2Devices = nil
+			m.fido2DeviceSel = 0
+			m.fido2BottleID = ""
+			m.fido2CredID = ""
+			m.fido2Salt = ""
+			m.fido2Secret = nil
+			m.fido2Error = ""
+			m.createForm = createBottleFormYubiKey()
+			m.state = viewCreateBottleYubiKey
+			return m, m.createForm.Init()
+		case key.Matches(msg, m.keys.Sort):
+			// Toggle between name and last-used ordering
+			if m.sortMode == sortByName {
+				m.sortMode = sortByLastUsed
+			} else {
+				m.sortMode = sortByName
+			}
+			m.bottleList.SetItems(buildBottleItems(m.bottles, m.sortMode, m.showHidden))
+			return m, nil
+		case key.Matches(msg, m.keys.RevealHidden):
+			m.showHidden = !m.showHidden
+			m.bottleList.SetItems(buildBottleItems(m.bottles, m.sortMode, m.showHidden))
+			m.bottleList.ResetSelected()
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.bottleList, cmd = m.bottleList.Update(msg)
+	return m, cmd
+}
+
+// launchProfile unlocks a profile's bottle and runs its app, like a quick
+// launch with the profile's permissions and arguments
+func (m model) launchProfile(p *launchProfile) (tea.Model, tea.Cmd) {
+	if _, err := os.Stat(p.Bottle); err != nil {
+		m.statusMsg = "@" + p.Name + ": " + bottleName(p.Bottle) + " not found"
+		return m, nil
+	}
+	m.selectedBottle = p.Bottle
+	m.configPath = getConfigPath(p.Bottle)
+	m.permissions = loadPermissions(m.configPath)
+	m.statusMsg = ""
+	m.quickLaunch = true
+	m.profile = p
+	m.selectedApp = parseAppRef(p.App)
+	return m.beginLaunch()
+}
+
+func (m model) updateBottleActions(msg tea.Msg) (tea.Model, tea.Cmd) {
+	const numActions = 6
+
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, m.keys.Back):
+			m.state = viewBottleList
+			return m, nil
+		case key.Matches(msg, m.keys.Up):
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case key.Matches(msg, m.keys.Down):
+			if m.cursor < numActions-1 {
+				m.cursor++
+			}
+		case key.Matches(msg, m.keys.Enter):
+			switch m.cursor {
+			case 0: // Launch
+				m.loading = true
+				m.loadingMsg = "Loading applications..."
+				return m, loadAppsCmd(m.startTask())
+			case 1: // Permissions
+				m.cursor = 0
+				m.state = viewPermissions
+				return m, nil
+			case 2: // Delete
+				m.state = viewDeleteConfirm
+				return m, nil
+			case 3: // Info
+				m.state = viewBottleInfo
+				return m, nil
+			case 4: // Snapshots
+				return m.openSnapshots()
+			case 5: // Hide
+				return m.toggleHidden()
+			}
+		case key.Matches(msg, m.keys.Launch):
+			m.loading = true
+			m.loadingMsg = "Loading applications..."
+			return m, loadAppsCmd(m.startTask())
+		case key.Matches(msg, m.keys.Permissions):
+			m.cursor = 0
+			m.state = viewPermissions
+			return m, nil
+		case key.Matches(msg, m.keys.Delete):
+			m.state = viewDeleteConfirm
+			return m, nil
+		case key.Matches(msg, m.keys.Info):
+			m.state = viewBottleInfo
+			return m, nil
+		case key.Matches(msg, m.keys.Snapshots):
+			return m.openSnapshots()
+		case key.Matches(msg, m.keys.HideBottle):
+			return m.toggleHidden()
+		}
+	}
+	return m, nil
+}
+
+// toggleHidden hides the selected bottle from the list, or shows it again
+func (m model) toggleHidden() (tea.Model, tea.Cmd) {
+	if strings.HasPrefix(bottleName(m.selectedBottle), ".") {
+		m.statusMsg = "Hidden by its name - rename it without the leading dot to show it"
+		return m, nil
+	}
+	m.permissions.Hidden = !m.permissions.Hidden
+	if err := savePermissions(m.configPath, m.permissions); err != nil {
+		m.permissions.Hidden = !m.permissions.Hidden
+		m.statusMsg = "Could not save: " + err.Error()
+		return m, nil
+	}
+	m.statusMsg = ""
+	m.bottleList.SetItems(buildBottleItems(m.bottles, m.sortMode, m.showHidden))
+	return m, nil
+}
+
+// openSnapshots shows the snapshot browser for the selected bottle
+func (m model) openSnapshots() (tea.Model, tea.Cmd) {
+	if err := requireSnapshotBottle(m.selectedBottle); err != nil {
+		m.statusMsg = err.Error()
+		return m, nil
+	}
+	m.cursor = 0
+	m.snapshots = nil
+	m.snapshotConfirm = ""
+	m.statusMsg = ""
+	m.state = viewSnapshots
+	m.loading = true
+	m.loadingMsg = "Loading snapshots..."
+	return m, loadSnapshotsCmd(m.selectedBottle)
+}
+
+func (m model) updateSnapshots(msg tea.Msg) (tea.Model, tea.Cmd) {
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+	if m.snapshotConfirm != "" {
+		action := m.snapshotConfirm
+		m.snapshotConfirm = ""
+		if !key.Matches(keyMsg, m.keys.Yes) || m.cursor >= len(m.snapshots) {
+			return m, nil
+		}
+		s := m.snapshots[m.cursor]
+		m.loading = true
+		if action == "restore" {
+			m.loadingMsg = "Restoring " + s.Name() + "..."
+			return m, restoreSnapshotCmd(m.selectedBottle, s)
+		}
+		m.loadingMsg = "Deleting " + s.Name() + "..."
+		return m, deleteSnapshotCmd(s)
+	}
+
+	switch {
+	case key.Matches(keyMsg, m.keys.Back):
+		m.statusMsg = ""
+		m.cursor = 4
+		m.state = viewBottleActions
+	case key.Matches(keyMsg, m.keys.Up):
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case key.Matches(keyMsg, m.keys.Down):
+		if m.cursor < len(m.snapshots)-1 {
+			m.cursor++
+		}
+	case key.Matches(keyMsg, m.keys.TakeSnapshot):
+		m.loading = true
+		m.loadingMsg = "Taking a snapshot of " + bottleName(m.selectedBottle) + "..."
+		return m, takeSnapshotCmd(m.selectedBottle)
+	case key.Matches(keyMsg, m.keys.Enter):
+		switch {
+		case len(m.snapshots) == 0:
+		case m.snapshotMounted:
+			m.statusMsg = bottleName(m.selectedBottle) + " is open - lock it before restoring a snapshot"
+		default:
+			m.snapshotConfirm = "restore"
+		}
+	case key.Matches(keyMsg, m.keys.DeleteSnapshot):
+		if len(m.snapshots) > 0 {
+			m.snapshotConfirm = "delete"
+		}
+	}
+	return m, nil
+}
+
+func (m model) updateBottleInfo(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, m.keys.Back, m.keys.Enter):
+			m.cursor = 3
+			m.state = viewBottleActions
+			return m, nil
+		case key.Matches(msg, m.keys.EditDescription):
+			m.descriptionForm = descriptionForm(m.permissions)
+			m.state = viewDescription
+			return m, m.descriptionForm.Init()
+		}
+	}
+	return m, nil
+}
+
+// updateDescription runs the description form; finishing it saves the
+// description
+func (m model) updateDescription(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok && key.Matches(msg, m.keys.Back) && m.descriptionForm.State == huh.StateNormal {
+		m.state = viewBottleInfo
+		return m, nil
+	}
+
+	form, cmd := m.descriptionForm.Update(msg)
+	if f, ok := form.(*huh.Form); ok {
+		m.descriptionForm = f
+		if m.descriptionForm.State == huh.StateCompleted {
+			m.permissions.Description = strings.TrimSpace(m.descriptionForm.GetString("description"))
+			if err := savePermissions(m.configPath, m.permissions); err != nil {
+				m.statusMsg = "Could not save: " + err.Error()
+			}
+			m.bottleList.SetItems(buildBottleItems(m.bottles, m.sortMode, m.showHidden))
+			m.state = viewBottleInfo
+			return m, nil
+		}
+	}
+	return m, cmd
+}
+
+func (m model) updateRunning(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if m.confirmQuit {
+			switch {
+			case key.Matches(msg, m.keys.Yes):
+				return m.stopRunningApp()
+			case key.Matches(msg, m.keys.No):
+				m.confirmQuit = false
+			}
+			return m, nil
+		}
+		if key.Matches(msg, m.keys.OpenFolder) && m.mountInfo != nil {
+			return m, openFileManagerCmd(m.mountInfo.MountPoint)
+		}
+	}
+	return m, nil
+}
+
+func (m model) updateHelp(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if key.Matches(msg, m.keys.Back, m.keys.Enter) {
+			m.state = m.prevState
+			return m, nil
+		}
+	}
+	return m, nil
+}
+
+func (m model) updatePermissions(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, m.keys.Back, m.keys.Enter):
+			// Save and go back
+			savePermissions(m.configPath, m.permissions)
+			m.cursor = 0
+			m.state = viewBottleActions
+			return m, nil
+		case key.Matches(msg, m.keys.Up):
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case key.Matches(msg, m.keys.Down):
+			if m.cursor < len(permissionDefs)-1 {
+				m.cursor++
+			}
+		case key.Matches(msg, m.keys.Toggle):
+			// Toggle current permission
+			m.permissions.Toggle(m.cursor)
+		case key.Matches(msg, m.keys.EditDNS):
+			m.dnsForm = dnsForm(m.permissions)
+			m.state = viewDNS
+			return m, m.dnsForm.Init()
+		default:
+			// Shortcut keys toggle the matching permission directly
+			for i, b := range permissionBindings() {
+				if key.Matches(msg, b) {
+					m.permissions.Toggle(i)
+					break
+				}
+			}
+		}
+	}
+	return m, nil
+}
+
+// updateDNS runs the DNS form; finishing it saves the overrides
+func (m model) updateDNS(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok && key.Matches(msg, m.keys.Back) && m.dnsForm.State == huh.StateNormal {
+		m.state = viewPermissions
+		return m, nil
+	}
+
+	form, cmd := m.dnsForm.Update(msg)
+	if f, ok := form.(*huh.Form); ok {
+		m.dnsForm = f
+		if m.dnsForm.State == huh.StateCompleted {
+			// Both were validated by the form
+			m.permissions.DNS, _ = parseDNSServers(m.dnsForm.GetString("dns"))
+			m.permissions.Hosts, _ = parseHostsEntries(m.dnsForm.GetString("hosts"))
+			savePermissions(m.configPath, m.permissions)
+			m.state = viewPermissions
+			return m, nil
+		}
+	}
+	return m, cmd
+}
+
+func (m model) updateAppSelect(msg tea.Msg) (tea.Model, tea.Cmd) {
+	// Let the list process the message first (for filtering, navigation, etc.)
+	var cmd tea.Cmd
+	m.appList, cmd = m.appList.Update(msg)
+
+	// Then handle our specific actions
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		// Only handle esc when NOT filtering
+		if key.Matches(msg, m.keys.Back) && m.appList.FilterState() == list.Unfiltered {
+			m.cursor = 0
+			m.state = viewBottleActions
+			return m, nil
+		}
+		if key.Matches(msg, m.keys.SearchFlathub) && m.appList.FilterState() != list.Filtering {
+			return m.openFlathubSearch()
+		}
+		if key.Matches(msg, m.keys.ShowAllApps) && m.appList.FilterState() == list.Unfiltered && len(m.permissions.AllowedApps) > 0 {
+			m.showAllApps = !m.showAllApps
+			m.setAppItems()
+			return m, nil
+		}
+		// Handle enter to select (list might also process it, but we need to act on selection)
+		if key.Matches(msg, m.keys.Enter) && m.appList.FilterState() != list.Filtering {
+			if i, ok := m.appList.SelectedItem().(appItem); ok {
+				m.selectedApp = i.app
+				m.permissions.LastApp = i.app.Ref()
+				savePermissions(m.configPath, m.permissions)
+				m.state = viewLaunchConfirm
+				m.appStatic, m.appPreset = nil, nil
+				return m, loadAppPermissionsCmd(i.app)
+			}
+		}
+	}
+
+	return m, cmd
+}
+
+// setAppItems fills the app list with the bottle's allowed apps (or all
+// installed apps) and selects the last app used
+func (m *model) setAppItems() {
+	var items []list.Item
+	selected, exact := 0, false
+	for _, app := range m.apps {
+		if !m.showAllApps && !m.permissions.AllowsApp(app.ID) {
+			continue
+		}
+		// The exact ref wins over another branch of the same app
+		if app.Ref() == m.permissions.LastApp || (app.ID == m.permissions.LastApp && !exact) {
+			selected, exact = len(items), app.Ref() == m.permissions.LastApp
+		}
+		items = append(items, appItem{app: app})
+	}
+	m.appList.SetItems(items)
+	m.appList.Select(selected)
+
+	m.appList.Title = "Select Application"
+	switch {
+	case len(m.permissions.AllowedApps) == 0:
+	case m.showAllApps:
+		m.appList.Title += " (all apps)"
+	default:
+		m.appList.Title += " (allowed in this bottle)"
+	}
+}
+
+// openFlathubSearch switches to the Flathub search, starting from the app
+// list's filter text if there is one
+func (m model) openFlathubSearch() (tea.Model, tea.Cmd) {
+	m.flathubQuery.SetValue(m.appList.FilterValue())
+	m.flathubQuery.CursorEnd()
+	m.flathubQuery.Focus()
+	m.flathubResults, m.flathubErr, m.flathubSearching = nil, "", false
+	m.state = viewFlathubSearch
+	return m, textinput.Blink
+}
+
+func (m model) updateFlathubSearch(msg tea.Msg) (tea.Model, tea.Cmd) {
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if m.flathubQuery.Focused() {
+		switch {
+		case ok && key.Matches(keyMsg, m.keys.Back):
+			m.state = viewAppSelect
+			return m, nil
+		case ok && key.Matches(keyMsg, m.keys.Enter):
+			query := strings.TrimSpace(m.flathubQuery.Value())
+			if query == "" {
+				return m, nil
+			}
+			m.flathubQuery.SetValue(query)
+			m.flathubSearching, m.flathubErr = true, ""
+			return m, searchFlathubCmd(query)
+		case ok && key.Matches(keyMsg, m.keys.Down) && keyMsg.Type != tea.KeyRunes && len(m.flathubResults) > 0:
+			m.flathubQuery.Blur()
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.flathubQuery, cmd = m.flathubQuery.Update(msg)
+		return m, cmd
+	}
+
+	if !ok {
+		return m, nil
+	}
+	switch {
+	case key.Matches(keyMsg, m.keys.Back):
+		// Back to editing the query
+		m.flathubQuery.Focus()
+		return m, textinput.Blink
+	case key.Matches(keyMsg, m.keys.Up):
+		if m.flathubCursor > 0 {
+			m.flathubCursor--
+		}
+	case key.Matches(keyMsg, m.keys.Down):
+		if m.flathubCursor < len(m.flathubResults)-1 {
+			m.flathubCursor++
+		}
+	case key.Matches(keyMsg, m.keys.Enter):
+		m.installing = m.flathubResults[m.flathubCursor]
+		m.installProgress, m.flathubErr = "", ""
+		m.state = viewFlathubInstall
+		return m, installAppCmd(m.installing)
+	}
+	return m, nil
+}
+
+func (m model) updateLaunchConfirm(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, m.keys.Back):
+			m.state = viewAppSelect
+			return m, nil
+		case key.Matches(msg, m.keys.Enter, m.keys.Launch):
+			return m.beginLaunch()
+		case key.Matches(msg, m.keys.SetDefault):
+			// Toggle this app as the bottle's quick-launch default
+			if m.permissions.DefaultApp == m.selectedApp.Ref() {
+				m.permissions.DefaultApp = ""
+			} else {
+				m.permissions.DefaultApp = m.selectedApp.Ref()
+			}
+			savePermissions(m.configPath, m.permissions)
+			return m, nil
+		case key.Matches(msg, m.keys.AllowApp):
+			m.permissions.ToggleAllowedApp(m.selectedApp.ID)
+			savePermissions(m.configPath, m.permissions)
+			return m, nil
+		case key.Matches(msg, m.keys.UseSuggested):
+			if m.suggestPreset() {
+				m.appPreset.apply(m.permissions)
+				savePermissions(m.configPath, m.permissions)
+			}
+			return m, nil
+		case key.Matches(msg, m.keys.Permissions):
+			// Edit permissions first
+			m.cursor = 0
+			m.prevState = viewLaunchConfirm
+			m.state = viewPermissions
+			return m, nil
+		}
+	}
+	return m, nil
+}
+
+// suggestPreset reports whether the launch screen offers the app's suggested
+// permissions: only before the bottle's first launch, and only if they differ
+func (m model) suggestPreset() bool {
+	return m.appPreset != nil && m.permissions.LastUsed == 0 && !m.appPreset.matches(m.permissions)
+}
+
+// beginLaunch starts launching the selected app: it runs directly if the
+// bottle is already mounted, otherwise it moves to the matching unlock view
+func (m model) beginLaunch() (tea.Model, tea.Cmd) {
+	if m.permissions.Tampered {
+		m.reviewLaunch = true
+		m.state = viewConfigReview
+		return m, nil
+	}
+
+	// Make sure no other session is mounting or unmounting this bottle
+	if m.bottleLock == nil {
+		lock, err := acquireBottleLock(m.selectedBottle, m.selectedApp.ID)
+		var inUse *bottleInUseError
+		if errors.As(err, &inUse) {
+			m.inUseOwner = inUse.owner
+			m.state = viewBottleInUse
+			return m, nil
+		}
+		if err != nil {
+			m.errMsg = "Could not lock bottle: " + err.Error()
+			m.state = viewError
+			return m, nil
+		}
+		m.bottleLock = lock
+		SetCurrentBottleLock(lock) // Update global for signal handler
+	}
+
+	// Check if already mounted
+	if info := currentMount(m.selectedBottle); info != nil && info.MountPoint != "" {
+		// Already mounted, just run
+		m.mountInfo = info
+		SetCurrentMountInfo(m.mountInfo) // Update global for signal handler
+		return m, m.launchOrWarn(info.MountPoint)
+	}
+
+	// Warn before unlocking if the file changed behind our back
+	m.statusMsg = checkBottleChanged(m.selectedBottle, m.permissions)
+
+	// Unlocked but not mounted (e.g. adopted after a crash), or a plain
+	// squashfs image: no secret needed
+	if state, _ := getBottleState(m.selectedBottle); state == StateUnlocked || opensWithoutSecret(m.selectedBottle) {
+		m.loading = true
+		m.loadingMsg = "Mounting bottle..."
+		return m, mountBottleCmd(m.startTask(), m.selectedBottle, "")
+	}
+
+	m.fromManager = false
+	m.fromKeyDrive = false
+
+	// Key drive bottle: wait for the drive
+	if m.permissions.KeyDriveUUID != "" {
+		m.keyDrivePoll++
+		m.keyDriveError = ""
+		m.state = viewKeyDrive
+		return m, readDriveKeyCmd(m.permissions, m.keyDrivePoll, false)
+	}
+
+	// Check if this is a FIDO2 bottle
+	isFIDO2, err := IsFIDO2Bottle(m.permissions)
+	if err != nil {
+		// Corrupted config
+		m.releaseLock()
+		m.errMsg = err.Error()
+		m.state = viewError
+		return m, nil
+	}
+
+	if isFIDO2 {
+		// FIDO2 bottle - go to YubiKey unlock
+		m.bottleUsesYubiKey = true
+		m.fido2Error = ""
+		m.fido2Devices = nil
+		m.state = viewFIDO2Unlock
+		m.loading = true
+		m.loadingMsg = "Looking for YubiKey..."
+		return m, unlockFIDO2DevicesCmd(m.permissions)
+	}
+
+	// Password bottle
+	m.vaultRef = nil
+	m.errMsg = ""
+	m.passwordInput.Reset()
+	m.passwordInput.Focus()
+	m.state = viewPasswordInput
+
+	if m.permissions.SecretRef != "" {
+		ref, err := parseSecretRef(m.permissions.SecretRef)
+		if err != nil {
+			m.errMsg = err.Error()
+			return m, textinput.Blink
+		}
+		if ref.needsMasterPassword() {
+			// Ask for the database's master password first
+			m.vaultRef = ref
+			return m, textinput.Blink
+		}
+		m.loading = true
+		m.loadingMsg = "Looking up password..."
+		return m, lookupSecretCmd(m.startTask(), ref, "")
+	}
+	return m, textinput.Blink
+}
+
+// unlockBackState is where Esc leads from the unlock views: the bottle list
+// for quick launches, the launch confirmation otherwise
+func (m model) unlockBackState() viewState {
+	if m.quickLaunch {
+		return viewBottleList
+	}
+	return viewLaunchConfirm
+}
+
+// updateBottleInUse handles the prompt shown when another session holds the bottle
+func (m model) updateBottleInUse(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, m.keys.No):
+			m.state = m.unlockBackState()
+			return m, nil
+		case key.Matches(msg, m.keys.Yes):
+			lock, err := joinBottleLock(m.selectedBottle)
+			if err != nil {
+				m.errMsg = err.Error()
+				m.state = viewError
+				return m, nil
+			}
+			m.bottleLock = lock
+			SetCurrentBottleLock(lock) // Update global for signal handler
+			return m.beginLaunch()
+		}
+	}
+	return m, nil
+}
+
+// updateUnmountBusy handles the dialog for a bottle that processes keep busy
+func (m model) updateUnmountBusy(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, m.keys.Terminate):
+			m.loading = true
+			m.loadingMsg = "Closing " + strconv.Itoa(len(m.busy.Procs)) + " processes and unmounting..."
+			return m, retryUnmountCmd(m.mountInfo, m.bottleLock, m.busy.Procs)
+		case key.Matches(msg, m.keys.Retry):
+			m.loading = true
+			m.loadingMsg = "Unmounting " + bottleName(m.selectedBottle) + "..."
+			return m, retryUnmountCmd(m.mountInfo, m.bottleLock, nil)
+		case key.Matches(msg, m.keys.Back):
+			// Leave it mounted; it shows up in session recovery later
+			m.statusMsg = bottleName(m.selectedBottle) + " left mounted at " + m.busy.MountPoint
+			m.busy = nil
+			m.clearMount()
+			m.releaseLock()
+			if m.quitAfterUnmount {
+				return m, tea.Quit
+			}
+			m.state = viewBottleList
+			return m, loadBottlesCmd()
+		}
+	}
+	return m, nil
+}
+
+// updateRecovery handles the startup dialog for bottles left behind by a crashed session
+func (m model) updateRecovery(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if len(m.staleBottles) == 0 {
+			m.state = viewBottleList
+			return m, nil
+		}
+		stale := m.staleBottles[m.cursor]
+
+		switch {
+		case key.Matches(msg, m.keys.Back):
+			// Leave everything as is
+			m.staleBottles = nil
+			m.statusMsg = ""
+			m.state = viewBottleList
+			return m, nil
+		case key.Matches(msg, m.keys.Up):
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case key.Matches(msg, m.keys.Down):
+			if m.cursor < len(m.staleBottles)-1 {
+				m.cursor++
+			}
+		case key.Matches(msg, m.keys.Adopt, m.keys.Enter):
+			// Take it over by launching an app in it; the launch flow
+			// reuses the existing mount or mounts the unlocked device
+			m.removeStaleBottle(stale.path)
+			m.selectedBottle = stale.path
+			m.configPath = getConfigPath(stale.path)
+			m.permissions = loadPermissions(m.configPath)
+			m.quickLaunch = false
+			m.profile = nil
+			m.statusMsg = ""
+			m.loading = true
+			m.loadingMsg = "Loading applications..."
+			return m, loadAppsCmd(m.startTask())
+		case key.Matches(msg, m.keys.Unmount):
+			if stale.info.MountPoint == "" {
+				m.statusMsg = bottleName(stale.path) + " is not mounted"
+				return m, nil
+			}
+			m.loading = true
+			m.loadingMsg = "Unmounting " + bottleName(stale.path) + "..."
+			return m, recoverBottleCmd(stale, false)
+		case key.Matches(msg, m.keys.LockBottle):
+			m.loading = true
+			m.loadingMsg = "Locking " + bottleName(stale.path) + "..."
+			return m, recoverBottleCmd(stale, true)
+		}
+	}
+	return m, nil
+}
+
+// removeStaleBottle drops a bottle from the recovery list once it's been handled
+func (m *model) removeStaleBottle(path string) {
+	for i, s := range m.staleBottles {
+		if s.path == path {
+			m.staleBottles = append(m.staleBottles[:i], m.staleBottles[i+1:]...)
+			break
+		}
+	}
+	if m.cursor >= len(m.staleBottles) && m.cursor > 0 {
+		m.cursor = len(m.staleBottles) - 1
+	}
+}
+
+// releaseLock drops the bottle lock without unmounting (launch cancelled or failed)
+func (m *model) releaseLock() {
+	m.bottleLock.Release()
+	m.bottleLock = nil
+	SetCurrentBottleLock(nil)
+}
+
+func (m model) updatePasswordInput(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, m.keys.Back):
+			m.vaultRef = nil
+			m.releaseLock()
+			m.state = m.unlockBackState()
+			return m, nil
+		case key.Matches(msg, m.keys.Enter):
+			if m.vaultRef != nil {
+				master := m.passwordInput.Value()
+				if master == "" {
+					return m, nil
+				}
+				m.passwordInput.Reset()
+				m.loading = true
+				m.loadingMsg = "Opening password database..."
+				return m, lookupSecretCmd(m.startTask(), m.vaultRef, master)
+			}
+			m.password = m.passwordInput.Value()
+			if m.password == "" {
+				return m, nil
+			}
+			m.fromManager = false
+			m.loading = true
+			m.loadingMsg = "Unlocking bottle..."
+			return m, mountTypedPasswordCmd(m.startTask(), m.selectedBottle, m.password)
+		}
+	}
+
+	var cmd tea.Cmd
+	m.passwordInput, cmd = m.passwordInput.Update(msg)
+	return m, cmd
+}
+
+func (m model) updateCreateBottle(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if key.Matches(msg, m.keys.Back) && m.createForm.State == huh.StateNormal {
+			m.state = viewBottleList
+			return m, nil
+		}
+	}
+
+	form, cmd := m.createForm.Update(msg)
+	if f, ok := form.(*huh.Form); ok {
+		m.createForm = f
+
+		if m.createForm.State == huh.StateCompleted {
+			// Extract form values
+			name := m.createForm.GetString("name")
+			backend := m.createForm.GetString("backend")
+			size := m.createForm.GetString("size")
+			password := m.createForm.GetString("password")
+			confirm := m.createForm.GetString("confirm")
+
+			// Validate password confirmation
+			if password != confirm {
+				m.errMsg = "Passwords do not match"
+				m.state = viewError
+				return m, nil
+			}
+
+			if name != "" && (size != "" || backend != BackendLUKS) && password != "" {
+				integrity = backend == BackendLUKS && m.createForm.GetBool("integrity")
+				m.loading = true
+				m.loadingMsg = "Creating bottle..."
+				return m, createBottleCmd(m.startTask(), backend, name, size, password)
+			}
+			m.state = viewBottleList
+			return m, nil
+		}
+	}
+
+	return m, cmd
+}
+
+func (m model) updateDeleteConfirm(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, m.keys.No):
+			m.cursor = 0
+			m.state = viewBottleActions
+			return m, nil
+		case key.Matches(msg, m.keys.Yes):
+			// Check if mounted
+			if currentMount(m.selectedBottle) != nil {
+				m.errMsg = "Bottle is currently mounted. Close any running apps first."
+				m.state = viewError
+				return m, nil
+			}
+			m.loading = true
+			m.loadingMsg = "Deleting bottle..."
+			return m, deleteBottleCmd(m.selectedBottle)
+		}
+	}
+	return m, nil
+}
+
+func (m model) updateError(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if key.Matches(msg, m.keys.Details) {
+			m.errDetails = !m.errDetails
+			return m, nil
+		}
+		if key.Matches(msg, m.keys.Back, m.keys.Enter) {
+			m.err = nil
+			m.errMsg = ""
+			m.errDetails = false
+			m.state = viewBottleList
+			return m, nil
+		}
+	}
+	return m, nil
+}
+
+func (m model) updateLowSpace(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, m.keys.Yes):
+			return m, m.launchApp(m.mountInfo.MountPoint)
+		case key.Matches(msg, m.keys.OpenFolder):
+			return m, openFileManagerCmd(m.mountInfo.MountPoint)
+		case key.Matches(msg, m.keys.Retry):
+			return m, m.launchOrWarn(m.mountInfo.MountPoint)
+		case key.Matches(msg, m.keys.No):
+			// Not launching after all: lock the bottle again
+			if err := m.releaseMount(); err != nil {
+				m.unmountFailed(err)
+				return m, nil
+			}
+			m.releaseLock()
+			m.state = viewBottleList
+			return m, loadBottlesCmd()
+		}
+	}
+	return m, nil
+}
+
+func (m model) updateCreateBottleYubiKey(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, m.keys.Back):
+			// Handle escape based on current step
+			if m.fido2Step == 0 && m.createForm != nil && m.createForm.State == huh.StateNormal {
+				m.state = viewBottleList
+				return m, nil
+			} else if m.fido2Step == 5 {
+				// Review step - back to picking the key
+				m.fido2Step = 1
+				m.fido2Error = ""
+				return m, nil
+			} else if m.fido2Step == 4 {
+				// Success step - go back to bottle list
+				m.state = viewBottleList
+				return m, loadBottlesCmd()
+			} else if m.fido2Step > 0 {
+				// Cancel creation in progress
+				m.fido2Secret = nil
+				m.state = viewBottleList
+				return m, nil
+			}
+		case key.Matches(msg, m.keys.Enter):
+			// Handle enter based on step
+			switch m.fido2Step {
+			case 1:
+				// Device selected, review before the first touch
+				if len(m.fido2Devices) > 0 {
+					m.fido2Step = 5
+					m.fido2Acknowledged = false
+					m.fido2Error = ""
+				}
+			case 5:
+				// Reviewed, start credential creation
+				if !m.fido2Acknowledged {
+					m.fido2Error = "Acknowledge that the data is unrecoverable without this key (" + m.keys.Toggle.Help().Key + ")"
+					return m, nil
+				}
+				if len(m.fido2Devices) > 0 {
+					m.loading = true
+					m.loadingMsg = "Touch YubiKey to create credential..."
+					device := m.fido2Devices[m.fido2DeviceSel].Path
+					return m, createFIDO2CredentialCmd(m.startTask(), device, m.fido2RPID, m.fido2User, m.fido2BottleID)
+				}
+			case 2:
+				// Credential created, get secret
+				m.loading = true
+				m.loadingMsg = "Touch YubiKey to generate encryption key..."
+				m.touchDeadline = time.Now().Add(fido2TouchWindow())
+				device := m.fido2Devices[m.fido2DeviceSel].Path
+				return m, getFIDO2SecretCmd(m.startTask(), device, m.fido2RPID, m.fido2BottleID, m.fido2CredID, m.fido2Salt)
+			case 3:
+				// Secret ready, create bottle
+				m.loading = true
+				m.loadingMsg = "Creating encrypted bottle..."
+				device := m.fido2Devices[m.fido2DeviceSel].Path
+				return m, createBottleYubiKeyCmd(
+					m.startTask(),
+					m.fido2BottleName,
+					m.fido2BottleSize,
+					m.fido2Secret,
+					m.fido2BottleID,
+					m.fido2CredID,
+					m.fido2Salt,
+					m.fido2RPID,
+					m.fido2User,
+					device,
+				)
+			case 4:
+				// Success, go back to bottle list
+				m.state = viewBottleList
+				return m, loadBottlesCmd()
+			}
+		case key.Matches(msg, m.keys.Toggle):
+			if m.fido2Step == 5 {
+				m.fido2Acknowledged = !m.fido2Acknowledged
+				m.fido2Error = ""
+			}
+		case key.Matches(msg, m.keys.Retry):
+			// Retry device enumeration
+			if m.fido2Step == 1 && len(m.fido2Devices) == 0 {
+				m.loading = true
+				m.loadingMsg = "Looking for YubiKey..."
+				return m, enumerateFIDO2DevicesCmd()
+			}
+		case key.Matches(msg, m.keys.Up):
+			if m.fido2Step == 1 && m.fido2DeviceSel > 0 {
+				m.fido2DeviceSel--
+			}
+		case key.Matches(msg, m.keys.Down):
+			if m.fido2Step == 1 && m.fido2DeviceSel < len(m.fido2Devices)-1 {
+				m.fido2DeviceSel++
+			}
+		}
+	}
+
+	// Handle form update in step 0
+	if m.fido2Step == 0 && m.createForm != nil {
+		form, cmd := m.createForm.Update(msg)
+		if f, ok := form.(*huh.Form); ok {
+			m.createForm = f
+
+			if m.createForm.State == huh.StateCompleted {
+				// Extract form values
+				name := m.createForm.GetString("name")
+				size := m.createForm.GetString("size")
+
+				if name != "" && size != "" {
+					m.fido2BottleName = name
+					m.fido2BottleSize = size
+					integrity = m.createForm.GetBool("integrity")
+
+					// Check prerequisites
+					if err := CheckFIDO2Available(); err != nil {
+						m.fido2Error = err.Error()
+						m.fido2Step = -1 // Error step
+						return m, nil
+					}
+					if err := CheckPrivilegeEscalation(); err != nil {
+						m.fido2Error = err.Error()
+						m.fido2Step = -1
+						return m, nil
+					}
+
+					// Generate bottle ID
+					bottleID, err := generateBottleID()
+					if err != nil {
+						m.fido2Error = err.Error()
+						m.fido2Step = -1
+						return m, nil
+					}
+					m.fido2BottleID = bottleID
+					m.fido2RPID, m.fido2User = newFIDO2Party()
+
+					// Move to device enumeration
+					m.fido2Step = 1
+					m.loading = true
+					m.loadingMsg = "Looking for YubiKey..."
+					return m, enumerateFIDO2DevicesCmd()
+				}
+				m.state = viewBottleList
+				return m, nil
+			}
+		}
+		return m, cmd
+	}
+
+	return m, nil
+}
+
+// updateConfigReview handles the prompt for a config changed outside
+// bottle-launch: trusting signs it again, anything else leaves it unused
+func (m model) updateConfigReview(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch {
+		case key.Matches(msg, m.keys.Trust):
+			if err := trustConfig(m.configPath); err != nil {
+				m.errMsg = "Could not save the config: " + err.Error()
+				m.state = viewError
+				return m, nil
+			}
+			m.permissions.Tampered = false
+			if m.reviewLaunch {
+				return m.beginLaunch()
+			}
+			m.state = viewBottleActions
+			return m, nil
+		case key.Matches(msg, m.keys.Back), key.Matches(msg, m.keys.No):
+			m.statusMsg = bottleName(m.selectedBottle) + ": config not trusted - it stays unused until you trust it"
+			m.state = viewBottleList
+			return m, nil
+		}
+	}
+	return m, nil
+}
+
+// updateKeyDrive handles the wait for a key drive bottle's drive
+func (m model) updateKeyDrive(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok && key.Matches(msg, m.keys.Back) {
+		m.keyDrivePoll++ // stop polling
+		m.keyDriveError = ""
+		m.releaseLock()
+		m.state = m.unlockBackState()
+	}
+	return m, nil
+}
+
+func (m model) updateFIDO2Unlock(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, m.keys.Back):
+			m.fido2Secret = nil
+			m.fido2Error = ""
+			m.releaseLock()
+			m.state = m.unlockBackState()
+			return m, nil
+		case key.Matches(msg, m.keys.Retry):
+			// Retry
+			m.fido2Error = ""
+			m.loading = true
+			m.loadingMsg = "Looking for YubiKey..."
+			return m, unlockFIDO2DevicesCmd(m.permissions)
+		case key.Matches(msg, m.keys.Enter):
+			// Try the selected key, then the others
+			if len(m.fido2Devices) > 0 {
+				selected := m.fido2Devices[m.fido2DeviceSel]
+				m.fido2Queue = []FIDO2Device{selected}
+				for _, dev := range m.fido2Devices {
+					if dev != selected {
+						m.fido2Queue = append(m.fido2Queue, dev)
+					}
+				}
+				return m, m.unlockWithNextFIDO2Device()
+			}
+		case key.Matches(msg, m.keys.Up):
+			if m.fido2DeviceSel > 0 {
+				m.fido2DeviceSel--
+			}
+		case key.Matches(msg, m.keys.Down):
+			if m.fido2DeviceSel < len(m.fido2Devices)-1 {
+				m.fido2DeviceSel++
+			}
+		}
+	}
+
+	// Auto-unlock if devices were just enumerated, trying them in order
+	if len(m.fido2Devices) > 0 && m.fido2Error == "" && !m.loading {
+		m.fido2Queue = append([]FIDO2Device(nil), m.fido2Devices...)
+		return m, m.unlockWithNextFIDO2Device()
+	}
+
+	return m, nil
+}
+
+// unlockWithNextFIDO2Device tries to unlock the bottle with the next key in
+// fido2Queue
+func (m *model) unlockWithNextFIDO2Device() tea.Cmd {
+	dev := m.fido2Queue[0]
+	m.fido2Queue = m.fido2Queue[1:]
+	m.loading = true
+	m.loadingMsg = "Touch YubiKey to unlock..."
+	if n := len(m.fido2Devices); n > 1 {
+		m.loadingMsg = "Touch YubiKey " + dev.Path + " to unlock (" + strconv.Itoa(n-len(m.fido2Queue)) + " of " + strconv.Itoa(n) + ")..."
+	}
+	m.touchDeadline = time.Now().Add(fido2TouchWindow())
+	rpID, _ := bottleFIDO2Party(m.permissions)
+	return mountBottleFIDO2Cmd(
+		m.startTask(),
+		m.selectedBottle,
+		dev.Path,
+		rpID,
+		m.permissions.FIDO2BottleID,
+		m.permissions.FIDO2CredentialID,
+		m.permissions.FIDO2Salt,
+	)
+}
+
+// startTask returns the context for a task that esc (or ctrl+c) cancels
+// while it runs
+func (m *model) startTask() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancelTask = cancel
+	m.taskCancelled = false
+	return ctx
+}
+
+// endTask releases the context of the task that reported back
+func (m *model) endTask() {
+	if m.cancelTask != nil {
+		m.cancelTask()
+		m.cancelTask = nil
+	}
+	m.taskCancelled = false
+}
+
+// textEntryActive reports whether the current view is capturing typed text,
+// in which case single-letter shortcuts must not trigger actions
+func (m model) textEntryActive() bool {
+	switch m.state {
+	case viewPasswordInput, viewCreateBottle, viewDNS, viewDescription:
+		return true
+	case viewFlathubSearch:
+		return m.flathubQuery.Focused()
+	case viewCreateBottleYubiKey:
+		return m.fido2Step == 0
+	case viewAppSelect:
+		return m.appList.FilterState() == list.Filtering
+	}
+	return false
+}
+
+// launchOrWarn launches the app, unless the bottle is nearly full: many apps
+// corrupt their profiles when the disk fills mid-write, so it asks first
+func (m *model) launchOrWarn(mountPoint string) tea.Cmd {
+	free, total, err := filesystemSpace(mountPoint)
+	if err != nil || !spaceIsLow(free, total) {
+		return m.launchApp(mountPoint)
+	}
+	m.bottleFree, m.bottleSize = free, total
+	m.statusMsg = ""
+	m.state = viewLowSpace
+	return nil
+}
+
+// launchApp starts the selected app on a mounted bottle and, once it has
+// started, records the launch time
+func (m *model) launchApp(mountPoint string) tea.Cmd {
+	m.state = viewRunning
+	m.statusMsg = ""
+	perms, args := m.permissions, []string(nil)
+	if m.profile != nil {
+		perms, args = m.profile.apply(m.permissions), m.profile.Args
+	}
+	forensics := startForensics(m.selectedBottle, m.selectedApp.ID, mountPoint, m.permissions)
+	cmd, running := startFlatpakCmd(m.selectedApp, mountPoint, perms, args)
+	m.runningCmd = running
+	SetCurrentRunningCmd(running) // Update global for signal handler
+	m.bottleLock.Share()          // Mounted; other sessions may now join
+	if running != nil {
+		m.forensics = forensics
+		// Only launches that started count as uses
+		if err := recordLastUsed(m.configPath, m.permissions); err != nil {
+			m.statusMsg = "Could not record the launch: " + err.Error()
+		}
+	}
+
+	m.launchedAt = time.Now()
+	m.usage, m.prevUsage = appUsage{}, appUsage{}
+	m.bottleFree, m.bottleSize, m.bottleUsedSpace = 0, 0, 0
+	cmds := []tea.Cmd{cmd}
+	if running != nil {
+		m.stopSync = startSyncer(mountPoint)
+		cmds = append(cmds, runningStatsCmd(running.Process.Pid, mountPoint, 0))
+	}
+	m.deadline, m.warned, m.timedOut = time.Time{}, false, false
+	if m.permissions.Timeout > 0 {
+		m.deadline = time.Now().Add(m.permissions.Timeout)
+		cmds = append(cmds, sessionTickCmd())
+	}
+	return tea.Batch(cmds...)
+}
+
+// buildBottleItems creates list items for bottles, ordered by the given sort
+// mode; hidden bottles (and their profiles) are left out unless showHidden
+func buildBottleItems(bottles []string, sortMode bottleSortMode, showHidden bool) []list.Item {
+	var bottleItems []bottleItem
+	hidden := map[string]bool{}
+	for _, b := range bottles {
+		// Check if this is a YubiKey bottle
+		perms := loadPermissions(getConfigPath(b))
+		if isHiddenBottle(b, perms) {
+			hidden[b] = true
+			if !showHidden {
+				continue
+			}
+		}
+		isYubiKey, _ := IsFIDO2Bottle(perms)
+		state, _ := getBottleState(b)
+		bottleItems = append(bottleItems, bottleItem{path: b, name: bottleName(b), isYubiKey: isYubiKey, lastUsed: perms.LastUsed,
+			state: state, hidden: hidden[b], tampered: perms.Tampered, about: perms.Description,
+			keyDrive: perms.KeyDriveUUID != "", untrusted: perms.Untrusted, forensics: perms.Forensics,
+			risky: perms.Untrusted && perms.Network})
+	}
+
+	if sortMode == sortByLastUsed {
+		// Most recently used first; never-used bottles keep name order at the end
+		sort.SliceStable(bottleItems, func(i, j int) bool {
+			return bottleItems[i].lastUsed > bottleItems[j].lastUsed
+		})
+	}
+
+	// Profiles come first, in name order whatever the sort mode
+	var items []list.Item
+	for _, p := range listProfiles() {
+		if showHidden || !hidden[p.Bottle] {
+			items = append(items, profileItem{profile: p})
+		}
+	}
+	for _, b := range bottleItems {
+		items = append(items, b)
+	}
+	return items
+}
+
+// quitWhileRunning handles a quit key while an app runs: the first press
+// asks for confirmation, a second one confirms, and one more while the app
+// is shutting down kills it right away
+func (m model) quitWhileRunning() (tea.Model, tea.Cmd) {
+	m.state = viewRunning
+	switch {
+	case !m.stoppingSince.IsZero():
+		_ = m.runningCmd.Process.Kill()
+		return m, nil
+	case m.confirmQuit:
+		return m.stopRunningApp()
+	}
+	m.confirmQuit = true
+	return m, nil
+}
+
+// stopRunningApp asks the app to exit and quits once it has and the bottle
+// is unmounted (see appFinishedMsg). The app is killed after SessionKillGrace.
+func (m model) stopRunningApp() (tea.Model, tea.Cmd) {
+	m.confirmQuit = false
+	m.quitAfterUnmount = true
+	m.stoppingSince = time.Now()
+	_ = m.runningCmd.Process.Signal(syscall.SIGTERM)
+	return m, shutdownTickCmd()
+}
+
+// releaseMount unmounts the session's bottle and drops its lock. While
+// processes keep it busy, both are kept for a retry.
+// releaseAfterApp locks the bottle once its app has exited and returns to
+// the bottle list
+func (m model) releaseAfterApp() (tea.Model, tea.Cmd) {
+	if m.mountInfo != nil {
+		if err := m.releaseMount(); err != nil {
+			m.unmountFailed(err)
+			return m, nil
+		}
+	}
+	m.releaseLock()
+	if m.quitAfterUnmount {
+		return m, tea.Quit
+	}
+	m.state = viewBottleList
+	return m, loadBottlesCmd()
+}
+
+// scanBeforeRelease starts the malware scan of an untrusted-downloads bottle
+// this session is about to lock (nil if it won't lock it, or needs no scan).
+// The session keeps the bottle to itself until then, so nobody joins it.
+func (m *model) scanBeforeRelease() tea.Cmd {
+	if !needsScan(m.mountInfo) || keptOpen(m.mountInfo.BottlePath) {
+		return nil
+	}
+	if m.bottleLock != nil && !m.bottleLock.tryExclusive() {
+		return nil
+	}
+	m.loading = true
+	m.loadingMsg = "Scanning " + bottleName(m.mountInfo.BottlePath) + " for malware..."
+	return malwareScanCmd(m.mountInfo)
+}
+
+func (m *model) releaseMount() error {
+	err := releaseBottle(m.mountInfo, m.bottleLock)
+	var busy *busyError
+	if errors.As(err, &busy) {
+		return err
+	}
+	m.clearMount()
+	return err
+}
+
+// clearMount forgets the session's mount and lock (the lock must already be
+// released or handed off)
+func (m *model) clearMount() {
+	m.mountInfo = nil
+	m.bottleLock = nil
+	SetCurrentMountInfo(nil) // Clear globals for the signal handler
+	SetCurrentBottleLock(nil)
+}
+
+// unmountFailed shows why the bottle couldn't be released: the busy dialog
+// if processes still have files open in it, the error view otherwise
+func (m *model) unmountFailed(err error) {
+	var busy *busyError
+	if errors.As(err, &busy) {
+		m.busy = busy
+		m.state = viewUnmountBusy
+		return
+	}
+	m.errMsg = "Unmount failed: " + err.Error()
+	m.state = viewError
+}
+
+// stopSyncer stops the periodic flush started with the app
+func (m *model) stopSyncer() {
+	if m.stopSync != nil {
+		m.stopSync()
+		m.stopSync = nil
+	}
+}
+
+func (m *model) stopAndUnmount() error {
+	m.stopSyncer()
+	if m.runningCmd != nil && m.runningCmd.Process != nil {
+		_ = m.runningCmd.Process.Signal(syscall.SIGTERM)
+		// Force kill if still running
+		if !wait.ForExits([]int{m.runningCmd.Process.Pid}, 200*time.Millisecond) {
+			_ = m.runningCmd.Process.Kill()
+		}
+	}
+
+	if m.mountInfo != nil {
+		if err := m.releaseMount(); err != nil {
+			return err
+		}
+	}
+	m.releaseLock()
+
+	m.runningCmd = nil
+	SetCurrentRunningCmd(nil)
+	return nil
+}
+
+func (m model) View() string {
+	if m.loading {
+		return m.renderLoading()
+	}
+
+	var content string
+	switch m.state {
+	case viewBottleList:
+		content = m.renderBottleList()
+	case viewBottleActions:
+		content = m.renderBottleActions()
+	case viewPermissions:
+		content = m.renderPermissions()
+	case viewDNS:
+		content = m.renderDNS()
+	case viewDescription:
+		content = m.renderDescription()
+	case viewAppSelect:
+		content = m.renderAppSelect()
+	case viewLaunchConfirm:
+		content = m.renderLaunchConfirm()
+	case viewPasswordInput:
+		content = m.renderPasswordInput()
+	case viewCreateBottle:
+		content = m.renderCreateBottle()
+	case viewDeleteConfirm:
+		content = m.renderDeleteConfirm()
+	case viewRunning:
+		content = m.renderRunning()
+	case viewError:
+		content = m.renderError()
+	case viewLowSpace:
+		content = m.renderLowSpace()
+	case viewCreateBottleYubiKey:
+		content = m.renderCreateBottleYubiKey()
+	case viewFIDO2Unlock:
+		content = m.renderFIDO2Unlock()
+	case viewKeyDrive:
+		content = m.renderKeyDrive()
+	case viewConfigReview:
+		content = m.renderConfigReview()
+	case viewBottleInfo:
+		content = m.renderBottleInfo()
+	case viewHelp:
+		content = m.renderHelp()
+	case viewBottleInUse:
+		content = m.renderBottleInUse()
+	case viewRecovery:
+		content = m.renderRecovery()
+	case viewUnmountBusy:
+		content = m.renderUnmountBusy()
+	case viewFlathubSearch:
+		content = m.renderFlathubSearch()
+	case viewFlathubInstall:
+		content = m.renderFlathubInstall()
+	case viewSnapshots:
+		content = m.renderSnapshots()
+	default:
+		content = "Unknown state"
+	}
+
+	return content
+}
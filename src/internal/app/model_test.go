@@ -0,0 +1,174 @@
+// TUI integration tests: the model driven by keystrokes in mock mode.
+package app
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/exp/teatest"
+)
+
+// waitTimeout bounds every wait for the TUI; the mock app alone runs for
+// mockRunSeconds
+const waitTimeout = 10 * time.Second
+
+// newMockTUI starts the TUI in mock mode on a fresh sandbox
+func newMockTUI(t *testing.T) *teatest.TestModel {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_RUNTIME_DIR", filepath.Join(dir, "run"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+	t.Setenv("BOTTLE_DIR", filepath.Join(dir, "bottles"))
+
+	wasMock, oldBottles, oldConfig, oldGlobal := mockMode, bottleDir, configDir, globalConfig
+	t.Cleanup(func() {
+		mockMode, bottleDir, configDir, globalConfig = wasMock, oldBottles, oldConfig, oldGlobal
+	})
+	mockMode = true
+	useMockSandbox()
+
+	tm := teatest.NewTestModel(t, initialModel(false, nil), teatest.WithInitialTermSize(100, 40))
+	waitForText(t, tm, "New bottle (password)")
+	return tm
+}
+
+// waitForText waits until the TUI has drawn all of texts in one go
+func waitForText(t *testing.T, tm *teatest.TestModel, texts ...string) {
+	t.Helper()
+	teatest.WaitFor(t, tm.Output(), func(out []byte) bool {
+		for _, text := range texts {
+			if !bytes.Contains(out, []byte(text)) {
+				return false
+			}
+		}
+		return true
+	}, teatest.WithDuration(waitTimeout), teatest.WithCheckInterval(20*time.Millisecond))
+}
+
+// enter presses enter
+func enter(tm *teatest.TestModel) {
+	tm.Send(tea.KeyMsg{Type: tea.KeyEnter})
+}
+
+// fill waits for the form field titled title to have focus, then types
+// text into it and waits for it to show (masked as echo)
+func fill(t *testing.T, tm *teatest.TestModel, title, text, echo string) {
+	t.Helper()
+	waitForText(t, tm, "┃ "+title)
+	tm.Type(text)
+	waitForText(t, tm, "> "+echo)
+}
+
+// createMockBottle creates a password bottle through the creation form
+func createMockBottle(t *testing.T, tm *teatest.TestModel, name, password string) string {
+	t.Helper()
+	masked := strings.Repeat("*", len(password))
+	tm.Type("n")
+	fill(t, tm, "Bottle Name", name, name)
+	enter(tm)
+	waitForText(t, tm, "Storage")
+	enter(tm) // LUKS image
+	fill(t, tm, "Bottle Size", "1G", "1G")
+	enter(tm)
+	waitForText(t, tm, "┃ Tamper Detection")
+	enter(tm) // no tamper detection
+	fill(t, tm, "Encryption Password", password, masked)
+	enter(tm)
+	fill(t, tm, "Confirm Password", password, masked)
+	enter(tm)
+	waitForText(t, tm, "Select Bottle", name)
+
+	bottle := filepath.Join(bottleDir, name+".bottle")
+	if _, err := os.Stat(bottle); err != nil {
+		t.Fatalf("bottle not created: %v", err)
+	}
+	if info := currentMount(bottle); info != nil {
+		t.Fatalf("new bottle is mounted at %s", info.MountPoint)
+	}
+	return bottle
+}
+
+func TestCreateLaunchUnmount(t *testing.T) {
+	tm := newMockTUI(t)
+	bottle := createMockBottle(t, tm, "work", "correct horse")
+
+	// Open the bottle and pick the first app
+	enter(tm)
+	waitForText(t, tm, "Bottle: work")
+	enter(tm) // Launch
+	waitForText(t, tm, "Select Application")
+	enter(tm)
+	waitForText(t, tm, "Ready to launch")
+	enter(tm)
+	waitForText(t, tm, "Enter bottle password")
+
+	// A wrong password leaves it locked and asks again
+	tm.Type("battery staple")
+	enter(tm)
+	waitForText(t, tm, "Wrong password")
+	if info := currentMount(bottle); info != nil {
+		t.Fatalf("mounted with the wrong password at %s", info.MountPoint)
+	}
+
+	tm.Type("correct horse")
+	enter(tm)
+	waitForText(t, tm, "Running ")
+	info := currentMount(bottle)
+	if info == nil {
+		t.Fatal("bottle not mounted while its app runs")
+	}
+
+	// The mock app exits by itself; the bottle is locked and the list is back
+	waitForText(t, tm, "Select Bottle")
+	if info := currentMount(bottle); info != nil {
+		t.Fatalf("bottle still mounted at %s after its app exited", info.MountPoint)
+	}
+	if _, err := os.Stat(filepath.Join(info.MountPoint, ".mock-last-run")); err != nil {
+		t.Errorf("app did not run in the bottle: %v", err)
+	}
+
+	tm.Type("q")
+	final := tm.FinalModel(t, teatest.WithFinalTimeout(waitTimeout)).(model)
+	if final.state != viewBottleList {
+		t.Errorf("final view = %d, want the bottle list", final.state)
+	}
+	if final.mountInfo != nil || final.bottleLock != nil {
+		t.Error("session still holds the bottle after quitting")
+	}
+}
+
+func TestQuitWhileRunningLocksBottle(t *testing.T) {
+	tm := newMockTUI(t)
+	bottle := createMockBottle(t, tm, "notes", "pw")
+
+	enter(tm)
+	waitForText(t, tm, "Bottle: notes")
+	enter(tm)
+	waitForText(t, tm, "Select Application")
+	enter(tm)
+	waitForText(t, tm, "Ready to launch")
+	enter(tm)
+	waitForText(t, tm, "Enter bottle password")
+	tm.Type("pw")
+	enter(tm)
+	waitForText(t, tm, "Running ")
+	if currentMount(bottle) == nil {
+		t.Fatal("bottle not mounted while its app runs")
+	}
+
+	// Quitting asks first, then closes the app and locks the bottle
+	tm.Send(tea.KeyMsg{Type: tea.KeyCtrlC})
+	waitForText(t, tm, "is still running")
+	tm.Type("y")
+	tm.WaitFinished(t, teatest.WithFinalTimeout(waitTimeout))
+	if info := currentMount(bottle); info != nil {
+		t.Fatalf("bottle still mounted at %s after quitting", info.MountPoint)
+	}
+}
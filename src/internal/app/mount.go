@@ -0,0 +1,501 @@
+// Mount operations for LUKS bottles, through udisks2 or privilege escalation.
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"bottle-launch/internal/sysfs"
+	"bottle-launch/internal/wait"
+)
+
+// MountInfo holds the state of a mounted bottle
+type MountInfo struct {
+	LoopDevice      string
+	CleartextDevice string
+	MountPoint      string
+	BottlePath      string
+	Unlocked        bool   // true if this mount decrypted the bottle (vs. reusing an unlocked one)
+	Backend         string // backend that mounted it ("" = LUKS)
+	Scanned         bool   // the malware scan before locking already ran
+}
+
+// KeyProvider supplies the key that unlocks a LUKS bottle. Each way of
+// unlocking is one; mountLUKS takes the same steps for all of them.
+type KeyProvider interface {
+	// Key returns the key, or nil to have udisks or cryptsetup ask for it
+	Key(ctx context.Context) ([]byte, error)
+	// WrongKey is the error for a key the bottle rejects
+	WrongKey() error
+}
+
+// passwordKey is a passphrase, typed or from a password manager
+type passwordKey string
+
+func (p passwordKey) Key(context.Context) ([]byte, error) {
+	if p == "" {
+		return nil, nil
+	}
+	return []byte(p), nil
+}
+
+func (passwordKey) WrongKey() error { return errWrongPassword }
+
+// fido2Key is the secret a FIDO2 key derived for the bottle
+type fido2Key []byte
+
+func (f fido2Key) Key(context.Context) ([]byte, error) { return f, nil }
+
+func (fido2Key) WrongKey() error { return errWrongYubiKey }
+
+// keyfileKey is the key file on a key drive bottle's drive, read when the
+// bottle is unlocked
+type keyfileKey struct {
+	bottle string
+	perms  *Permissions
+}
+
+func (k keyfileKey) Key(context.Context) ([]byte, error) {
+	key, err := readDriveKey(k.perms)
+	if err == errKeyDriveMissing {
+		return nil, &bottleError{op: "key drive", msg: "plug in " + keyDriveName(k.perms) + " to unlock " + bottleName(k.bottle)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(key), nil
+}
+
+func (k keyfileKey) WrongKey() error { return wrongDriveKeyError(k.perms) }
+
+// recoveryKey is a recovery key (recovery --new-key), standing in for a
+// lost YubiKey or key drive
+type recoveryKey string
+
+func (r recoveryKey) Key(context.Context) ([]byte, error) { return []byte(r), nil }
+
+func (recoveryKey) WrongKey() error { return errWrongRecoveryKey }
+
+// mountStrategy carries out the steps of mountLUKS and unmountLUKS: through
+// udisks2, or without it with losetup, cryptsetup and mount through
+// privilege escalation
+type mountStrategy interface {
+	// attach sets up a loop device for a bottle file
+	attach(ctx context.Context, file string) (string, error)
+	// unlock opens a LUKS device and returns its cleartext device, or
+	// errKeyRejected. With a nil key, the tool asks for it.
+	unlock(ctx context.Context, bottle, device string, key []byte) (string, error)
+	// mount mounts a cleartext device and returns the mount point; out is
+	// the tool's output, for error messages
+	mount(ctx context.Context, bottle, device string) (mountPoint string, out []byte, err error)
+	// lock closes a cleartext device on top of loop
+	lock(loop, cleartext string) ([]byte, error)
+	// detach deletes a loop device
+	detach(loop string) ([]byte, error)
+}
+
+// errKeyRejected is a mountStrategy's unlock failing on the key; mountLUKS
+// turns it into the KeyProvider's error
+var errKeyRejected = errors.New("key rejected")
+
+// luksMountStrategy returns udisks2 if it is installed, or privilege
+// escalation
+func luksMountStrategy() mountStrategy {
+	if haveUdisks() {
+		return udisksStrategy{}
+	}
+	return privStrategy{}
+}
+
+// mountLUKS attaches, unlocks and mounts a LUKS bottle with the key from
+// key, reusing whatever is already open. Any failure, or cancelling ctx,
+// undoes its steps.
+func mountLUKS(ctx context.Context, bottle string, key KeyProvider) (_ *MountInfo, err error) {
+	// Also needed by growBottle when the bottle is already unlocked
+	secret, err := key.Key(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s := luksMountStrategy()
+	realPath, err := filepath.Abs(bottle)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &MountInfo{BottlePath: realPath, Backend: BackendLUKS}
+
+	// Check if already mounted
+	info.LoopDevice = findLoopForFile(realPath)
+	if info.LoopDevice != "" {
+		info.CleartextDevice = sysfs.CryptHolder(info.LoopDevice)
+		if info.CleartextDevice != "" {
+			info.MountPoint = sysfs.MountPoint(info.CleartextDevice)
+			if info.MountPoint != "" {
+				// Already fully mounted
+				return info, nil
+			}
+		}
+	}
+	had := *info
+	defer func() {
+		if err != nil {
+			undoMount(s, had)
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+		}
+	}()
+
+	// Setup loop device if needed (block device bottles are used directly)
+	if info.LoopDevice == "" {
+		info.LoopDevice = blockDevicePath(realPath)
+	}
+	if info.LoopDevice == "" {
+		if info.LoopDevice, err = s.attach(ctx, realPath); err != nil {
+			return nil, err
+		}
+	}
+
+	unlock := func() error {
+		cleartext, err := s.unlock(ctx, realPath, info.LoopDevice, secret)
+		if err == errKeyRejected {
+			return key.WrongKey()
+		}
+		if err != nil {
+			return err
+		}
+		info.CleartextDevice, info.Unlocked = cleartext, true
+		return nil
+	}
+	if info.CleartextDevice == "" {
+		if err := unlock(); err != nil {
+			return nil, err
+		}
+	}
+
+	mountPoint, out, err := s.mount(ctx, realPath, info.CleartextDevice)
+	if err != nil && strings.Contains(string(out), "Error looking up object for device") {
+		// Stale dm device; relock + unlock to refresh udisks state, then retry mount.
+		_, _ = s.lock(info.LoopDevice, info.CleartextDevice)
+		if err := unlock(); err != nil {
+			return nil, err
+		}
+		mountPoint, out, err = s.mount(ctx, realPath, info.CleartextDevice)
+	}
+	if err != nil {
+		return nil, mountFailure(out, err)
+	}
+	info.MountPoint = mountPoint
+
+	growBottle(info, secret)
+	return info, nil
+}
+
+// udisksStrategy mounts through udisks2, which asks for missing keys
+// through polkit
+type udisksStrategy struct{}
+
+func (udisksStrategy) attach(ctx context.Context, file string) (string, error) {
+	out, err := commandContext(ctx, "udisksctl", "loop-setup", "-f", file).CombinedOutput()
+	if err != nil {
+		return "", udisksFailure("loop-setup", out)
+	}
+	// Parse: Mapped file ... as /dev/loop0.
+	re := regexp.MustCompile(`/dev/loop\d+`)
+	match := re.FindString(string(out))
+	if match == "" {
+		return "", &mountError{op: "loop-setup", msg: "could not parse loop device"}
+	}
+	return match, nil
+}
+
+func (udisksStrategy) unlock(ctx context.Context, _, device string, key []byte) (string, error) {
+	unlockCmd := commandContext(ctx, "udisksctl", "unlock", "-b", device)
+	if key != nil {
+		unlockCmd = commandContext(ctx, "udisksctl", "unlock", "-b", device, "--key-file", "/dev/stdin")
+		unlockCmd.Stdin = bytes.NewReader(key)
+	}
+	out, err := unlockCmd.CombinedOutput()
+	if err != nil {
+		outStr := string(out)
+		// Check for wrong key
+		if strings.Contains(outStr, "Failed to activate device") ||
+			strings.Contains(outStr, "No key available") ||
+			strings.Contains(outStr, "passphrase") {
+			return "", errKeyRejected
+		}
+		return "", &mountError{op: "unlock", msg: outStr}
+	}
+
+	// Parse: Unlocked /dev/loop0 as /dev/dm-0.
+	re := regexp.MustCompile(`/dev/dm-\d+`)
+	match := re.FindString(string(out))
+	if match == "" {
+		return "", &mountError{op: "unlock", msg: "could not parse cleartext device"}
+	}
+	return match, nil
+}
+
+func (udisksStrategy) mount(ctx context.Context, bottle, device string) (string, []byte, error) {
+	return mountFilesystem(ctx, bottle, device)
+}
+
+func (udisksStrategy) lock(loop, _ string) ([]byte, error) {
+	return command("udisksctl", "lock", "-b", loop).CombinedOutput()
+}
+
+func (udisksStrategy) detach(loop string) ([]byte, error) {
+	return command("udisksctl", "loop-delete", "-b", loop).CombinedOutput()
+}
+
+// mountBottleFIDO2 mounts a bottle using a FIDO2-derived secret
+func mountBottleFIDO2(ctx context.Context, bottle string, secret []byte) (*MountInfo, error) {
+	if mockMode {
+		return mockBackend{}.Mount(ctx, bottle, hex.EncodeToString(secret))
+	}
+	return mountLUKS(ctx, bottle, fido2Key(secret))
+}
+
+// fixedMountPoint returns where a bottle is mounted instead of the udisks
+// default (/run/media/<user>/<label>): its PREF_MOUNT_POINT, or <name> in
+// the global MOUNT_DIR, or "" to let udisks choose
+func fixedMountPoint(bottle string) string {
+	// Unchecked: a changed config is refused where it would be used
+	if dir := readPermissions(getConfigPath(bottle)).MountPoint; dir != "" {
+		return expandHome(dir)
+	}
+	if dir := globalConfig.Get("MOUNT_DIR"); dir != "" {
+		return filepath.Join(expandHome(dir), strings.TrimSuffix(bottleName(bottle), ".bottle"))
+	}
+	return ""
+}
+
+// expandHome replaces a leading ~/ with the user's home directory
+func expandHome(path string) string {
+	if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(path, "~/") {
+		return filepath.Join(home, path[2:])
+	}
+	return path
+}
+
+// mountFilesystem mounts a bottle's cleartext device and returns the mount
+// point. udisks can't mount at a chosen path, so fixed mount points are
+// mounted with privilege escalation (and handed to the user, like udisks
+// does) instead. out is the tool's output, for error messages.
+func mountFilesystem(ctx context.Context, bottle, device string) (mountPoint string, out []byte, err error) {
+	target := fixedMountPoint(bottle)
+	if target == "" {
+		out, err = commandContext(ctx, "udisksctl", "mount", "-b", device,
+			"--options", "nodev,nosuid,noexec").CombinedOutput()
+		if err != nil {
+			return "", out, err
+		}
+		// The mount table has the exact path; udisksctl's message
+		// (Mounted /dev/dm-0 at /run/media/user/My Work.) is the fallback
+		mountPoint = sysfs.MountPoint(device)
+		if mountPoint == "" {
+			_, at, found := strings.Cut(strings.TrimSpace(string(out)), " at ")
+			if !found || !strings.HasPrefix(at, "/") {
+				return "", out, &mountError{op: "mount", msg: "could not parse mount point"}
+			}
+			mountPoint = strings.TrimSuffix(at, ".")
+		}
+		claimOwnership(mountPoint)
+		relabelMount(mountPoint)
+		return mountPoint, out, nil
+	}
+	if out, err = privMount(ctx, device, target); err != nil {
+		return "", out, err
+	}
+	return target, out, nil
+}
+
+// undoMount undoes what a failed or cancelled mount did, given what was
+// open before it began. The step it was waiting on may have finished just
+// as it was stopped, so the devices are looked up again.
+func undoMount(s mountStrategy, had MountInfo) {
+	loop := had.LoopDevice
+	if loop == "" {
+		loop = blockDevicePath(had.BottlePath)
+	}
+	if loop == "" {
+		loop = findLoopForFile(had.BottlePath)
+	}
+	if loop == "" {
+		return
+	}
+	if dev := sysfs.CryptHolder(loop); dev != "" {
+		if mountPoint := sysfs.MountPoint(dev); mountPoint != "" {
+			_ = unmountFilesystemCmd(&MountInfo{BottlePath: had.BottlePath, CleartextDevice: dev, MountPoint: mountPoint}, false).Run()
+		}
+		if had.CleartextDevice == "" {
+			_, _ = s.lock(loop, dev)
+		}
+	}
+	if had.LoopDevice == "" && isLoopDevice(loop) {
+		_, _ = s.detach(loop)
+	}
+}
+
+// mountFailure turns a failed mountFilesystem into an error
+func mountFailure(out []byte, err error) error {
+	var mErr *mountError
+	if errors.As(err, &mErr) {
+		return mErr
+	}
+	return &mountError{op: "mount", msg: string(out)}
+}
+
+// unmountFilesystemCmd returns the command that unmounts a bottle's
+// filesystem: udisks for its own mounts, umount for fixed mount points and
+// when udisks is not installed
+func unmountFilesystemCmd(info *MountInfo, force bool) *exec.Cmd {
+	if !haveUdisks() || (info.MountPoint != "" && info.MountPoint == fixedMountPoint(info.BottlePath)) {
+		if force {
+			return privCmd("umount", "--lazy", info.MountPoint)
+		}
+		return privCmd("umount", info.MountPoint)
+	}
+	if force {
+		return command("udisksctl", "unmount", "-b", info.CleartextDevice, "--force")
+	}
+	return command("udisksctl", "unmount", "-b", info.CleartextDevice)
+}
+
+// unmountLUKS unmounts and locks a LUKS bottle
+func unmountLUKS(info *MountInfo) error {
+	if info == nil {
+		return nil
+	}
+	s := luksMountStrategy()
+
+	// Sync filesystem - critical for data persistence
+	if info.MountPoint != "" {
+		if err := command("sync", "-f", info.MountPoint).Run(); err != nil {
+			// Log but continue - sync failure is concerning but we should still try to unmount
+		}
+	}
+
+	// Unmount with retry and force fallback
+	if info.CleartextDevice != "" && info.MountPoint != "" {
+		out, err := unmountFilesystemCmd(info, false).CombinedOutput()
+		if err != nil {
+			// Report processes holding files open instead of forcing the mount away under them
+			if busy := checkBusy(info.MountPoint); busy != nil {
+				return busy
+			}
+			// Try lazy unmount as fallback (e.g. stale handles with no process behind them)
+			out2, err2 := unmountFilesystemCmd(info, true).CombinedOutput()
+			if err2 != nil {
+				return &mountError{op: "unmount", msg: string(out) + "; force: " + string(out2)}
+			}
+		}
+		// Mount points made for the bottle go with it
+		if info.MountPoint == privMountPoint(info.BottlePath) && info.MountPoint != fixedMountPoint(info.BottlePath) {
+			os.Remove(info.MountPoint)
+		}
+	}
+
+	// Lock, once the kernel has released the dm device (lockAfterUnmount)
+	if info.LoopDevice != "" && info.CleartextDevice != "" {
+		out, err := lockAfterUnmount(info.CleartextDevice, func() ([]byte, error) {
+			return s.lock(info.LoopDevice, info.CleartextDevice)
+		})
+		if err != nil {
+			return &mountError{op: "lock", msg: string(out)}
+		}
+	}
+
+	// Remove loop
+	if isLoopDevice(info.LoopDevice) {
+		if out, err := s.detach(info.LoopDevice); err != nil {
+			return &mountError{op: "loop-delete", msg: string(out)}
+		}
+	}
+
+	// Fingerprint the now-quiet file so outside changes show up at next unlock
+	if info.BottlePath != "" && info.CleartextDevice != "" {
+		_ = recordLockedState(info.BottlePath)
+	}
+
+	return nil
+}
+
+// lockAfterUnmount runs lock until it succeeds or UnmountReleaseWait has
+// passed. The kernel may not have let go of the dm device right after its
+// filesystem was unmounted; when it does, the device changes, so each
+// retry waits for a change to it, or UnmountRetryDelay at most.
+func lockAfterUnmount(device string, lock func() ([]byte, error)) ([]byte, error) {
+	events := wait.NewDeviceEvents()
+	defer events.Close()
+	name := sysfs.BlockDevName(device)
+	deadline := time.Now().Add(UnmountReleaseWait)
+	for {
+		out, err := lock()
+		left := time.Until(deadline)
+		if err == nil || left <= 0 {
+			return out, err
+		}
+		events.WaitFor(name, min(left, UnmountRetryDelay))
+	}
+}
+
+// udisksUnmountOnly unmounts a bottle's filesystem but leaves it unlocked.
+// Backends without a separate unlocked state are locked as well.
+func udisksUnmountOnly(info *MountInfo) error {
+	if info == nil || info.MountPoint == "" {
+		return nil
+	}
+	if info.Backend != "" && info.Backend != BackendLUKS {
+		return unmountBottle(info)
+	}
+
+	_ = command("sync", "-f", info.MountPoint).Run()
+	if out, err := unmountFilesystemCmd(info, false).CombinedOutput(); err != nil {
+		if busy := checkBusy(info.MountPoint); busy != nil {
+			return busy
+		}
+		return &mountError{op: "unmount", msg: string(out)}
+	}
+	return nil
+}
+
+// Errors
+type mountError struct {
+	op    string
+	msg   string
+	class errorClass // kind of failure, if not classError
+}
+
+func (e *mountError) Error() string {
+	return e.op + ": " + e.msg
+}
+
+func (e *mountError) category() errorClass {
+	return e.class
+}
+
+var (
+	errWrongPassword    = &mountError{op: "unlock", msg: "wrong password", class: classWrongPassword}
+	errWrongYubiKey     = &mountError{op: "unlock", msg: "wrong YubiKey - use the key that created this bottle", class: classFIDO2}
+	errWrongRecoveryKey = &mountError{op: "unlock", msg: "wrong recovery key", class: classWrongPassword}
+)
+
+// udisksFailure turns the output of a failed udisksctl into an error,
+// recognizing a udisks2 service that isn't running
+func udisksFailure(op string, out []byte) *mountError {
+	err := &mountError{op: op, msg: string(out)}
+	lower := strings.ToLower(err.msg)
+	if strings.Contains(lower, "serviceunknown") || strings.Contains(lower, "org.freedesktop.udisks2 was not provided") {
+		err.class = classMissingTool
+	}
+	return err
+}
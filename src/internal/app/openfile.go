@@ -0,0 +1,67 @@
+// Opening host files in bottled apps: copying them into the bottle's inbox.
+package app
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// inboxDir is where files opened with `run --open` are copied, relative to
+// the bottle's mount point
+const inboxDir = "Inbox"
+
+// checkOpenFile makes sure a host file can be opened in a bottle
+func checkOpenFile(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return &bottleError{op: "open", msg: err.Error()}
+	}
+	if !fi.Mode().IsRegular() {
+		return &bottleError{op: "open", msg: path + " is not a regular file"}
+	}
+	return nil
+}
+
+// copyIntoBottle copies a host file into the bottle's inbox and returns its
+// path there, which is also its path inside the sandbox. An existing file of
+// the same name is kept; the copy gets a numbered name instead.
+func copyIntoBottle(path, mountPoint string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", &bottleError{op: "open", msg: err.Error()}
+	}
+	defer src.Close()
+
+	dir := filepath.Join(mountPoint, inboxDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", &bottleError{op: "open", msg: err.Error()}
+	}
+
+	name := filepath.Base(path)
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		target := filepath.Join(dir, name)
+		dst, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			name = stem + " (" + strconv.Itoa(i) + ")" + ext
+			continue
+		}
+		if err != nil {
+			return "", &bottleError{op: "open", msg: err.Error()}
+		}
+		if _, err := io.Copy(dst, src); err != nil {
+			dst.Close()
+			os.Remove(target)
+			return "", &bottleError{op: "open", msg: "copying " + path + ": " + err.Error()}
+		}
+		if err := dst.Close(); err != nil {
+			os.Remove(target)
+			return "", &bottleError{op: "open", msg: err.Error()}
+		}
+		return target, nil
+	}
+}
@@ -0,0 +1,261 @@
+// Flatpak overrides: exporting a bottle's permissions as a flatpak override file, and importing them back.
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// overrideToggle maps a permission to the [Context] list entry that grants
+// it; the first name is the one exported
+type overrideToggle struct {
+	pref  string // permission key, as in permissionToggle
+	key   string
+	names []string
+}
+
+var overrideToggles = []overrideToggle{
+	{pref: "PREF_NETWORK", key: "shared", names: []string{"network"}},
+	{pref: "PREF_AUDIO", key: "sockets", names: []string{"pulseaudio"}},
+	{pref: "PREF_GPU", key: "devices", names: []string{"dri"}},
+	{pref: "PREF_WAYLAND", key: "sockets", names: []string{"wayland"}},
+	{pref: "PREF_X11", key: "sockets", names: []string{"fallback-x11", "x11"}},
+	// flatpak has no camera-only device; webcams need all devices
+	{pref: "PREF_CAMERA", key: "devices", names: []string{"all"}},
+	{pref: "PREF_PRINTING", key: "sockets", names: []string{"cups"}},
+}
+
+// busToggle maps a permission to the session bus names it lets the app
+// talk to (or own)
+type busToggle struct {
+	pref   string
+	policy string // "talk" or "own"
+	names  []string
+}
+
+var busToggles = []busToggle{
+	{pref: "PREF_PORTALS", policy: "talk", names: []string{
+		"org.freedesktop.portal.Desktop",
+		"org.freedesktop.portal.Notification",
+		"org.freedesktop.portal.FileChooser",
+	}},
+	{pref: "PREF_ACCESSIBILITY", policy: "talk", names: []string{"org.a11y.Bus"}},
+	{pref: "PREF_INPUT_METHODS", policy: "talk", names: []string{
+		"org.freedesktop.portal.IBus",
+		"org.freedesktop.portal.Fcitx",
+		"org.fcitx.Fcitx5",
+	}},
+	{pref: "PREF_NOTIFICATIONS", policy: "talk", names: []string{"org.freedesktop.Notifications"}},
+	// Players own org.mpris.MediaPlayer2.<name>; the desktop finds them there
+	{pref: "PREF_MPRIS", policy: "own", names: []string{"org.mpris.MediaPlayer2.*"}},
+}
+
+// flatpakOverridesDir returns where flatpak keeps per-user override files
+func flatpakOverridesDir() string {
+	if mockMode {
+		return filepath.Join(bottleDir, ".flatpak-overrides")
+	}
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, _ := os.UserHomeDir()
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataHome, "flatpak", "overrides")
+}
+
+// keyFile is a GLib key file kept as lines, so edits keep comments, order,
+// and entries it doesn't know
+type keyFile struct {
+	lines []string
+}
+
+// readKeyFile reads a key file; a missing file is empty
+func readKeyFile(path string) (*keyFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	k := &keyFile{}
+	if len(data) > 0 {
+		k.lines = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	}
+	return k, nil
+}
+
+// find returns the line index of key in section, and the index to insert it
+// at if it is missing (-1 if the section is missing too)
+func (k *keyFile) find(section, key string) (line, insert int) {
+	line, insert = -1, -1
+	current := ""
+	for i, l := range k.lines {
+		trimmed := strings.TrimSpace(l)
+		if strings.HasPrefix(trimmed, "[") {
+			current = strings.Trim(trimmed, "[]")
+			continue
+		}
+		if current != section {
+			continue
+		}
+		if trimmed != "" {
+			insert = i + 1
+		} else if insert < 0 {
+			insert = i
+		}
+		if name, _, ok := strings.Cut(l, "="); ok && strings.TrimSpace(name) == key {
+			line = i
+		}
+	}
+	if insert < 0 {
+		// An empty section ends right after its header
+		for i, l := range k.lines {
+			if strings.TrimSpace(l) == "["+section+"]" {
+				insert = i + 1
+			}
+		}
+	}
+	return line, insert
+}
+
+// Get returns the value of key in section
+func (k *keyFile) Get(section, key string) (string, bool) {
+	line, _ := k.find(section, key)
+	if line < 0 {
+		return "", false
+	}
+	_, value, _ := strings.Cut(k.lines[line], "=")
+	return strings.TrimSpace(value), true
+}
+
+// Set sets key in section, adding the section at the end if needed
+func (k *keyFile) Set(section, key, value string) {
+	entry := key + "=" + value
+	line, insert := k.find(section, key)
+	switch {
+	case line >= 0:
+		k.lines[line] = entry
+	case insert >= 0:
+		k.lines = slices.Insert(k.lines, insert, entry)
+	default:
+		if len(k.lines) > 0 {
+			k.lines = append(k.lines, "")
+		}
+		k.lines = append(k.lines, "["+section+"]", entry)
+	}
+}
+
+// String returns the file's contents
+func (k *keyFile) String() string {
+	return strings.Join(k.lines, "\n") + "\n"
+}
+
+// splitKeyList splits a key file list value ("a;b;")
+func splitKeyList(value string) []string {
+	return slices.DeleteFunc(strings.Split(value, ";"), func(s string) bool { return strings.TrimSpace(s) == "" })
+}
+
+// exportOverrides sets a bottle's permissions in an override key file
+func exportOverrides(k *keyFile, perms *Permissions) {
+	for _, key := range []string{"shared", "sockets", "devices"} {
+		current, _ := k.Get("Context", key)
+		var managed, entries []string
+		for _, t := range overrideToggles {
+			if t.key != key {
+				continue
+			}
+			managed = append(managed, t.names...)
+			if *permissionToggle(perms, t.pref) {
+				entries = append(entries, t.names[0])
+			} else {
+				for _, name := range t.names {
+					entries = append(entries, "!"+name)
+				}
+			}
+		}
+		kept := slices.DeleteFunc(splitKeyList(current), func(s string) bool {
+			return slices.Contains(managed, strings.TrimPrefix(s, "!"))
+		})
+		k.Set("Context", key, strings.Join(append(kept, entries...), ";")+";")
+	}
+	for _, t := range busToggles {
+		policy := "none"
+		if *permissionToggle(perms, t.pref) {
+			policy = t.policy
+		}
+		for _, name := range t.names {
+			k.Set("Session Bus Policy", name, policy)
+		}
+	}
+}
+
+// importOverrides applies the permissions an override key file sets to perms;
+// those it doesn't mention keep their value
+func importOverrides(k *keyFile, perms *Permissions) {
+	for _, t := range overrideToggles {
+		value, _ := k.Get("Context", t.key)
+		for _, entry := range splitKeyList(value) {
+			name, negated := strings.CutPrefix(strings.TrimSpace(entry), "!")
+			if slices.Contains(t.names, name) {
+				*permissionToggle(perms, t.pref) = !negated
+			}
+		}
+	}
+	for _, t := range busToggles {
+		if policy, ok := k.Get("Session Bus Policy", t.names[0]); ok {
+			*permissionToggle(perms, t.pref) = policy == t.policy || policy == "own"
+		}
+	}
+}
+
+// cmdFlatpakOverride exports a bottle's permissions to the app's flatpak
+// override file, or imports them from it
+func cmdFlatpakOverride(direction, bottle, appArg string) error {
+	bottle = resolveBottlePath(bottle)
+	if _, err := os.Stat(bottle); err != nil {
+		return errBottleNotFound
+	}
+	appID := parseAppRef(appArg).ID
+	path := filepath.Join(flatpakOverridesDir(), appID)
+	configPath := getConfigPath(bottle)
+	perms := loadPermissions(configPath)
+
+	k, err := readKeyFile(path)
+	if err != nil {
+		return &bottleError{op: "flatpak-override", msg: err.Error()}
+	}
+	switch direction {
+	case "export":
+		exportOverrides(k, perms)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return &bottleError{op: "flatpak-override", msg: err.Error()}
+		}
+		if err := replaceFile(path, k.String()); err != nil {
+			return &bottleError{op: "flatpak-override", msg: "could not write " + path}
+		}
+		fmt.Println("Wrote " + bottleName(bottle) + "'s permissions to " + path)
+		fmt.Println("flatpak applies them whenever " + appID + " runs, also outside bottle-launch.")
+		return nil
+	case "import":
+		if len(k.lines) == 0 {
+			return &bottleError{op: "flatpak-override", msg: "no override file for " + appID + " (" + path + ")"}
+		}
+		before := perms.Summary()
+		importOverrides(k, perms)
+		if err := savePermissions(configPath, perms); err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s -> %s\n", bottleName(bottle), orNone(before), orNone(perms.Summary()))
+		return nil
+	}
+	return &bottleError{op: "flatpak-override", msg: "expected export or import, got " + direction, usage: true}
+}
+
+// orNone returns s, or "none" if it is empty
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
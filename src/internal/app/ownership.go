@@ -0,0 +1,39 @@
+// Ownership: handing a mounted bottle's files to the user when another UID owns them.
+package app
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// ext4RootOwner is the mkfs.ext4 -E option giving the user the new
+// filesystem's root, which mkfs (run as root) would otherwise own
+func ext4RootOwner() string {
+	return "root_owner=" + strconv.Itoa(os.Getuid()) + ":" + strconv.Itoa(os.Getgid())
+}
+
+// claimOwnership gives the user the root of a mounted bottle made before
+// filesystems were created with the user as owner. With FIX_OWNERSHIP=1, the
+// files of another UID owning the root are handed over too. Best-effort: a
+// failure leaves the bottle mounted as it is.
+func claimOwnership(mountPoint string) {
+	fi, err := os.Stat(mountPoint)
+	if err != nil {
+		return
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || int(st.Uid) == os.Getuid() {
+		return
+	}
+	owner := strconv.Itoa(os.Getuid()) + ":" + strconv.Itoa(os.Getgid())
+	if st.Uid == 0 {
+		_ = privCmd("chown", owner, mountPoint).Run()
+		return
+	}
+	// Walks the whole filesystem, so only when asked for
+	if globalConfig.Get("FIX_OWNERSHIP") != "1" {
+		return
+	}
+	_ = privCmd("chown", "-R", "--from="+strconv.FormatUint(uint64(st.Uid), 10), owner, mountPoint).Run()
+}
@@ -0,0 +1,110 @@
+// Password helpers: strength estimation and passphrase generation for bottle creation.
+package app
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"unicode"
+)
+
+// passphraseAlphabet omits look-alike characters (0/o, 1/l/i) so generated
+// passphrases are easy to copy by hand
+const passphraseAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// generatePassphrase returns a random passphrase of dash-separated groups,
+// e.g. "k7fqm-2mxpa-...", with roughly 99 bits of entropy
+func generatePassphrase() (string, error) {
+	const groups, groupLen = 4, 5
+	alphabetSize := big.NewInt(int64(len(passphraseAlphabet)))
+
+	parts := make([]string, groups)
+	for g := range parts {
+		var sb strings.Builder
+		for i := 0; i < groupLen; i++ {
+			n, err := rand.Int(rand.Reader, alphabetSize)
+			if err != nil {
+				return "", fmt.Errorf("generate passphrase: %w", err)
+			}
+			sb.WriteByte(passphraseAlphabet[n.Int64()])
+		}
+		parts[g] = sb.String()
+	}
+	return strings.Join(parts, "-"), nil
+}
+
+// passwordEntropy estimates the entropy of a password in bits from the
+// character classes it uses. Immediately repeated characters add nothing.
+func passwordEntropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	effectiveLen := 0
+	var prev rune
+	for i, r := range password {
+		switch {
+		case r < unicode.MaxASCII && unicode.IsLower(r):
+			lower = true
+		case r < unicode.MaxASCII && unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+		if i == 0 || r != prev {
+			effectiveLen++
+		}
+		prev = r
+	}
+
+	pool := 0
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if symbol {
+		pool += 33
+	}
+	if other {
+		pool += 100
+	}
+	if pool == 0 {
+		return 0
+	}
+	return float64(effectiveLen) * math.Log2(float64(pool))
+}
+
+// passwordStrength renders a short strength meter, e.g. "████░░░░░░ fair (~45 bits)"
+func passwordStrength(password string) string {
+	if password == "" {
+		return ""
+	}
+
+	bits := passwordEntropy(password)
+	var label string
+	switch {
+	case bits < 28:
+		label = "very weak"
+	case bits < 36:
+		label = "weak"
+	case bits < 60:
+		label = "fair"
+	case bits < 80:
+		label = "strong"
+	default:
+		label = "very strong"
+	}
+
+	const cells = 10
+	filled := int(math.Min(bits/10, cells))
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", cells-filled)
+	return fmt.Sprintf("%s %s (~%.0f bits)", bar, label, bits)
+}
@@ -0,0 +1,681 @@
+// Permission settings: loading, saving, and toggling sandbox permissions for bottles.
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PermissionDef defines a permission with its metadata
+type PermissionDef struct {
+	Name   string // Variable name (e.g., "Network")
+	Key    string // Shortcut key (e.g., "n")
+	Label  string // Display label (e.g., "Network")
+	Config string // Config file key (e.g., "PREF_NETWORK")
+}
+
+var permissionDefs = []PermissionDef{
+	{Name: "Network", Key: "n", Label: "Network", Config: "PREF_NETWORK"},
+	{Name: "Audio", Key: "a", Label: "Audio", Config: "PREF_AUDIO"},
+	{Name: "GPU", Key: "g", Label: "GPU", Config: "PREF_GPU"},
+	{Name: "Wayland", Key: "w", Label: "Wayland", Config: "PREF_WAYLAND"},
+	{Name: "X11", Key: "x", Label: "X11", Config: "PREF_X11"},
+	{Name: "Camera", Key: "c", Label: "Camera", Config: "PREF_CAMERA"},
+	{Name: "Portals", Key: "p", Label: "Portals", Config: "PREF_PORTALS"},
+	{Name: "Accessibility", Key: "y", Label: "Accessibility bus", Config: "PREF_ACCESSIBILITY"},
+	{Name: "InputMethods", Key: "i", Label: "Input methods (IBus, Fcitx)", Config: "PREF_INPUT_METHODS"},
+	{Name: "Notifications", Key: "o", Label: "Notifications", Config: "PREF_NOTIFICATIONS"},
+	{Name: "MPRIS", Key: "m", Label: "Media controls (MPRIS)", Config: "PREF_MPRIS"},
+	{Name: "Printing", Key: "r", Label: "Printing", Config: "PREF_PRINTING"},
+}
+
+// Permissions holds the permission settings for a bottle
+type Permissions struct {
+	Network bool
+	Audio   bool
+	GPU     bool
+	Wayland bool
+	X11     bool
+	Camera  bool
+	Portals bool
+
+	// Accessibility lets screen readers and other assistive tools see the
+	// app; InputMethods lets it talk to IBus and Fcitx for non-Latin text
+	Accessibility bool
+	InputMethods  bool
+
+	// Notifications and MPRIS grant the desktop notification service and
+	// media controls on their own, without the whole Portals group
+	Notifications bool
+	MPRIS         bool
+
+	// Printing shares the host's CUPS socket
+	Printing bool
+
+	// DNS replaces the sandbox's name servers and Hosts adds "<ip> <name>"
+	// entries to its /etc/hosts (both empty = the host's)
+	DNS   []string
+	Hosts []string
+
+	// Forensics records the files each session adds, changes, and removes
+	// in the audit log
+	Forensics bool
+
+	// Untrusted marks a bottle for untrusted downloads, scanned for malware
+	// before it is locked
+	Untrusted bool
+
+	// Hidden leaves the bottle out of the TUI's list until revealed
+	Hidden bool
+
+	// Description is a free-text note on what the bottle holds
+	Description string
+
+	LastApp string
+
+	// DefaultApp is launched by the quick-launch key in the bottle list
+	DefaultApp string
+
+	// AllowedApps are the only app IDs offered for (and run in) the bottle
+	// unless explicitly overridden (empty = any app)
+	AllowedApps []string
+
+	// LastUsed is the unix time of the last successful launch (0 = never)
+	LastUsed int64
+
+	// Timeout is the maximum session duration before the app is closed and
+	// the bottle locked (0 = unlimited)
+	Timeout time.Duration
+
+	// Locked is the bottle file's fingerprint from when it was last locked
+	Locked lockedState
+
+	// Backend is the bottle's storage backend (empty = LUKS)
+	Backend string
+
+	// Overlay mounts a squashfs bottle with a writable overlay on top
+	Overlay bool
+
+	// MountPoint is a fixed path to mount the bottle at (empty = let udisks
+	// choose, or MOUNT_DIR/<name> from the global config)
+	MountPoint string
+
+	// SecretRef points at the bottle's passphrase in a password manager
+	// (see parseSecretRef; empty = type the password)
+	SecretRef string
+
+	// Quota is a soft limit on the bytes used in the bottle, warned about
+	// while an app runs (0 = none)
+	Quota int64
+
+	// GrowBy, GrowAt and GrowMax are the growth policy: at mount, a LUKS
+	// image bottle more than GrowAt percent full (0 = DefaultGrowAtPercent)
+	// grows by GrowBy bytes (0 = never), up to GrowMax (0 = no limit)
+	GrowBy  int64
+	GrowAt  int
+	GrowMax int64
+
+	// GrowPaused stops growth after one failed with the image file extended
+	GrowPaused bool
+
+	// ReservedPercent is the share of an ext4 bottle reserved for root, as
+	// last set with tune2fs (-1 = the filesystem's default)
+	ReservedPercent int
+
+	// Retention decides which snapshots are pruned, and whether the bottle
+	// is snapshotted on schedule
+	Retention snapshotRetention
+
+	// Sync remembers the rclone remote and both sides' state after the last sync
+	Sync syncState
+
+	// LastUnlockMethod and LastUnlockAt record how and when the bottle was
+	// last decrypted (reusing an existing mount doesn't count)
+	LastUnlockMethod string
+	LastUnlockAt     int64
+
+	// FIDO2 fields (all empty = password-based bottle)
+	// BottleID is critical: random identifier generated at creation, used as clientDataHash
+	FIDO2BottleID     string
+	FIDO2CredentialID string
+	FIDO2Salt         string
+	FIDO2DeviceHint   string // hint only, re-enumerate on unlock
+	FIDO2RPID         string // relying party ID enrolled with (empty = the default)
+	FIDO2User         string // user name enrolled with (empty = the default)
+
+	// Tampered is set when the config's HMAC is missing or wrong (not saved)
+	Tampered bool
+
+	// Key drive fields (all empty = no key drive): the passphrase is the
+	// contents of KeyDriveFile on the removable filesystem KeyDriveUUID
+	KeyDriveUUID  string
+	KeyDriveLabel string // for prompts only
+	KeyDriveFile  string // path relative to the drive's root
+}
+
+// defaultPermissions returns the default permission set
+func defaultPermissions() *Permissions {
+	return &Permissions{
+		Network: true,
+		Audio:   true,
+		GPU:     true,
+		Wayland: true,
+		X11:     true,
+		Camera:  false,
+		Portals: false,
+
+		ReservedPercent: -1,
+	}
+}
+
+// IsEnabled returns whether the permission at index is enabled
+func (p *Permissions) IsEnabled(index int) bool {
+	switch index {
+	case 0:
+		return p.Network
+	case 1:
+		return p.Audio
+	case 2:
+		return p.GPU
+	case 3:
+		return p.Wayland
+	case 4:
+		return p.X11
+	case 5:
+		return p.Camera
+	case 6:
+		return p.Portals
+	case 7:
+		return p.Accessibility
+	case 8:
+		return p.InputMethods
+	case 9:
+		return p.Notifications
+	case 10:
+		return p.MPRIS
+	case 11:
+		return p.Printing
+	}
+	return false
+}
+
+// Toggle toggles the permission at index
+func (p *Permissions) Toggle(index int) {
+	switch index {
+	case 0:
+		p.Network = !p.Network
+	case 1:
+		p.Audio = !p.Audio
+	case 2:
+		p.GPU = !p.GPU
+	case 3:
+		p.Wayland = !p.Wayland
+	case 4:
+		p.X11 = !p.X11
+	case 5:
+		p.Camera = !p.Camera
+	case 6:
+		p.Portals = !p.Portals
+	case 7:
+		p.Accessibility = !p.Accessibility
+	case 8:
+		p.InputMethods = !p.InputMethods
+	case 9:
+		p.Notifications = !p.Notifications
+	case 10:
+		p.MPRIS = !p.MPRIS
+	case 11:
+		p.Printing = !p.Printing
+	}
+}
+
+// Summary returns a string summary of enabled permissions
+func (p *Permissions) Summary() string {
+	var parts []string
+	if p.Network {
+		parts = append(parts, "Network")
+	}
+	if p.Audio {
+		parts = append(parts, "Audio")
+	}
+	if p.GPU {
+		parts = append(parts, "GPU")
+	}
+	if p.Wayland {
+		parts = append(parts, "Wayland")
+	}
+	if p.X11 {
+		parts = append(parts, "X11")
+	}
+	if p.Camera {
+		parts = append(parts, "Camera")
+	}
+	if p.Portals {
+		parts = append(parts, "Portals")
+	}
+	if p.Accessibility {
+		parts = append(parts, "Accessibility")
+	}
+	if p.InputMethods {
+		parts = append(parts, "InputMethods")
+	}
+	if p.Notifications {
+		parts = append(parts, "Notifications")
+	}
+	if p.MPRIS {
+		parts = append(parts, "MPRIS")
+	}
+	if p.Printing {
+		parts = append(parts, "Printing")
+	}
+	return strings.Join(parts, " ")
+}
+
+// AllowsApp reports whether appID may run in the bottle
+func (p *Permissions) AllowsApp(appID string) bool {
+	return len(p.AllowedApps) == 0 || slices.Contains(p.AllowedApps, appID)
+}
+
+// ToggleAllowedApp adds appID to the allowlist, or removes it if present
+func (p *Permissions) ToggleAllowedApp(appID string) {
+	if i := slices.Index(p.AllowedApps, appID); i >= 0 {
+		p.AllowedApps = slices.Delete(p.AllowedApps, i, i+1)
+	} else {
+		p.AllowedApps = append(p.AllowedApps, appID)
+	}
+}
+
+// loadPermissions loads permissions from a config file
+func loadPermissions(path string) *Permissions {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return defaultPermissions()
+	}
+	p := parsePermissions(data)
+	p.Tampered = configTampered(path, data)
+	return p
+}
+
+// readPermissions loads a config without checking its signature, for
+// read-only reports that must not wait on the keyring. Its settings may have
+// been changed outside bottle-launch: nothing may be run or unlocked by them.
+func readPermissions(path string) *Permissions {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return defaultPermissions()
+	}
+	return parsePermissions(data)
+}
+
+// parsePermissions reads permissions from a config's contents
+func parsePermissions(data []byte) *Permissions {
+	p := defaultPermissions()
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		key := strings.TrimSpace(parts[0])
+		val := strings.TrimSpace(parts[1])
+		boolVal := val == "1" || strings.ToLower(val) == "true"
+
+		switch key {
+		case "PREF_NETWORK":
+			p.Network = boolVal
+		case "PREF_AUDIO":
+			p.Audio = boolVal
+		case "PREF_GPU":
+			p.GPU = boolVal
+		case "PREF_WAYLAND":
+			p.Wayland = boolVal
+		case "PREF_X11":
+			p.X11 = boolVal
+		case "PREF_CAMERA":
+			p.Camera = boolVal
+		case "PREF_PORTALS":
+			p.Portals = boolVal
+		case "PREF_ACCESSIBILITY":
+			p.Accessibility = boolVal
+		case "PREF_INPUT_METHODS":
+			p.InputMethods = boolVal
+		case "PREF_NOTIFICATIONS":
+			p.Notifications = boolVal
+		case "PREF_MPRIS":
+			p.MPRIS = boolVal
+		case "PREF_PRINTING":
+			p.Printing = boolVal
+		case "PREF_LAST_APP":
+			p.LastApp = strings.Trim(val, `"`)
+		case "PREF_DEFAULT_APP":
+			p.DefaultApp = strings.Trim(val, `"`)
+		case "PREF_ALLOWED_APPS":
+			for _, id := range strings.Split(strings.Trim(val, `"`), ",") {
+				if id = strings.TrimSpace(id); id != "" {
+					p.AllowedApps = append(p.AllowedApps, id)
+				}
+			}
+		case "PREF_FORENSICS":
+			p.Forensics = boolVal
+		case "PREF_UNTRUSTED":
+			p.Untrusted = boolVal
+		case "PREF_HIDDEN":
+			p.Hidden = boolVal
+		case "PREF_DESCRIPTION":
+			p.Description = val
+			if unquoted, err := strconv.Unquote(val); err == nil {
+				p.Description = unquoted
+			}
+		case "PREF_DNS":
+			p.DNS = strings.Fields(strings.ReplaceAll(strings.Trim(val, `"`), ",", " "))
+		case "PREF_HOSTS":
+			p.Hosts, _ = parseHostsEntries(strings.Trim(val, `"`))
+		case "PREF_LAST_USED":
+			p.LastUsed, _ = strconv.ParseInt(val, 10, 64)
+		case "PREF_TIMEOUT":
+			p.Timeout, _ = parseTimeout(strings.Trim(val, `"`))
+		case "PREF_LOCKED_SIZE":
+			p.Locked.Size, _ = strconv.ParseInt(val, 10, 64)
+		case "PREF_LOCKED_MTIME":
+			p.Locked.MTime, _ = strconv.ParseInt(val, 10, 64)
+		case "PREF_LOCKED_SHA256":
+			p.Locked.Checksum = strings.Trim(val, `"`)
+		case "BACKEND":
+			p.Backend = strings.Trim(val, `"`)
+		case "PREF_OVERLAY":
+			p.Overlay = val == "1"
+		case "PREF_MOUNT_POINT":
+			p.MountPoint = strings.Trim(val, `"`)
+		case "PREF_QUOTA":
+			p.Quota, _ = strconv.ParseInt(val, 10, 64)
+		case "PREF_GROW_BY":
+			p.GrowBy, _ = strconv.ParseInt(val, 10, 64)
+		case "PREF_GROW_AT":
+			p.GrowAt, _ = strconv.Atoi(val)
+		case "PREF_GROW_MAX":
+			p.GrowMax, _ = strconv.ParseInt(val, 10, 64)
+		case "PREF_GROW_PAUSED":
+			p.GrowPaused = boolVal
+		case "PREF_RESERVED_PERCENT":
+			if n, err := strconv.Atoi(val); err == nil {
+				p.ReservedPercent = n
+			}
+		case "PREF_SNAPSHOT_KEEP_LAST":
+			p.Retention.KeepLast, _ = strconv.Atoi(val)
+		case "PREF_SNAPSHOT_KEEP_DAILY":
+			p.Retention.KeepDaily, _ = strconv.Atoi(val)
+		case "PREF_SNAPSHOT_KEEP_WEEKLY":
+			p.Retention.KeepWeekly, _ = strconv.Atoi(val)
+		case "PREF_SECRET_REF":
+			p.SecretRef = strings.Trim(val, `"`)
+		case "PREF_SYNC_REMOTE":
+			p.Sync.Remote = strings.Trim(val, `"`)
+		case "PREF_SYNC_LOCAL_SIZE":
+			p.Sync.Local.Size, _ = strconv.ParseInt(val, 10, 64)
+		case "PREF_SYNC_LOCAL_MTIME":
+			p.Sync.Local.MTime, _ = strconv.ParseInt(val, 10, 64)
+		case "PREF_SYNC_REMOTE_ID":
+			p.Sync.RemoteID = strings.Trim(val, `"`)
+		case "PREF_LAST_UNLOCK_METHOD":
+			p.LastUnlockMethod = strings.Trim(val, `"`)
+		case "PREF_LAST_UNLOCK_AT":
+			p.LastUnlockAt, _ = strconv.ParseInt(val, 10, 64)
+		case "FIDO2_BOTTLE_ID":
+			p.FIDO2BottleID = strings.Trim(val, `"`)
+		case "FIDO2_CREDENTIAL_ID":
+			p.FIDO2CredentialID = strings.Trim(val, `"`)
+		case "FIDO2_SALT":
+			p.FIDO2Salt = strings.Trim(val, `"`)
+		case "FIDO2_DEVICE_HINT":
+			p.FIDO2DeviceHint = strings.Trim(val, `"`)
+		case "FIDO2_RP_ID":
+			p.FIDO2RPID = strings.Trim(val, `"`)
+		case "FIDO2_USER":
+			p.FIDO2User = strings.Trim(val, `"`)
+		case "KEYDRIVE_UUID":
+			p.KeyDriveUUID = strings.Trim(val, `"`)
+		case "KEYDRIVE_LABEL":
+			p.KeyDriveLabel = strings.Trim(val, `"`)
+		case "KEYDRIVE_FILE":
+			p.KeyDriveFile = strings.Trim(val, `"`)
+		}
+	}
+
+	return p
+}
+
+// recordLastUsed stamps the current time as the bottle's last launch and saves it
+func recordLastUsed(path string, p *Permissions) error {
+	p.LastUsed = time.Now().Unix()
+	return savePermissions(path, p)
+}
+
+// Unlock methods recorded in PREF_LAST_UNLOCK_METHOD
+const (
+	UnlockPassword = "password"         // passphrase typed into the TUI
+	UnlockYubiKey  = "yubikey"          // FIDO2 hmac-secret
+	UnlockPolkit   = "polkit"           // passphrase prompted by udisks (CLI)
+	UnlockManager  = "password-manager" // passphrase looked up via PREF_SECRET_REF
+	UnlockDialog   = "dialog"           // passphrase typed into a graphical prompt (no terminal)
+	UnlockKeyDrive = "key-drive"        // key file read from a removable drive
+	UnlockRecovery = "recovery-key"     // recovery key typed in place of a YubiKey or key drive
+)
+
+// recordUnlock stamps how and when the bottle was decrypted and saves it
+func recordUnlock(path string, p *Permissions, method string) error {
+	p.LastUnlockMethod = method
+	p.LastUnlockAt = time.Now().Unix()
+	return savePermissions(path, p)
+}
+
+// savePermissions saves permissions to a config file
+func savePermissions(path string, p *Permissions) error {
+	return savePermissionsAtomic(path, p)
+}
+
+// savePermissionsAtomic saves permissions atomically (write to temp, fsync, rename)
+// This is critical for FIDO2 bottles to avoid data loss on crash
+func savePermissionsAtomic(path string, p *Permissions) error {
+	os.MkdirAll(filepath.Dir(path), 0700)
+
+	// Sign the config last, over everything above. A changed config stays
+	// unsigned until it is trusted, whatever else gets saved into it.
+	lines := permissionLines(p)
+	content := strings.Join(lines, "\n") + "\n"
+	if mac := signConfig(path, []byte(content)); mac != "" && !p.Tampered {
+		lines = append(lines, mac)
+	}
+
+	// Write to temp file first
+	tempFile, err := os.CreateTemp(filepath.Dir(path), ".bottle-config-*.tmp")
+	if err != nil {
+		return err
+	}
+	tempPath := tempFile.Name()
+
+	for _, line := range lines {
+		if _, err := tempFile.WriteString(line + "\n"); err != nil {
+			tempFile.Close()
+			os.Remove(tempPath)
+			return err
+		}
+	}
+
+	// Sync to disk
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	tempFile.Close()
+
+	// Atomic rename
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	// Sync parent directory to ensure the rename is durable
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	return nil
+}
+
+// permissionLines renders permissions as config lines, without the HMAC
+func permissionLines(p *Permissions) []string {
+	boolToInt := func(b bool) string {
+		if b {
+			return "1"
+		}
+		return "0"
+	}
+
+	lines := []string{
+		"PREF_NETWORK=" + boolToInt(p.Network),
+		"PREF_AUDIO=" + boolToInt(p.Audio),
+		"PREF_GPU=" + boolToInt(p.GPU),
+		"PREF_WAYLAND=" + boolToInt(p.Wayland),
+		"PREF_X11=" + boolToInt(p.X11),
+		"PREF_CAMERA=" + boolToInt(p.Camera),
+		"PREF_PORTALS=" + boolToInt(p.Portals),
+		"PREF_ACCESSIBILITY=" + boolToInt(p.Accessibility),
+		"PREF_INPUT_METHODS=" + boolToInt(p.InputMethods),
+		"PREF_NOTIFICATIONS=" + boolToInt(p.Notifications),
+		"PREF_MPRIS=" + boolToInt(p.MPRIS),
+		"PREF_PRINTING=" + boolToInt(p.Printing),
+		"PREF_LAST_APP=" + strconv.Quote(p.LastApp),
+		"PREF_DEFAULT_APP=" + strconv.Quote(p.DefaultApp),
+		"PREF_LAST_USED=" + strconv.FormatInt(p.LastUsed, 10),
+		"PREF_LAST_UNLOCK_METHOD=" + strconv.Quote(p.LastUnlockMethod),
+		"PREF_LAST_UNLOCK_AT=" + strconv.FormatInt(p.LastUnlockAt, 10),
+	}
+
+	if p.Timeout > 0 {
+		lines = append(lines, "PREF_TIMEOUT="+p.Timeout.String())
+	}
+
+	if p.Locked.MTime != 0 {
+		lines = append(lines,
+			"PREF_LOCKED_SIZE="+strconv.FormatInt(p.Locked.Size, 10),
+			"PREF_LOCKED_MTIME="+strconv.FormatInt(p.Locked.MTime, 10))
+	}
+	if p.Locked.Checksum != "" {
+		lines = append(lines, "PREF_LOCKED_SHA256="+strconv.Quote(p.Locked.Checksum))
+	}
+
+	if p.Backend != "" {
+		lines = append(lines, "BACKEND="+strconv.Quote(p.Backend))
+	}
+	if p.Overlay {
+		lines = append(lines, "PREF_OVERLAY=1")
+	}
+
+	if len(p.AllowedApps) > 0 {
+		lines = append(lines, "PREF_ALLOWED_APPS="+strconv.Quote(strings.Join(p.AllowedApps, ",")))
+	}
+
+	if p.Forensics {
+		lines = append(lines, "PREF_FORENSICS=1")
+	}
+	if p.Untrusted {
+		lines = append(lines, "PREF_UNTRUSTED=1")
+	}
+	if p.Hidden {
+		lines = append(lines, "PREF_HIDDEN=1")
+	}
+	if p.Description != "" {
+		lines = append(lines, "PREF_DESCRIPTION="+strconv.Quote(p.Description))
+	}
+
+	if len(p.DNS) > 0 {
+		lines = append(lines, "PREF_DNS="+strconv.Quote(strings.Join(p.DNS, ",")))
+	}
+	if len(p.Hosts) > 0 {
+		lines = append(lines, "PREF_HOSTS="+strconv.Quote(strings.Join(p.Hosts, ",")))
+	}
+
+	if p.MountPoint != "" {
+		lines = append(lines, "PREF_MOUNT_POINT="+strconv.Quote(p.MountPoint))
+	}
+
+	if p.Quota > 0 {
+		lines = append(lines, "PREF_QUOTA="+strconv.FormatInt(p.Quota, 10))
+	}
+	if p.GrowBy > 0 {
+		lines = append(lines, "PREF_GROW_BY="+strconv.FormatInt(p.GrowBy, 10))
+	}
+	if p.GrowAt > 0 {
+		lines = append(lines, "PREF_GROW_AT="+strconv.Itoa(p.GrowAt))
+	}
+	if p.GrowMax > 0 {
+		lines = append(lines, "PREF_GROW_MAX="+strconv.FormatInt(p.GrowMax, 10))
+	}
+	if p.GrowPaused {
+		lines = append(lines, "PREF_GROW_PAUSED=1")
+	}
+	if p.ReservedPercent >= 0 {
+		lines = append(lines, "PREF_RESERVED_PERCENT="+strconv.Itoa(p.ReservedPercent))
+	}
+
+	if p.Retention.IsSet() {
+		lines = append(lines,
+			"PREF_SNAPSHOT_KEEP_LAST="+strconv.Itoa(p.Retention.KeepLast),
+			"PREF_SNAPSHOT_KEEP_DAILY="+strconv.Itoa(p.Retention.KeepDaily),
+			"PREF_SNAPSHOT_KEEP_WEEKLY="+strconv.Itoa(p.Retention.KeepWeekly))
+	}
+
+	if p.SecretRef != "" {
+		lines = append(lines, "PREF_SECRET_REF="+strconv.Quote(p.SecretRef))
+	}
+
+	if p.Sync.Remote != "" {
+		lines = append(lines,
+			"PREF_SYNC_REMOTE="+strconv.Quote(p.Sync.Remote),
+			"PREF_SYNC_LOCAL_SIZE="+strconv.FormatInt(p.Sync.Local.Size, 10),
+			"PREF_SYNC_LOCAL_MTIME="+strconv.FormatInt(p.Sync.Local.MTime, 10),
+			"PREF_SYNC_REMOTE_ID="+strconv.Quote(p.Sync.RemoteID))
+	}
+
+	// Add FIDO2 fields if present
+	if p.FIDO2BottleID != "" {
+		lines = append(lines, "FIDO2_BOTTLE_ID="+strconv.Quote(p.FIDO2BottleID))
+	}
+	if p.FIDO2CredentialID != "" {
+		lines = append(lines, "FIDO2_CREDENTIAL_ID="+strconv.Quote(p.FIDO2CredentialID))
+	}
+	if p.FIDO2Salt != "" {
+		lines = append(lines, "FIDO2_SALT="+strconv.Quote(p.FIDO2Salt))
+	}
+	if p.FIDO2DeviceHint != "" {
+		lines = append(lines, "FIDO2_DEVICE_HINT="+strconv.Quote(p.FIDO2DeviceHint))
+	}
+	if p.FIDO2RPID != "" {
+		lines = append(lines, "FIDO2_RP_ID="+strconv.Quote(p.FIDO2RPID))
+	}
+	if p.FIDO2User != "" {
+		lines = append(lines, "FIDO2_USER="+strconv.Quote(p.FIDO2User))
+	}
+	if p.KeyDriveUUID != "" {
+		lines = append(lines,
+			"KEYDRIVE_UUID="+strconv.Quote(p.KeyDriveUUID),
+			"KEYDRIVE_LABEL="+strconv.Quote(p.KeyDriveLabel),
+			"KEYDRIVE_FILE="+strconv.Quote(p.KeyDriveFile))
+	}
+
+	return lines
+}
@@ -0,0 +1,100 @@
+// Mounting without udisks2: losetup, cryptsetup, and mount through pkexec/sudo.
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// cryptsetupExitBadPassphrase is cryptsetup's exit code for a wrong passphrase
+const cryptsetupExitBadPassphrase = 2
+
+// haveUdisks reports whether udisks2 is installed; without it, bottles are
+// mounted with privilege escalation instead
+func haveUdisks() bool {
+	_, err := exec.LookPath("udisksctl")
+	return err == nil
+}
+
+// privMountPoint returns where a bottle is mounted without udisks
+func privMountPoint(bottle string) string {
+	if dir := fixedMountPoint(bottle); dir != "" {
+		return dir
+	}
+	return filepath.Join(lockDir(), "mnt", strings.TrimSuffix(bottleName(bottle), ".bottle"))
+}
+
+// privMount mounts a cleartext device at target with the same options udisks
+// uses, and hands the filesystem to the user
+func privMount(ctx context.Context, device, target string) ([]byte, error) {
+	if err := os.MkdirAll(target, 0700); err != nil {
+		return nil, &mountError{op: "mount", msg: err.Error()}
+	}
+	// Never stack a bottle on top of other files (or another bottle)
+	if entries, err := os.ReadDir(target); err != nil || len(entries) > 0 {
+		return nil, &mountError{op: "mount", msg: target + " is not an empty directory"}
+	}
+	out, err := privCmdContext(ctx, "mount", "-o", "nodev,nosuid,noexec"+mountContextOption(), device, target).CombinedOutput()
+	if err != nil {
+		return out, err
+	}
+	claimOwnership(target)
+	return out, nil
+}
+
+// privStrategy mounts with losetup, cryptsetup and mount through
+// privilege escalation; cryptsetup asks for missing keys on the terminal
+type privStrategy struct{}
+
+func (privStrategy) attach(ctx context.Context, file string) (string, error) {
+	out, err := privCmdContext(ctx, "losetup", "--find", "--show", "--", file).Output()
+	if err != nil {
+		return "", &mountError{op: "loop-setup", msg: err.Error()}
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (privStrategy) unlock(ctx context.Context, bottle, device string, key []byte) (string, error) {
+	mapperName := getMapperName(bottle)
+	var out []byte
+	var err error
+	if len(key) > 0 {
+		open := privCmdContext(ctx, "cryptsetup", "open", "--key-file", "-", device, mapperName)
+		open.Stdin = bytes.NewReader(key)
+		out, err = open.CombinedOutput()
+	} else {
+		open := privCmdContext(ctx, "cryptsetup", "open", device, mapperName)
+		open.Stdin, open.Stdout, open.Stderr = os.Stdin, os.Stdout, os.Stderr
+		err = open.Run()
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == cryptsetupExitBadPassphrase {
+			return "", errKeyRejected
+		}
+		return "", &mountError{op: "unlock", msg: strings.TrimSpace(string(out) + " " + err.Error())}
+	}
+	return "/dev/mapper/" + mapperName, nil
+}
+
+func (privStrategy) mount(ctx context.Context, bottle, device string) (string, []byte, error) {
+	mountPoint := privMountPoint(bottle)
+	out, err := privMount(ctx, device, mountPoint)
+	if err != nil {
+		return "", out, err
+	}
+	return mountPoint, out, nil
+}
+
+func (privStrategy) lock(_, cleartext string) ([]byte, error) {
+	return cryptsetupCmd("close", filepath.Base(cleartext)).CombinedOutput()
+}
+
+func (privStrategy) detach(loop string) ([]byte, error) {
+	return privCmd("losetup", "-d", loop).CombinedOutput()
+}
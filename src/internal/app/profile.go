@@ -0,0 +1,150 @@
+// Launch profiles: a named bottle, app, permission overrides, and app arguments, run as one.
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// launchProfile is a saved launch of an app in a bottle
+type launchProfile struct {
+	Name      string
+	Bottle    string // bottle path
+	App       string
+	Args      []string
+	Overrides map[string]bool // permission keys (PREF_NETWORK, ...) to values
+}
+
+// profileDir returns the directory holding profile files
+func profileDir() string {
+	return filepath.Join(configDir, "profiles")
+}
+
+// permissionToggle returns the permission field a PREF_* key sets, or nil
+// for keys a profile can't override
+func permissionToggle(p *Permissions, key string) *bool {
+	switch key {
+	case "PREF_NETWORK":
+		return &p.Network
+	case "PREF_AUDIO":
+		return &p.Audio
+	case "PREF_GPU":
+		return &p.GPU
+	case "PREF_WAYLAND":
+		return &p.Wayland
+	case "PREF_X11":
+		return &p.X11
+	case "PREF_CAMERA":
+		return &p.Camera
+	case "PREF_PORTALS":
+		return &p.Portals
+	case "PREF_ACCESSIBILITY":
+		return &p.Accessibility
+	case "PREF_INPUT_METHODS":
+		return &p.InputMethods
+	case "PREF_NOTIFICATIONS":
+		return &p.Notifications
+	case "PREF_MPRIS":
+		return &p.MPRIS
+	case "PREF_PRINTING":
+		return &p.Printing
+	}
+	return nil
+}
+
+// loadProfile reads a profile by name (a leading @ is allowed)
+func loadProfile(name string) (*launchProfile, error) {
+	name = strings.TrimPrefix(name, "@")
+	if name == "" || strings.ContainsRune(name, '/') {
+		return nil, &bottleError{op: "profile", msg: "invalid profile name @" + name}
+	}
+	path := filepath.Join(profileDir(), name+".conf")
+	if _, err := os.Stat(path); err != nil {
+		return nil, &bottleError{op: "profile", msg: "no profile " + name + " - create " + path +
+			" with BOTTLE=<bottle> and APP=<app id>"}
+	}
+
+	c := loadGlobalConfig(path)
+	p := &launchProfile{
+		Name:      name,
+		Bottle:    c.Get("BOTTLE"),
+		App:       c.Get("APP"),
+		Args:      strings.Fields(c.Get("ARGS")),
+		Overrides: map[string]bool{},
+	}
+	if p.Bottle == "" || p.App == "" {
+		return nil, &bottleError{op: "profile", msg: path + " needs BOTTLE= and APP="}
+	}
+	p.Bottle = resolveBottlePath(p.Bottle)
+	for _, key := range c.KeysWithPrefix("PREF_") {
+		if permissionToggle(&Permissions{}, key) == nil {
+			return nil, &bottleError{op: "profile", msg: path + ": " + key + " can't be set in a profile"}
+		}
+		value := strings.ToLower(c.Get(key))
+		p.Overrides[key] = value == "1" || value == "true"
+	}
+	return p, nil
+}
+
+// listProfiles returns the valid profiles, sorted by name
+func listProfiles() []*launchProfile {
+	entries, err := os.ReadDir(profileDir())
+	if err != nil {
+		return nil
+	}
+	var profiles []*launchProfile
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".conf")
+		if !ok || e.IsDir() {
+			continue
+		}
+		if p, err := loadProfile(name); err == nil {
+			profiles = append(profiles, p)
+		}
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles
+}
+
+// apply returns a copy of perms with the profile's overrides
+func (p *launchProfile) apply(perms *Permissions) *Permissions {
+	copied := *perms
+	for key, value := range p.Overrides {
+		*permissionToggle(&copied, key) = value
+	}
+	return &copied
+}
+
+// Summary describes the profile in one line, e.g.
+// "finance.bottle, org.mozilla.firefox --private-window, no camera"
+func (p *launchProfile) Summary() string {
+	parts := []string{bottleName(p.Bottle), strings.Join(append([]string{p.App}, p.Args...), " ")}
+	keys := make([]string, 0, len(p.Overrides))
+	for key := range p.Overrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name := strings.ToLower(strings.TrimPrefix(key, "PREF_"))
+		if !p.Overrides[key] {
+			name = "no " + name
+		}
+		parts = append(parts, name)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// cmdProfiles lists the launch profiles
+func cmdProfiles() {
+	profiles := listProfiles()
+	if len(profiles) == 0 {
+		fmt.Println("No profiles - create one in " + profileDir() + " (see the README)")
+		return
+	}
+	for _, p := range profiles {
+		fmt.Printf("@%-15s %s\n", p.Name, p.Summary())
+	}
+}
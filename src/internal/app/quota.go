@@ -0,0 +1,140 @@
+// Quotas: a soft limit on a bottle's used space, and ext4's root-reserved blocks.
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// bottleUsed returns the bytes used on the filesystem at path, counting the
+// reserved blocks as free
+func bottleUsed(path string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Blocks-st.Bfree) * int64(st.Bsize), nil
+}
+
+// overQuota reports whether used exceeds the bottle's soft quota (0 = none)
+func overQuota(used int64, perms *Permissions) bool {
+	return perms.Quota > 0 && used > perms.Quota
+}
+
+// quotaMessage describes a bottle over its quota
+func quotaMessage(bottle string, used, quota int64) string {
+	return bottleName(bottle) + " uses " + formatSize(used) + ", over its quota of " + formatSize(quota)
+}
+
+// watchQuota checks a running session's bottle against its quota every
+// RunningStatsInterval and calls warn each time usage goes over it. The
+// returned function stops watching.
+func watchQuota(bottle, mountPoint string, quota int64, warn func(string)) func() {
+	if quota <= 0 {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(RunningStatsInterval)
+		defer ticker.Stop()
+		over := false
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			used, err := bottleUsed(mountPoint)
+			if err != nil {
+				continue
+			}
+			// Warn again only after it dropped back under the quota
+			if used > quota && !over {
+				warn(quotaMessage(bottle, used, quota))
+			}
+			over = used > quota
+		}
+	}()
+	return func() { close(stop) }
+}
+
+// cmdQuota shows, sets, or clears a bottle's soft quota
+func cmdQuota(bottle, size string) error {
+	bottle = resolveBottlePath(bottle)
+	configPath := getConfigPath(bottle)
+	perms := loadPermissions(configPath)
+
+	switch size {
+	case "":
+		line := bottleName(bottle) + ": "
+		if perms.Quota > 0 {
+			line += "quota " + formatSize(perms.Quota)
+		} else {
+			line += "no quota"
+		}
+		if info := currentMount(bottle); info != nil && info.MountPoint != "" {
+			if used, err := bottleUsed(info.MountPoint); err == nil {
+				line += ", " + formatSize(used) + " used"
+				if overQuota(used, perms) {
+					line += " (over quota)"
+				}
+			}
+		}
+		fmt.Println(line)
+		return nil
+	case "--clear":
+		perms.Quota = 0
+		return savePermissions(configPath, perms)
+	}
+
+	quota, err := parseSize(size)
+	if err != nil {
+		return badArgument("quota", err)
+	}
+	perms.Quota = quota
+	return savePermissions(configPath, perms)
+}
+
+// cmdReserve shows or sets the percentage of an ext4 bottle reserved for
+// root, so a full bottle still leaves room for recovery. The bottle has to be
+// open, since tune2fs changes the filesystem itself.
+func cmdReserve(bottle, percent string) error {
+	bottle = resolveBottlePath(bottle)
+	configPath := getConfigPath(bottle)
+	perms := loadPermissions(configPath)
+
+	if percent == "" {
+		if perms.ReservedPercent >= 0 {
+			fmt.Printf("%s: %d%% reserved for root\n", bottleName(bottle), perms.ReservedPercent)
+		} else {
+			fmt.Println(bottleName(bottle) + ": filesystem default (5% for ext4)")
+		}
+		return nil
+	}
+
+	pct, err := strconv.Atoi(percent)
+	if err != nil || pct < 0 || pct > 50 {
+		return &bottleError{op: "reserve", msg: "percent must be a whole number from 0 to 50", usage: true}
+	}
+	backend := bottleBackend(bottle)
+	if backend == BackendGocryptfs || backend == BackendFscrypt || backend == BackendSquashfs {
+		return &bottleError{op: "reserve", msg: "only LUKS (ext4) bottles have reserved blocks"}
+	}
+	info := currentMount(bottle)
+	if info == nil || (info.CleartextDevice == "" && backend != BackendMock) {
+		return &bottleError{op: "reserve", msg: bottleName(bottle) + " is locked; unlock it first (e.g. bottle-launch unlock-all)"}
+	}
+	if backend != BackendMock {
+		if out, err := privCmd("tune2fs", "-m", strconv.Itoa(pct), info.CleartextDevice).CombinedOutput(); err != nil {
+			return &bottleError{op: "tune2fs", msg: string(out)}
+		}
+	}
+	perms.ReservedPercent = pct
+	if err := savePermissions(configPath, perms); err != nil {
+		return err
+	}
+	fmt.Printf("%d%% of %s is now reserved for root\n", pct, bottleName(bottle))
+	return nil
+}
@@ -0,0 +1,44 @@
+// Stale session recovery: finds bottles left unlocked or mounted by a crashed session.
+package app
+
+// staleBottle is a bottle with kernel state (loop device, dm-crypt mapping,
+// or mount) that no running session owns
+type staleBottle struct {
+	path string
+	info *MountInfo
+}
+
+// Describe returns a short explanation of what was left behind
+func (s staleBottle) Describe() string {
+	switch {
+	case s.info.MountPoint != "":
+		return "mounted at " + s.info.MountPoint
+	case s.info.CleartextDevice != "":
+		return "unlocked but not mounted"
+	}
+	return "loop device " + s.info.LoopDevice + " still attached"
+}
+
+// findStaleBottles returns bottles that are attached, unlocked, or mounted
+// while no session holds their lock (e.g. after a crash or kill -9). Bottles
+// unlock-all left open on purpose are not stale.
+func findStaleBottles() []staleBottle {
+	var stale []staleBottle
+	for _, bottle := range listBottles() {
+		info := currentMount(bottle)
+		if info == nil || bottleInUse(bottle) || keptOpen(bottle) {
+			continue
+		}
+		stale = append(stale, staleBottle{path: bottle, info: info})
+	}
+	return stale
+}
+
+// recoverStaleBottle unmounts a stale bottle, and also locks it and detaches
+// its loop device if lock is set
+func recoverStaleBottle(s staleBottle, lock bool) error {
+	if lock {
+		return unmountBottle(s.info)
+	}
+	return udisksUnmountOnly(s.info)
+}
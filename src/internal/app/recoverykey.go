@@ -0,0 +1,124 @@
+// Recovery material: recovery keys and offline (paper/QR) copies of YubiKey parameters.
+package app
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/x/term"
+)
+
+// recoveryMaterial is what a user needs to regain access to a bottle if
+// its password, YubiKey, or config file is lost
+type recoveryMaterial struct {
+	Bottle      string
+	RecoveryKey string   // passphrase in an extra LUKS keyslot ("" if none generated)
+	FIDO2Lines  []string // FIDO2_* config lines (YubiKey bottles only)
+}
+
+// fido2ConfigLines returns a YubiKey bottle's FIDO2 parameters exactly as
+// they appear in its config file, so a paper copy can be typed back in
+func fido2ConfigLines(p *Permissions) []string {
+	if p.FIDO2BottleID == "" {
+		return nil
+	}
+	lines := []string{
+		"FIDO2_BOTTLE_ID=" + strconv.Quote(p.FIDO2BottleID),
+		"FIDO2_CREDENTIAL_ID=" + strconv.Quote(p.FIDO2CredentialID),
+		"FIDO2_SALT=" + strconv.Quote(p.FIDO2Salt),
+	}
+	if p.FIDO2RPID != "" {
+		lines = append(lines, "FIDO2_RP_ID="+strconv.Quote(p.FIDO2RPID))
+	}
+	return lines
+}
+
+// hasKeyslots reports whether a bottle unlocks through LUKS keyslots, which
+// a recovery key is added to: LUKS images and devices, encrypted squashfs
+func hasKeyslots(bottle string) bool {
+	switch bottleBackend(bottle) {
+	case BackendLUKS:
+		return true
+	case BackendSquashfs:
+		return squashfsImageKind(bottle) == "luks"
+	}
+	return false
+}
+
+// addRecoveryKey generates a passphrase and adds it to the bottle as an
+// extra keyslot, authorized by an existing secret (password or YubiKey secret)
+func addRecoveryKey(bottle string, existing []byte) (string, error) {
+	key, err := generatePassphrase()
+	if err != nil {
+		return "", err
+	}
+	if err := AddLUKSKeyFIDO2(bottle, existing, []byte(key)); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// askRecoveryKey asks on the terminal for a recovery key to unlock a LUKS
+// bottle with, after its YubiKey or key drive failed with cause. An empty
+// answer gives up.
+func askRecoveryKey(bottle string, cause error) (recoveryKey, bool) {
+	if cause == nil || bottleBackend(bottle) != BackendLUKS ||
+		mockMode || needGUIPrompts() || !term.IsTerminal(os.Stdin.Fd()) {
+		return "", false
+	}
+	fmt.Fprintf(os.Stderr, "%v\nRecovery key (Enter to give up): ", cause)
+	answer, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Fprintln(os.Stderr)
+	key := strings.TrimSpace(string(answer))
+	return recoveryKey(key), err == nil && key != ""
+}
+
+// qrPayload is the compact text encoded in the QR code
+func (r recoveryMaterial) qrPayload() string {
+	lines := []string{"bottle-launch " + bottleName(r.Bottle)}
+	if r.RecoveryKey != "" {
+		lines = append(lines, "RECOVERY_KEY="+r.RecoveryKey)
+	}
+	lines = append(lines, r.FIDO2Lines...)
+	return strings.Join(lines, "\n")
+}
+
+// Text renders the material as a printable sheet
+func (r recoveryMaterial) Text() string {
+	var sb strings.Builder
+	sb.WriteString("bottle-launch recovery sheet\n")
+	sb.WriteString("Bottle:  " + bottleName(r.Bottle) + "\n")
+	sb.WriteString("Created: " + time.Now().Format("2006-01-02 15:04") + "\n")
+
+	if r.RecoveryKey != "" {
+		sb.WriteString("\nRecovery key (unlocks the bottle like its password):\n")
+		sb.WriteString("  " + r.RecoveryKey + "\n")
+	}
+	if len(r.FIDO2Lines) > 0 {
+		sb.WriteString("\nYubiKey parameters - if the bottle's config is lost, add these lines to\n")
+		sb.WriteString(getConfigPath(r.Bottle) + " (the YubiKey is still required):\n")
+		for _, line := range r.FIDO2Lines {
+			sb.WriteString("  " + line + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// renderQR renders text as a QR code using qrencode. format is a qrencode
+// output type: ANSIUTF8 for terminals, UTF8 for plain text files.
+func renderQR(text, format string) (string, error) {
+	cmd := command("qrencode", "--type", format, "--level", "M", "--output", "-")
+	cmd.Stdin = strings.NewReader(text)
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", &bottleError{op: "qrencode", msg: strings.TrimSpace(string(exitErr.Stderr))}
+		}
+		return "", &bottleError{op: "qrencode", msg: err.Error()}
+	}
+	return string(out), nil
+}
@@ -0,0 +1,59 @@
+// Reflinks: copy-on-write file clones (FICLONE) on btrfs and XFS, for instant snapshots and clones.
+package app
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFile creates dst as a reflink of the regular file src, with src's
+// permissions and modification time. It fails, leaving nothing behind,
+// where reflinks aren't supported.
+func cloneFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	err = unix.IoctlFileClone(int(out.Fd()), int(in.Fd()))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	// Like cp -a
+	return os.Chtimes(dst, fi.ModTime(), fi.ModTime())
+}
+
+// reflinkSupported reports whether files in dir can be reflinked, by
+// cloning a scratch file
+func reflinkSupported(dir string) bool {
+	probe, err := os.CreateTemp(dir, ".reflink-probe-")
+	if err != nil {
+		return false
+	}
+	defer os.Remove(probe.Name())
+	_, err = probe.WriteString("probe")
+	probe.Close()
+	if err != nil {
+		return false
+	}
+	clone := filepath.Join(dir, filepath.Base(probe.Name())+".clone")
+	if err := cloneFile(probe.Name(), clone); err != nil {
+		return false
+	}
+	os.Remove(clone)
+	return true
+}
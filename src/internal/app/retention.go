@@ -0,0 +1,277 @@
+// Snapshot retention: pruning old snapshots by policy, and scheduled snapshots through a systemd timer.
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// snapshotRetention says which snapshots of a bottle to keep; a snapshot is
+// kept if any rule keeps it. All zero means no policy: nothing is pruned
+// and the bottle isn't snapshotted on schedule.
+type snapshotRetention struct {
+	KeepLast   int // the newest N snapshots
+	KeepDaily  int // the newest snapshot of each of the last N days that have one
+	KeepWeekly int // the newest snapshot of each of the last N weeks that have one
+}
+
+// IsSet reports whether any rule is set
+func (r snapshotRetention) IsSet() bool {
+	return r.KeepLast > 0 || r.KeepDaily > 0 || r.KeepWeekly > 0
+}
+
+// String describes the policy, e.g. "last 3, daily 7, weekly 4"
+func (r snapshotRetention) String() string {
+	var rules []string
+	if r.KeepLast > 0 {
+		rules = append(rules, "last "+strconv.Itoa(r.KeepLast))
+	}
+	if r.KeepDaily > 0 {
+		rules = append(rules, "daily "+strconv.Itoa(r.KeepDaily))
+	}
+	if r.KeepWeekly > 0 {
+		rules = append(rules, "weekly "+strconv.Itoa(r.KeepWeekly))
+	}
+	if len(rules) == 0 {
+		return "keep all"
+	}
+	return strings.Join(rules, ", ")
+}
+
+// snapshotsToPrune returns the snapshots the policy doesn't keep. snapshots
+// must be newest first, as listSnapshots returns them.
+func snapshotsToPrune(snapshots []bottleSnapshot, r snapshotRetention) []bottleSnapshot {
+	if !r.IsSet() {
+		return nil
+	}
+	keep := make([]bool, len(snapshots))
+	for i := range snapshots {
+		if i < r.KeepLast {
+			keep[i] = true
+		}
+	}
+	// bucket keeps the newest snapshot in each of the first n periods
+	bucket := func(n int, period func(bottleSnapshot) string) {
+		seen := map[string]bool{}
+		for i, s := range snapshots {
+			p := period(s)
+			if seen[p] {
+				continue
+			}
+			if len(seen) == n {
+				return
+			}
+			seen[p] = true
+			keep[i] = true
+		}
+	}
+	bucket(r.KeepDaily, func(s bottleSnapshot) string { return s.Taken.Format("2006-01-02") })
+	bucket(r.KeepWeekly, func(s bottleSnapshot) string {
+		year, week := s.Taken.ISOWeek()
+		return fmt.Sprintf("%d-%02d", year, week)
+	})
+
+	var prune []bottleSnapshot
+	for i, s := range snapshots {
+		if !keep[i] {
+			prune = append(prune, s)
+		}
+	}
+	return prune
+}
+
+// pruneSnapshots deletes the snapshots a bottle's retention policy doesn't
+// keep and returns them
+func pruneSnapshots(bottle string) ([]bottleSnapshot, error) {
+	perms := loadPermissions(getConfigPath(bottle))
+	prune := snapshotsToPrune(listSnapshots(bottle), perms.Retention)
+	for i, s := range prune {
+		if err := deleteSnapshot(s); err != nil {
+			return prune[:i], err
+		}
+	}
+	return prune, nil
+}
+
+// cmdRetention shows, sets, or clears a bottle's retention policy. Rules
+// not given keep their value.
+func cmdRetention(bottle string, args []string) error {
+	bottle = resolveBottlePath(bottle)
+	configPath := getConfigPath(bottle)
+	perms := loadPermissions(configPath)
+
+	if len(args) == 0 {
+		fmt.Println(bottleName(bottle) + ": " + perms.Retention.String())
+		return nil
+	}
+	for _, arg := range args {
+		if arg == "--clear" {
+			perms.Retention = snapshotRetention{}
+			continue
+		}
+		name, value, ok := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		n, err := strconv.Atoi(value)
+		if !ok || err != nil || n < 0 {
+			return &bottleError{op: "retention", msg: "expected --last=N, --daily=N, --weekly=N, or --clear, got " + arg, usage: true}
+		}
+		switch name {
+		case "last":
+			perms.Retention.KeepLast = n
+		case "daily":
+			perms.Retention.KeepDaily = n
+		case "weekly":
+			perms.Retention.KeepWeekly = n
+		default:
+			return &bottleError{op: "retention", msg: "unknown rule " + arg + " (use --last, --daily, or --weekly)"}
+		}
+	}
+	if err := savePermissions(configPath, perms); err != nil {
+		return err
+	}
+	fmt.Println(bottleName(bottle) + ": " + perms.Retention.String())
+	return nil
+}
+
+// cmdPrune deletes the snapshots a bottle's policy doesn't keep, or with
+// dryRun lists them
+func cmdPrune(bottle string, dryRun bool) error {
+	bottle = resolveBottlePath(bottle)
+	perms := loadPermissions(getConfigPath(bottle))
+	if !perms.Retention.IsSet() {
+		return &bottleError{op: "prune", msg: bottleName(bottle) + " has no retention policy (set one with bottle-launch retention)"}
+	}
+	if dryRun {
+		for _, s := range snapshotsToPrune(listSnapshots(bottle), perms.Retention) {
+			fmt.Println("Would delete " + s.Name())
+		}
+		return nil
+	}
+	pruned, err := pruneSnapshots(bottle)
+	for _, s := range pruned {
+		fmt.Println("Deleted " + s.Name())
+	}
+	return err
+}
+
+// cmdSnapshotScheduled snapshots and prunes every bottle with a retention
+// policy; it is what the systemd timer runs. Mounted LUKS bottles are
+// skipped, since freezing them needs authentication nobody is there to give.
+func cmdSnapshotScheduled() error {
+	var failed []string
+	for _, bottle := range listBottles() {
+		perms := loadPermissions(getConfigPath(bottle))
+		if !perms.Retention.IsSet() || requireSnapshotBottle(bottle) != nil {
+			continue
+		}
+		if info := currentMount(bottle); info != nil && bottleBackend(bottle) != BackendMock {
+			fmt.Println("Skipped " + bottleName(bottle) + ": it is open (snapshot it by hand with bottle-launch snapshot)")
+			continue
+		}
+		s, err := takeSnapshot(bottle)
+		if err != nil {
+			failed = append(failed, bottleName(bottle)+": "+err.Error())
+			continue
+		}
+		fmt.Println("Snapshot " + s.Name() + " of " + bottleName(bottle))
+		pruned, err := pruneSnapshots(bottle)
+		if len(pruned) > 0 {
+			fmt.Printf("Pruned %d old snapshot(s) of %s\n", len(pruned), bottleName(bottle))
+		}
+		if err != nil {
+			failed = append(failed, bottleName(bottle)+": "+err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		sendNotification("Scheduled snapshots failed", strings.Join(failed, "\n"))
+		return &bottleError{op: "snapshot", msg: strings.Join(failed, "; ")}
+	}
+	return nil
+}
+
+// systemdUserDir returns where user units go
+func systemdUserDir() string {
+	if mockMode {
+		return filepath.Join(configDir, "systemd")
+	}
+	return filepath.Join(filepath.Dir(configDir), "systemd", "user")
+}
+
+// snapshotUnit is the name shared by the snapshot service and timer
+const snapshotUnit = "bottle-launch-snapshot"
+
+// cmdSnapshotTimer writes a systemd user service and timer that run
+// `snapshot --all` on schedule (a systemd OnCalendar expression), or with
+// remove deletes them again
+func cmdSnapshotTimer(onCalendar string, remove bool) error {
+	dir := systemdUserDir()
+	service := filepath.Join(dir, snapshotUnit+".service")
+	timer := filepath.Join(dir, snapshotUnit+".timer")
+
+	if remove {
+		systemctlUser("disable", "--now", snapshotUnit+".timer")
+		for _, path := range []string{timer, service} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return &bottleError{op: "snapshot-timer", msg: err.Error()}
+			}
+		}
+		systemctlUser("daemon-reload")
+		fmt.Println("Removed " + timer)
+		return nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return &bottleError{op: "snapshot-timer", msg: err.Error()}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return &bottleError{op: "snapshot-timer", msg: err.Error()}
+	}
+	serviceUnit := "[Unit]\n" +
+		"Description=Snapshot bottles with a retention policy\n\n" +
+		"[Service]\n" +
+		"Type=oneshot\n" +
+		"ExecStart=" + quoteUnitArg(exe) + " snapshot --all\n"
+	if os.Getenv("BOTTLE_DIR") != "" {
+		serviceUnit += "Environment=" + quoteUnitArg("BOTTLE_DIR="+bottleDir) + "\n"
+	}
+	timerUnit := "[Unit]\n" +
+		"Description=Snapshot bottles with a retention policy on schedule\n\n" +
+		"[Timer]\n" +
+		"OnCalendar=" + onCalendar + "\n" +
+		"Persistent=true\n" +
+		"RandomizedDelaySec=10min\n\n" +
+		"[Install]\n" +
+		"WantedBy=timers.target\n"
+	for path, content := range map[string]string{service: serviceUnit, timer: timerUnit} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return &bottleError{op: "snapshot-timer", msg: err.Error()}
+		}
+	}
+
+	fmt.Println("Wrote " + service)
+	fmt.Println("Wrote " + timer)
+	fmt.Println("Enable it with: systemctl --user daemon-reload && systemctl --user enable --now " + snapshotUnit + ".timer")
+	fmt.Println("Only bottles with a retention policy are snapshotted (bottle-launch retention <bottle> --daily=7).")
+	return nil
+}
+
+// quoteUnitArg quotes one word of a systemd unit's ExecStart or Environment line
+func quoteUnitArg(arg string) string {
+	arg = strings.ReplaceAll(arg, "%", "%%")
+	if !strings.ContainsAny(arg, " \t\"'\\;$") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `$$`).Replace(arg) + `"`
+}
+
+// systemctlUser runs a systemctl --user command, ignoring failures (e.g. no
+// user manager running)
+func systemctlUser(args ...string) {
+	if mockMode {
+		return
+	}
+	_ = command("systemctl", append([]string{"--user"}, args...)...).Run()
+}
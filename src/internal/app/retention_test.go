@@ -0,0 +1,69 @@
+// Tests for snapshot retention: which snapshots a policy prunes.
+package app
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSnapshotsToPrune(t *testing.T) {
+	// Newest first, as listSnapshots returns them. 2026-10-16 is a Friday:
+	// s0 to s3 fall in one ISO week, s4 and s5 in the two before it.
+	day := func(d, hour int) time.Time { return time.Date(2026, 10, d, hour, 0, 0, 0, time.UTC) }
+	snapshots := []bottleSnapshot{
+		{Path: "s0", Taken: day(16, 12)},
+		{Path: "s1", Taken: day(16, 8)},
+		{Path: "s2", Taken: day(15, 12)},
+		{Path: "s3", Taken: day(14, 12)},
+		{Path: "s4", Taken: day(8, 12)},
+		{Path: "s5", Taken: day(1, 12)},
+	}
+	tests := []struct {
+		name   string
+		policy snapshotRetention
+		want   []string
+	}{
+		{"no policy", snapshotRetention{}, nil},
+		{"last", snapshotRetention{KeepLast: 2}, []string{"s2", "s3", "s4", "s5"}},
+		{"last above count", snapshotRetention{KeepLast: 10}, nil},
+		{"daily keeps newest of each day", snapshotRetention{KeepDaily: 2}, []string{"s1", "s3", "s4", "s5"}},
+		{"daily skips days without snapshots", snapshotRetention{KeepDaily: 4}, []string{"s1", "s5"}},
+		{"weekly", snapshotRetention{KeepWeekly: 2}, []string{"s1", "s2", "s3", "s5"}},
+		// A snapshot is kept if any rule keeps it
+		{"last and daily", snapshotRetention{KeepLast: 2, KeepDaily: 3}, []string{"s4", "s5"}},
+		{"daily and weekly", snapshotRetention{KeepDaily: 1, KeepWeekly: 3}, []string{"s1", "s2", "s3"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, s := range snapshotsToPrune(snapshots, tt.policy) {
+			got = append(got, s.Path)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: snapshotsToPrune() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSnapshotsToPruneEmpty(t *testing.T) {
+	if got := snapshotsToPrune(nil, snapshotRetention{KeepLast: 1, KeepDaily: 1}); len(got) != 0 {
+		t.Errorf("snapshotsToPrune(nil) = %v, want none", got)
+	}
+}
+
+func TestSnapshotRetentionString(t *testing.T) {
+	tests := []struct {
+		policy snapshotRetention
+		want   string
+	}{
+		{snapshotRetention{}, "keep all"},
+		{snapshotRetention{KeepLast: 3}, "last 3"},
+		{snapshotRetention{KeepDaily: 7, KeepWeekly: 4}, "daily 7, weekly 4"},
+		{snapshotRetention{KeepLast: 3, KeepDaily: 7, KeepWeekly: 4}, "last 3, daily 7, weekly 4"},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.policy, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Password manager integration: looks up bottle passphrases in KeePassXC or a Secret Service keyring.
+package app
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Password manager reference kinds
+const (
+	secretServiceRef = "secret-service"
+	keepassxcRef     = "keepassxc"
+)
+
+// secretRef is a parsed PREF_SECRET_REF
+type secretRef struct {
+	Kind      string
+	Attrs     []string // secret-service: attribute/value pairs, flattened for secret-tool
+	Database  string   // keepassxc: database file
+	Entry     string   // keepassxc: entry path
+	Attribute string   // keepassxc: entry attribute
+}
+
+var (
+	errWrongMasterPassword = &bottleError{op: "keepassxc", msg: "wrong master password", class: classWrongPassword}
+	errSecretNotFound      = &bottleError{op: "secret", msg: "no matching entry in the password manager"}
+)
+
+// parseSecretRef parses a password manager reference
+func parseSecretRef(ref string) (*secretRef, error) {
+	kind, rest, _ := strings.Cut(ref, ":")
+	invalid := &bottleError{op: "secret", msg: "invalid reference " + strconv.Quote(ref) +
+		" (expected secret-service:<attr>=<value>,... or keepassxc:<database>#<entry>[#<attribute>])"}
+
+	switch kind {
+	case secretServiceRef:
+		r := &secretRef{Kind: kind}
+		for _, pair := range strings.Split(rest, ",") {
+			attr, val, ok := strings.Cut(pair, "=")
+			if !ok || attr == "" || val == "" {
+				return nil, invalid
+			}
+			r.Attrs = append(r.Attrs, attr, val)
+		}
+		return r, nil
+
+	case keepassxcRef:
+		parts := strings.Split(rest, "#")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			return nil, invalid
+		}
+		database := parts[0]
+		if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(database, "~/") {
+			database = filepath.Join(home, database[2:])
+		}
+		r := &secretRef{Kind: kind, Database: database, Entry: parts[1], Attribute: "Password"}
+		if len(parts) == 3 && parts[2] != "" {
+			r.Attribute = parts[2]
+		}
+		return r, nil
+	}
+	return nil, invalid
+}
+
+// masterPasswords caches KeePassXC master passwords per database for the
+// lifetime of the process, so a session unlocks each database only once
+var masterPasswords = struct {
+	sync.Mutex
+	byDatabase map[string]string
+}{byDatabase: make(map[string]string)}
+
+// cachedMasterPassword returns the remembered master password for a database
+func cachedMasterPassword(database string) (string, bool) {
+	masterPasswords.Lock()
+	defer masterPasswords.Unlock()
+	pw, ok := masterPasswords.byDatabase[database]
+	return pw, ok
+}
+
+// needsMasterPassword reports whether looking up r requires asking for a
+// master password first
+func (r *secretRef) needsMasterPassword() bool {
+	if r.Kind != keepassxcRef {
+		return false
+	}
+	_, ok := cachedMasterPassword(r.Database)
+	return !ok
+}
+
+// lookupSecret returns the passphrase r points at. For keepassxc references,
+// master is the database's master password ("" to use the cached one).
+// Cancelling ctx stops the lookup, e.g. while a keyring unlock prompt waits.
+func lookupSecret(ctx context.Context, r *secretRef, master string) (string, error) {
+	if r.Kind == keepassxcRef && master == "" {
+		master, _ = cachedMasterPassword(r.Database)
+	}
+	return runSecretLookup(ctx, r, master, strings.NewReader(master+"\n"))
+}
+
+// lookupSecretInteractive looks up r from the CLI, letting keepassxc-cli ask
+// for the master password on the terminal if it isn't cached
+func lookupSecretInteractive(r *secretRef) (string, error) {
+	if r.needsMasterPassword() {
+		return runSecretLookup(context.Background(), r, "", os.Stdin)
+	}
+	return lookupSecret(context.Background(), r, "")
+}
+
+// runSecretLookup runs the password manager's CLI for r. A master password
+// that worked is cached for later lookups.
+func runSecretLookup(ctx context.Context, r *secretRef, master string, stdin io.Reader) (string, error) {
+	var cmd *exec.Cmd
+	if r.Kind == secretServiceRef {
+		cmd = commandContext(ctx, "secret-tool", append([]string{"lookup"}, r.Attrs...)...)
+	} else {
+		cmd = commandContext(ctx, "keepassxc-cli", "show", "--quiet", "--show-protected",
+			"--attributes", r.Attribute, r.Database, r.Entry)
+	}
+	cmd.Stdin = stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if stdin == os.Stdin {
+		// Interactive: keepassxc-cli prompts on stderr
+		cmd.Stderr = io.MultiWriter(&stderr, os.Stderr)
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		if _, exited := err.(*exec.ExitError); !exited {
+			return "", &bottleError{op: r.Kind, msg: err.Error()}
+		}
+		msg := strings.TrimSpace(stderr.String())
+		switch {
+		case r.Kind == keepassxcRef && strings.Contains(msg, "Invalid credentials"):
+			return "", errWrongMasterPassword
+		case r.Kind == secretServiceRef && msg == "":
+			// secret-tool exits 1 silently when nothing matches
+			return "", errSecretNotFound
+		case msg == "":
+			msg = err.Error()
+		}
+		return "", &bottleError{op: r.Kind, msg: msg}
+	}
+
+	secret := strings.TrimSuffix(string(out), "\n")
+	if secret == "" {
+		return "", errSecretNotFound
+	}
+	if r.Kind == keepassxcRef && master != "" {
+		masterPasswords.Lock()
+		masterPasswords.byDatabase[r.Database] = master
+		masterPasswords.Unlock()
+	}
+	return secret, nil
+}
+
+// secretServiceHasItem reports whether the keyring holds an entry matching
+// attrs, locked or not. Unlike a lookup it doesn't need the entry unlocked,
+// so "nothing stored" can be told apart from "can't read it now".
+func secretServiceHasItem(ctx context.Context, attrs []string) (bool, error) {
+	cmd := commandContext(ctx, "secret-tool", append([]string{"search", "--all"}, attrs...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if len(bytes.TrimSpace(out)) > 0 {
+		return true, nil
+	}
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return false, &bottleError{op: secretServiceRef, msg: msg}
+	}
+	if _, exited := err.(*exec.ExitError); err != nil && !exited {
+		return false, &bottleError{op: secretServiceRef, msg: err.Error()}
+	}
+	return false, nil
+}
@@ -0,0 +1,107 @@
+// Self-check: keeping bottle-launch's own files private, and warning about where bottles are kept.
+package app
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+
+	"bottle-launch/internal/sysfs"
+)
+
+// networkFSTypes are filesystem types whose files live on another machine
+var networkFSTypes = []string{"nfs", "nfs4", "cifs", "smb3", "smbfs", "9p", "afs", "ceph", "glusterfs",
+	"fuse.sshfs", "fuse.rclone", "fuse.davfs2", "davfs"}
+
+// selfCheck fixes the permissions of bottle-launch's files and returns
+// warnings for the user
+func selfCheck() []string {
+	var warnings []string
+	if n := restrictTree(configDir, true); n > 0 {
+		warnings = append(warnings, fmt.Sprintf("other users could read files in %s - made %d of them private", configDir, n))
+	}
+	if n := restrictTree(lockDir(), false); n > 0 {
+		warnings = append(warnings, fmt.Sprintf("other users could read files in %s - made %d of them private", lockDir(), n))
+	}
+
+	if bottleDirReadable() {
+		warnings = append(warnings, "other users can read the bottles in "+bottleDir+" - run chmod -R go-rwx "+bottleDir)
+	}
+	if fsType := bottleDirFSType(); slices.Contains(networkFSTypes, fsType) {
+		warnings = append(warnings, bottleDir+" is on a network filesystem ("+fsType+"): the server keeps a copy of every bottle, and unlocking over the network is slow and fragile")
+	}
+	return warnings
+}
+
+// restrictTree strips group and other permissions from a directory and the
+// files in it (and, if recursive, in its subdirectories on the same
+// filesystem), returning how many it changed
+func restrictTree(dir string, recursive bool) int {
+	root, err := os.Lstat(dir)
+	if err != nil || !root.IsDir() {
+		return 0
+	}
+	rootDev := root.Sys().(*syscall.Stat_t).Dev
+
+	fixed := 0
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() && path != dir {
+			// Never descend into mounts, such as bottles mounted under the runtime directory
+			if !recursive || info.Sys().(*syscall.Stat_t).Dev != rootDev {
+				return filepath.SkipDir
+			}
+		}
+		if perm := info.Mode().Perm(); perm&0077 != 0 {
+			if os.Chmod(path, perm&^0077) == nil {
+				fixed++
+			}
+		}
+		return nil
+	})
+	return fixed
+}
+
+// bottleDirReadable reports whether other users can list the bottle
+// directory or read a bottle file in it
+func bottleDirReadable() bool {
+	info, err := os.Stat(bottleDir)
+	if err != nil {
+		return false
+	}
+	if info.Mode().Perm()&0004 != 0 {
+		return true
+	}
+	for _, b := range listBottles() {
+		if info, err := os.Stat(b); err == nil && info.Mode().IsRegular() && info.Mode().Perm()&0004 != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// bottleDirFSType returns the type of the filesystem holding the bottle
+// directory
+func bottleDirFSType() string {
+	dir, err := filepath.EvalSymlinks(bottleDir)
+	if err != nil {
+		return ""
+	}
+	best, fsType := "", ""
+	for _, m := range sysfs.Mounts() {
+		if (dir == m.MountPoint || strings.HasPrefix(dir, strings.TrimSuffix(m.MountPoint, "/")+"/")) && len(m.MountPoint) >= len(best) {
+			best, fsType = m.MountPoint, m.FSType
+		}
+	}
+	return fsType
+}
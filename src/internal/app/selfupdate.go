@@ -0,0 +1,202 @@
+// Self-update: checking GitHub for a newer release and, if asked, installing it.
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// releasesURL is the GitHub API endpoint for the latest release
+const releasesURL = "https://api.github.com/repos/neoromantique/bottle-launch/releases/latest"
+
+// checksumsAsset is the release asset listing the SHA-256 of the others
+const checksumsAsset = "SHA256SUMS"
+
+// release is the part of a GitHub release self-update reads
+type release struct {
+	TagName string `json:"tag_name"`
+	HTMLURL string `json:"html_url"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// assetURL returns the download URL of a release asset ("" if missing)
+func (r *release) assetURL(name string) string {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL
+		}
+	}
+	return ""
+}
+
+var updateClient = &http.Client{Timeout: 60 * time.Second}
+
+// fetchURL downloads a URL, failing on anything but 200
+func fetchURL(url string) ([]byte, error) {
+	if verbose {
+		fmt.Fprintln(os.Stderr, "+ GET "+url)
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "bottle-launch")
+	resp, err := updateClient.Do(req)
+	if err != nil {
+		return nil, &bottleError{op: "self-update", msg: "can't reach GitHub: " + err.Error()}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &bottleError{op: "self-update", msg: "GitHub answered " + resp.Status + " for " + url}
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// latestRelease asks GitHub for the latest release
+func latestRelease() (*release, error) {
+	data, err := fetchURL(releasesURL)
+	if err != nil {
+		return nil, err
+	}
+	var r release
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, &bottleError{op: "self-update", msg: "unexpected answer from GitHub: " + err.Error()}
+	}
+	return &r, nil
+}
+
+// compareVersions compares two dotted versions numerically (a leading v and
+// any -suffix are ignored), returning -1, 0 or 1
+func compareVersions(a, b string) int {
+	parts := func(v string) []int {
+		v, _, _ = strings.Cut(strings.TrimPrefix(v, "v"), "-")
+		var nums []int
+		for _, p := range strings.Split(v, ".") {
+			n, _ := strconv.Atoi(p)
+			nums = append(nums, n)
+		}
+		return nums
+	}
+	pa, pb := parts(a), parts(b)
+	for i := range max(len(pa), len(pb)) {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// releaseChecksum finds an asset's SHA-256 in a SHA256SUMS file; an entry
+// that isn't 64 hex digits counts as missing
+func releaseChecksum(sums []byte, name string) string {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || strings.TrimPrefix(fields[1], "*") != name {
+			continue
+		}
+		sum, err := hex.DecodeString(fields[0])
+		if err != nil || len(sum) != sha256.Size {
+			return ""
+		}
+		return hex.EncodeToString(sum)
+	}
+	return ""
+}
+
+// cmdSelfUpdate checks for a newer release and, unless checkOnly, installs it
+func cmdSelfUpdate(checkOnly bool) error {
+	current, _, _ := buildVersion()
+	r, err := latestRelease()
+	if err != nil {
+		return err
+	}
+	latest := strings.TrimPrefix(r.TagName, "v")
+	isRelease := versionPattern.MatchString(current) // not a development build
+	if isRelease && compareVersions(current, latest) >= 0 {
+		fmt.Println("bottle-launch " + current + " is up to date.")
+		return nil
+	}
+	if !isRelease {
+		fmt.Println("This is a development build (" + current + "); the latest release is " + latest + ": " + r.HTMLURL)
+		if checkOnly {
+			return nil
+		}
+		return &bottleError{op: "self-update", msg: "not replacing a development build - rebuild it, or install the release by hand"}
+	}
+	fmt.Println("bottle-launch " + latest + " is available (this is " + current + "): " + r.HTMLURL)
+	if checkOnly {
+		return nil
+	}
+
+	asset := "bottle-launch-linux-" + runtime.GOARCH
+	binURL, sumsURL := r.assetURL(asset), r.assetURL(checksumsAsset)
+	if binURL == "" || sumsURL == "" {
+		return &bottleError{op: "self-update", msg: "release " + latest + " has no " + asset + " with a " + checksumsAsset + " - download it from " + r.HTMLURL}
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+
+	sums, err := fetchURL(sumsURL)
+	if err != nil {
+		return err
+	}
+	want := releaseChecksum(sums, asset)
+	if want == "" {
+		return &bottleError{op: "self-update", msg: checksumsAsset + " of release " + latest + " doesn't list " + asset}
+	}
+	say("Downloading " + asset + "...")
+	bin, err := fetchURL(binURL)
+	if err != nil {
+		return err
+	}
+	// SHA256SUMS comes from the same release, so this only catches a
+	// corrupt or truncated download, not a tampered release
+	sum := sha256.Sum256(bin)
+	if hex.EncodeToString(sum[:]) != want {
+		return &bottleError{op: "self-update", msg: "checksum mismatch for " + asset + " - not installed"}
+	}
+
+	// Write next to the binary and rename over it, so a failure leaves the
+	// old one in place
+	tmp := exe + ".update"
+	if err := os.WriteFile(tmp, bin, 0755); err != nil {
+		return &bottleError{op: "self-update", msg: "can't replace " + exe + " (" + err.Error() + ") - update it with the package manager that installed it"}
+	}
+	if err := os.Rename(tmp, exe); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	say("Updated " + exe + " to " + latest + ".")
+	return nil
+}
@@ -0,0 +1,62 @@
+// Tests for self-update: release checksums and version comparison.
+package app
+
+import "testing"
+
+func TestReleaseChecksum(t *testing.T) {
+	const sum = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	const asset = "bottle-launch-linux-amd64"
+	tests := []struct {
+		name string
+		sums string
+		want string
+	}{
+		{"text mode", sum + "  " + asset + "\n", sum},
+		{"binary marker", sum + " *" + asset + "\n", sum},
+		{"among others", "0000000000000000000000000000000000000000000000000000000000000000  bottle-launch-linux-arm64\n" + sum + "  " + asset + "\n", sum},
+		{"upper case", "9F86D081884C7D659A2FEAA0C55AD015A3BF4F1B2B0B822CD15D6C15B0F00A08  " + asset, sum},
+		{"no trailing newline", sum + "  " + asset, sum},
+		// Missing entries
+		{"empty file", "", ""},
+		{"missing entry", sum + "  bottle-launch-linux-arm64\n", ""},
+		{"prefix of name", sum + "  " + asset + ".sig\n", ""},
+		{"name is prefix", sum + "  bottle-launch\n", ""},
+		{"path in name", sum + "  dist/" + asset + "\n", ""},
+		{"extra field", sum + "  " + asset + " extra\n", ""},
+		{"name only", asset + "\n", ""},
+		// Malformed hex
+		{"not hex", "zz86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08  " + asset, ""},
+		{"too short", "9f86d081  " + asset, ""},
+		{"too long", sum + "00  " + asset, ""},
+		{"odd length", sum[:63] + "  " + asset, ""},
+	}
+	for _, tt := range tests {
+		got := releaseChecksum([]byte(tt.sums), asset)
+		if got != tt.want {
+			t.Errorf("%s: releaseChecksum() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"v1.2.3", "1.2.3", 0},
+		{"1.2", "1.2.0", 0},
+		{"1.2.3-rc1", "1.2.3", 0},
+		{"1.2.3", "1.2.4", -1},
+		{"1.2.4", "1.2.3", 1},
+		{"1.9.0", "1.10.0", -1},
+		{"2.0", "1.99.99", 1},
+		{"1.2", "1.2.1", -1},
+		{"0.10.0", "v0.9.12", 1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Session time limits: maximum run duration, pre-cutoff warnings, and app termination.
+package app
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"bottle-launch/internal/wait"
+)
+
+// parseTimeout parses a session time limit such as "2h", "90m", or "1h30m".
+// "0" or "" means no limit.
+func parseTimeout(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, &bottleError{op: "timeout", msg: fmt.Sprintf("invalid duration %q (use e.g. 90m or 2h)", s)}
+	}
+	return d, nil
+}
+
+// timeoutWarningLead returns how long before the cutoff to warn the user:
+// SessionWarningLead, or a quarter of the limit for short sessions
+func timeoutWarningLead(timeout time.Duration) time.Duration {
+	if lead := timeout / 4; lead < SessionWarningLead {
+		return lead
+	}
+	return SessionWarningLead
+}
+
+// formatRemaining formats a countdown, e.g. "1h04m" or "3m20s"
+func formatRemaining(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	d = d.Round(time.Second)
+	h, m, s := int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60
+	if h > 0 {
+		return fmt.Sprintf("%dh%02dm", h, m)
+	}
+	return fmt.Sprintf("%dm%02ds", m, s)
+}
+
+// sendNotification shows a desktop notification. Best-effort: does nothing
+// if notify-send is not installed.
+func sendNotification(summary, body string) {
+	_ = command("notify-send", "--app-name=bottle-launch", summary, body).Run()
+}
+
+// terminateApp asks the app to exit, then kills it after SessionKillGrace
+// if it is still running
+func terminateApp(cmd *exec.Cmd) {
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+	_ = cmd.Process.Signal(syscall.SIGTERM)
+	time.AfterFunc(SessionKillGrace, func() {
+		_ = cmd.Process.Kill()
+	})
+}
+
+// appRunning reports whether cmd's process is still running. It turns false
+// once whoever started the app has waited for it.
+func appRunning(cmd *exec.Cmd) bool {
+	return cmd != nil && cmd.Process != nil && cmd.Process.Signal(syscall.Signal(0)) == nil
+}
+
+// stopAppGracefully asks the app to exit and waits up to SessionKillGrace for
+// it before killing it, telling the user on stderr what it is waiting for.
+// A signal on hurry (e.g. a second ctrl+c) kills the app right away.
+func stopAppGracefully(cmd *exec.Cmd, hurry <-chan os.Signal) {
+	if !appRunning(cmd) {
+		return
+	}
+	exited, stop := wait.ForExit(cmd.Process.Pid)
+	defer stop()
+	_ = cmd.Process.Signal(syscall.SIGTERM)
+
+	announce := time.NewTimer(time.Second)
+	defer announce.Stop()
+	grace := time.NewTimer(SessionKillGrace)
+	defer grace.Stop()
+wait:
+	for {
+		select {
+		case <-exited:
+			return
+		case <-announce.C:
+			notice(fmt.Sprintf("Waiting for the app to exit (killed after %s; press ctrl+c again to kill it now)...", SessionKillGrace))
+		case <-hurry:
+			break wait
+		case <-grace.C:
+			break wait
+		}
+	}
+
+	_ = cmd.Process.Kill()
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+	}
+}
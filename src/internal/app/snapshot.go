@@ -0,0 +1,244 @@
+// Snapshots: point-in-time copies of a bottle, consistent even while it is mounted.
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// snapshotTimeFormat names snapshot files
+const snapshotTimeFormat = "20060102-150405"
+
+// bottleSnapshot is one snapshot of a bottle
+type bottleSnapshot struct {
+	Path      string
+	Taken     time.Time
+	Allocated int64 // bytes on disk (clones share most of theirs with the bottle)
+	Reflinked bool  // taken as a reflink clone (only known when just taken)
+}
+
+// Name returns the snapshot's timestamp name, as accepted by restore
+func (s bottleSnapshot) Name() string {
+	return strings.TrimSuffix(filepath.Base(s.Path), ".bottle")
+}
+
+// snapshotDir returns the directory holding a bottle's snapshots. Like the
+// archive, it is below the bottle directory so snapshots stay out of the
+// bottle list, and on the same filesystem so they can be cloned.
+func snapshotDir(bottle string) string {
+	base := globalConfig.GetDefault("SNAPSHOT_DIR", filepath.Join(bottleDir, "snapshots"))
+	return filepath.Join(base, bottleName(bottle))
+}
+
+// requireSnapshotBottle checks that a bottle can be snapshotted: LUKS image
+// files (and mock bottles, copied as directories)
+func requireSnapshotBottle(bottle string) error {
+	if bottleBackend(bottle) == BackendMock {
+		return nil
+	}
+	return requireImageBottle(bottle)
+}
+
+// listSnapshots returns a bottle's snapshots, newest first
+func listSnapshots(bottle string) []bottleSnapshot {
+	dir := snapshotDir(bottle)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var snapshots []bottleSnapshot
+	for _, e := range entries {
+		stem, ok := strings.CutSuffix(e.Name(), ".bottle")
+		if !ok {
+			continue
+		}
+		taken, err := time.ParseInLocation(snapshotTimeFormat, stem, time.Local)
+		if err != nil {
+			continue
+		}
+		s := bottleSnapshot{Path: filepath.Join(dir, e.Name()), Taken: taken}
+		_, s.Allocated, _ = bottleDiskUsage(s.Path)
+		snapshots = append(snapshots, s)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Taken.After(snapshots[j].Taken) })
+	return snapshots
+}
+
+// findSnapshot looks up a snapshot of bottle by name (its timestamp), file
+// name, or path
+func findSnapshot(bottle, name string) (bottleSnapshot, error) {
+	name = strings.TrimSuffix(filepath.Base(name), ".bottle")
+	for _, s := range listSnapshots(bottle) {
+		if s.Name() == name {
+			return s, nil
+		}
+	}
+	return bottleSnapshot{}, &bottleError{op: "snapshot", msg: "no snapshot " + name + " of " + bottleName(bottle) +
+		" (see bottle-launch snapshots " + bottleName(bottle) + ")"}
+}
+
+// copyBottle copies a bottle file (or mock directory), as a reflink clone
+// where the filesystem supports it and sparse otherwise; reflinked reports
+// which it was
+func copyBottle(from, to string) (reflinked bool, err error) {
+	if fi, err := os.Stat(from); err == nil && fi.Mode().IsRegular() && cloneFile(from, to) == nil {
+		return true, nil
+	}
+	out, err := command("cp", "-a", "--reflink=auto", "--sparse=always", from, to).CombinedOutput()
+	if err != nil {
+		return false, &bottleError{op: "snapshot", msg: strings.TrimSpace(string(out))}
+	}
+	return false, nil
+}
+
+// freezeFilesystem suspends writes to the filesystem mounted at mountPoint
+// (fsfreeze, through pkexec/sudo) until thaw is called. The privileged shell
+// waits on its stdin, so the filesystem thaws even if bottle-launch dies.
+func freezeFilesystem(mountPoint string) (thaw func() error, err error) {
+	cmd := privCmd("sh", "-c", `fsfreeze --freeze "$1" || exit 1; echo frozen; read _; fsfreeze --unfreeze "$1"`, "sh", mountPoint)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return nil, &bottleError{op: "fsfreeze", msg: err.Error()}
+	}
+	if line, _ := bufio.NewReader(stdout).ReadString('\n'); strings.TrimSpace(line) != "frozen" {
+		stdin.Close()
+		_ = cmd.Wait()
+		return nil, &bottleError{op: "fsfreeze", msg: strings.TrimSpace(stderr.String())}
+	}
+
+	return func() error {
+		stdin.Close()
+		go io.Copy(io.Discard, stdout)
+		if err := cmd.Wait(); err != nil {
+			return &bottleError{op: "fsfreeze", msg: "could not thaw " + mountPoint + " (" + strings.TrimSpace(stderr.String()) +
+				"); run: sudo fsfreeze --unfreeze " + mountPoint}
+		}
+		return nil
+	}, nil
+}
+
+// takeSnapshot copies a bottle into its snapshot directory. A mounted LUKS
+// bottle is frozen for the copy; apps writing to it wait until it is done.
+func takeSnapshot(bottle string) (bottleSnapshot, error) {
+	if err := requireSnapshotBottle(bottle); err != nil {
+		return bottleSnapshot{}, err
+	}
+	if _, err := os.Stat(bottle); err != nil {
+		return bottleSnapshot{}, errBottleNotFound
+	}
+	dir := snapshotDir(bottle)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return bottleSnapshot{}, err
+	}
+	taken := time.Now()
+	path := filepath.Join(dir, taken.Format(snapshotTimeFormat)+".bottle")
+	if _, err := os.Stat(path); err == nil {
+		return bottleSnapshot{}, &bottleError{op: "snapshot", msg: filepath.Base(path) + " already exists; try again in a second"}
+	}
+
+	var reflinked bool
+	if info := currentMount(bottle); info != nil && info.MountPoint != "" && bottleBackend(bottle) != BackendMock {
+		thaw, err := freezeFilesystem(info.MountPoint)
+		if err != nil {
+			return bottleSnapshot{}, err
+		}
+		// The frozen filesystem has flushed everything to the loop device,
+		// which writes through the bottle file's page cache: a reflink
+		// writes that back first, and cp reads it
+		reflinked, err = copySnapshot(bottle, path)
+		if thawErr := thaw(); thawErr != nil {
+			return bottleSnapshot{}, thawErr
+		}
+		if err != nil {
+			return bottleSnapshot{}, err
+		}
+	} else {
+		var err error
+		if reflinked, err = copySnapshot(bottle, path); err != nil {
+			return bottleSnapshot{}, err
+		}
+	}
+
+	s := bottleSnapshot{Path: path, Taken: taken, Reflinked: reflinked}
+	_, s.Allocated, _ = bottleDiskUsage(path)
+	return s, nil
+}
+
+// copySnapshot copies bottle to path through a temp name, so an interrupted
+// copy never looks like a snapshot (or a clone)
+func copySnapshot(bottle, path string) (reflinked bool, err error) {
+	tmp := path + ".partial"
+	if reflinked, err = copyBottle(bottle, tmp); err != nil {
+		os.RemoveAll(tmp)
+		return false, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.RemoveAll(tmp)
+		return false, err
+	}
+	return reflinked, nil
+}
+
+// restoreSnapshot replaces a locked bottle with one of its snapshots. The
+// current version is snapshotted first, so a restore can be undone; it is
+// returned.
+func restoreSnapshot(bottle string, s bottleSnapshot) (bottleSnapshot, error) {
+	if err := requireSnapshotBottle(bottle); err != nil {
+		return bottleSnapshot{}, err
+	}
+	if currentMount(bottle) != nil {
+		return bottleSnapshot{}, errBottleMounted
+	}
+	lock, err := acquireBottleLock(bottle, "restore")
+	if err != nil {
+		return bottleSnapshot{}, err
+	}
+	defer lock.Release()
+
+	var kept bottleSnapshot
+	if _, err := os.Stat(bottle); err == nil {
+		if kept, err = takeSnapshot(bottle); err != nil {
+			return bottleSnapshot{}, err
+		}
+	}
+
+	tmp := bottle + ".restore.partial"
+	if _, err := copyBottle(s.Path, tmp); err != nil {
+		os.RemoveAll(tmp)
+		return kept, err
+	}
+	// rename only replaces files; mock bottles are directories
+	if fi, err := os.Stat(bottle); err == nil && fi.IsDir() {
+		if err := os.RemoveAll(bottle); err != nil {
+			os.RemoveAll(tmp)
+			return kept, err
+		}
+	}
+	if err := os.Rename(tmp, bottle); err != nil {
+		os.RemoveAll(tmp)
+		return kept, err
+	}
+	// The file changed on purpose; don't warn about it on the next unlock
+	return kept, recordLockedState(bottle)
+}
+
+// deleteSnapshot removes a snapshot
+func deleteSnapshot(s bottleSnapshot) error {
+	return os.RemoveAll(s.Path)
+}
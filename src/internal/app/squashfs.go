@@ -0,0 +1,448 @@
+// squashfs backend: read-only bottles packed from a directory, optionally inside LUKS, with an optional writable overlay.
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"bottle-launch/internal/sysfs"
+)
+
+// squashfsLUKSLabel marks the LUKS2 header of an encrypted squashfs bottle,
+// so it is recognised without its config
+const squashfsLUKSLabel = "bottle-launch-squashfs"
+
+// luksHeaderMargin is the room left in an encrypted image for the LUKS2
+// header (16 MiB by default)
+const luksHeaderMargin = 32 << 20
+
+var (
+	// squashfsEncrypt is set by create --encrypt
+	squashfsEncrypt bool
+	// squashfsOverlay is set by create --overlay
+	squashfsOverlay bool
+)
+
+// squashfsBackend implements Backend for squashfs images
+type squashfsBackend struct{}
+
+// squashfsImageKind returns "plain" or "luks" for a squashfs bottle, from
+// the first bytes of the file ("" if it is not one)
+func squashfsImageKind(bottle string) string {
+	f, err := os.Open(bottle)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	// LUKS2 header: magic, version, header size, sequence id, then the label
+	header := make([]byte, 72)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return ""
+	}
+	switch {
+	case bytes.HasPrefix(header, []byte("hsqs")):
+		return "plain"
+	case bytes.HasPrefix(header, []byte("LUKS\xba\xbe")) &&
+		string(bytes.TrimRight(header[24:72], "\x00")) == squashfsLUKSLabel:
+		return "luks"
+	}
+	return ""
+}
+
+// opensWithoutSecret reports whether a bottle mounts without a password or
+// key: an unencrypted squashfs image
+func opensWithoutSecret(bottle string) bool {
+	return bottleBackend(bottle) == BackendSquashfs && squashfsImageKind(bottle) == "plain"
+}
+
+// squashfsMountPoint returns where a squashfs bottle is mounted (its fixed
+// mount point if it has one)
+func squashfsMountPoint(bottle string) string {
+	if dir := fixedMountPoint(bottle); dir != "" {
+		return dir
+	}
+	return filepath.Join(lockDir(), "mnt", strings.TrimSuffix(bottleName(bottle), ".bottle"))
+}
+
+// squashfsImageDir returns where the image is mounted under an overlay.
+// Named by hash: overlay options are comma-separated.
+func squashfsImageDir(bottle string) string {
+	return filepath.Join(lockDir(), "squashfs", getBottleHash(bottle))
+}
+
+// squashfsOverlayDir returns where a bottle's overlay keeps its changes
+// (upper/) and fuse-overlayfs's scratch space (work/)
+func squashfsOverlayDir(bottle string) string {
+	if squashfsImageKind(bottle) == "luks" {
+		return filepath.Join(lockDir(), "overlay", getBottleHash(bottle))
+	}
+	return filepath.Join(configDir, "overlays", getBottleHash(bottle))
+}
+
+// mountFSType returns the filesystem type mounted at dir ("" if none)
+func mountFSType(dir string) string {
+	for _, m := range sysfs.Mounts() {
+		if m.MountPoint == dir {
+			return m.FSType
+		}
+	}
+	return ""
+}
+
+// Create packs the directory given as size into a squashfs bottle, inside
+// LUKS with create --encrypt (an empty password prompts on the terminal)
+func (squashfsBackend) Create(ctx context.Context, bottle, source, password string) (err error) {
+	if bottle == "" {
+		return errBottlePathRequired
+	}
+	bottle = newBottlePath(bottle)
+	if _, err := os.Lstat(bottle); err == nil {
+		return errBottleExists
+	}
+	if fi, err := os.Stat(source); err != nil || !fi.IsDir() {
+		return &bottleError{op: "squashfs", msg: "give the directory to pack instead of a size"}
+	}
+	if _, err := exec.LookPath("mksquashfs"); err != nil {
+		return &bottleError{op: "squashfs", msg: "mksquashfs is not installed (squashfs-tools)", class: classMissingTool}
+	}
+	if squashfsEncrypt && password == "" {
+		p, err := promptNewPassword()
+		if err != nil {
+			return err
+		}
+		password = p
+	}
+	realPath, err := filepath.Abs(bottle)
+	if err != nil {
+		return &bottleError{op: "path", msg: err.Error()}
+	}
+	os.MkdirAll(filepath.Dir(realPath), 0700)
+
+	claim, err := startCreating(realPath)
+	if err != nil {
+		return err
+	}
+	defer claim.Close()
+	tmp := claim.Name()
+	j, err := beginJournal("create", realPath)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	defer j.finish()
+	j.setTemp(tmp)
+
+	perms := defaultPermissions()
+	perms.Backend = BackendSquashfs
+	perms.Overlay = squashfsOverlay
+	configSaved := saveNewConfig(j, realPath, perms)
+	image := tmp
+	if squashfsEncrypt {
+		image = tmp + ".squashfs"
+		defer os.Remove(image)
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		_ = configSaved()
+		os.Remove(getConfigPath(realPath))
+		os.Remove(tmp)
+	}()
+
+	// Files are packed as root's: the packer's UIDs mean nothing to the team
+	if err = j.next(ctx, "pack"); err != nil {
+		return err
+	}
+	pack := commandContext(ctx, "mksquashfs", source, image, "-noappend", "-all-root", "-comp", "zstd", "-quiet")
+	if out, cmdErr := pack.CombinedOutput(); cmdErr != nil {
+		os.Remove(image)
+		return &bottleError{op: "mksquashfs", msg: strings.TrimSpace(string(out))}
+	}
+	if squashfsEncrypt {
+		if err = wrapSquashfsInLUKS(ctx, j, image, claim, password); err != nil {
+			return err
+		}
+	}
+	if err = os.Chmod(tmp, 0600); err != nil {
+		return err
+	}
+	if err = configSaved(); err != nil {
+		return err
+	}
+	if err = j.next(ctx, "rename"); err != nil {
+		return err
+	}
+	err = finishCreating(tmp, realPath)
+	return err
+}
+
+// wrapSquashfsInLUKS makes the claimed file a LUKS2 image just big enough
+// for image and copies image into it, recording its steps in j
+func wrapSquashfsInLUKS(ctx context.Context, j *journal, image string, claim *os.File, password string) error {
+	bottle := claim.Name()
+	fi, err := os.Stat(image)
+	if err != nil {
+		return err
+	}
+	if err := createBottleFile(ctx, claim, fi.Size()+luksHeaderMargin); err != nil {
+		return err
+	}
+
+	if err := j.next(ctx, "format"); err != nil {
+		return err
+	}
+	format := privCmdContext(ctx, "cryptsetup", "luksFormat", "--type", "luks2", "--label", squashfsLUKSLabel, "--batch-mode", bottle, "-")
+	format.Stdin = strings.NewReader(password)
+	if out, err := format.CombinedOutput(); err != nil {
+		return &bottleError{op: "LUKS format", msg: string(out)}
+	}
+
+	if err := j.next(ctx, "loop setup"); err != nil {
+		return err
+	}
+	loopOut, err := privCmdContext(ctx, "losetup", "--find", "--show", "--", bottle).Output()
+	if err != nil {
+		return &bottleError{op: "loop setup", msg: err.Error()}
+	}
+	loopDev := strings.TrimSpace(string(loopOut))
+	j.setLoop(loopDev)
+	defer privCmd("losetup", "-d", loopDev).Run()
+
+	mapperName := getMapperName(bottle)
+	j.setMapper(mapperName)
+	if err := j.next(ctx, "open"); err != nil {
+		return err
+	}
+	open := privCmdContext(ctx, "cryptsetup", "open", "--key-file=-", loopDev, mapperName)
+	open.Stdin = strings.NewReader(password)
+	if out, err := open.CombinedOutput(); err != nil {
+		return &bottleError{op: "LUKS open", msg: string(out)}
+	}
+	defer cryptsetupCmd("close", mapperName).Run()
+
+	if err := j.next(ctx, "copy"); err != nil {
+		return err
+	}
+	copyImage := privCmdContext(ctx, "dd", "if="+image, "of=/dev/mapper/"+mapperName, "bs=4M", "conv=fsync", "status=none")
+	if out, err := copyImage.CombinedOutput(); err != nil {
+		return &bottleError{op: "copy", msg: strings.TrimSpace(string(out))}
+	}
+	return nil
+}
+
+// Mount mounts a squashfs bottle read-only, under its overlay if it has one
+// (or returns the existing mount)
+func (squashfsBackend) Mount(ctx context.Context, bottle, password string) (*MountInfo, error) {
+	realPath, err := filepath.Abs(bottle)
+	if err != nil {
+		return nil, err
+	}
+	info := &MountInfo{BottlePath: realPath, MountPoint: squashfsMountPoint(realPath), Backend: BackendSquashfs}
+	info.LoopDevice = findLoopForFile(realPath)
+	if info.LoopDevice != "" {
+		info.CleartextDevice = sysfs.CryptHolder(info.LoopDevice)
+	}
+	if mountFSType(info.MountPoint) != "" {
+		return info, nil
+	}
+
+	overlay := loadPermissions(getConfigPath(realPath)).Overlay
+	imageDir := info.MountPoint
+	if overlay {
+		if _, err := exec.LookPath("fuse-overlayfs"); err != nil {
+			return nil, &mountError{op: "mount", msg: "the writable overlay needs fuse-overlayfs"}
+		}
+		imageDir = squashfsImageDir(realPath)
+	}
+
+	if mountFSType(imageDir) == "" {
+		if err := mountSquashfsImage(ctx, info, imageDir, password); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		info.Unlocked = true
+	}
+	if !overlay {
+		return info, nil
+	}
+
+	dir := squashfsOverlayDir(realPath)
+	upper, work := filepath.Join(dir, "upper"), filepath.Join(dir, "work")
+	for _, d := range []string{upper, work, info.MountPoint} {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			return nil, &mountError{op: "mount", msg: err.Error()}
+		}
+	}
+	// squash_to_*: the image's files are root's, the merged view is the user's
+	opts := "lowerdir=" + imageDir + ",upperdir=" + upper + ",workdir=" + work +
+		",squash_to_uid=" + strconv.Itoa(os.Getuid()) + ",squash_to_gid=" + strconv.Itoa(os.Getgid()) + ",noexec"
+	if out, err := commandContext(ctx, "fuse-overlayfs", "-o", opts, info.MountPoint).CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			if info.Unlocked {
+				_ = squashfsBackend{}.Unmount(info)
+			}
+			return nil, ctx.Err()
+		}
+		return nil, &mountError{op: "overlay", msg: strings.TrimSpace(string(out) + " " + err.Error())}
+	}
+	return info, nil
+}
+
+// mountSquashfsImage mounts a bottle's image read-only at dir: plain images
+// with squashfuse (or mount through pkexec/sudo without it), encrypted ones
+// after opening their LUKS mapping read-only
+func mountSquashfsImage(ctx context.Context, info *MountInfo, dir, password string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return &mountError{op: "mount", msg: err.Error()}
+	}
+	if squashfsImageKind(info.BottlePath) == "plain" {
+		var out []byte
+		var err error
+		if _, lookErr := exec.LookPath("squashfuse"); lookErr == nil {
+			out, err = commandContext(ctx, "squashfuse", info.BottlePath, dir).CombinedOutput()
+		} else {
+			out, err = privCmdContext(ctx, "mount", "-t", "squashfs", "-o", "ro,loop,nodev,nosuid,noexec"+mountContextOption(), info.BottlePath, dir).CombinedOutput()
+		}
+		if err != nil {
+			return mountFailure(out, err)
+		}
+		return nil
+	}
+
+	attached := false
+	if info.LoopDevice == "" {
+		out, err := privCmdContext(ctx, "losetup", "--read-only", "--find", "--show", "--", info.BottlePath).Output()
+		if err != nil {
+			return &mountError{op: "loop-setup", msg: err.Error()}
+		}
+		info.LoopDevice = strings.TrimSpace(string(out))
+		attached = true
+	}
+	detach := func() {
+		if attached {
+			privCmd("losetup", "-d", info.LoopDevice).Run()
+			info.LoopDevice = ""
+		}
+	}
+
+	opened := false
+	if info.CleartextDevice == "" {
+		mapperName := getMapperName(info.BottlePath)
+		var out []byte
+		var err error
+		if password != "" {
+			open := privCmdContext(ctx, "cryptsetup", "open", "--readonly", "--key-file=-", info.LoopDevice, mapperName)
+			open.Stdin = strings.NewReader(password)
+			out, err = open.CombinedOutput()
+		} else {
+			open := privCmdContext(ctx, "cryptsetup", "open", "--readonly", info.LoopDevice, mapperName)
+			open.Stdin, open.Stdout, open.Stderr = os.Stdin, os.Stdout, os.Stderr
+			err = open.Run()
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				// Stopped just as it opened
+				if _, statErr := os.Stat("/dev/mapper/" + mapperName); statErr == nil {
+					cryptsetupCmd("close", mapperName).Run()
+				}
+			}
+			detach()
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) && exitErr.ExitCode() == cryptsetupExitBadPassphrase {
+				return errWrongPassword
+			}
+			return &mountError{op: "unlock", msg: strings.TrimSpace(string(out) + " " + err.Error())}
+		}
+		info.CleartextDevice = "/dev/mapper/" + mapperName
+		opened = true
+	}
+
+	out, err := privCmdContext(ctx, "mount", "-t", "squashfs", "-o", "ro,nodev,nosuid,noexec"+mountContextOption(), info.CleartextDevice, dir).CombinedOutput()
+	if err != nil {
+		if opened {
+			cryptsetupCmd("close", filepath.Base(info.CleartextDevice)).Run()
+			info.CleartextDevice = ""
+			detach()
+		}
+		return mountFailure(out, err)
+	}
+	return nil
+}
+
+// Unmount unmounts a squashfs bottle's overlay and image, and closes its
+// LUKS mapping if it is encrypted
+func (squashfsBackend) Unmount(info *MountInfo) error {
+	if info == nil {
+		return nil
+	}
+	dirs := []string{squashfsMountPoint(info.BottlePath), squashfsImageDir(info.BottlePath)}
+	for _, dir := range dirs {
+		fsType := mountFSType(dir)
+		if fsType == "" {
+			continue
+		}
+		_ = command("sync", "-f", dir).Run()
+		unmount := privCmd("umount", dir)
+		if strings.HasPrefix(fsType, "fuse") {
+			unmount = fusermountCmd("-u", dir)
+		}
+		if out, err := unmount.CombinedOutput(); err != nil {
+			if busy := checkBusy(dir); busy != nil {
+				return busy
+			}
+			return &mountError{op: "unmount", msg: strings.TrimSpace(string(out))}
+		}
+		if dir != fixedMountPoint(info.BottlePath) {
+			os.Remove(dir)
+		}
+	}
+
+	if squashfsImageKind(info.BottlePath) != "luks" {
+		return nil
+	}
+	// Changes to an encrypted image only last until it is locked
+	os.RemoveAll(squashfsOverlayDir(info.BottlePath))
+	if loopDev := findLoopForFile(info.BottlePath); loopDev != "" {
+		if cleartext := sysfs.CryptHolder(loopDev); cleartext != "" {
+			if out, err := cryptsetupCmd("close", filepath.Base(cleartext)).CombinedOutput(); err != nil {
+				return &mountError{op: "lock", msg: string(out)}
+			}
+		}
+		if out, err := privCmd("losetup", "-d", loopDev).CombinedOutput(); err != nil {
+			return &mountError{op: "loop-delete", msg: string(out)}
+		}
+	}
+	return nil
+}
+
+// Current returns the bottle's mount, or nil if nothing of it is open
+func (squashfsBackend) Current(bottle string) *MountInfo {
+	realPath, err := filepath.Abs(bottle)
+	if err != nil {
+		realPath = bottle
+	}
+	info := &MountInfo{BottlePath: realPath, Backend: BackendSquashfs}
+	if info.LoopDevice = findLoopForFile(realPath); info.LoopDevice != "" {
+		info.CleartextDevice = sysfs.CryptHolder(info.LoopDevice)
+	}
+	mount := squashfsMountPoint(realPath)
+	if mountFSType(mount) != "" {
+		info.MountPoint = mount
+	} else if mountFSType(squashfsImageDir(realPath)) == "" && info.LoopDevice == "" {
+		return nil
+	}
+	return info
+}
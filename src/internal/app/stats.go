@@ -0,0 +1,143 @@
+// Usage statistics: launch counts and cumulative runtime per (bottle, app) pair.
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AppStats holds usage totals for one app in one bottle
+type AppStats struct {
+	AppID    string
+	Launches int
+	Runtime  time.Duration
+	LastRun  int64 // unix time the last run ended
+}
+
+// getStatsPath returns the stats file path for a bottle.
+// Stats live next to the bottle config so they survive config edits.
+func getStatsPath(bottle string) string {
+	return filepath.Join(configDir, getBottleHash(bottle)+".stats")
+}
+
+// loadStats reads a bottle's stats file, sorted by runtime (most used first).
+// Each line is <app_id>=<launches>,<runtime seconds>,<last run unix time>.
+func loadStats(path string) []AppStats {
+	var stats []AppStats
+
+	file, err := os.Open(path)
+	if err != nil {
+		return stats
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		appID, val, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		fields := strings.Split(val, ",")
+		if len(fields) != 3 {
+			continue
+		}
+
+		s := AppStats{AppID: appID}
+		s.Launches, _ = strconv.Atoi(fields[0])
+		seconds, _ := strconv.ParseInt(fields[1], 10, 64)
+		s.Runtime = time.Duration(seconds) * time.Second
+		s.LastRun, _ = strconv.ParseInt(fields[2], 10, 64)
+		stats = append(stats, s)
+	}
+
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].Runtime > stats[j].Runtime
+	})
+	return stats
+}
+
+// saveStats writes a bottle's stats file atomically
+func saveStats(path string, stats []AppStats) error {
+	os.MkdirAll(filepath.Dir(path), 0700)
+
+	var sb strings.Builder
+	for _, s := range stats {
+		fmt.Fprintf(&sb, "%s=%d,%d,%d\n", s.AppID, s.Launches, int64(s.Runtime/time.Second), s.LastRun)
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Dir(path), ".bottle-stats-*.tmp")
+	if err != nil {
+		return err
+	}
+	tempPath := tempFile.Name()
+	if _, err := tempFile.WriteString(sb.String()); err != nil {
+		tempFile.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return os.Rename(tempPath, path)
+}
+
+// recordAppRun adds a finished run of appID, started at started, to the bottle's stats
+func recordAppRun(bottle, appID string, started time.Time) error {
+	if appID == "" || started.IsZero() {
+		return nil
+	}
+
+	path := getStatsPath(bottle)
+	stats := loadStats(path)
+
+	i := -1
+	for j := range stats {
+		if stats[j].AppID == appID {
+			i = j
+			break
+		}
+	}
+	if i < 0 {
+		stats = append(stats, AppStats{AppID: appID})
+		i = len(stats) - 1
+	}
+
+	now := time.Now()
+	stats[i].Launches++
+	stats[i].Runtime += now.Sub(started).Round(time.Second)
+	stats[i].LastRun = now.Unix()
+	return saveStats(path, stats)
+}
+
+// totalRuntime sums the runtime of all apps
+func totalRuntime(stats []AppStats) time.Duration {
+	var total time.Duration
+	for _, s := range stats {
+		total += s.Runtime
+	}
+	return total
+}
+
+// formatRuntime formats a cumulative runtime, e.g. "42h10m", "12m", or "30s"
+func formatRuntime(d time.Duration) string {
+	d = d.Round(time.Second)
+	switch {
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%ds", int(d.Seconds()))
+}
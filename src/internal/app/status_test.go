@@ -0,0 +1,37 @@
+// Tests for status: the exit code of each bottle state.
+package app
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStatusExitCode(t *testing.T) {
+	tests := []struct {
+		state string
+		want  int
+	}{
+		{"mounted", 0},
+		{"unlocked", ExitStatusUnlocked},
+		{"locked", ExitStatusLocked},
+		{"missing", ExitStatusMissing},
+		{"", ExitStatusLocked},
+	}
+	for _, tt := range tests {
+		if got := statusExitCode(bottleStatus{State: tt.state}); got != tt.want {
+			t.Errorf("statusExitCode(%q) = %d, want %d", tt.state, got, tt.want)
+		}
+	}
+	// Scripts rely on the numbers, not just the names
+	if ExitStatusUnlocked != 3 || ExitStatusLocked != 4 || ExitStatusMissing != 5 {
+		t.Errorf("status exit codes are %d, %d, %d, want 3, 4, 5", ExitStatusUnlocked, ExitStatusLocked, ExitStatusMissing)
+	}
+}
+
+func TestCollectBottleStatusMissing(t *testing.T) {
+	bottle := filepath.Join(t.TempDir(), "gone.bottle")
+	s := collectBottleStatus(bottle)
+	if s.State != "missing" || statusExitCode(s) != ExitStatusMissing {
+		t.Errorf("collectBottleStatus(missing) = %q (exit %d), want missing (exit %d)", s.State, statusExitCode(s), ExitStatusMissing)
+	}
+}
@@ -0,0 +1,216 @@
+// Lipgloss styles for TUI colors and formatting.
+package app
+
+import (
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Theme defines the palette used to build all TUI styles
+type Theme struct {
+	Name      string
+	Primary   lipgloss.TerminalColor
+	Secondary lipgloss.TerminalColor
+	Error     lipgloss.TerminalColor
+	Warning   lipgloss.TerminalColor
+	Dim       lipgloss.TerminalColor
+	Text      lipgloss.TerminalColor
+}
+
+var themes = map[string]Theme{
+	"default": {
+		Name:      "default",
+		Primary:   lipgloss.Color("212"), // Pink
+		Secondary: lipgloss.Color("86"),  // Cyan
+		Error:     lipgloss.Color("196"), // Red
+		Warning:   lipgloss.Color("214"), // Orange
+		Dim:       lipgloss.Color("240"), // Gray
+		Text:      lipgloss.Color("252"), // Light gray
+	},
+	// Bright ANSI colors only, with a light "dim" so secondary text stays readable
+	"high-contrast": {
+		Name:      "high-contrast",
+		Primary:   lipgloss.Color("11"), // Bright yellow
+		Secondary: lipgloss.Color("14"), // Bright cyan
+		Error:     lipgloss.Color("9"),  // Bright red
+		Warning:   lipgloss.Color("11"), // Bright yellow
+		Dim:       lipgloss.Color("7"),  // White
+		Text:      lipgloss.Color("15"), // Bright white
+	},
+	// No colors at all; emphasis comes from bold/italic/faint only
+	"monochrome": {
+		Name:      "monochrome",
+		Primary:   lipgloss.NoColor{},
+		Secondary: lipgloss.NoColor{},
+		Error:     lipgloss.NoColor{},
+		Warning:   lipgloss.NoColor{},
+		Dim:       lipgloss.NoColor{},
+		Text:      lipgloss.NoColor{},
+	},
+}
+
+// currentTheme is the theme the styles below were built from
+var currentTheme Theme
+
+var (
+	// Header/Footer
+	headerStyle lipgloss.Style
+	footerStyle lipgloss.Style
+
+	// Titles
+	titleStyle    lipgloss.Style
+	subtitleStyle lipgloss.Style
+
+	// Items
+	itemStyle         lipgloss.Style
+	selectedItemStyle lipgloss.Style
+	cursorStyle       lipgloss.Style
+	selectedStyle     lipgloss.Style
+
+	// Status
+	dimStyle     lipgloss.Style
+	hintStyle    lipgloss.Style
+	errorStyle   lipgloss.Style
+	warningStyle lipgloss.Style
+
+	// Bottle list badges: how the bottle unlocks, and risky settings
+	passwordBadgeStyle lipgloss.Style
+	fido2BadgeStyle    lipgloss.Style
+	keyDriveBadgeStyle lipgloss.Style
+	riskBadgeStyle     lipgloss.Style
+
+	// Spinner
+	spinnerStyle lipgloss.Style
+)
+
+func init() {
+	applyTheme(themes["default"])
+}
+
+// resolveTheme picks the theme from NO_COLOR, THEME, and COLOR_* settings.
+// NO_COLOR (any non-empty value, see https://no-color.org) always wins.
+func resolveTheme(cfg *GlobalConfig) Theme {
+	if os.Getenv("NO_COLOR") != "" {
+		return themes["monochrome"]
+	}
+
+	t, ok := themes[strings.ToLower(cfg.Get("THEME"))]
+	if !ok {
+		t = themes["default"]
+	}
+
+	// Individual colors may be overridden (ANSI number or #rrggbb)
+	overrides := map[string]*lipgloss.TerminalColor{
+		"COLOR_PRIMARY":   &t.Primary,
+		"COLOR_SECONDARY": &t.Secondary,
+		"COLOR_ERROR":     &t.Error,
+		"COLOR_WARNING":   &t.Warning,
+		"COLOR_DIM":       &t.Dim,
+		"COLOR_TEXT":      &t.Text,
+	}
+	for key, color := range overrides {
+		if v := cfg.Get(key); v != "" {
+			*color = lipgloss.Color(v)
+		}
+	}
+
+	return t
+}
+
+// applyTheme rebuilds all styles from a theme
+func applyTheme(t Theme) {
+	currentTheme = t
+
+	headerStyle = lipgloss.NewStyle().
+		Foreground(t.Primary).
+		Bold(true)
+
+	footerStyle = lipgloss.NewStyle().
+		Foreground(t.Dim)
+
+	titleStyle = lipgloss.NewStyle().
+		Foreground(t.Primary).
+		Bold(true).
+		MarginBottom(1)
+
+	subtitleStyle = lipgloss.NewStyle().
+		Foreground(t.Secondary).
+		Bold(true)
+
+	itemStyle = lipgloss.NewStyle().
+		Foreground(t.Text)
+
+	selectedItemStyle = lipgloss.NewStyle().
+		Foreground(t.Primary).
+		Bold(true)
+
+	cursorStyle = lipgloss.NewStyle().
+		Foreground(t.Primary)
+
+	selectedStyle = lipgloss.NewStyle().
+		Foreground(t.Secondary)
+
+	dimStyle = lipgloss.NewStyle().
+		Foreground(t.Dim)
+
+	hintStyle = lipgloss.NewStyle().
+		Foreground(t.Dim).
+		Italic(true)
+
+	errorStyle = lipgloss.NewStyle().
+		Foreground(t.Error).
+		Bold(true)
+
+	warningStyle = lipgloss.NewStyle().
+		Foreground(t.Warning).
+		Bold(true)
+
+	passwordBadgeStyle = lipgloss.NewStyle().
+		Foreground(t.Dim)
+
+	fido2BadgeStyle = lipgloss.NewStyle().
+		Foreground(t.Secondary).
+		Bold(true)
+
+	keyDriveBadgeStyle = lipgloss.NewStyle().
+		Foreground(t.Primary)
+
+	riskBadgeStyle = lipgloss.NewStyle().
+		Foreground(t.Error).
+		Bold(true)
+
+	spinnerStyle = lipgloss.NewStyle().
+		Foreground(t.Primary)
+
+	if t.Name == "monochrome" {
+		// Without color, mark selection and secondary text by weight instead
+		selectedStyle = selectedStyle.Bold(true)
+		dimStyle = dimStyle.Faint(true)
+		footerStyle = footerStyle.Faint(true)
+		errorStyle = errorStyle.Underline(true)
+		passwordBadgeStyle = passwordBadgeStyle.Faint(true)
+		keyDriveBadgeStyle = keyDriveBadgeStyle.Italic(true)
+		riskBadgeStyle = riskBadgeStyle.Underline(true)
+	}
+}
+
+// formTheme returns the huh form theme matching the current TUI theme
+func formTheme() *huh.Theme {
+	switch currentTheme.Name {
+	case "monochrome":
+		t := huh.ThemeBase()
+		t.Focused.FocusedButton = t.Focused.FocusedButton.UnsetForeground().UnsetBackground().Reverse(true)
+		t.Focused.BlurredButton = t.Focused.BlurredButton.UnsetForeground().UnsetBackground()
+		t.Focused.TextInput.Placeholder = t.Focused.TextInput.Placeholder.UnsetForeground().Faint(true)
+		t.Blurred.FocusedButton = t.Focused.FocusedButton
+		t.Blurred.BlurredButton = t.Focused.BlurredButton
+		t.Blurred.TextInput.Placeholder = t.Focused.TextInput.Placeholder
+		return t
+	case "high-contrast":
+		return huh.ThemeBase16()
+	}
+	return huh.ThemeCharm()
+}
@@ -0,0 +1,194 @@
+// Cloud sync: pushes and pulls locked bottle files to rclone remotes with conflict detection.
+package app
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// syncState is what bottle-launch remembers about a bottle's last sync
+type syncState struct {
+	Remote   string      // rclone remote directory, e.g. "gdrive:bottles"
+	Local    lockedState // local file size/mtime after the last sync
+	RemoteID string      // remote object "<size>@<modtime>" after the last sync
+}
+
+// remoteObject returns the rclone path of a bottle's archive on a remote
+func remoteObject(remote, bottle string) string {
+	return strings.TrimSuffix(remote, "/") + "/" + bottleName(bottle) + archiveSuffix
+}
+
+// remoteObjectID returns "<size>@<modtime>" for a remote file, or "" if it doesn't exist
+func remoteObjectID(object string) (string, error) {
+	out, err := command("rclone", "lsjson", object).Output()
+	if err != nil {
+		// rclone exits non-zero for a missing object; distinguish from real failures
+		if exitErr, ok := err.(*exec.ExitError); ok && strings.Contains(string(exitErr.Stderr), "not found") {
+			return "", nil
+		}
+		return "", &bottleError{op: "sync", msg: "rclone lsjson " + object + ": " + err.Error()}
+	}
+
+	var entries []struct {
+		Size    int64
+		ModTime time.Time
+	}
+	if err := json.Unmarshal(out, &entries); err != nil {
+		return "", &bottleError{op: "sync", msg: "parse rclone output: " + err.Error()}
+	}
+	if len(entries) == 0 {
+		return "", nil
+	}
+	return strconv.FormatInt(entries[0].Size, 10) + "@" + entries[0].ModTime.UTC().Format(time.RFC3339), nil
+}
+
+// syncPlan is the state gathered before a push or pull
+type syncPlan struct {
+	lock          *BottleLock
+	perms         *Permissions
+	object        string // remote archive path
+	remoteID      string // "" if the remote object doesn't exist
+	localChanged  bool
+	remoteChanged bool
+}
+
+// syncPreflight locks the bottle against launches and works out what changed
+// on each side since the last sync
+func syncPreflight(bottle, remote string) (*syncPlan, error) {
+	if findLoopForFile(bottle) != "" {
+		return nil, errBottleMounted
+	}
+	if err := requireImageBottle(bottle); err != nil {
+		return nil, err
+	}
+	lock, err := acquireBottleLock(bottle, "sync")
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &syncPlan{lock: lock, perms: loadPermissions(getConfigPath(bottle))}
+	if remote == "" {
+		remote = plan.perms.Sync.Remote
+	}
+	if remote == "" {
+		lock.Release()
+		return nil, &bottleError{op: "sync", msg: "no remote given and none remembered for " + bottleName(bottle)}
+	}
+	if remote != plan.perms.Sync.Remote {
+		// New remote: no history to compare against
+		plan.perms.Sync = syncState{Remote: remote}
+	}
+
+	plan.object = remoteObject(remote, bottle)
+	if plan.remoteID, err = remoteObjectID(plan.object); err != nil {
+		lock.Release()
+		return nil, err
+	}
+
+	last := plan.perms.Sync
+	if current, err := fileFingerprint(bottle); err == nil {
+		plan.localChanged = current.Size != last.Local.Size || current.MTime != last.Local.MTime
+	}
+	plan.remoteChanged = plan.remoteID != "" && plan.remoteID != last.RemoteID
+	return plan, nil
+}
+
+// errSyncConflict is returned when both the local and remote copies changed since the last sync
+var errSyncConflict = &bottleError{op: "sync", msg: "conflict: both the local bottle and the remote copy changed since the last sync - use --force to overwrite one"}
+
+// syncPush uploads a locked bottle to remote. Returns a short description of what happened.
+func syncPush(bottle, remote string, force bool) (string, error) {
+	plan, err := syncPreflight(bottle, remote)
+	if err != nil {
+		return "", err
+	}
+	defer plan.lock.Release()
+
+	switch {
+	case plan.remoteChanged && plan.localChanged && !force:
+		return "", errSyncConflict
+	case plan.remoteChanged && !force:
+		return "", &bottleError{op: "sync", msg: "the remote copy is newer - pull it first, or use --force to overwrite it"}
+	case !plan.localChanged && plan.remoteID != "" && !force:
+		return "already up to date", nil
+	}
+
+	tmp := filepath.Join(filepath.Dir(bottle), "."+bottleName(bottle)+".sync"+archiveSuffix)
+	defer os.Remove(tmp)
+	if out, err := command("tar", "--create", "--sparse", "--zstd",
+		"--file", tmp, "--directory", filepath.Dir(bottle), bottleName(bottle)).CombinedOutput(); err != nil {
+		return "", &bottleError{op: "sync", msg: strings.TrimSpace(string(out))}
+	}
+	if out, err := command("rclone", "copyto", tmp, plan.object).CombinedOutput(); err != nil {
+		return "", &bottleError{op: "sync", msg: "rclone copyto: " + strings.TrimSpace(string(out))}
+	}
+
+	return "pushed to " + plan.object, recordSync(bottle, plan)
+}
+
+// syncPull downloads a bottle from remote, replacing the local copy
+func syncPull(bottle, remote string, force bool) (string, error) {
+	plan, err := syncPreflight(bottle, remote)
+	if err != nil {
+		return "", err
+	}
+	defer plan.lock.Release()
+
+	_, statErr := os.Stat(bottle)
+	exists := statErr == nil
+	switch {
+	case plan.remoteID == "":
+		return "", &bottleError{op: "sync", msg: plan.object + " does not exist"}
+	case exists && plan.localChanged && plan.remoteChanged && !force:
+		return "", errSyncConflict
+	case exists && plan.localChanged && !force:
+		return "", &bottleError{op: "sync", msg: "the local bottle has changes that were never pushed - push first, or use --force to discard them"}
+	case exists && !plan.remoteChanged && !force:
+		return "already up to date", nil
+	}
+
+	// Download and extract next to the bottle, then swap it in atomically
+	tmpDir, err := os.MkdirTemp(filepath.Dir(bottle), ".bottle-sync-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	archive := filepath.Join(tmpDir, "download"+archiveSuffix)
+	if out, err := command("rclone", "copyto", plan.object, archive).CombinedOutput(); err != nil {
+		return "", &bottleError{op: "sync", msg: "rclone copyto: " + strings.TrimSpace(string(out))}
+	}
+	if out, err := command("tar", "--extract", "--zstd",
+		"--file", archive, "--directory", tmpDir, bottleName(bottle)).CombinedOutput(); err != nil {
+		return "", &bottleError{op: "sync", msg: strings.TrimSpace(string(out))}
+	}
+	if err := os.Rename(filepath.Join(tmpDir, bottleName(bottle)), bottle); err != nil {
+		return "", err
+	}
+
+	// The pulled file is legitimately different; don't warn about it at unlock
+	if current, err := fileFingerprint(bottle); err == nil {
+		plan.perms.Locked = current
+	}
+	return "pulled from " + plan.object, recordSync(bottle, plan)
+}
+
+// recordSync remembers both sides' state after a successful sync
+func recordSync(bottle string, plan *syncPlan) error {
+	remoteID, err := remoteObjectID(plan.object)
+	if err != nil {
+		return err
+	}
+	local, err := fileFingerprint(bottle)
+	if err != nil {
+		return err
+	}
+	plan.perms.Sync.Local = lockedState{Size: local.Size, MTime: local.MTime}
+	plan.perms.Sync.RemoteID = remoteID
+	return savePermissions(getConfigPath(bottle), plan.perms)
+}
@@ -0,0 +1,51 @@
+// Periodic syncfs: flushing a bottle's writes to its backing file while an app runs.
+package app
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// syncfsInterval returns how often to flush a mounted bottle, from
+// SYNCFS_INTERVAL (seconds) in the global config, or 0 if turned off
+func syncfsInterval() time.Duration {
+	return time.Duration(max(globalConfig.GetInt("SYNCFS_INTERVAL", 0), 0)) * time.Second
+}
+
+// syncFilesystem flushes the filesystem holding path, like sync -f
+func syncFilesystem(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return unix.Syncfs(int(dir.Fd()))
+}
+
+// startSyncer flushes the bottle mounted at mountPoint every SYNCFS_INTERVAL
+// until the returned function is called, so a crash mid-session loses at most
+// that much of what the app wrote. Otherwise the data only reliably reaches
+// the bottle file when it is unmounted.
+func startSyncer(mountPoint string) func() {
+	interval := syncfsInterval()
+	if interval <= 0 {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				// Errors are left for unmount to report
+				_ = syncFilesystem(mountPoint)
+			}
+		}
+	}()
+	return func() { close(stop) }
+}
@@ -0,0 +1,275 @@
+// Trace: --trace <dir> saves a transcript of every external command, for bug reports.
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/x/term"
+)
+
+// traceCommand is the hidden first argument that runs the tracing wrapper
+const traceCommand = "__trace"
+
+var (
+	// traceDir is where transcripts go ("" when not tracing)
+	traceDir string
+	// traceSeq numbers the transcripts
+	traceSeq atomic.Int64
+)
+
+// traceSecretOutput are the programs whose standard output is a secret
+var traceSecretOutput = map[string]bool{
+	"secret-tool": true, "keepassxc-cli": true, "zenity": true, "kdialog": true,
+	"systemd-ask-password": true, "fido2-assert": true, "fido2-cred": true, "qrencode": true,
+}
+
+// traceSensitive matches the names of variables and options to redact
+var traceSensitive = regexp.MustCompile(`(?i)pass|secret|token|key|cred|auth|pin$`)
+
+// traceSecretFlags are the options whose value, as the next word, is
+// redacted: secrets and the files holding them
+var traceSecretFlags = map[string]bool{
+	"--key-file": true, "--keyfile": true, "--new-keyfile": true, "--password-file": true,
+	"--password": true, "--passphrase": true, "--pin": true, "--secret": true, "--token": true,
+}
+
+// traceProgramSecretFlags are the secret options only some programs have.
+// Short options mean something else elsewhere (mkdir -p, losetup -d).
+var traceProgramSecretFlags = map[string]map[string]bool{
+	"cryptsetup":    {"-d": true},
+	"gocryptfs":     {"-passfile": true},
+	"keepassxc-cli": {"-k": true},
+}
+
+// startTrace creates the trace directory and continues the numbering of
+// any transcripts already in it
+func startTrace(dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return &bottleError{op: "trace", msg: err.Error()}
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		num, _, _ := strings.Cut(e.Name(), "-")
+		if n, err := strconv.ParseInt(num, 10, 64); err == nil && n > traceSeq.Load() {
+			traceSeq.Store(n)
+		}
+	}
+	traceDir = dir
+	return nil
+}
+
+// tracedCommand returns a command that runs name through the tracing wrapper
+func tracedCommand(ctx context.Context, name string, arg ...string) *exec.Cmd {
+	self, err := os.Executable()
+	if err != nil {
+		return exec.CommandContext(ctx, name, arg...)
+	}
+	// A missing program fails as usual, without a transcript
+	if _, err := exec.LookPath(name); err != nil {
+		return exec.CommandContext(ctx, name, arg...)
+	}
+	seq := strconv.FormatInt(traceSeq.Add(1), 10)
+	return exec.CommandContext(ctx, self, append([]string{traceCommand, traceDir, seq, name}, arg...)...)
+}
+
+// traceProgram returns the program a command line really runs, past pkexec or sudo
+func traceProgram(argv []string) string {
+	if len(argv) > 1 && (argv[0] == "pkexec" || argv[0] == "sudo") {
+		return filepath.Base(argv[1])
+	}
+	return filepath.Base(argv[0])
+}
+
+// redactArgs hides the values of secret options in a command line, both
+// --password=... and --password ... (the next word)
+func redactArgs(argv []string) []string {
+	programFlags := traceProgramSecretFlags[traceProgram(argv)]
+	redacted := make([]string, len(argv))
+	for i, arg := range argv {
+		switch name, _, ok := strings.Cut(arg, "="); {
+		case i > 0 && (traceSecretFlags[argv[i-1]] || programFlags[argv[i-1]]):
+			arg = "[redacted]"
+		case ok && strings.HasPrefix(name, "-") && traceSensitive.MatchString(name):
+			arg = name + "=[redacted]"
+		}
+		redacted[i] = arg
+	}
+	return redacted
+}
+
+// environDelta lists the variables set, changed or removed in env
+// compared to base, sensitive values redacted
+func environDelta(base, env []string) []string {
+	parse := func(vars []string) map[string]string {
+		m := map[string]string{}
+		for _, kv := range vars {
+			if k, v, ok := strings.Cut(kv, "="); ok {
+				m[k] = v
+			}
+		}
+		return m
+	}
+	before, after := parse(base), parse(env)
+	var delta []string
+	for k, v := range after {
+		if old, ok := before[k]; ok && old == v {
+			continue
+		}
+		if traceSensitive.MatchString(k) {
+			v = "[redacted]"
+		}
+		delta = append(delta, k+"="+v)
+	}
+	for k := range before {
+		if _, ok := after[k]; !ok {
+			delta = append(delta, "-"+k)
+		}
+	}
+	sort.Strings(delta)
+	return delta
+}
+
+// traceStream is one of the wrapper's output streams: passed through to
+// the caller, and kept for the transcript unless it is the terminal
+type traceStream struct {
+	out      *os.File
+	terminal bool
+	buf      bytes.Buffer
+}
+
+func newTraceStream(f *os.File) *traceStream {
+	return &traceStream{out: f, terminal: term.IsTerminal(f.Fd())}
+}
+
+// writer returns what the child writes to
+func (s *traceStream) writer() io.Writer {
+	if s.terminal {
+		return s.out
+	}
+	return io.MultiWriter(s.out, &s.buf)
+}
+
+// transcript returns the stream's section of the transcript
+func (s *traceStream) transcript(secret bool) string {
+	switch {
+	case s.terminal:
+		return "(terminal, not recorded)\n"
+	case secret && s.buf.Len() > 0:
+		return fmt.Sprintf("[%d bytes redacted]\n", s.buf.Len())
+	case s.buf.Len() > 0 && !bytes.HasSuffix(s.buf.Bytes(), []byte("\n")):
+		return s.buf.String() + "\n"
+	}
+	return s.buf.String()
+}
+
+// runTraceWrapper runs `__trace <dir> <seq> <program> [args...]`, writes
+// its transcript and exits the way the program did. It doesn't return.
+func runTraceWrapper(args []string) {
+	if len(args) < 3 {
+		fmt.Fprintln(os.Stderr, "bottle-launch: "+traceCommand+" needs a directory, a number and a command")
+		os.Exit(ExitUsage)
+	}
+	dir, seq, argv := args[0], args[1], args[2:]
+
+	cmd := exec.Command(argv[0], argv[1:]...)
+	// The child goes when the wrapper is killed, as it would without it
+	cmd.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL}
+	// Handed over as it is, so the child sees the same end-of-input
+	cmd.Stdin = os.Stdin
+	stdout, stderr := newTraceStream(os.Stdout), newTraceStream(os.Stderr)
+	cmd.Stdout, cmd.Stderr = stdout.writer(), stderr.writer()
+
+	sigs := make(chan os.Signal, 4)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	started := time.Now()
+	err := cmd.Start()
+	if err == nil {
+		go func() {
+			for sig := range sigs {
+				_ = cmd.Process.Signal(sig)
+			}
+		}()
+		err = cmd.Wait()
+	}
+	elapsed := time.Since(started)
+	signal.Stop(sigs)
+
+	var base []string
+	if data, err := os.ReadFile("/proc/" + strconv.Itoa(os.Getppid()) + "/environ"); err == nil {
+		base = strings.Split(strings.TrimRight(string(data), "\x00"), "\x00")
+	}
+
+	var t strings.Builder
+	words := redactArgs(argv)
+	for i, a := range words {
+		if a == "" || strings.ContainsAny(a, " \t\n\"'\\$") {
+			a = strconv.Quote(a)
+		}
+		words[i] = a
+	}
+	fmt.Fprintf(&t, "command: %s\n", strings.Join(words, " "))
+	if wd, err := os.Getwd(); err == nil {
+		fmt.Fprintf(&t, "directory: %s\n", wd)
+	}
+	for _, kv := range environDelta(base, os.Environ()) {
+		fmt.Fprintf(&t, "environment: %s\n", kv)
+	}
+	fmt.Fprintf(&t, "started: %s\n", started.Format(time.RFC3339Nano))
+	fmt.Fprintf(&t, "duration: %s\n", elapsed.Round(time.Millisecond))
+
+	code := 0
+	var exitErr *exec.ExitError
+	var signaled syscall.Signal
+	switch {
+	case err == nil:
+		fmt.Fprintln(&t, "exit: 0")
+	case errors.As(err, &exitErr):
+		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			signaled = ws.Signal()
+			fmt.Fprintf(&t, "exit: killed by %s\n", signaled)
+		} else {
+			code = exitErr.ExitCode()
+			fmt.Fprintf(&t, "exit: %d\n", code)
+		}
+	default:
+		code = 127
+		fmt.Fprintf(&t, "exit: failed to start: %s\n", err)
+		fmt.Fprintln(os.Stderr, err)
+	}
+	fmt.Fprintln(&t, "stdin: not recorded")
+	secret := traceSecretOutput[traceProgram(argv)]
+	fmt.Fprintf(&t, "--- stdout ---\n%s", stdout.transcript(secret))
+	fmt.Fprintf(&t, "--- stderr ---\n%s", stderr.transcript(false))
+
+	n, _ := strconv.Atoi(seq)
+	name := fmt.Sprintf("%04d-%s.txt", n, traceProgram(argv))
+	_ = os.WriteFile(filepath.Join(dir, name), []byte(t.String()), 0600)
+
+	if signaled != 0 {
+		// Die of the same signal, for callers that look at how it ended
+		signal.Reset(signaled)
+		_ = syscall.Kill(os.Getpid(), signaled)
+		time.Sleep(time.Second)
+		code = 128 + int(signaled)
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,71 @@
+// Tests for trace transcripts: what is redacted from arguments, environment, and output.
+package app
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRedactArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		argv []string
+		want []string
+	}{
+		{"no secrets", []string{"udisksctl", "loop-setup", "-f", "/b/work.bottle"}, []string{"udisksctl", "loop-setup", "-f", "/b/work.bottle"}},
+		{"option=value", []string{"tool", "--password=hunter2"}, []string{"tool", "--password=[redacted]"}},
+		{"key file option=value", []string{"cryptsetup", "open", "--key-file=/tmp/k", "/dev/loop0"}, []string{"cryptsetup", "open", "--key-file=[redacted]", "/dev/loop0"}},
+		{"key file as next word", []string{"cryptsetup", "luksAddKey", "--key-file", "/tmp/k", "/b/work.bottle"}, []string{"cryptsetup", "luksAddKey", "--key-file", "[redacted]", "/b/work.bottle"}},
+		{"password as next word", []string{"tool", "--password", "hunter2", "--verbose"}, []string{"tool", "--password", "[redacted]", "--verbose"}},
+		{"short option", []string{"cryptsetup", "open", "-d", "/tmp/k", "/dev/loop0"}, []string{"cryptsetup", "open", "-d", "[redacted]", "/dev/loop0"}},
+		{"under sudo", []string{"sudo", "cryptsetup", "-d", "/tmp/k", "open"}, []string{"sudo", "cryptsetup", "-d", "[redacted]", "open"}},
+		{"key file of keepassxc-cli", []string{"keepassxc-cli", "show", "-k", "/media/k.key", "db.kdbx"}, []string{"keepassxc-cli", "show", "-k", "[redacted]", "db.kdbx"}},
+		{"gocryptfs passfile", []string{"gocryptfs", "-passfile", "/dev/stdin", "/b/notes.bottle"}, []string{"gocryptfs", "-passfile", "[redacted]", "/b/notes.bottle"}},
+		// Short options of other programs are kept
+		{"mkdir -p", []string{"mkdir", "-p", "dir"}, []string{"mkdir", "-p", "dir"}},
+		{"losetup -d", []string{"pkexec", "losetup", "-d", "/dev/loop3"}, []string{"pkexec", "losetup", "-d", "/dev/loop3"}},
+		{"mount -o", []string{"sudo", "mount", "-o", "nosuid,nodev", "/dev/mapper/x", "/mnt"}, []string{"sudo", "mount", "-o", "nosuid,nodev", "/dev/mapper/x", "/mnt"}},
+		{"secret flag last", []string{"tool", "--passphrase"}, []string{"tool", "--passphrase"}},
+		{"not an option", []string{"echo", "password=x"}, []string{"echo", "password=x"}},
+	}
+	for _, tt := range tests {
+		if got := redactArgs(tt.argv); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: redactArgs(%q) = %q, want %q", tt.name, tt.argv, got, tt.want)
+		}
+	}
+}
+
+func TestEnvironDeltaRedacts(t *testing.T) {
+	base := []string{"HOME=/home/me", "GONE=1"}
+	env := []string{"HOME=/home/me", "LANG=C", "BOTTLE_PASSWORD=hunter2"}
+	want := []string{"-GONE", "BOTTLE_PASSWORD=[redacted]", "LANG=C"}
+	if got := environDelta(base, env); !slices.Equal(got, want) {
+		t.Errorf("environDelta() = %q, want %q", got, want)
+	}
+}
+
+func TestTraceSecretOutput(t *testing.T) {
+	tests := []struct {
+		argv   []string
+		secret bool
+		want   string
+	}{
+		{[]string{"fido2-assert", "-G", "-h"}, true, "[7 bytes redacted]\n"},
+		{[]string{"sudo", "secret-tool", "lookup"}, true, "[7 bytes redacted]\n"},
+		{[]string{"udisksctl", "unlock"}, false, "hunter2\n"},
+	}
+	for _, tt := range tests {
+		secret := traceSecretOutput[traceProgram(tt.argv)]
+		if secret != tt.secret {
+			t.Errorf("%q: secret output = %v, want %v", tt.argv, secret, tt.secret)
+		}
+		s := &traceStream{}
+		s.buf.WriteString("hunter2")
+		if got := s.transcript(secret); got != tt.want {
+			t.Errorf("%q: transcript = %q, want %q", tt.argv, got, tt.want)
+		}
+	}
+	if got := (&traceStream{terminal: true}).transcript(true); got != "(terminal, not recorded)\n" {
+		t.Errorf("terminal transcript = %q", got)
+	}
+}
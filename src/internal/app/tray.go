@@ -0,0 +1,232 @@
+// Tray: a status icon listing open bottles, with lock and launch actions, drawn by yad.
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Icon names for "no bottle open" and "some bottle open"
+const (
+	trayIconLocked = "changes-prevent-symbolic"
+	trayIconOpen   = "changes-allow-symbolic"
+)
+
+// trayFavorites returns the bottles the tray offers to launch:
+// TRAY_FAVORITES from the global config, or else the default bottle set
+func trayFavorites() []string {
+	names := globalConfig.GetList("TRAY_FAVORITES")
+	if len(names) == 0 {
+		names = globalConfig.GetList("BOTTLE_SET")
+	}
+	bottles := make([]string, len(names))
+	for i, n := range names {
+		bottles[i] = resolveBottlePath(n)
+	}
+	return bottles
+}
+
+// trayAction is the command of a menu item that reports action and its
+// arguments back to the tray, tab-separated in one quoted word so paths with
+// spaces survive yad's command line parser and echo
+func trayAction(action string, args ...string) string {
+	word := strings.Join(append([]string{action}, args...), "\t")
+	return "echo '" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
+
+// menuLabel keeps yad's item ('|') and field ('!') separators out of a label
+func menuLabel(s string) string {
+	return strings.NewReplacer("|", "/", "!", ".").Replace(s)
+}
+
+// trayState is what the icon shows: the open bottles and the menu built from them
+type trayState struct {
+	icon    string
+	tooltip string
+	menu    string
+}
+
+// collectTrayState builds the icon, tooltip, and menu for the current
+// bottles. Hidden bottles are left out unless showHidden is set.
+func collectTrayState(showHidden bool) trayState {
+	visible := func(bottle string) bool {
+		return showHidden || !isHiddenBottle(bottle, readPermissions(getConfigPath(bottle)))
+	}
+	var open []string
+	var items []string
+	for _, bottle := range listBottles() {
+		if info := currentMount(bottle); info == nil || info.MountPoint == "" || !visible(bottle) {
+			continue
+		}
+		open = append(open, bottleName(bottle))
+		items = append(items, menuLabel("Lock "+bottleName(bottle))+"!"+trayAction("lock", bottle)+"!"+trayIconLocked)
+	}
+	if len(open) > 1 {
+		items = append(items, "Lock all!"+trayAction("lock-all")+"!"+trayIconLocked)
+	}
+
+	for _, bottle := range trayFavorites() {
+		if !visible(bottle) {
+			continue
+		}
+		perms := loadPermissions(getConfigPath(bottle))
+		app := perms.DefaultApp
+		if app == "" {
+			app = perms.LastApp
+		}
+		if app == "" {
+			continue
+		}
+		label := "Open " + parseAppRef(app).ID + " in " + bottleName(bottle)
+		items = append(items, menuLabel(label)+"!"+trayAction("launch", bottle, app)+"!"+trayIconOpen)
+	}
+	items = append(items, "Quit!"+trayAction("quit")+"!application-exit")
+
+	state := trayState{icon: trayIconLocked, tooltip: "bottle-launch: no bottles open", menu: strings.Join(items, "|")}
+	if len(open) > 0 {
+		state.icon = trayIconOpen
+		state.tooltip = fmt.Sprintf("bottle-launch: %d open (%s)", len(open), strings.Join(open, ", "))
+	}
+	return state
+}
+
+// cmdTray shows the tray icon until it is quit from its menu or killed
+func cmdTray(showHidden bool) error {
+	if _, err := exec.LookPath("yad"); err != nil {
+		return &bottleError{op: "tray", msg: "yad is not installed (it draws the tray icon)", class: classMissingTool}
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return &bottleError{op: "tray", msg: err.Error()}
+	}
+
+	state := collectTrayState(showHidden)
+	cmd := command("yad", "--notification", "--listen",
+		"--image="+state.icon, "--text="+state.tooltip, "--command="+trayAction("status"))
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return &bottleError{op: "tray", msg: err.Error()}
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return &bottleError{op: "tray", msg: err.Error()}
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return &bottleError{op: "tray", msg: err.Error()}
+	}
+
+	var mu sync.Mutex // guards writes to yad and the shown state
+	shown := trayState{}
+	update := func() {
+		next := collectTrayState(showHidden)
+		mu.Lock()
+		defer mu.Unlock()
+		if next.icon != shown.icon {
+			fmt.Fprintln(stdin, "icon:"+next.icon)
+		}
+		if next.tooltip != shown.tooltip {
+			fmt.Fprintln(stdin, "tooltip:"+next.tooltip)
+		}
+		if next.menu != shown.menu {
+			fmt.Fprintln(stdin, "menu:"+next.menu)
+		}
+		shown = next
+	}
+	update()
+
+	actions := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			actions <- scanner.Text()
+		}
+		close(actions)
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigChan)
+
+	ticker := time.NewTicker(TrayRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			update()
+		case <-sigChan:
+			return closeTray(cmd, stdin)
+		case action, ok := <-actions:
+			if !ok {
+				// yad exited (e.g. its own quit item or the session ending)
+				_ = cmd.Wait()
+				return nil
+			}
+			if action == "quit" {
+				return closeTray(cmd, stdin)
+			}
+			go func() {
+				runTrayAction(exe, action, showHidden)
+				update()
+			}()
+		}
+	}
+}
+
+// closeTray removes the icon
+func closeTray(cmd *exec.Cmd, stdin io.WriteCloser) error {
+	fmt.Fprintln(stdin, "quit")
+	stdin.Close()
+	return cmd.Wait()
+}
+
+// runTrayAction carries out a menu action, reporting the result in a notification
+func runTrayAction(exe, action string, showHidden bool) {
+	fields := strings.Split(action, "\t")
+	verb, args := fields[0], fields[1:]
+	switch {
+	case verb == "status":
+		state := collectTrayState(showHidden)
+		sendNotification("Bottles", strings.TrimPrefix(state.tooltip, "bottle-launch: "))
+	case verb == "lock" && len(args) == 1:
+		if err := lockSessions(args[0], false); err != nil {
+			sendNotification("Could not lock "+bottleName(args[0]), err.Error())
+		} else {
+			sendNotification(bottleName(args[0])+" is locked", "")
+		}
+	case verb == "lock-all":
+		var failed []string
+		for _, bottle := range listBottles() {
+			if currentMount(bottle) == nil {
+				continue
+			}
+			if err := lockSessions(bottle, false); err != nil {
+				failed = append(failed, bottleName(bottle)+": "+err.Error())
+			}
+		}
+		if len(failed) > 0 {
+			sendNotification("Some bottles could not be locked", strings.Join(failed, "\n"))
+		} else {
+			sendNotification("All bottles are locked", "")
+		}
+	case verb == "launch" && len(args) == 2:
+		// Without a terminal, run asks for the password in a dialog
+		cmd := command(exe, "run", args[0], args[1])
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+		if err := cmd.Start(); err != nil {
+			sendNotification("Could not launch "+args[1], err.Error())
+			return
+		}
+		// Refresh once it has had time to mount
+		go func() { _ = cmd.Wait() }()
+		time.Sleep(TrayRefreshInterval)
+	}
+}
@@ -0,0 +1,93 @@
+// udev rules: letting the logged-in user open FIDO2 keys' hidraw devices.
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// udevRulesPath is where install-udev-rules puts the rules; the uaccess tag
+// must be set before 73-seat-late.rules applies it
+const udevRulesPath = "/etc/udev/rules.d/70-bottle-launch-fido2.rules"
+
+const fido2UdevRules = `# Written by bottle-launch install-udev-rules: lets the logged-in user use
+# FIDO2 security keys (YubiKeys and others) through /dev/hidraw*.
+ACTION=="remove", GOTO="bottle_launch_fido2_end"
+SUBSYSTEM!="hidraw", GOTO="bottle_launch_fido2_end"
+
+# Any key systemd's fido_id recognized
+ENV{ID_SECURITY_TOKEN}=="1", TAG+="uaccess"
+
+# Yubico, Feitian, Nitrokey, Google Titan, SoloKeys (for udev without fido_id)
+ATTRS{idVendor}=="1050", TAG+="uaccess"
+ATTRS{idVendor}=="096e", TAG+="uaccess"
+ATTRS{idVendor}=="20a0", TAG+="uaccess"
+ATTRS{idVendor}=="18d1", ATTRS{idProduct}=="5026", TAG+="uaccess"
+ATTRS{idVendor}=="0483", ATTRS{idProduct}=="a2ca", TAG+="uaccess"
+ATTRS{idVendor}=="1209", ATTRS{idProduct}=="5070|beee", TAG+="uaccess"
+
+LABEL="bottle_launch_fido2_end"
+`
+
+// fido2UsagePage is how a FIDO key's HID report descriptor starts: Usage
+// Page (0xF1D0)
+var fido2UsagePage = []byte{0x06, 0xd0, 0xf1}
+
+// fido2HidrawNodes returns the /dev/hidraw* devices of the connected FIDO2
+// keys, found by their report descriptors (readable without access to the
+// devices themselves)
+func fido2HidrawNodes() []string {
+	descriptors, _ := filepath.Glob("/sys/class/hidraw/hidraw*/device/report_descriptor")
+	var nodes []string
+	for _, path := range descriptors {
+		desc, err := os.ReadFile(path)
+		if err != nil || !bytes.Contains(desc, fido2UsagePage) {
+			continue
+		}
+		name := filepath.Base(filepath.Dir(filepath.Dir(path)))
+		nodes = append(nodes, "/dev/"+name)
+	}
+	return nodes
+}
+
+// cmdInstallUdevRules installs the rules with pkexec (or sudo) and makes
+// udev apply them to the keys already plugged in; printOnly just prints them
+func cmdInstallUdevRules(printOnly bool) error {
+	if printOnly {
+		fmt.Print(fido2UdevRules)
+		return nil
+	}
+	if mockMode {
+		// Keep the real /etc out of it
+		dest := filepath.Join(bottleDir, ".udev", filepath.Base(udevRulesPath))
+		os.MkdirAll(filepath.Dir(dest), 0700)
+		if err := os.WriteFile(dest, []byte(fido2UdevRules), 0644); err != nil {
+			return err
+		}
+		say("Installed " + dest + ".")
+		return nil
+	}
+
+	tmp, err := os.CreateTemp("", "bottle-launch-udev-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(fido2UdevRules); err != nil {
+		tmp.Close()
+		return err
+	}
+	tmp.Close()
+
+	// One privileged shell, so there is one authentication prompt
+	cmd := privCmd("sh", "-c",
+		`install -m 0644 "$1" "$2" && udevadm control --reload && udevadm trigger --subsystem-match=hidraw --action=change`,
+		"sh", tmp.Name(), udevRulesPath)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return &bottleError{op: "udev", msg: "installing " + udevRulesPath + " failed: " + string(bytes.TrimSpace(out))}
+	}
+	say("Installed " + udevRulesPath + ". If a key still isn't accessible, unplug it and plug it back in.")
+	return nil
+}
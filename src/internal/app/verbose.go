@@ -0,0 +1,93 @@
+// Output levels: -q/--quiet and -v/--verbose for the CLI commands.
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Output levels set by -q and -v, and the --trace directory
+var (
+	quiet   bool
+	verbose bool
+	// traceArg is the directory given to --trace
+	traceArg string
+)
+
+// parseOutputFlags sets quiet and verbose from the command line and returns
+// the arguments without them
+func parseOutputFlags(args []string) []string {
+	kept := args[:1:1]
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(kept, args[i:]...)
+		}
+		switch {
+		case arg == "-q" || arg == "--quiet":
+			quiet, verbose = true, false
+		case arg == "-v" || arg == "--verbose":
+			verbose, quiet = true, false
+		case arg == "--trace" && i+1 < len(args):
+			i++
+			traceArg = args[i]
+		case strings.HasPrefix(arg, "--trace="):
+			traceArg = strings.TrimPrefix(arg, "--trace=")
+		default:
+			kept = append(kept, arg)
+		}
+	}
+	return kept
+}
+
+// notice prints a progress message or warning to stderr, unless quiet
+func notice(msg string) {
+	if !quiet {
+		fmt.Fprintln(os.Stderr, msg)
+	}
+}
+
+// say prints a result message to stdout, unless quiet
+func say(msg string) {
+	if !quiet {
+		fmt.Println(msg)
+	}
+}
+
+// command returns an external command to run, tracing it when verbose
+// and recording a transcript with --trace
+func command(name string, arg ...string) *exec.Cmd {
+	return commandContext(context.Background(), name, arg...)
+}
+
+// commandContext is command for a step that ctx can cancel. The command
+// is asked to stop with SIGTERM, which sudo passes on; a program that
+// pkexec runs as root can't be signalled and runs to the end.
+func commandContext(ctx context.Context, name string, arg ...string) *exec.Cmd {
+	if verbose {
+		words := []string{"+", name}
+		for _, a := range arg {
+			if a == "" || strings.ContainsAny(a, " \t\n\"'\\$") {
+				a = strconv.Quote(a)
+			}
+			words = append(words, a)
+		}
+		fmt.Fprintln(os.Stderr, strings.Join(words, " "))
+	}
+	var cmd *exec.Cmd
+	if traceDir != "" {
+		cmd = tracedCommand(ctx, name, arg...)
+	} else {
+		cmd = exec.CommandContext(ctx, name, arg...)
+	}
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	if ctx.Done() != nil {
+		cmd.WaitDelay = CancelWaitDelay
+	}
+	return cmd
+}
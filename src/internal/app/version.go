@@ -0,0 +1,85 @@
+// Version: build metadata and the versions of the system tools bottle-launch drives.
+package app
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Set at build time by the Makefile:
+//
+//	-ldflags "-X bottle-launch/internal/app.version=1.2.0 -X bottle-launch/internal/app.commit=abc1234 -X bottle-launch/internal/app.buildDate=2025-01-31"
+//
+// Plain `go build` and `go install` fill in what they can from the build info.
+var (
+	version   = ""
+	commit    = ""
+	buildDate = ""
+)
+
+// versionPattern finds a version number in a tool's output
+var versionPattern = regexp.MustCompile(`\d+\.\d+(\.\d+)*`)
+
+// buildVersion returns the version, commit and build date of this binary
+func buildVersion() (ver, rev, date string) {
+	ver, rev, date = version, commit, buildDate
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ver, rev, date
+	}
+	if ver == "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		ver = strings.TrimPrefix(info.Main.Version, "v")
+	}
+	for _, s := range info.Settings {
+		switch {
+		case s.Key == "vcs.revision" && rev == "":
+			rev = s.Value[:min(len(s.Value), 12)]
+		case s.Key == "vcs.time" && date == "":
+			date = s.Value
+		case s.Key == "vcs.modified" && s.Value == "true" && rev != "" && !strings.HasSuffix(rev, "-dirty"):
+			rev += "-dirty"
+		}
+	}
+	if ver == "" {
+		ver = "dev"
+	}
+	return ver, rev, date
+}
+
+// toolVersion runs a version query and returns the first version number in
+// its output ("not found" if the tool is missing or fails)
+func toolVersion(name string, args ...string) string {
+	out, err := command(name, args...).CombinedOutput()
+	if err != nil {
+		return "not found"
+	}
+	if v := versionPattern.FindString(string(out)); v != "" {
+		return v
+	}
+	return "unknown"
+}
+
+// cmdVersion prints the build metadata and tool versions, for bug reports
+func cmdVersion() {
+	ver, rev, date := buildVersion()
+	orUnknown := func(s string) string {
+		if s == "" {
+			return "unknown"
+		}
+		return s
+	}
+	fmt.Println("bottle-launch " + ver)
+	fmt.Println("  commit:     " + orUnknown(rev))
+	fmt.Println("  built:      " + orUnknown(date))
+	fmt.Println("  go:         " + runtime.Version() + " " + runtime.GOOS + "/" + runtime.GOARCH)
+	fmt.Println()
+	fmt.Println("  cryptsetup: " + toolVersion("cryptsetup", "--version"))
+	// udisksctl has no --version; ask the daemon
+	fmt.Println("  udisks2:    " + toolVersion("busctl", "--system", "get-property", "org.freedesktop.UDisks2",
+		"/org/freedesktop/UDisks2/Manager", "org.freedesktop.UDisks2.Manager", "Version"))
+	fmt.Println("  flatpak:    " + toolVersion("flatpak", "--version"))
+	fmt.Println("  libfido2:   " + toolVersion("fido2-token", "-V"))
+}
@@ -0,0 +1,1284 @@
+// View rendering: all TUI screens and list item delegates.
+package app
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+func (m model) renderHeader() string {
+	if mockMode {
+		return headerStyle.Render("BOTTLE LAUNCHER (mock mode)")
+	}
+	return headerStyle.Render("BOTTLE LAUNCHER")
+}
+
+func (m model) renderFooter() string {
+	return footerStyle.Render(m.help.View(m.keys))
+}
+
+func (m model) renderLoading() string {
+	msg := m.spinner.View() + " " + m.loadingMsg
+	if !m.touchDeadline.IsZero() {
+		left := max(time.Until(m.touchDeadline).Round(time.Second), 0)
+		msg += dimStyle.Render(fmt.Sprintf(" %ds left", int(left.Seconds())))
+	}
+	if m.cancelTask != nil && !m.taskCancelled {
+		msg += dimStyle.Render(" (" + m.keys.Back.Help().Key + " to cancel)")
+	}
+	content := lipgloss.JoinVertical(lipgloss.Left,
+		m.renderHeader(),
+		"",
+		msg,
+		"",
+		m.renderFooter(),
+	)
+	return content
+}
+
+func (m model) renderBottleList() string {
+	var sb strings.Builder
+
+	sb.WriteString(m.renderHeader())
+	sb.WriteString("\n\n")
+
+	if len(m.bottleList.Items()) == 0 {
+		sb.WriteString(dimStyle.Render("No bottles found. Press '" + m.keys.NewBottle.Help().Key + "' to create one."))
+	} else {
+		sb.WriteString(m.bottleList.View())
+	}
+
+	if m.statusMsg != "" {
+		sb.WriteString("\n")
+		sb.WriteString(warningStyle.Render(m.statusMsg))
+	}
+
+	sb.WriteString("\n\n")
+	sb.WriteString(hintStyle.Render(hint(m.keys.QuickLaunch, "Quick launch default app")))
+	sb.WriteString("\n")
+	sb.WriteString(hintStyle.Render(hint(m.keys.NewBottle, "New bottle (password)") + "  " + hint(m.keys.NewYubiKey, "New bottle (YubiKey)")))
+	sb.WriteString("\n")
+	if m.sortMode == sortByLastUsed {
+		sb.WriteString(hintStyle.Render(hint(m.keys.Sort, "Sort by name")))
+	} else {
+		sb.WriteString(hintStyle.Render(hint(m.keys.Sort, "Sort by last used")))
+	}
+	if m.showHidden {
+		sb.WriteString("  " + hintStyle.Render(hint(m.keys.RevealHidden, "Hide hidden bottles")))
+	} else {
+		sb.WriteString("  " + hintStyle.Render(hint(m.keys.RevealHidden, "Show hidden bottles")))
+	}
+	sb.WriteString("\n\n")
+	sb.WriteString(m.renderFooter())
+
+	return sb.String()
+}
+
+func (m model) renderBottleActions() string {
+	var sb strings.Builder
+
+	sb.WriteString(m.renderHeader())
+	sb.WriteString("\n\n")
+
+	// Show bottle name with auth type indicator
+	bottleTitle := "Bottle: " + bottleName(m.selectedBottle)
+	isFIDO2, _ := IsFIDO2Bottle(m.permissions)
+	if isFIDO2 {
+		bottleTitle += " (YubiKey)"
+	} else if m.permissions.KeyDriveUUID != "" {
+		bottleTitle += " (key drive)"
+	}
+	sb.WriteString(subtitleStyle.Render(bottleTitle))
+	sb.WriteString("\n\n")
+
+	options := []string{
+		hint(m.keys.Launch, "Launch app"),
+		hint(m.keys.Permissions, "Edit permissions"),
+		hint(m.keys.Delete, "Delete bottle"),
+		hint(m.keys.Info, "Bottle info"),
+		hint(m.keys.Snapshots, "Snapshots (take, restore)"),
+		hint(m.keys.HideBottle, "Hide from bottle list"),
+	}
+	if isHiddenBottle(m.selectedBottle, m.permissions) {
+		options[5] = hint(m.keys.HideBottle, "Show in bottle list")
+	}
+
+	for i, opt := range options {
+		if i == m.cursor {
+			sb.WriteString(cursorStyle.Render("> ") + selectedItemStyle.Render(opt) + "\n")
+		} else {
+			sb.WriteString("  " + opt + "\n")
+		}
+	}
+
+	if m.statusMsg != "" {
+		sb.WriteString("\n")
+		sb.WriteString(errorStyle.Render(m.statusMsg))
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("\n")
+	sb.WriteString(dimStyle.Render("Press " + m.keys.Back.Help().Key + " to go back"))
+	sb.WriteString("\n\n")
+	sb.WriteString(m.renderFooter())
+
+	return sb.String()
+}
+
+func (m model) renderSnapshots() string {
+	var sb strings.Builder
+
+	sb.WriteString(m.renderHeader())
+	sb.WriteString("\n\n")
+	sb.WriteString(subtitleStyle.Render("Snapshots of " + bottleName(m.selectedBottle)))
+	sb.WriteString("\n\n")
+	if m.snapshotMounted {
+		sb.WriteString(dimStyle.Render("  The bottle is open: new snapshots freeze it briefly, and restoring needs it locked."))
+		sb.WriteString("\n\n")
+	}
+
+	if len(m.snapshots) == 0 {
+		sb.WriteString(dimStyle.Render("  No snapshots yet."))
+		sb.WriteString("\n")
+	}
+	for i, s := range m.snapshots {
+		line := s.Taken.Format("2006-01-02 15:04:05") + "  " + dimStyle.Render(formatSize(s.Allocated)+" on disk")
+		if i == m.cursor {
+			sb.WriteString(cursorStyle.Render("> ") + selectedItemStyle.Render(line) + "\n")
+		} else {
+			sb.WriteString("  " + line + "\n")
+		}
+	}
+	sb.WriteString("\n")
+
+	switch m.snapshotConfirm {
+	case "restore":
+		sb.WriteString(warningStyle.Render("Replace " + bottleName(m.selectedBottle) + " with this snapshot? The current version is snapshotted first."))
+		sb.WriteString("\n\n  " + hint(m.keys.Yes, "Restore") + "  " + hint(m.keys.No, "Cancel") + "\n")
+	case "delete":
+		sb.WriteString(warningStyle.Render("Delete this snapshot for good?"))
+		sb.WriteString("\n\n  " + hint(m.keys.Yes, "Delete") + "  " + hint(m.keys.No, "Cancel") + "\n")
+	default:
+		sb.WriteString("  " + hint(m.keys.TakeSnapshot, "Take a snapshot now") + "\n")
+		if len(m.snapshots) > 0 {
+			sb.WriteString("  " + hint(m.keys.Enter, "Restore the selected snapshot") + "\n")
+			sb.WriteString("  " + hint(m.keys.DeleteSnapshot, "Delete it") + "\n")
+		}
+		sb.WriteString("  " + hint(m.keys.Back, "Back") + "\n")
+	}
+
+	if m.statusMsg != "" {
+		sb.WriteString("\n")
+		sb.WriteString(warningStyle.Render(m.statusMsg))
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("\n")
+	sb.WriteString(m.renderFooter())
+
+	return sb.String()
+}
+
+func (m model) renderPermissions() string {
+	var sb strings.Builder
+
+	sb.WriteString(m.renderHeader())
+	sb.WriteString("\n\n")
+	sb.WriteString(subtitleStyle.Render("Permissions"))
+	sb.WriteString("\n\n")
+
+	for i, def := range permissionDefs {
+		var checkbox string
+		enabled := m.permissions.IsEnabled(i)
+		if enabled {
+			checkbox = selectedStyle.Render("[x]")
+		} else {
+			checkbox = dimStyle.Render("[ ]")
+		}
+
+		line := fmt.Sprintf("%s [%s] %s", checkbox, keyHelpName(def.Key), def.Label)
+
+		if i == m.cursor {
+			line = cursorStyle.Render("> ") + line
+		} else {
+			line = "  " + line
+		}
+
+		sb.WriteString(line + "\n")
+	}
+
+	sb.WriteString("\n")
+	shortcuts := make([]string, len(permissionDefs))
+	for i, def := range permissionDefs {
+		shortcuts[i] = keyHelpName(def.Key)
+	}
+	sb.WriteString("  DNS: " + dimStyle.Render(orNone(m.permissions.dnsSummary())+" - "+m.keys.EditDNS.Help().Key+" to edit") + "\n\n")
+	sb.WriteString(dimStyle.Render(m.keys.Toggle.Help().Key + " to toggle, or press shortcut key (" + strings.Join(shortcuts, "/") + ")"))
+	sb.WriteString("\n")
+	sb.WriteString(dimStyle.Render(m.keys.Enter.Help().Key + "/" + m.keys.Back.Help().Key + " to save and return"))
+	sb.WriteString("\n\n")
+	sb.WriteString(m.renderFooter())
+
+	return sb.String()
+}
+
+func (m model) renderDNS() string {
+	var sb strings.Builder
+
+	sb.WriteString(m.renderHeader())
+	sb.WriteString("\n\n")
+	sb.WriteString(subtitleStyle.Render("DNS and Hosts"))
+	sb.WriteString("\n\n")
+
+	if m.dnsForm != nil {
+		sb.WriteString(m.dnsForm.View())
+	}
+
+	sb.WriteString("\n")
+	sb.WriteString(m.renderFooter())
+
+	return sb.String()
+}
+
+func (m model) renderAppSelect() string {
+	var sb strings.Builder
+
+	sb.WriteString(m.renderHeader())
+	sb.WriteString("\n\n")
+
+	if len(m.apps) == 0 {
+		sb.WriteString(errorStyle.Render("No Flatpak apps installed!"))
+		sb.WriteString("\n\n  " + hint(m.keys.SearchFlathub, "Install one from Flathub") + "\n")
+	} else if len(m.appList.Items()) == 0 && !m.showAllApps {
+		sb.WriteString(warningStyle.Render("None of the apps allowed in this bottle are installed."))
+		sb.WriteString("\n\n  " + hint(m.keys.ShowAllApps, "Show all apps") + "\n")
+	} else {
+		sb.WriteString(m.appList.View())
+	}
+
+	sb.WriteString("\n")
+	sb.WriteString(m.renderFooter())
+
+	return sb.String()
+}
+
+// maxFlathubShown caps the search results listed at once
+const maxFlathubShown = 12
+
+func (m model) renderFlathubSearch() string {
+	var sb strings.Builder
+
+	sb.WriteString(m.renderHeader())
+	sb.WriteString("\n\n")
+	sb.WriteString(subtitleStyle.Render("Install from Flathub"))
+	sb.WriteString("\n\n")
+	sb.WriteString("  " + m.flathubQuery.View() + "\n\n")
+
+	switch {
+	case m.flathubSearching:
+		sb.WriteString("  " + m.spinner.View() + " Searching...\n")
+	case m.flathubErr != "":
+		sb.WriteString(errorStyle.Render("  "+m.flathubErr) + "\n")
+	case m.flathubResults != nil && len(m.flathubResults) == 0:
+		sb.WriteString(dimStyle.Render("  No apps found on Flathub.") + "\n")
+	}
+
+	// Keep the cursor in view
+	start := max(0, m.flathubCursor-maxFlathubShown+1)
+	for i := start; i < len(m.flathubResults) && i < start+maxFlathubShown; i++ {
+		app := m.flathubResults[i]
+		if i == m.flathubCursor && !m.flathubQuery.Focused() {
+			sb.WriteString(cursorStyle.Render("> ") + selectedItemStyle.Render(app.Name))
+		} else {
+			sb.WriteString("  " + itemStyle.Render(app.Name))
+		}
+		sb.WriteString("  " + dimStyle.Render(app.Summary) + "\n    " + dimStyle.Render(app.ID) + "\n")
+	}
+	sb.WriteString("\n")
+
+	if m.flathubQuery.Focused() {
+		sb.WriteString(dimStyle.Render(m.keys.Enter.Help().Key + " to search, " + m.keys.Back.Help().Key + " to go back"))
+	} else {
+		sb.WriteString(dimStyle.Render(m.keys.Enter.Help().Key + " to install for your user, " + m.keys.Back.Help().Key + " to edit the search"))
+	}
+	sb.WriteString("\n\n")
+	sb.WriteString(m.renderFooter())
+
+	return sb.String()
+}
+
+func (m model) renderFlathubInstall() string {
+	var sb strings.Builder
+
+	sb.WriteString(m.renderHeader())
+	sb.WriteString("\n\n")
+	sb.WriteString(m.spinner.View() + " Installing " + m.installing.Name + " from Flathub...")
+	sb.WriteString("\n\n")
+	sb.WriteString("  " + dimStyle.Render(m.installing.ID) + "\n\n")
+	if m.installProgress != "" {
+		sb.WriteString("  " + m.installProgress + "\n\n")
+	}
+	sb.WriteString(dimStyle.Render("The app is installed for your user only (flatpak install --user)."))
+	sb.WriteString("\n\n")
+	sb.WriteString(m.renderFooter())
+
+	return sb.String()
+}
+
+func (m model) renderLaunchConfirm() string {
+	var sb strings.Builder
+
+	sb.WriteString(m.renderHeader())
+	sb.WriteString("\n\n")
+	sb.WriteString(subtitleStyle.Render("Ready to launch"))
+	sb.WriteString("\n\n")
+
+	sb.WriteString("  App:    " + m.selectedApp.Name + "\n")
+	sb.WriteString("  ID:     " + dimStyle.Render(m.selectedApp.ID) + "\n")
+	if origin := m.selectedApp.Origin(); origin != "" {
+		sb.WriteString("  From:   " + origin + "\n")
+	}
+	sb.WriteString("  Bottle: " + bottleName(m.selectedBottle) + "\n")
+	sb.WriteString("\n")
+
+	sb.WriteString("  Permissions: " + dimStyle.Render(m.permissions.Summary()) + "\n")
+	if dns := m.permissions.dnsSummary(); dns != "" {
+		sb.WriteString("  DNS:         " + dimStyle.Render(dns) + "\n")
+	}
+	if m.appStatic != nil {
+		// What the app asks for in its metadata, which --sandbox drops
+		granted, removed := splitAppPermissions(compareAppPermissions(m.appStatic, m.permissions))
+		if len(granted) > 0 {
+			sb.WriteString("  App asks for, granted: " + dimStyle.Render(strings.Join(granted, ", ")) + "\n")
+		}
+		if len(removed) > 0 {
+			sb.WriteString("  App asks for, removed: " + warningStyle.Render(strings.Join(removed, ", ")) + "\n")
+		}
+	}
+	if m.suggestPreset() {
+		sb.WriteString("  Suggested for " + m.appPreset.label + ": " + dimStyle.Render(orNone(m.appPreset.summary())) + "\n")
+	}
+	sb.WriteString("\n")
+	if !m.permissions.AllowsApp(m.selectedApp.ID) {
+		sb.WriteString(warningStyle.Render("  This app is not on the bottle's allowed list."))
+		sb.WriteString("\n\n")
+	}
+
+	allowLabel := "Add to allowed apps"
+	switch {
+	case len(m.permissions.AllowedApps) == 0:
+		allowLabel = "Allow only this app in this bottle"
+	case slices.Contains(m.permissions.AllowedApps, m.selectedApp.ID):
+		allowLabel = "Remove from allowed apps"
+	}
+	defaultLabel := "Set as default app"
+	if m.permissions.DefaultApp == m.selectedApp.Ref() {
+		defaultLabel = "Unset as default app (currently default)"
+	}
+	options := []string{
+		hint(m.keys.Launch, "Launch now"),
+		hint(m.keys.Permissions, "Edit permissions first"),
+		hint(m.keys.SetDefault, defaultLabel),
+		hint(m.keys.AllowApp, allowLabel),
+	}
+	if m.suggestPreset() {
+		options = append(options, hint(m.keys.UseSuggested, "Use the suggested permissions"))
+	}
+
+	for _, opt := range options {
+		sb.WriteString("  " + opt + "\n")
+	}
+
+	sb.WriteString("\n")
+	sb.WriteString(dimStyle.Render(m.keys.Back.Help().Key + " to go back"))
+	sb.WriteString("\n\n")
+	sb.WriteString(m.renderFooter())
+
+	return sb.String()
+}
+
+func (m model) renderPasswordInput() string {
+	var sb strings.Builder
+
+	sb.WriteString(m.renderHeader())
+	sb.WriteString("\n\n")
+	if m.vaultRef != nil {
+		sb.WriteString(subtitleStyle.Render("Enter KeePassXC master password"))
+		sb.WriteString("\n")
+		sb.WriteString(dimStyle.Render("  " + m.vaultRef.Database))
+	} else {
+		sb.WriteString(subtitleStyle.Render("Enter bottle password"))
+	}
+	sb.WriteString("\n\n")
+
+	if m.errMsg != "" && m.state == viewPasswordInput {
+		sb.WriteString(errorStyle.Render(m.errMsg))
+		sb.WriteString("\n\n")
+	}
+	if m.statusMsg != "" {
+		sb.WriteString(warningStyle.Render(m.statusMsg))
+		sb.WriteString("\n\n")
+	}
+
+	sb.WriteString("  " + m.passwordInput.View())
+	sb.WriteString("\n\n")
+	sb.WriteString(dimStyle.Render(m.keys.Enter.Help().Key + " to unlock, " + m.keys.Back.Help().Key + " to cancel"))
+	sb.WriteString("\n\n")
+	sb.WriteString(m.renderFooter())
+
+	return sb.String()
+}
+
+func (m model) renderCreateBottle() string {
+	var sb strings.Builder
+
+	sb.WriteString(m.renderHeader())
+	sb.WriteString("\n\n")
+	sb.WriteString(subtitleStyle.Render("Create New Bottle"))
+	sb.WriteString("\n\n")
+
+	if m.createForm != nil {
+		sb.WriteString(m.createForm.View())
+	}
+
+	sb.WriteString("\n")
+	sb.WriteString(m.renderFooter())
+
+	return sb.String()
+}
+
+func (m model) renderDeleteConfirm() string {
+	var sb strings.Builder
+
+	sb.WriteString(m.renderHeader())
+	sb.WriteString("\n\n")
+	sb.WriteString(warningStyle.Render("Delete bottle?"))
+	sb.WriteString("\n\n")
+
+	sb.WriteString("  " + bottleName(m.selectedBottle) + "\n\n")
+	sb.WriteString(errorStyle.Render("  This cannot be undone!"))
+	sb.WriteString("\n\n")
+
+	sb.WriteString("  " + hint(m.keys.Yes, "Yes, delete") + "\n")
+	sb.WriteString("  " + hint(m.keys.No, "No, cancel") + "\n")
+
+	sb.WriteString("\n")
+	sb.WriteString(m.renderFooter())
+
+	return sb.String()
+}
+
+func (m model) renderBottleInUse() string {
+	var sb strings.Builder
+
+	sb.WriteString(m.renderHeader())
+	sb.WriteString("\n\n")
+	sb.WriteString(warningStyle.Render("Bottle already in use"))
+	sb.WriteString("\n\n")
+
+	sb.WriteString("  " + bottleName(m.selectedBottle) + " is open in another session:\n")
+	sb.WriteString("  " + dimStyle.Render(m.inUseOwner.String()) + "\n\n")
+	sb.WriteString(dimStyle.Render("  Joining runs " + m.selectedApp.Name + " in the same mount. The bottle stays"))
+	sb.WriteString("\n")
+	sb.WriteString(dimStyle.Render("  mounted until the last session using it exits."))
+	sb.WriteString("\n\n")
+
+	sb.WriteString("  " + hint(m.keys.Yes, "Join") + "\n")
+	sb.WriteString("  " + hint(m.keys.No, "Cancel") + "\n")
+
+	sb.WriteString("\n")
+	sb.WriteString(m.renderFooter())
+
+	return sb.String()
+}
+
+func (m model) renderConfigReview() string {
+	var sb strings.Builder
+
+	sb.WriteString(m.renderHeader())
+	sb.WriteString("\n\n")
+	sb.WriteString(warningStyle.Render("Config changed outside bottle-launch"))
+	sb.WriteString("\n\n")
+
+	sb.WriteString("  The config of " + bottleName(m.selectedBottle) + " doesn't match its signature: something else\n")
+	sb.WriteString("  edited it. It decides how the bottle unlocks and what its apps may do,\n")
+	sb.WriteString("  so check every line before trusting it:\n\n")
+
+	lines := configLines(m.configPath)
+	shown := max(m.height-16, 5)
+	for i, line := range lines {
+		if i == shown {
+			sb.WriteString(dimStyle.Render("  ... and "+strconv.Itoa(len(lines)-shown)+" more (see "+m.configPath+")") + "\n")
+			break
+		}
+		sb.WriteString("    " + line + "\n")
+	}
+	sb.WriteString("\n")
+
+	sb.WriteString("  " + hint(m.keys.Trust, "Trust these settings") + "\n")
+	sb.WriteString("  " + hint(m.keys.Back, "Cancel") + "\n")
+
+	sb.WriteString("\n")
+	sb.WriteString(m.renderFooter())
+
+	return sb.String()
+}
+
+// maxBusyShown caps the process list in the busy-unmount dialog
+const maxBusyShown = 10
+
+func (m model) renderUnmountBusy() string {
+	var sb strings.Builder
+
+	sb.WriteString(m.renderHeader())
+	sb.WriteString("\n\n")
+	sb.WriteString(warningStyle.Render("Bottle is busy"))
+	sb.WriteString("\n\n")
+
+	sb.WriteString("  " + bottleName(m.selectedBottle) + " can't be unmounted - these processes still use it:\n\n")
+	for i, p := range m.busy.Procs {
+		if i == maxBusyShown {
+			sb.WriteString(dimStyle.Render("  ... and "+strconv.Itoa(len(m.busy.Procs)-maxBusyShown)+" more") + "\n")
+			break
+		}
+		sb.WriteString("  " + p.String() + "  " + dimStyle.Render(p.Path) + "\n")
+	}
+	sb.WriteString("\n")
+
+	sb.WriteString("  " + hint(m.keys.Terminate, "Terminate them and unmount") + "\n")
+	sb.WriteString("  " + hint(m.keys.Retry, "Retry (after closing them yourself)") + "\n")
+	sb.WriteString("  " + hint(m.keys.Back, "Leave the bottle mounted") + "\n")
+
+	sb.WriteString("\n")
+	sb.WriteString(m.renderFooter())
+
+	return sb.String()
+}
+
+func (m model) renderRecovery() string {
+	var sb strings.Builder
+
+	sb.WriteString(m.renderHeader())
+	sb.WriteString("\n\n")
+	sb.WriteString(warningStyle.Render("Bottles left open by a previous session"))
+	sb.WriteString("\n\n")
+	sb.WriteString(dimStyle.Render("  These bottles are still decrypted but no bottle-launch session owns them."))
+	sb.WriteString("\n\n")
+
+	for i, s := range m.staleBottles {
+		cursor := "  "
+		style := itemStyle
+		if i == m.cursor {
+			cursor = cursorStyle.Render("> ")
+			style = selectedItemStyle
+		}
+		sb.WriteString(cursor + style.Render(bottleName(s.path)) + "  " + dimStyle.Render(s.Describe()) + "\n")
+	}
+	sb.WriteString("\n")
+
+	sb.WriteString("  " + hint(m.keys.Adopt, "Adopt (launch an app in it)") + "\n")
+	sb.WriteString("  " + hint(m.keys.Unmount, "Unmount, keep unlocked") + "\n")
+	sb.WriteString("  " + hint(m.keys.LockBottle, "Unmount and lock") + "\n")
+	sb.WriteString("  " + hint(m.keys.Back, "Leave as is") + "\n")
+
+	if m.statusMsg != "" {
+		sb.WriteString("\n")
+		sb.WriteString(errorStyle.Render(m.statusMsg))
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("\n")
+	sb.WriteString(m.renderFooter())
+
+	return sb.String()
+}
+
+func (m model) renderRunning() string {
+	var sb strings.Builder
+
+	sb.WriteString(m.renderHeader())
+	sb.WriteString("\n\n")
+	if !m.stoppingSince.IsZero() {
+		waited := time.Since(m.stoppingSince).Round(time.Second)
+		sb.WriteString(m.spinner.View() + " Closing " + m.selectedApp.Name + "... " + waited.String())
+		sb.WriteString("\n\n")
+		sb.WriteString(dimStyle.Render("The bottle is locked once it has exited. It is killed after " +
+			SessionKillGrace.String() + "; press ctrl+c to kill it now."))
+		sb.WriteString("\n\n")
+		sb.WriteString(m.renderFooter())
+		return sb.String()
+	}
+	sb.WriteString(m.spinner.View() + " Running " + m.selectedApp.Name + "...")
+	if m.profile != nil {
+		sb.WriteString(" " + dimStyle.Render("(@"+m.profile.Name+")"))
+	}
+	sb.WriteString("\n\n")
+	if m.confirmQuit {
+		sb.WriteString(warningStyle.Render("Quit? " + m.selectedApp.Name + " is still running."))
+		sb.WriteString("\n\n")
+		sb.WriteString("  " + hint(m.keys.Yes, "Close it, lock the bottle, and quit") + "\n")
+		sb.WriteString("  " + hint(m.keys.No, "Keep it running") + "\n\n")
+		sb.WriteString(m.renderFooter())
+		return sb.String()
+	}
+	sb.WriteString(dimStyle.Render("The application is running. Close it to return here."))
+	sb.WriteString("\n\n")
+	sb.WriteString("  Running for: " + formatRemaining(time.Since(m.launchedAt)) + "\n")
+	if m.runningCmd != nil {
+		process := "pid " + strconv.Itoa(m.runningCmd.Process.Pid)
+		if m.usage.Procs > 1 {
+			process += dimStyle.Render(fmt.Sprintf(" (%d processes)", m.usage.Procs))
+		}
+		sb.WriteString("  Process:     " + process + "\n")
+	}
+	if m.usage.Procs > 0 {
+		usage := "memory " + formatSize(m.usage.RSS)
+		if !m.prevUsage.At.IsZero() {
+			usage = fmt.Sprintf("CPU %.0f%%, ", cpuPercent(m.prevUsage, m.usage)) + usage
+		}
+		sb.WriteString("  Usage:       " + usage + "\n")
+	}
+	if m.mountInfo != nil {
+		sb.WriteString("  Mounted at:  " + dimStyle.Render(m.mountInfo.MountPoint) + "\n")
+	}
+	if m.bottleSize > 0 {
+		free := formatSize(m.bottleFree) + " of " + formatSize(m.bottleSize)
+		if m.bottleFree < m.bottleSize/20 {
+			free = warningStyle.Render(free)
+		}
+		sb.WriteString("  Free space:  " + free + "\n")
+	}
+	if m.permissions.Quota > 0 && m.bottleUsedSpace > 0 {
+		quota := formatSize(m.bottleUsedSpace) + " of " + formatSize(m.permissions.Quota) + " used"
+		if overQuota(m.bottleUsedSpace, m.permissions) {
+			quota = warningStyle.Render(quota + " - over quota")
+		}
+		sb.WriteString("  Quota:       " + quota + "\n")
+	}
+	sb.WriteString("\n")
+	if !m.deadline.IsZero() {
+		remaining := time.Until(m.deadline)
+		countdown := "  Time left:   " + formatRemaining(remaining)
+		if remaining <= timeoutWarningLead(m.permissions.Timeout) {
+			sb.WriteString(warningStyle.Render(countdown) + "\n\n")
+		} else {
+			sb.WriteString(countdown + "\n\n")
+		}
+	}
+	sb.WriteString("  " + hint(m.keys.OpenFolder, "Open in file manager"))
+	sb.WriteString("\n\n")
+	if m.statusMsg != "" {
+		sb.WriteString(warningStyle.Render(m.statusMsg))
+		sb.WriteString("\n\n")
+	}
+	sb.WriteString(m.renderFooter())
+
+	return sb.String()
+}
+
+func (m model) renderError() string {
+	var sb strings.Builder
+
+	sb.WriteString(m.renderHeader())
+	sb.WriteString("\n\n")
+	sb.WriteString(errorStyle.Render("Error"))
+	sb.WriteString("\n\n")
+
+	explained, ok := explainError(m.err, m.errMsg)
+	if !ok || m.errDetails {
+		sb.WriteString("  " + m.errMsg)
+		sb.WriteString("\n\n")
+	}
+	if ok {
+		sb.WriteString("  " + warningStyle.Render(explained.Title))
+		sb.WriteString("\n\n")
+		sb.WriteString("  " + explained.Cause)
+		sb.WriteString("\n\n")
+		sb.WriteString("  What to try:\n")
+		for i, step := range explained.Steps {
+			sb.WriteString(fmt.Sprintf("    %d. %s\n", i+1, step))
+		}
+		sb.WriteString("\n")
+		label := "Show details"
+		if m.errDetails {
+			label = "Hide details"
+		}
+		sb.WriteString("  " + hint(m.keys.Details, label))
+		sb.WriteString("\n\n")
+	}
+	sb.WriteString(dimStyle.Render("Press " + m.keys.Enter.Help().Key + " or " + m.keys.Back.Help().Key + " to continue"))
+	sb.WriteString("\n\n")
+	sb.WriteString(m.renderFooter())
+
+	return sb.String()
+}
+
+func (m model) renderLowSpace() string {
+	var sb strings.Builder
+
+	sb.WriteString(m.renderHeader())
+	sb.WriteString("\n\n")
+	sb.WriteString(warningStyle.Render("Bottle almost full"))
+	sb.WriteString("\n\n")
+	sb.WriteString(fmt.Sprintf("  %s has %s free of %s (%.1f%%).\n\n",
+		bottleName(m.selectedBottle), formatSize(m.bottleFree), formatSize(m.bottleSize),
+		float64(m.bottleFree)*100/float64(max(m.bottleSize, 1))))
+	sb.WriteString("  Many apps corrupt their profiles when the disk fills up in the middle\n")
+	sb.WriteString("  of a write. Open the bottle and delete what you don't need, or move\n")
+	sb.WriteString("  the data to a larger bottle, before running " + m.selectedApp.Name + ".\n\n")
+	sb.WriteString("  " + hint(m.keys.OpenFolder, "Open in file manager"))
+	sb.WriteString("  " + hint(m.keys.Retry, "Check again"))
+	sb.WriteString("\n  " + hint(m.keys.Yes, "Launch anyway"))
+	sb.WriteString("  " + hint(m.keys.No, "Cancel and lock"))
+	sb.WriteString("\n\n")
+	if m.statusMsg != "" {
+		sb.WriteString(warningStyle.Render(m.statusMsg))
+		sb.WriteString("\n\n")
+	}
+	sb.WriteString(m.renderFooter())
+
+	return sb.String()
+}
+
+func (m model) renderBottleInfo() string {
+	var sb strings.Builder
+
+	sb.WriteString(m.renderHeader())
+	sb.WriteString("\n\n")
+	sb.WriteString(subtitleStyle.Render("Bottle: " + bottleName(m.selectedBottle)))
+	sb.WriteString("\n\n")
+
+	auth := "Password"
+	if isFIDO2, _ := IsFIDO2Bottle(m.permissions); isFIDO2 {
+		auth = "YubiKey (FIDO2)"
+	} else if m.permissions.KeyDriveUUID != "" {
+		auth = "Key drive " + keyDriveName(m.permissions) + " (" + m.permissions.KeyDriveFile + ")"
+	}
+
+	size := "unknown"
+	if apparent, allocated, err := bottleDiskUsage(m.selectedBottle); err == nil {
+		size = formatSize(apparent) + " (" + formatSize(allocated) + " on disk)"
+	}
+
+	status := "locked"
+	if mountPoint := fixedMountPoint(m.selectedBottle); mountPoint != "" {
+		status = "locked (mounts at " + mountPoint + ")"
+	}
+	if info := currentMount(m.selectedBottle); info != nil {
+		switch {
+		case info.MountPoint != "":
+			status = "mounted at " + info.MountPoint
+		case info.CleartextDevice != "":
+			status = "unlocked"
+		default:
+			status = "attached (" + info.LoopDevice + ")"
+		}
+	}
+
+	lastApp := m.permissions.LastApp
+	if lastApp == "" {
+		lastApp = "none"
+	}
+	defaultApp := m.permissions.DefaultApp
+	if defaultApp == "" {
+		defaultApp = "none"
+	}
+
+	description := m.permissions.Description
+	if description == "" {
+		description = dimStyle.Render("none - press " + m.keys.EditDescription.Help().Key + " to add one")
+	}
+	sb.WriteString("  About:     " + description + "\n")
+	sb.WriteString("  Path:      " + dimStyle.Render(m.selectedBottle) + "\n")
+	sb.WriteString("  Size:      " + size + "\n")
+	sb.WriteString("  Auth:      " + auth + "\n")
+	if backend := bottleBackend(m.selectedBottle); backend != BackendLUKS {
+		sb.WriteString("  Storage:   " + backend + "\n")
+	}
+	sb.WriteString("  Status:    " + status + "\n")
+	sb.WriteString("  Last used: " + formatLastUsed(m.permissions.LastUsed) + "\n")
+	sb.WriteString("  Last app:  " + lastApp + "\n")
+	sb.WriteString("  Default:   " + defaultApp + "\n")
+	if len(m.permissions.AllowedApps) > 0 {
+		sb.WriteString("  Allowed:   " + strings.Join(m.permissions.AllowedApps, ", ") + "\n")
+	}
+	if m.permissions.SecretRef != "" {
+		sb.WriteString("  Secret:    " + m.permissions.SecretRef + "\n")
+	}
+	if m.permissions.Timeout > 0 {
+		sb.WriteString("  Limit:     " + m.permissions.Timeout.String() + " per session\n")
+	}
+	if dns := m.permissions.dnsSummary(); dns != "" {
+		sb.WriteString("  DNS:       " + dns + "\n")
+	}
+	if m.permissions.Forensics {
+		sb.WriteString("  Forensics: on (files changed are kept in the audit log)\n")
+	}
+	if m.permissions.Untrusted {
+		sb.WriteString("  Downloads: untrusted, scanned for malware before locking\n")
+	}
+	sb.WriteString("  Config:    " + dimStyle.Render(m.configPath) + "\n")
+
+	if stats := loadStats(getStatsPath(m.selectedBottle)); len(stats) > 0 {
+		sb.WriteString("\n")
+		sb.WriteString(subtitleStyle.Render("Usage"))
+		sb.WriteString("\n")
+		for _, s := range stats {
+			sb.WriteString(fmt.Sprintf("  %-32s %4d launches  %8s total  last %s\n",
+				s.AppID, s.Launches, formatRuntime(s.Runtime), formatLastUsed(s.LastRun)))
+		}
+	}
+
+	sb.WriteString("\n")
+	sb.WriteString(dimStyle.Render("Press " + m.keys.EditDescription.Help().Key + " to edit the description, " +
+		m.keys.Enter.Help().Key + " or " + m.keys.Back.Help().Key + " to go back"))
+	sb.WriteString("\n\n")
+	sb.WriteString(m.renderFooter())
+
+	return sb.String()
+}
+
+func (m model) renderDescription() string {
+	var sb strings.Builder
+
+	sb.WriteString(m.renderHeader())
+	sb.WriteString("\n\n")
+	sb.WriteString(subtitleStyle.Render("Bottle: " + bottleName(m.selectedBottle)))
+	sb.WriteString("\n\n")
+
+	if m.descriptionForm != nil {
+		sb.WriteString(m.descriptionForm.View())
+	}
+
+	sb.WriteString("\n")
+	sb.WriteString(m.renderFooter())
+
+	return sb.String()
+}
+
+func (m model) renderHelp() string {
+	var sb strings.Builder
+
+	sb.WriteString(m.renderHeader())
+	sb.WriteString("\n\n")
+	sb.WriteString(subtitleStyle.Render("Keybindings"))
+	sb.WriteString("\n")
+
+	for _, section := range m.keys.HelpSections() {
+		sb.WriteString("\n")
+		sb.WriteString(titleStyle.UnsetMarginBottom().Render(section.title))
+		sb.WriteString("\n")
+		for _, b := range section.bindings {
+			h := b.Help()
+			sb.WriteString(fmt.Sprintf("  %s %s\n", selectedStyle.Render(fmt.Sprintf("%-8s", h.Key)), h.Desc))
+		}
+	}
+
+	sb.WriteString("\n")
+	sb.WriteString(dimStyle.Render("Press " + m.keys.Help.Help().Key + " or " + m.keys.Back.Help().Key + " to close"))
+	sb.WriteString("\n")
+
+	return sb.String()
+}
+
+// formatLastUsed renders a unix timestamp as a short relative time
+func formatLastUsed(unix int64) string {
+	if unix == 0 {
+		return "never"
+	}
+	d := time.Since(time.Unix(unix, 0))
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	case d < 30*24*time.Hour:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	}
+	return time.Unix(unix, 0).Format("2006-01-02")
+}
+
+// formatSize renders a byte count using binary units (e.g. "1.5G")
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%dB", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// List item types for bubbles/list
+
+type bottleItem struct {
+	path      string
+	name      string
+	isYubiKey bool
+	lastUsed  int64
+	state     BottleState
+	hidden    bool   // listed because hidden bottles are revealed
+	tampered  bool   // config changed outside bottle-launch
+	about     string // the bottle's description
+	keyDrive  bool   // unlocks with a key file on a USB drive
+	untrusted bool   // holds untrusted downloads
+	forensics bool   // sessions are recorded in the audit log
+	risky     bool   // untrusted, yet its apps get network access
+}
+
+func (i bottleItem) Title() string {
+	if i.isYubiKey {
+		return i.name + " (YubiKey)"
+	}
+	return i.name
+}
+func (i bottleItem) Description() string {
+	desc := "last used " + formatLastUsed(i.lastUsed)
+	if i.about != "" {
+		about := []rune(i.about)
+		if len(about) > 50 {
+			about = append(about[:49], '…')
+		}
+		desc = string(about) + " - " + desc
+	}
+	return desc
+}
+func (i bottleItem) FilterValue() string { return i.name + " " + i.about }
+
+// profileItem is a launch profile, listed above the bottles
+type profileItem struct {
+	profile *launchProfile
+}
+
+func (i profileItem) Title() string       { return "@" + i.profile.Name }
+func (i profileItem) Description() string { return i.profile.Summary() }
+func (i profileItem) FilterValue() string {
+	return "@" + i.profile.Name + " " + bottleName(i.profile.Bottle)
+}
+
+type appItem struct {
+	app FlatpakApp
+}
+
+func (i appItem) Title() string       { return i.app.Name }
+func (i appItem) Description() string { return i.app.ID }
+func (i appItem) FilterValue() string { return i.app.Name + " " + i.app.ID }
+
+// Custom delegates for list items
+
+type bottleItemDelegate struct{}
+
+func (d bottleItemDelegate) Height() int                             { return 1 }
+func (d bottleItemDelegate) Spacing() int                            { return 0 }
+func (d bottleItemDelegate) Update(_ tea.Msg, _ *list.Model) tea.Cmd { return nil }
+func (d bottleItemDelegate) Render(w io.Writer, m list.Model, index int, item list.Item) {
+	if p, ok := item.(profileItem); ok {
+		str := p.Title()
+		if index == m.Index() {
+			str = cursorStyle.Render("> ") + selectedItemStyle.Render(str)
+		} else {
+			str = "  " + itemStyle.Render(str)
+		}
+		fmt.Fprint(w, str+"  "+dimStyle.Render(p.Description()))
+		return
+	}
+	i, ok := item.(bottleItem)
+	if !ok {
+		return
+	}
+
+	str := i.name
+	if index == m.Index() {
+		str = cursorStyle.Render("> ") + selectedItemStyle.Render(str)
+	} else {
+		str = "  " + itemStyle.Render(str)
+	}
+	switch {
+	case i.isYubiKey:
+		str += " " + fido2BadgeStyle.Render("[yubikey]")
+	case i.keyDrive:
+		str += " " + keyDriveBadgeStyle.Render("[key drive]")
+	default:
+		str += " " + passwordBadgeStyle.Render("[password]")
+	}
+	switch i.state {
+	case StateMounted:
+		str += " " + selectedStyle.Render("[mounted]")
+	case StateUnlocked:
+		str += " " + warningStyle.Render("[unlocked]")
+	}
+	if i.hidden {
+		str += " " + dimStyle.Render("[hidden]")
+	}
+	if i.untrusted {
+		str += " " + warningStyle.Render("[untrusted]")
+	}
+	if i.forensics {
+		str += " " + dimStyle.Render("[forensics]")
+	}
+	if i.risky {
+		str += " " + riskBadgeStyle.Render("[! untrusted + network]")
+	}
+	if i.tampered {
+		str += " " + warningStyle.Render("[config changed]")
+	}
+	str += "  " + dimStyle.Render(i.Description())
+
+	fmt.Fprint(w, str)
+}
+
+type appItemDelegate struct{}
+
+func (d appItemDelegate) Height() int                             { return 2 }
+func (d appItemDelegate) Spacing() int                            { return 0 }
+func (d appItemDelegate) Update(_ tea.Msg, _ *list.Model) tea.Cmd { return nil }
+func (d appItemDelegate) Render(w io.Writer, m list.Model, index int, item list.Item) {
+	i, ok := item.(appItem)
+	if !ok {
+		return
+	}
+
+	detail := i.app.ID
+	if origin := i.app.Origin(); origin != "" {
+		detail += " (" + origin + ")"
+	}
+	var str string
+	if index == m.Index() {
+		str = cursorStyle.Render("> ") + selectedItemStyle.Render(i.app.Name) + "\n    " + dimStyle.Render(detail)
+	} else {
+		str = "  " + itemStyle.Render(i.app.Name) + "\n    " + dimStyle.Render(detail)
+	}
+
+	fmt.Fprint(w, str)
+}
+
+// FIDO2 views
+
+func (m model) renderCreateBottleYubiKey() string {
+	var sb strings.Builder
+
+	sb.WriteString(m.renderHeader())
+	sb.WriteString("\n\n")
+	sb.WriteString(subtitleStyle.Render("Create YubiKey Bottle"))
+	sb.WriteString("\n\n")
+
+	switch m.fido2Step {
+	case -1:
+		// Error step
+		sb.WriteString(errorStyle.Render("Error: " + m.fido2Error))
+		sb.WriteString("\n\n")
+		sb.WriteString(dimStyle.Render("Press " + m.keys.Back.Help().Key + " to go back"))
+
+	case 0:
+		// Form step (name and size)
+		if m.createForm != nil {
+			sb.WriteString(m.createForm.View())
+		}
+
+	case 1:
+		// Device selection step
+		if len(m.fido2Devices) == 0 {
+			sb.WriteString(warningStyle.Render("No FIDO2 device found."))
+			sb.WriteString("\n\n")
+			sb.WriteString("  Insert YubiKey and press " + m.keys.Retry.Help().Key + " to retry.\n")
+			sb.WriteString("\n")
+			sb.WriteString(dimStyle.Render(hint(m.keys.Retry, "Retry") + "  " + hint(m.keys.Back, "Cancel")))
+		} else if len(m.fido2Devices) == 1 {
+			sb.WriteString("  Found: ")
+			sb.WriteString(selectedStyle.Render(m.fido2Devices[0].Path))
+			if m.fido2Devices[0].Description != "" {
+				sb.WriteString("\n  " + dimStyle.Render(m.fido2Devices[0].Description))
+			}
+			sb.WriteString("\n\n")
+			sb.WriteString(dimStyle.Render(hint(m.keys.Enter, "Continue") + "  " + hint(m.keys.Back, "Cancel")))
+		} else {
+			sb.WriteString("  Select YubiKey:\n\n")
+			for i, dev := range m.fido2Devices {
+				if i == m.fido2DeviceSel {
+					sb.WriteString(cursorStyle.Render("> ") + selectedItemStyle.Render(dev.Path))
+				} else {
+					sb.WriteString("  " + itemStyle.Render(dev.Path))
+				}
+				if dev.Description != "" {
+					sb.WriteString(" " + dimStyle.Render(dev.Description))
+				}
+				sb.WriteString("\n")
+			}
+			sb.WriteString("\n")
+			sb.WriteString(dimStyle.Render(hint(m.keys.Enter, "Select") + "  " + hint(m.keys.Back, "Cancel")))
+		}
+
+		if m.fido2Error != "" {
+			sb.WriteString("\n\n")
+			sb.WriteString(errorStyle.Render("Error: " + m.fido2Error))
+		}
+
+	case 5:
+		// Review before the first touch enrolls the key
+		dev := m.fido2Devices[m.fido2DeviceSel]
+		device := dev.Path
+		if dev.Description != "" {
+			device += " " + dimStyle.Render("("+dev.Description+")")
+		}
+		sb.WriteString("  Review before enrolling the key:\n\n")
+		sb.WriteString("  Name:   " + bottleName(newBottlePath(m.fido2BottleName)) + "\n")
+		sb.WriteString("  Size:   " + m.fido2BottleSize + "\n")
+		sb.WriteString("  Key:    " + selectedStyle.Render(device) + "\n")
+		sb.WriteString("  RP ID:  " + m.fido2RPID + " " + dimStyle.Render("(user "+m.fido2User+")") + "\n")
+		sb.WriteString("\n")
+		check := "[ ]"
+		if m.fido2Acknowledged {
+			check = selectedStyle.Render("[x]")
+		}
+		sb.WriteString("  " + check + " " + warningStyle.Render("The data is unrecoverable without this key") + "\n")
+		sb.WriteString("\n")
+		sb.WriteString(dimStyle.Render(hint(m.keys.Toggle, "Acknowledge") + "  " + hint(m.keys.Enter, "Touch the key to start") + "  " + hint(m.keys.Back, "Back")))
+
+		if m.fido2Error != "" {
+			sb.WriteString("\n\n")
+			sb.WriteString(errorStyle.Render(m.fido2Error))
+		}
+
+	case 2:
+		// Credential created, prompt for secret
+		sb.WriteString("  Credential created.\n\n")
+		sb.WriteString("  Press " + m.keys.Enter.Help().Key + " to generate encryption key.\n")
+		sb.WriteString("  You will need to touch YubiKey again.\n")
+		sb.WriteString("\n")
+		sb.WriteString(dimStyle.Render(hint(m.keys.Enter, "Continue") + "  " + hint(m.keys.Back, "Cancel")))
+
+		if m.fido2Error != "" {
+			sb.WriteString("\n\n")
+			sb.WriteString(errorStyle.Render("Error: " + m.fido2Error))
+		}
+
+	case 3:
+		// Secret ready, prompt for bottle creation
+		sb.WriteString("  Encryption key generated.\n\n")
+		sb.WriteString("  Press " + m.keys.Enter.Help().Key + " to create the encrypted bottle.\n")
+		sb.WriteString("\n")
+		sb.WriteString(dimStyle.Render(hint(m.keys.Enter, "Create bottle") + "  " + hint(m.keys.Back, "Cancel")))
+
+		if m.fido2Error != "" {
+			sb.WriteString("\n\n")
+			sb.WriteString(errorStyle.Render("Error: " + m.fido2Error))
+		}
+
+	case 4:
+		// Success
+		sb.WriteString(selectedStyle.Render("Bottle created successfully!"))
+		sb.WriteString("\n\n")
+		sb.WriteString(warningStyle.Render("WARNING: "))
+		sb.WriteString("This bottle can ONLY be unlocked with this specific YubiKey.\n")
+		sb.WriteString("         If you lose this YubiKey, the data is PERMANENTLY UNRECOVERABLE.\n")
+		sb.WriteString("\n")
+		sb.WriteString("  Back up your config file:\n")
+		sb.WriteString("  " + dimStyle.Render("~/.config/bottle-launch/<hash>.conf"))
+		sb.WriteString("\n\n")
+		sb.WriteString(dimStyle.Render(hint(m.keys.Enter, "Done")))
+	}
+
+	sb.WriteString("\n\n")
+	sb.WriteString(m.renderFooter())
+
+	return sb.String()
+}
+
+func (m model) renderKeyDrive() string {
+	var sb strings.Builder
+
+	sb.WriteString(m.renderHeader())
+	sb.WriteString("\n\n")
+	sb.WriteString(subtitleStyle.Render("Unlock with Key Drive"))
+	sb.WriteString("\n\n")
+
+	if m.statusMsg != "" {
+		sb.WriteString(warningStyle.Render(m.statusMsg))
+		sb.WriteString("\n\n")
+	}
+
+	sb.WriteString(warningStyle.Render("Plug in " + keyDriveName(m.permissions) + " to unlock " + bottleName(m.selectedBottle) + "."))
+	sb.WriteString("\n\n")
+	sb.WriteString("  " + m.spinner.View() + " Waiting for the drive...\n")
+	if m.keyDriveError != "" {
+		sb.WriteString("\n")
+		sb.WriteString(errorStyle.Render("Error: " + m.keyDriveError))
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n")
+	sb.WriteString(dimStyle.Render(hint(m.keys.Back, "Cancel")))
+
+	sb.WriteString("\n\n")
+	sb.WriteString(m.renderFooter())
+
+	return sb.String()
+}
+
+func (m model) renderFIDO2Unlock() string {
+	var sb strings.Builder
+
+	sb.WriteString(m.renderHeader())
+	sb.WriteString("\n\n")
+	sb.WriteString(subtitleStyle.Render("Unlock with YubiKey"))
+	sb.WriteString("\n\n")
+
+	if m.statusMsg != "" {
+		sb.WriteString(warningStyle.Render(m.statusMsg))
+		sb.WriteString("\n\n")
+	}
+
+	if len(m.fido2Devices) == 0 {
+		sb.WriteString(warningStyle.Render("YubiKey not found."))
+		sb.WriteString("\n\n")
+		sb.WriteString("  Insert your YubiKey and try again.\n")
+		sb.WriteString("\n")
+		sb.WriteString(dimStyle.Render(hint(m.keys.Retry, "Retry") + "  " + hint(m.keys.Back, "Cancel")))
+	} else if len(m.fido2Devices) == 1 {
+		sb.WriteString("  Found: ")
+		sb.WriteString(selectedStyle.Render(m.fido2Devices[0].Path))
+		sb.WriteString("\n\n")
+		sb.WriteString("  Press " + m.keys.Enter.Help().Key + " to unlock (requires touch).\n")
+		sb.WriteString("\n")
+		sb.WriteString(dimStyle.Render(hint(m.keys.Enter, "Unlock") + "  " + hint(m.keys.Back, "Cancel")))
+	} else {
+		sb.WriteString("  Select YubiKey:\n\n")
+		for i, dev := range m.fido2Devices {
+			if i == m.fido2DeviceSel {
+				sb.WriteString(cursorStyle.Render("> ") + selectedItemStyle.Render(dev.Path))
+			} else {
+				sb.WriteString("  " + itemStyle.Render(dev.Path))
+			}
+			if dev.Description != "" {
+				sb.WriteString(" " + dimStyle.Render(dev.Description))
+			}
+			sb.WriteString("\n")
+		}
+		sb.WriteString("\n")
+		sb.WriteString(dimStyle.Render(hint(m.keys.Enter, "Unlock") + "  " + hint(m.keys.Back, "Cancel")))
+	}
+
+	if m.fido2Error != "" {
+		sb.WriteString("\n\n")
+		sb.WriteString(errorStyle.Render("Error: " + m.fido2Error))
+		sb.WriteString("\n\n")
+		sb.WriteString(dimStyle.Render(hint(m.keys.Retry, "Retry") + "  " + hint(m.keys.Back, "Cancel")))
+	}
+
+	sb.WriteString("\n\n")
+	sb.WriteString(m.renderFooter())
+
+	return sb.String()
+}
@@ -0,0 +1,175 @@
+// Watch: a live stream of bottle mount, unmount, lock, and use events, for debugging and automation.
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// watchPollInterval is how often watch re-reads the states regardless
+const watchPollInterval = 2 * time.Second
+
+// watchEvent is one line of `watch --json`
+type watchEvent struct {
+	Time       string `json:"time"` // RFC 3339
+	Bottle     string `json:"bottle"`
+	Path       string `json:"path"`
+	Event      string `json:"event"` // added, removed, unlocked, mounted, unmounted, locked, in-use, released
+	MountPoint string `json:"mount_point,omitempty"`
+}
+
+// watchState is what watch compares between reads
+type watchState struct {
+	state      BottleState
+	mountPoint string
+	inUse      bool
+}
+
+// readWatchStates returns the state of every bottle, by path
+func readWatchStates() map[string]watchState {
+	states := map[string]watchState{}
+	for _, bottle := range listBottles() {
+		state, mountPoint := getBottleState(bottle)
+		states[bottle] = watchState{state: state, mountPoint: mountPoint, inUse: bottleInUse(bottle)}
+	}
+	return states
+}
+
+// watchTransitions names the events that lead from one state to the next
+func watchTransitions(prev, cur watchState) []string {
+	var events []string
+	if prev.state == StateMounted && (cur.state != StateMounted || cur.mountPoint != prev.mountPoint) {
+		events = append(events, "unmounted")
+	}
+	if prev.state == StateLocked && cur.state != StateLocked {
+		events = append(events, "unlocked")
+	}
+	if cur.state == StateMounted && (prev.state != StateMounted || cur.mountPoint != prev.mountPoint) {
+		events = append(events, "mounted")
+	}
+	if prev.state != StateLocked && cur.state == StateLocked {
+		events = append(events, "locked")
+	}
+	switch {
+	case !prev.inUse && cur.inUse:
+		events = append(events, "in-use")
+	case prev.inUse && !cur.inUse:
+		events = append(events, "released")
+	}
+	return events
+}
+
+// udisksMonitor signals each time udisks reports a change, until stop is
+// closed. It returns nil without udisks.
+func udisksMonitor(stop <-chan struct{}) <-chan struct{} {
+	if mockMode || !haveUdisks() {
+		return nil
+	}
+	cmd := exec.Command("udisksctl", "monitor")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil || cmd.Start() != nil {
+		return nil
+	}
+	changed := make(chan struct{}, 1)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	go func() {
+		<-stop
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+	return changed
+}
+
+// cmdWatch prints bottle events as they happen until interrupted
+func cmdWatch(asJSON bool) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigChan)
+
+	dirChanges := watchBottleDirs()
+	udisksChanges := udisksMonitor(stop)
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	source := "polling"
+	if udisksChanges != nil {
+		source = "udisks and polling"
+	}
+	notice("Watching " + bottleDir + " (" + source + "); Ctrl+C to stop")
+
+	enc := json.NewEncoder(os.Stdout)
+	emit := func(bottle, event, mountPoint string) {
+		now := time.Now()
+		if asJSON {
+			_ = enc.Encode(watchEvent{Time: now.Format(time.RFC3339), Bottle: bottleName(bottle), Path: bottle, Event: event, MountPoint: mountPoint})
+			return
+		}
+		line := fmt.Sprintf("%s  %-10s %s", now.Format("2006-01-02 15:04:05"), event, bottleName(bottle))
+		if mountPoint != "" {
+			line += "  " + mountPoint
+		}
+		fmt.Println(line)
+	}
+
+	prev := readWatchStates()
+	for {
+		select {
+		case <-sigChan:
+			return nil
+		case <-dirChanges:
+		case <-udisksChanges:
+		case <-ticker.C:
+		}
+
+		cur := readWatchStates()
+		var bottles []string
+		for bottle := range prev {
+			bottles = append(bottles, bottle)
+		}
+		for bottle := range cur {
+			if _, ok := prev[bottle]; !ok {
+				bottles = append(bottles, bottle)
+			}
+		}
+		sort.Strings(bottles)
+		for _, bottle := range bottles {
+			before, existed := prev[bottle]
+			after, exists := cur[bottle]
+			switch {
+			case !existed:
+				emit(bottle, "added", "")
+				before = watchState{}
+			case !exists:
+				emit(bottle, "removed", "")
+				continue
+			}
+			for _, event := range watchTransitions(before, after) {
+				mountPoint := ""
+				if event == "mounted" {
+					mountPoint = after.mountPoint
+				} else if event == "unmounted" {
+					mountPoint = before.mountPoint
+				}
+				emit(bottle, event, mountPoint)
+			}
+		}
+		prev = cur
+	}
+}
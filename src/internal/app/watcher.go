@@ -0,0 +1,58 @@
+// Filesystem watching: refreshes the bottle list when bottles or device-mapper nodes change.
+package app
+
+import (
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce coalesces bursts of events (e.g. udisks creating several
+// device nodes during unlock) into a single refresh
+const watchDebounce = 300 * time.Millisecond
+
+// devMapperDir gains/loses entries when bottles are unlocked/locked
+const devMapperDir = "/dev/mapper"
+
+// watchBottleDirs watches the bottle directory and /dev/mapper and signals on
+// the returned channel after changes settle. Returns nil if watching is
+// unavailable (e.g. inotify limits reached); the TUI then simply doesn't
+// auto-refresh.
+func watchBottleDirs() <-chan struct{} {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil
+	}
+	if err := w.Add(bottleDir); err != nil {
+		w.Close()
+		return nil
+	}
+	// Device-mapper watching is best-effort: not all systems expose it to users
+	_ = w.Add(devMapperDir)
+
+	changed := make(chan struct{}, 1)
+	go func() {
+		var debounce <-chan time.Time
+		for {
+			select {
+			case _, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				debounce = time.After(watchDebounce)
+			case _, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+			case <-debounce:
+				debounce = nil
+				// Non-blocking: one pending notification is enough
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return changed
+}
@@ -0,0 +1,199 @@
+// Workspaces: a configured group of apps in bottles, unlocked and launched with one command.
+package app
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// workspaceEntry is one app of a workspace
+type workspaceEntry struct {
+	bottle string
+	app    string
+}
+
+// workspaceKey returns a workspace's global config key
+func workspaceKey(name string) string {
+	return "WORKSPACE_" + strings.ToUpper(name)
+}
+
+// loadWorkspace returns a workspace's entries
+func loadWorkspace(name string) ([]workspaceEntry, error) {
+	key := workspaceKey(name)
+	items := globalConfig.GetList(key)
+	if len(items) == 0 {
+		return nil, &bottleError{op: "workspace", msg: "no workspace " + name + " - add " + key +
+			"=<bottle>:<app>,<bottle>:<app> to " + globalConfigPath()}
+	}
+	entries := make([]workspaceEntry, len(items))
+	for i, item := range items {
+		bottle, app, ok := strings.Cut(item, ":")
+		bottle, app = strings.TrimSpace(bottle), strings.TrimSpace(app)
+		if !ok || bottle == "" || app == "" {
+			return nil, &bottleError{op: "workspace", msg: key + ": expected <bottle>:<app>, got " + item}
+		}
+		entries[i] = workspaceEntry{bottle: resolveBottlePath(bottle), app: app}
+	}
+	return entries, nil
+}
+
+// cmdWorkspaces lists the configured workspaces
+func cmdWorkspaces() error {
+	keys := globalConfig.KeysWithPrefix("WORKSPACE_")
+	if len(keys) == 0 {
+		fmt.Println("No workspaces configured - add WORKSPACE_<NAME>=<bottle>:<app>,... to " + globalConfigPath())
+		return nil
+	}
+	for _, key := range keys {
+		fmt.Printf("%-16s %s\n", strings.ToLower(strings.TrimPrefix(key, "WORKSPACE_")),
+			strings.Join(globalConfig.GetList(key), ", "))
+	}
+	return nil
+}
+
+// cmdWorkspace unlocks a workspace's bottles and runs its apps in parallel.
+// Without the daemon it waits for all of them, like run; with it, it returns
+// once they are started.
+func cmdWorkspace(name string) error {
+	entries, err := loadWorkspace(name)
+	if err != nil {
+		return err
+	}
+
+	// Unlock each bottle once, in prompt order
+	var bottles []string
+	seen := map[string]bool{}
+	kinds := map[string]int{}
+	for _, e := range entries {
+		if !seen[e.bottle] {
+			seen[e.bottle] = true
+			bottles = append(bottles, e.bottle)
+			kinds[e.bottle] = unlockKind(e.bottle, loadPermissions(getConfigPath(e.bottle)))
+		}
+	}
+	sort.SliceStable(bottles, func(i, j int) bool { return kinds[bottles[i]] < kinds[bottles[j]] })
+
+	holds := map[string]bottleHold{}
+	failed := map[string]error{}
+	for i, bottle := range bottles {
+		if kinds[bottle] != unlockOpen {
+			notice(fmt.Sprintf("[%d/%d] Unlocking %s", i+1, len(bottles), bottleName(bottle)))
+		}
+		hold, err := holdBottle(bottle, "workspace", true)
+		if err != nil {
+			failed[bottle] = err
+			continue
+		}
+		holds[bottle] = hold
+	}
+	releaseHolds := func() {
+		for _, hold := range holds {
+			hold.release()
+		}
+	}
+
+	results := make([]batchResult, len(entries))
+	for i, e := range entries {
+		results[i] = batchResult{bottle: e.bottle, err: failed[e.bottle]}
+	}
+
+	if client := dialDaemon(); client != nil {
+		client.Close()
+		dir, _ := os.Getwd()
+		for i, e := range entries {
+			if results[i].err != nil {
+				continue
+			}
+			var session SessionInfo
+			args := LaunchArgs{Bottle: absBottlePath(e.bottle), App: e.app, Join: true, Timeout: -1, Env: os.Environ(), Dir: dir}
+			if _, err := daemonCall("Launch", args, &session); err != nil {
+				results[i].err = err
+				continue
+			}
+			results[i].status = fmt.Sprintf("%s started through the daemon (pid %d)", e.app, session.PID)
+		}
+		releaseHolds()
+		return printBatchSummary(results)
+	}
+
+	// Start the apps in parallel; they join the bottles held above
+	sessions := make([]*runSession, len(entries))
+	var wg sync.WaitGroup
+	for i, e := range entries {
+		if results[i].err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sessions[i], results[i].err = startRunSession(e.bottle, e.app, runOptions{join: true, timeout: -1}, nil, false)
+		}()
+	}
+	wg.Wait()
+	releaseHolds()
+
+	started := 0
+	for i, s := range sessions {
+		if s != nil {
+			started++
+			notice(fmt.Sprintf("Running %s in %s", entries[i].app, bottleName(entries[i].bottle)))
+		}
+	}
+	if started == 0 {
+		return printBatchSummary(results)
+	}
+
+	// Close every app on a signal, then let the waits below lock the bottles
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigChan)
+	done := make(chan struct{})
+	defer close(done)
+	var closing atomic.Bool
+	go func() {
+		select {
+		case <-sigChan:
+		case <-done:
+			return
+		}
+		closing.Store(true)
+		notice("Closing the workspace's apps...")
+		// A second signal hurries all of them
+		hurry := make(chan os.Signal)
+		for _, s := range sessions {
+			if s != nil {
+				go stopAppGracefully(s.cmd, hurry)
+			}
+		}
+		select {
+		case <-sigChan:
+			close(hurry)
+		case <-done:
+		}
+	}()
+
+	for i, s := range sessions {
+		if s == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.cmd.Wait()
+			s.finish()
+			if !closing.Load() {
+				results[i].err = err
+			}
+			results[i].status = entries[i].app + " ran for " + time.Since(s.started).Round(time.Second).String()
+		}()
+	}
+	wg.Wait()
+	return printBatchSummary(results)
+}
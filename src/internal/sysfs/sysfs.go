@@ -0,0 +1,173 @@
+// Package sysfs discovers loop devices, dm-crypt mappings, and mounts from sysfs and /proc.
+package sysfs
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// The kernel already knows everything about a bottle's state: which loop
+// device is backed by the file (/sys/block/loop*/loop/backing_file), which
+// dm-crypt mapping sits on top of it (/sys/block/dm-*/slaves), and where
+// that is mounted (/proc/self/mountinfo). Reading it directly is faster
+// than running losetup and lsblk and doesn't depend on how they format
+// unusual device names.
+
+// MountEntry is one line of /proc/self/mountinfo
+type MountEntry struct {
+	Dev        string // major:minor of the mounted device
+	MountPoint string
+	FSType     string
+	Source     string
+}
+
+// Mounts returns the mounts visible to this process
+func Mounts() []MountEntry {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var mounts []MountEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Format: <id> <parent> <maj:min> <root> <mount point> <options> [optional...] - <fstype> <source> <super options>
+		fields := strings.Fields(scanner.Text())
+		sep := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep < 0 || sep+2 >= len(fields) {
+			continue
+		}
+		mounts = append(mounts, MountEntry{
+			Dev:        fields[2],
+			MountPoint: unescapeMountField(fields[4]),
+			FSType:     fields[sep+1],
+			Source:     unescapeMountField(fields[sep+2]),
+		})
+	}
+	return mounts
+}
+
+// unescapeMountField decodes the octal escapes (\040 for space etc.) the
+// kernel uses in mount tables
+func unescapeMountField(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				sb.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// BlockDevName returns the kernel name of a device node (e.g. /dev/mapper/x
+// -> dm-3), or "" if it is not a block device
+func BlockDevName(dev string) string {
+	resolved, err := filepath.EvalSymlinks(dev)
+	if err != nil {
+		return ""
+	}
+	name := filepath.Base(resolved)
+	if _, err := os.Stat(filepath.Join("/sys/class/block", name)); err != nil {
+		return ""
+	}
+	return name
+}
+
+// deviceNumber returns a device node's major:minor as written in mountinfo
+func deviceNumber(dev string) string {
+	fi, err := os.Stat(dev)
+	if err != nil {
+		return ""
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || fi.Mode()&os.ModeDevice == 0 {
+		return ""
+	}
+	rdev := uint64(st.Rdev)
+	major := (rdev>>8)&0xfff | (rdev>>32)&^0xfff
+	minor := rdev&0xff | (rdev>>12)&^0xff
+	return strconv.FormatUint(major, 10) + ":" + strconv.FormatUint(minor, 10)
+}
+
+// ReadAttr returns the trimmed contents of a sysfs attribute, or ""
+func ReadAttr(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// LoopForFile finds the loop device backed by a file, or ""
+func LoopForFile(path string) string {
+	realPath, err := filepath.Abs(path)
+	if err != nil {
+		realPath = path
+	}
+	if resolved, err := filepath.EvalSymlinks(realPath); err == nil {
+		realPath = resolved
+	}
+
+	loops, _ := filepath.Glob(filepath.Join("/sys/block", "loop*", "loop", "backing_file"))
+	for _, backingFile := range loops {
+		// A file deleted while attached reads "<path> (deleted)" and never matches
+		if ReadAttr(backingFile) == realPath {
+			return "/dev/" + filepath.Base(filepath.Dir(filepath.Dir(backingFile)))
+		}
+	}
+	return ""
+}
+
+// CryptHolder finds the dm-crypt device on top of a loop (or block)
+// device, as /dev/mapper/<name>
+func CryptHolder(dev string) string {
+	name := BlockDevName(dev)
+	if name == "" {
+		return ""
+	}
+	holders, _ := filepath.Glob(filepath.Join("/sys/block", "dm-*", "slaves", name))
+	for _, slave := range holders {
+		dm := filepath.Dir(filepath.Dir(slave))
+		// dm-crypt mappings have UUIDs starting with CRYPT- (e.g. CRYPT-LUKS2-...)
+		if !strings.HasPrefix(ReadAttr(filepath.Join(dm, "dm", "uuid")), "CRYPT-") {
+			continue
+		}
+		if mapper := ReadAttr(filepath.Join(dm, "dm", "name")); mapper != "" {
+			return "/dev/mapper/" + mapper
+		}
+	}
+	return ""
+}
+
+// MountPoint finds the mount point for a device
+func MountPoint(device string) string {
+	devNum := deviceNumber(device)
+	if devNum == "" {
+		return ""
+	}
+	for _, m := range Mounts() {
+		if m.Dev == devNum {
+			return m.MountPoint
+		}
+	}
+	return ""
+}
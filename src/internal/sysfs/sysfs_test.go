@@ -0,0 +1,29 @@
+// Tests for reading kernel tables: mount table escapes.
+package sysfs
+
+import "testing"
+
+func TestUnescapeMountField(t *testing.T) {
+	tests := []struct {
+		field string
+		want  string
+	}{
+		{"/run/media/me/work", "/run/media/me/work"},
+		{`/run/media/me/My\040Work\040Stuff`, "/run/media/me/My Work Stuff"},
+		{`/mnt/tab\011here`, "/mnt/tab\there"},
+		{`/mnt/new\012line`, "/mnt/new\nline"},
+		{`/mnt/back\134slash`, `/mnt/back\slash`},
+		// UTF-8 is not escaped
+		{"/run/media/me/Café", "/run/media/me/Café"},
+		{`/run/media/me/Caf\303\251`, "/run/media/me/Café"},
+		// Not escapes: too short, not octal, out of range
+		{`/mnt/end\04`, `/mnt/end\04`},
+		{`/mnt/x\09y`, `/mnt/x\09y`},
+		{`/mnt/x\777y`, `/mnt/x\777y`},
+	}
+	for _, tt := range tests {
+		if got := unescapeMountField(tt.field); got != tt.want {
+			t.Errorf("unescapeMountField(%q) = %q, want %q", tt.field, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Package wait waits for process exits through pidfds and device releases through kernel uevents.
+package wait
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Cleanup waits on other things a lot: an app exiting after SIGTERM, the
+// processes keeping a bottle busy, the kernel letting go of a dm device
+// after its filesystem was unmounted. Sleeping a fixed time and checking
+// again is slow when the thing happens at once and wrong when it takes
+// longer. A pidfd becomes readable the moment its process exits, and the
+// kernel announces every device change on a netlink socket (udev reacts to
+// the same events), so those are waited on instead, with a deadline.
+
+// exitPollInterval is how often a process is checked where the kernel has
+// no pidfds (before Linux 5.3)
+const exitPollInterval = 100 * time.Millisecond
+
+// ForExit returns a channel that is closed when process pid exits, and a
+// func that stops watching it
+func ForExit(pid int) (exited <-chan struct{}, stop func()) {
+	done := make(chan struct{})
+	pidfd, err := unix.PidfdOpen(pid, 0)
+	if errors.Is(err, unix.ESRCH) {
+		close(done)
+		return done, func() {}
+	}
+	var wake [2]int
+	if err == nil {
+		if err = unix.Pipe2(wake[:], unix.O_CLOEXEC); err != nil {
+			unix.Close(pidfd)
+		}
+	}
+	if err != nil {
+		return pollExit(pid, done)
+	}
+
+	go func() {
+		defer unix.Close(pidfd)
+		defer unix.Close(wake[0])
+		fds := []unix.PollFd{{Fd: int32(pidfd), Events: unix.POLLIN}, {Fd: int32(wake[0]), Events: unix.POLLIN}}
+		for {
+			_, err := unix.Poll(fds, -1)
+			if err == unix.EINTR {
+				continue
+			}
+			if err == nil && fds[0].Revents != 0 {
+				close(done)
+			}
+			return
+		}
+	}()
+	var once sync.Once
+	return done, func() {
+		once.Do(func() {
+			_, _ = unix.Write(wake[1], []byte{0})
+			unix.Close(wake[1])
+		})
+	}
+}
+
+// pollExit is ForExit without pidfds. An exited process that its parent
+// hasn't waited for yet still counts as running.
+func pollExit(pid int, done chan struct{}) (<-chan struct{}, func()) {
+	quit := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(exitPollInterval)
+		defer ticker.Stop()
+		for syscall.Kill(pid, 0) == nil {
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+			}
+		}
+		close(done)
+	}()
+	var once sync.Once
+	return done, func() { once.Do(func() { close(quit) }) }
+}
+
+// ForExits waits up to timeout for all of pids to exit, and reports
+// whether they did
+func ForExits(pids []int, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for _, pid := range pids {
+		exited, stop := ForExit(pid)
+		select {
+		case <-exited:
+			stop()
+		case <-timer.C:
+			stop()
+			return false
+		}
+	}
+	return true
+}
+
+// DeviceEvents receives the kernel's device events
+type DeviceEvents struct {
+	fd int
+}
+
+// NewDeviceEvents starts listening for device events. Only events after
+// this are seen, so it is opened before the step that may need to wait.
+// Where netlink is not allowed (some containers) it returns nil, whose
+// WaitFor just waits.
+func NewDeviceEvents() *DeviceEvents {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return nil
+	}
+	// Group 1: the kernel's own events, which need no privileges
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: 1}); err != nil {
+		unix.Close(fd)
+		return nil
+	}
+	return &DeviceEvents{fd: fd}
+}
+
+// WaitFor waits up to timeout for a change to the block device named name
+// (e.g. dm-3), and reports whether one came
+func (u *DeviceEvents) WaitFor(name string, timeout time.Duration) bool {
+	if u == nil || name == "" {
+		time.Sleep(timeout)
+		return false
+	}
+	deadline := time.Now().Add(timeout)
+	buf := make([]byte, 8192)
+	for {
+		left := time.Until(deadline)
+		if left <= 0 {
+			return false
+		}
+		fds := []unix.PollFd{{Fd: int32(u.fd), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, int(left.Milliseconds())+1)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil || n == 0 {
+			return false
+		}
+		size, _, err := unix.Recvfrom(u.fd, buf, 0)
+		if err != nil {
+			continue
+		}
+		if ueventDevice(buf[:size]) == name {
+			return true
+		}
+	}
+}
+
+// Close stops listening
+func (u *DeviceEvents) Close() {
+	if u != nil {
+		unix.Close(u.fd)
+	}
+}
+
+// ueventDevice returns the name of the device a kernel uevent is about:
+// "change@/devices/virtual/block/dm-0\0ACTION=change\0...\0DEVNAME=dm-0\0..."
+func ueventDevice(msg []byte) string {
+	for _, field := range bytes.Split(msg, []byte{0}) {
+		if name, ok := bytes.CutPrefix(field, []byte("DEVNAME=")); ok {
+			return filepath.Base(string(name))
+		}
+	}
+	return ""
+}